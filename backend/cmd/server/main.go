@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/Sosokker/todolist-backend/internal/api"
+	"github.com/Sosokker/todolist-backend/internal/auth"
 	"github.com/Sosokker/todolist-backend/internal/cache"
 	"github.com/Sosokker/todolist-backend/internal/config"
 	"github.com/Sosokker/todolist-backend/internal/repository"
@@ -28,6 +29,13 @@ import (
 
 func main() {
 	configPath := flag.String("config", ".", "Path to the config directory or file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "  reconcile          Delete stored attachment objects no database row references, then exit")
+		fmt.Fprintln(flag.CommandLine.Output(), "  migrate-storage    Copy attachments to another storage backend and repoint the database, then exit")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	cfg, err := config.LoadConfig(*configPath)
@@ -39,6 +47,19 @@ func main() {
 	logger := setupLogger(cfg.Log)
 	slog.SetDefault(logger)
 
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "reconcile":
+			os.Exit(runReconcileCommand(cfg, logger, args[1:]))
+		case "migrate-storage":
+			os.Exit(runMigrateStorageCommand(cfg, logger, args[1:]))
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n", args[0])
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
 	logger.Info("Starting Todolist Backend Service", "version", "1.2.0")
 	logger.Debug("Configuration loaded", "config", cfg)
 
@@ -58,59 +79,102 @@ func main() {
 	appCache := cache.NewMemoryCache(cfg.Cache, logger)
 
 	repoRegistry := repository.NewRepositoryRegistry(pool, appCache, logger)
+	if cfg.LoginThrottle.Store == "cache" {
+		repoRegistry.LoginAttemptRepo = repository.NewCacheLoginAttemptRepository(appCache)
+	}
 
-	var storageService service.FileStorageService
-	storageService, err = service.NewGCStorageService(cfg.Storage.GCS, logger)
+	storageService, err := service.NewFileStorageService(cfg.Storage, logger)
 	if err != nil {
 		logger.Error("Failed to initialize storage service", "error", err, "type", cfg.Storage.Type)
 		os.Exit(1)
 	}
 
-	authService := service.NewAuthService(repoRegistry.UserRepo, cfg)
+	scanner, err := service.NewAttachmentScanner(cfg.Storage.Scanner, logger)
+	if err != nil {
+		logger.Error("Failed to initialize malware scanner", "error", err, "type", cfg.Storage.Scanner.Type)
+		os.Exit(1)
+	}
+
+	mailer, err := service.NewMailer(cfg.Email, logger)
+	if err != nil {
+		logger.Error("Failed to initialize mailer", "error", err, "type", cfg.Email.Mailer)
+		os.Exit(1)
+	}
+
+	jwtKeys, err := auth.NewJWTKeys(cfg.JWT)
+	if err != nil {
+		logger.Error("Failed to load JWT keys", "error", err)
+		os.Exit(1)
+	}
+
+	mfaService := service.NewMFAService(repoRegistry.UserRepo, repoRegistry.MFARepo, cfg.MFA)
+	authService := service.NewAuthService(repoRegistry.UserRepo, repoRegistry.RefreshRepo, repoRegistry.RevokedRepo, repoRegistry.WebAuthnRepo, repoRegistry.IdentityRepo, repoRegistry.APITokenRepo, repoRegistry.LoginAttemptRepo, mfaService, jwtKeys, cfg)
+	emailService := service.NewEmailVerificationService(repoRegistry.UserRepo, mailer, cfg.Email)
+	passwordResetService := service.NewPasswordResetService(repoRegistry.UserRepo, repoRegistry.ResetRepo, authService, mailer, cfg.Email)
 	userService := service.NewUserService(repoRegistry.UserRepo)
 	tagService := service.NewTagService(repoRegistry.TagRepo)
 	subtaskService := service.NewSubtaskService(repoRegistry.SubtaskRepo)
-	todoService := service.NewTodoService(repoRegistry.TodoRepo, tagService, subtaskService, storageService)
+	todoService := service.NewTodoService(repoRegistry.TodoRepo, repoRegistry.AttachmentRepo, repoRegistry.UserRepo, tagService, subtaskService, storageService, scanner, cfg.Storage)
+	uploadService, err := service.NewResumableUploadService(repoRegistry.UploadRepo, repoRegistry.TodoRepo, todoService, cfg.Storage)
+	if err != nil {
+		logger.Error("Failed to initialize resumable upload service", "error", err)
+		os.Exit(1)
+	}
 
 	services := &service.ServiceRegistry{
-		Auth:    authService,
-		User:    userService,
-		Tag:     tagService,
-		Todo:    todoService,
-		Subtask: subtaskService,
-		Storage: storageService,
+		Auth:          authService,
+		Email:         emailService,
+		PasswordReset: passwordResetService,
+		MFA:           mfaService,
+		User:          userService,
+		Tag:           tagService,
+		Todo:          todoService,
+		Subtask:       subtaskService,
+		Storage:       storageService,
+		Upload:        uploadService,
 	}
 
 	apiHandler := api.NewApiHandler(services, cfg, logger)
 
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	go uploadService.Run(jobsCtx)
+	go authService.Run(jobsCtx)
+	go passwordResetService.Run(jobsCtx)
+
+	if cfg.Storage.Reconcile.Enabled {
+		reconciler := service.NewAttachmentReconciler(storageService, repoRegistry.AttachmentRepo, cfg.Storage.Reconcile)
+		go reconciler.Run(jobsCtx)
+	}
+
+	realIP, err := api.RealIPMiddleware(cfg.Server.TrustedProxies)
+	if err != nil {
+		logger.Error("Invalid server config", "error", err)
+		os.Exit(1)
+	}
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(realIP)
 	r.Use(NewStructuredLogger(logger))
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "https://your-frontend-domain.com"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins: []string{"http://localhost:3000", "https://your-frontend-domain.com"},
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Defer-Length"},
+		ExposedHeaders: []string{"Link", "Location",
+			"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 	r.Use(middleware.Timeout(60 * time.Second))
 
-	r.Route(cfg.Server.BasePath, func(subr chi.Router) {
-		subr.Post("/auth/signup", apiHandler.SignupUserApi)
-		subr.Post("/auth/login", apiHandler.LoginUserApi)
-		subr.Get("/auth/google/login", apiHandler.InitiateGoogleLogin)
-		subr.Get("/auth/google/callback", apiHandler.HandleGoogleCallback)
-
-		subr.Group(func(prot chi.Router) {
-			prot.Use(api.AuthMiddleware(authService, cfg))
-			api.HandlerFromMux(apiHandler, prot)
-		})
-	})
+	apiHandler.RegisterRoutes(r)
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		if err := pool.Ping(r.Context()); err != nil {
@@ -141,6 +205,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logger.Info("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/Sosokker/todolist-backend/internal/service"
+)
+
+// runMigrateStorageCommand copies every attachment file from one storage backend to
+// another and repoints the database at the copies. Both backends come from the
+// storage.local, storage.gcs and storage.s3 sections of the server's config.
+//
+//	todolist-server -config=. migrate-storage -to=s3 [-from=gcs] [-dry-run] [-verify] [-workers=4]
+func runMigrateStorageCommand(cfg *config.Config, logger *slog.Logger, args []string) int {
+	flags := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	from := flags.String("from", cfg.Storage.Type, "Storage type to copy from: local, gcs or s3")
+	to := flags.String("to", "", "Storage type to copy to: local, gcs or s3")
+	dryRun := flags.Bool("dry-run", false, "Report what would be copied without writing anything")
+	verify := flags.Bool("verify", false, "Read every copy back and compare its SHA-256 with the source")
+	workers := flags.Int("workers", 4, "Files copied in parallel")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *to == "" || *to == *from {
+		fmt.Fprintln(os.Stderr, "migrate-storage needs a -to storage type different from -from")
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pool, err := repository.NewConnectionPool(cfg.Database)
+	if err != nil {
+		logger.Error("Failed to connect to database", "error", err)
+		return 1
+	}
+	defer pool.Close()
+
+	sourceCfg, destinationCfg := cfg.Storage, cfg.Storage
+	sourceCfg.Type, destinationCfg.Type = *from, *to
+	source, err := service.NewFileStorageService(sourceCfg, logger)
+	if err != nil {
+		logger.Error("Failed to initialize source storage", "error", err, "type", *from)
+		return 1
+	}
+	destination, err := service.NewFileStorageService(destinationCfg, logger)
+	if err != nil {
+		logger.Error("Failed to initialize destination storage", "error", err, "type", *to)
+		return 1
+	}
+
+	attachmentRepo := repository.NewPgxAttachmentRepository(db.New(pool), pool)
+	migrator := service.NewStorageMigrator(source, destination, attachmentRepo)
+
+	report, err := migrator.Migrate(ctx, service.StorageMigrationOptions{DryRun: *dryRun, Verify: *verify, Workers: *workers})
+	if report.DryRun {
+		fmt.Fprintf(os.Stdout, "dry run: %d files, %d to copy (%d bytes), %d already at %s, %d verified, %d mismatched, %d missing, %d failed\n",
+			report.Files, report.Copied, report.CopiedBytes, report.Present, *to, report.Verified, report.Mismatched, report.Missing, report.Failed)
+	} else {
+		fmt.Fprintf(os.Stdout, "%d files, %d copied (%d bytes), %d already at %s, %d verified, %d mismatched, %d missing, %d failed, %d rows rewritten\n",
+			report.Files, report.Copied, report.CopiedBytes, report.Present, *to, report.Verified, report.Mismatched, report.Missing, report.Failed, report.Rewritten)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "References were not changed; run the command again to resume")
+		return 1
+	}
+	if !report.DryRun {
+		fmt.Fprintf(os.Stdout, "Set storage.type to %q before restarting the server\n", *to)
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/Sosokker/todolist-backend/internal/service"
+)
+
+// runReconcileCommand runs one attachment reconciliation pass and exits.
+// It uses the server's config but doesn't apply migrations.
+//
+//	todolist-server -config=. reconcile [-dry-run] [-grace-period=24h]
+func runReconcileCommand(cfg *config.Config, logger *slog.Logger, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", cfg.Storage.Reconcile.DryRun, "Report orphaned objects without deleting them")
+	gracePeriod := flags.Duration("grace-period", cfg.Storage.Reconcile.GracePeriod, "Skip objects modified more recently than this")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pool, err := repository.NewConnectionPool(cfg.Database)
+	if err != nil {
+		logger.Error("Failed to connect to database", "error", err)
+		return 1
+	}
+	defer pool.Close()
+
+	storageService, err := service.NewFileStorageService(cfg.Storage, logger)
+	if err != nil {
+		logger.Error("Failed to initialize storage service", "error", err, "type", cfg.Storage.Type)
+		return 1
+	}
+
+	attachmentRepo := repository.NewPgxAttachmentRepository(db.New(pool), pool)
+	reconciler := service.NewAttachmentReconciler(storageService, attachmentRepo, cfg.Storage.Reconcile)
+
+	report, err := reconciler.Reconcile(ctx, service.ReconcileOptions{DryRun: *dryRun, GracePeriod: *gracePeriod})
+	if err != nil {
+		return 1
+	}
+
+	if report.DryRun {
+		fmt.Fprintf(os.Stdout, "dry run: scanned %d objects, %d ignored, %d in grace period, %d orphaned (%d bytes)\n",
+			report.Scanned, report.Ignored, report.Skipped, report.Orphans, report.OrphanBytes)
+		return 0
+	}
+	fmt.Fprintf(os.Stdout, "released %d unreferenced blobs, scanned %d objects, %d ignored, %d in grace period, %d orphaned (%d bytes), %d deleted, %d failed\n",
+		report.ReleasedBlobs, report.Scanned, report.Ignored, report.Skipped, report.Orphans, report.OrphanBytes, report.Deleted, report.Failed)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
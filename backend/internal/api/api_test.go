@@ -0,0 +1,361 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/api"
+	"github.com/Sosokker/todolist-backend/internal/api/models"
+	"github.com/Sosokker/todolist-backend/internal/auth"
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+	"github.com/Sosokker/todolist-backend/internal/service"
+	"github.com/go-chi/chi/v5"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+const basePath = "/api/v1"
+
+// testServer runs the API over httptest with in-memory repositories and storage,
+// wired the same way as cmd/server.
+type testServer struct {
+	t       *testing.T
+	srv     *httptest.Server
+	repos   *repository.RepositoryRegistry
+	storage service.FileStorageService
+	mail    *mailbox
+}
+
+type serverOptions struct {
+	cfg     func(*config.Config)
+	scanner service.AttachmentScanner
+	local   bool                                                        // Store files on disk and serve them from /files/ instead of keeping them in memory
+	storage func(service.FileStorageService) service.FileStorageService // Wraps the storage the server uses
+}
+
+func testConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{BasePath: basePath},
+		JWT: config.JWTConfig{
+			Secret:         "test-secret",
+			Issuer:         "todolist",
+			Audience:       "todolist-api",
+			ExpiryMinutes:  60,
+			CookieName:     "jwt_token",
+			CookiePath:     "/",
+			CookieHttpOnly: true,
+			CookieSameSite: "Lax",
+
+			RefreshExpiry:     time.Hour,
+			RefreshCookieName: "refresh_token",
+			RefreshCookiePath: basePath + "/auth",
+		},
+		Email: config.EmailConfig{
+			TokenSecret:        "test-email-secret",
+			VerificationExpiry: time.Hour,
+			ResendInterval:     time.Minute,
+			VerifyURL:          "http://frontend.test/verify-email",
+
+			PasswordResetExpiry: time.Hour,
+			PasswordResetURL:    "http://frontend.test/reset-password",
+		},
+		OAuth: config.OAuthConfig{StateSecret: "test-oauth-secret"},
+		MFA: config.MFAConfig{
+			Issuer:          "Todolist",
+			ChallengeExpiry: time.Minute,
+			MaxAttempts:     3,
+			LockoutDuration: 50 * time.Millisecond,
+			MaxLockout:      time.Second,
+		},
+		WebAuthn: config.WebAuthnConfig{
+			RPID:             "frontend.test",
+			RPName:           "Todolist",
+			Origins:          []string{"http://frontend.test"},
+			Timeout:          time.Minute,
+			UserVerification: "required",
+		},
+		Storage: config.StorageConfig{
+			MaxUploadSize: 1 << 20,
+			UploadTimeout: time.Minute,
+			Resumable: config.ResumableConfig{
+				Path:       t.TempDir(),
+				Expiry:     time.Hour,
+				MaxPending: 10,
+			},
+		},
+	}
+}
+
+func newTestServer(t *testing.T, opts serverOptions) *testServer {
+	t.Helper()
+
+	cfg := testConfig(t)
+	if opts.cfg != nil {
+		opts.cfg(cfg)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	slog.SetDefault(logger)
+
+	repos := repository.NewMemoryRepositoryRegistry()
+	storage := service.NewMemoryStorageService(logger)
+	if opts.local {
+		var err error
+		storage, err = service.NewLocalStorageService(config.LocalStorageConfig{Path: t.TempDir(), BaseURL: basePath + "/files"}, logger)
+		if err != nil {
+			t.Fatalf("create local storage: %v", err)
+		}
+	}
+	if opts.storage != nil {
+		storage = opts.storage(storage)
+	}
+
+	jwtKeys, err := auth.NewJWTKeys(cfg.JWT)
+	if err != nil {
+		t.Fatalf("load jwt keys: %v", err)
+	}
+	mfaService := service.NewMFAService(repos.UserRepo, repos.MFARepo, cfg.MFA)
+	authService := service.NewAuthService(repos.UserRepo, repos.RefreshRepo, repos.RevokedRepo, repos.WebAuthnRepo, repos.IdentityRepo, repos.APITokenRepo, repos.LoginAttemptRepo, mfaService, jwtKeys, cfg)
+	mail := &mailbox{}
+	emailService := service.NewEmailVerificationService(repos.UserRepo, mail, cfg.Email)
+	passwordResetService := service.NewPasswordResetService(repos.UserRepo, repos.ResetRepo, authService, mail, cfg.Email)
+	userService := service.NewUserService(repos.UserRepo)
+	tagService := service.NewTagService(repos.TagRepo)
+	subtaskService := service.NewSubtaskService(repos.SubtaskRepo)
+	todoService := service.NewTodoService(repos.TodoRepo, repos.AttachmentRepo, repos.UserRepo, tagService, subtaskService, storage, opts.scanner, cfg.Storage)
+	uploadService, err := service.NewResumableUploadService(repos.UploadRepo, repos.TodoRepo, todoService, cfg.Storage)
+	if err != nil {
+		t.Fatalf("create upload service: %v", err)
+	}
+
+	handler := api.NewApiHandler(&service.ServiceRegistry{
+		Auth:          authService,
+		Email:         emailService,
+		PasswordReset: passwordResetService,
+		MFA:           mfaService,
+		User:          userService,
+		Tag:           tagService,
+		Todo:          todoService,
+		Subtask:       subtaskService,
+		Storage:       storage,
+		Upload:        uploadService,
+	}, cfg, logger)
+
+	realIP, err := api.RealIPMiddleware(cfg.Server.TrustedProxies)
+	if err != nil {
+		t.Fatalf("real ip middleware: %v", err)
+	}
+	r := chi.NewRouter()
+	r.Use(realIP)
+	handler.RegisterRoutes(r)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return &testServer{t: t, srv: srv, repos: repos, storage: storage, mail: mail}
+}
+
+// do sends a request and returns the response with its body already read
+func (s *testServer) do(method, path, token string, body io.Reader, header http.Header) (*http.Response, []byte) {
+	s.t.Helper()
+
+	req, err := http.NewRequest(method, s.srv.URL+basePath+path, body)
+	if err != nil {
+		s.t.Fatalf("build %s %s: %v", method, path, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("read %s %s response: %v", method, path, err)
+	}
+	return resp, data
+}
+
+// doJSON sends payload as JSON, checks the status and decodes the response into out if it's non-nil
+func (s *testServer) doJSON(method, path, token string, payload any, wantStatus int, out any) {
+	s.t.Helper()
+
+	var body io.Reader
+	header := http.Header{}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			s.t.Fatalf("encode %s %s body: %v", method, path, err)
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+
+	resp, data := s.do(method, path, token, body, header)
+	if resp.StatusCode != wantStatus {
+		s.t.Fatalf("%s %s: status %d, want %d: %s", method, path, resp.StatusCode, wantStatus, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			s.t.Fatalf("decode %s %s response: %v: %s", method, path, err, data)
+		}
+	}
+}
+
+// signup registers a user and returns a token for them
+func (s *testServer) signup(username string) string {
+	s.t.Helper()
+	return s.signupTokens(username).AccessToken
+}
+
+// signupTokens registers a user and returns the whole login response
+func (s *testServer) signupTokens(username string) models.LoginResponse {
+	s.t.Helper()
+
+	email := username + "@example.com"
+	password := "password123"
+	s.doJSON(http.MethodPost, "/auth/signup", "", models.SignupRequest{
+		Username: username,
+		Email:    openapi_types.Email(email),
+		Password: &password,
+	}, http.StatusCreated, nil)
+
+	return s.login(username)
+}
+
+// login starts another session for a user created by signup
+func (s *testServer) login(username string) models.LoginResponse {
+	s.t.Helper()
+
+	email := username + "@example.com"
+	password := "password123"
+	var login models.LoginResponse
+	s.doJSON(http.MethodPost, "/auth/login", "", models.LoginRequest{Email: openapi_types.Email(email), Password: &password}, http.StatusOK, &login)
+	return login
+}
+
+func (s *testServer) createTodo(token, title string) models.Todo {
+	s.t.Helper()
+
+	var todo models.Todo
+	s.doJSON(http.MethodPost, "/todos", token, models.CreateTodoRequest{Title: title}, http.StatusCreated, &todo)
+	return todo
+}
+
+// uploadInfo uploads content and decodes the created attachment
+func (s *testServer) uploadInfo(token, todoID, fileName string, content []byte) models.AttachmentInfo {
+	s.t.Helper()
+
+	resp, body := s.upload(token, todoID, fileName, content)
+	if resp.StatusCode != http.StatusCreated {
+		s.t.Fatalf("upload %s: status %d: %s", fileName, resp.StatusCode, body)
+	}
+	var info models.AttachmentInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		s.t.Fatalf("decode upload response: %v", err)
+	}
+	return info
+}
+
+// get fetches a URL handed out by the API, which already includes the base path
+func (s *testServer) get(url, token string) (*http.Response, []byte) {
+	s.t.Helper()
+
+	if !strings.HasPrefix(url, basePath+"/") {
+		s.t.Fatalf("URL %q is not below %s", url, basePath)
+	}
+	return s.do(http.MethodGet, strings.TrimPrefix(url, basePath), token, nil, nil)
+}
+
+// upload posts content as the "file" part of a multipart body
+func (s *testServer) upload(token, todoID, fileName string, content []byte) (*http.Response, []byte) {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", fileName)
+	if err != nil {
+		s.t.Fatalf("create form file: %v", err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	header := http.Header{}
+	header.Set("Content-Type", mw.FormDataContentType())
+	return s.do(http.MethodPost, "/todos/"+todoID+"/attachments", token, &body, header)
+}
+
+// storedObjects counts the objects in the in-memory storage
+func (s *testServer) storedObjects() int {
+	s.t.Helper()
+
+	n := 0
+	err := s.storage.List(context.Background(), func(service.StoredObject) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		s.t.Fatalf("list storage: %v", err)
+	}
+	return n
+}
+
+// stubScanner reports every file as infected with signature, or clean when it's empty.
+// onScan, if set, runs once the content has been read.
+type stubScanner struct {
+	signature string
+	onScan    func()
+}
+
+func (s stubScanner) Scan(ctx context.Context, content io.Reader) (*domain.ScanResult, error) {
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return nil, err
+	}
+	if s.onScan != nil {
+		s.onScan()
+	}
+	return &domain.ScanResult{Infected: s.signature != "", Signature: s.signature}, nil
+}
+
+// mailbox is a Mailer that keeps every message in memory
+type mailbox struct {
+	mu   sync.Mutex
+	sent []service.MailMessage
+}
+
+func (m *mailbox) Send(ctx context.Context, msg *service.MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, *msg)
+	return nil
+}
+
+// to returns the messages sent to address, oldest first
+func (m *mailbox) to(address string) []service.MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var msgs []service.MailMessage
+	for _, msg := range m.sent {
+		if msg.To == address {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
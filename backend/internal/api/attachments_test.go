@@ -0,0 +1,784 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/api/models"
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/service"
+	"github.com/google/uuid"
+)
+
+func TestAttachmentUploadAndDelete(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Taxes")
+	content := []byte("receipts for 2024\n")
+
+	resp, body := s.upload(token, todo.Id.String(), "receipts.txt", content)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+	}
+	var info models.AttachmentInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatalf("decode upload response: %v", err)
+	}
+	if info.FileName != "receipts.txt" || info.Size != int64(len(content)) || info.ScanStatus != models.NotScanned {
+		t.Fatalf("got %+v", info)
+	}
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects, want 1", got)
+	}
+
+	var attachments []models.AttachmentInfo
+	s.doJSON(http.MethodGet, "/todos/"+todo.Id.String()+"/attachments", token, nil, http.StatusOK, &attachments)
+	if len(attachments) != 1 || attachments[0].FileId != info.FileId {
+		t.Fatalf("listed %d attachments, want %s", len(attachments), info.FileId)
+	}
+
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.Storage.UsedBytes != int64(len(content)) {
+		t.Fatalf("used %d bytes, want %d", me.Storage.UsedBytes, len(content))
+	}
+
+	resp, _ = s.do(http.MethodGet, "/attachments/"+info.FileId.String()+"/download", token, nil, nil)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("download: status %d, want 302", resp.StatusCode)
+	}
+
+	s.doJSON(http.MethodDelete, "/todos/"+todo.Id.String()+"/attachments/"+info.FileId.String(), token, nil, http.StatusNoContent, nil)
+	if got := s.storedObjects(); got != 0 {
+		t.Fatalf("stored %d objects after delete, want 0", got)
+	}
+}
+
+// countingStorage counts the files written to the storage it wraps
+type countingStorage struct {
+	service.FileStorageService
+	uploads atomic.Int32
+}
+
+func (c *countingStorage) Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename, contentType string, reader io.Reader, size int64) (string, error) {
+	c.uploads.Add(1)
+	return c.FileStorageService.Upload(ctx, userID, todoID, originalFilename, contentType, reader, size)
+}
+
+func TestAttachmentDeduplication(t *testing.T) {
+	counting := &countingStorage{}
+	s := newTestServer(t, serverOptions{storage: func(storage service.FileStorageService) service.FileStorageService {
+		counting.FileStorageService = storage
+		return counting
+	}})
+	token := s.signup("alice")
+	first := s.createTodo(token, "First")
+	second := s.createTodo(token, "Second")
+	content := []byte("the same bytes twice")
+
+	for _, todoID := range []string{first.Id.String(), second.Id.String()} {
+		if resp, body := s.upload(token, todoID, "copy.txt", content); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+		}
+	}
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects for identical uploads, want 1", got)
+	}
+	if got := counting.uploads.Load(); got != 1 {
+		t.Fatalf("wrote %d files for identical uploads, want the second one never stored", got)
+	}
+
+	// The shared file outlives the first todo and goes with the last reference
+	s.doJSON(http.MethodDelete, "/todos/"+first.Id.String(), token, nil, http.StatusNoContent, nil)
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects while still referenced, want 1", got)
+	}
+	s.doJSON(http.MethodDelete, "/todos/"+second.Id.String(), token, nil, http.StatusNoContent, nil)
+	if got := s.storedObjects(); got != 0 {
+		t.Fatalf("stored %d objects after the last reference, want 0", got)
+	}
+}
+
+func TestAttachmentDeduplicationAcrossUsers(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	alice := s.signup("alice")
+	bob := s.signup("bob")
+	content := []byte("the team's shared handbook")
+
+	aliceTodo := s.createTodo(alice, "Onboarding").Id.String()
+	bobTodo := s.createTodo(bob, "Onboarding").Id.String()
+	for _, upload := range []struct{ token, todo string }{{alice, aliceTodo}, {bob, bobTodo}} {
+		if resp, body := s.upload(upload.token, upload.todo, "handbook.txt", content); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+		}
+	}
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects for the same file from two users, want 1", got)
+	}
+
+	// The first uploader leaving doesn't take the file from the second
+	s.doJSON(http.MethodDelete, "/todos/"+aliceTodo, alice, nil, http.StatusNoContent, nil)
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects while bob still references the file, want 1", got)
+	}
+	var attachments []models.AttachmentInfo
+	s.doJSON(http.MethodGet, "/todos/"+bobTodo+"/attachments", bob, nil, http.StatusOK, &attachments)
+	if len(attachments) != 1 {
+		t.Fatalf("bob has %d attachments, want 1", len(attachments))
+	}
+}
+
+func TestAttachmentReconciler(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Taxes")
+	ctx := context.Background()
+
+	if resp, body := s.upload(token, todo.Id.String(), "receipts.txt", []byte("receipts for 2024\n")); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+	}
+	put := func(storageID string) {
+		t.Helper()
+		if err := s.storage.Put(ctx, storageID, "file.txt", "text/plain", strings.NewReader("left behind"), 11); err != nil {
+			t.Fatalf("put %s: %v", storageID, err)
+		}
+	}
+	attachmentKey := func(name string) string {
+		return uuid.NewString() + "/" + uuid.NewString() + "/" + name
+	}
+	orphan := attachmentKey(uuid.NewString() + ".txt")
+	abandoned := attachmentKey(".upload-1234567890") // A local upload that never got renamed into place
+	foreign := "backups/2024-01-01.sql"
+	put(orphan)
+	put(abandoned)
+	put(foreign)
+	time.Sleep(100 * time.Millisecond)
+	recent := attachmentKey(uuid.NewString() + ".txt")
+	put(recent)
+
+	reconciler := service.NewAttachmentReconciler(s.storage, s.repos.AttachmentRepo, config.ReconcileConfig{})
+	opts := service.ReconcileOptions{DryRun: true, GracePeriod: 50 * time.Millisecond}
+	report, err := reconciler.Reconcile(ctx, opts)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Scanned != 5 || report.Ignored != 1 || report.Skipped != 1 || report.Orphans != 2 || report.Deleted != 0 {
+		t.Fatalf("got dry run report %+v, want 5 scanned, 1 ignored, 1 skipped and 2 orphans left in place", report)
+	}
+	if got := s.storedObjects(); got != 5 {
+		t.Fatalf("stored %d objects after a dry run, want 5", got)
+	}
+
+	opts.DryRun = false
+	if report, err = reconciler.Reconcile(ctx, opts); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.Orphans != 2 || report.Deleted != 2 || report.Failed != 0 {
+		t.Fatalf("got report %+v, want both orphans deleted", report)
+	}
+	for _, storageID := range []string{orphan, abandoned} {
+		if _, err := s.storage.Stat(ctx, storageID); !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("stat %s after reconciling: got %v, want it deleted", storageID, err)
+		}
+	}
+	for _, storageID := range []string{foreign, recent} {
+		if _, err := s.storage.Stat(ctx, storageID); err != nil {
+			t.Fatalf("stat %s after reconciling: %v, want it kept", storageID, err)
+		}
+	}
+	// The only other object is the attachment's file
+	if got := s.storedObjects(); got != 3 {
+		t.Fatalf("stored %d objects after reconciling, want the attachment, the recent and the foreign object", got)
+	}
+	var attachments []models.AttachmentInfo
+	s.doJSON(http.MethodGet, "/todos/"+todo.Id.String()+"/attachments", token, nil, http.StatusOK, &attachments)
+	if len(attachments) != 1 {
+		t.Fatalf("listed %d attachments, want 1", len(attachments))
+	}
+	resp, _ := s.do(http.MethodGet, "/attachments/"+attachments[0].FileId.String()+"/download", token, nil, nil)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("download after reconciling: status %d, want 302", resp.StatusCode)
+	}
+}
+
+func TestQuotaChargesIdenticalContentOnce(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.Storage.UserQuota = 100
+	}})
+	token := s.signup("alice")
+	content := bytes.Repeat([]byte("q"), 100)
+
+	for _, title := range []string{"First", "Second"} {
+		todo := s.createTodo(token, title).Id.String()
+		if resp, body := s.upload(token, todo, "report.pdf", content); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("upload to %s: status %d: %s", title, resp.StatusCode, body)
+		}
+	}
+
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.Storage.UsedBytes != int64(len(content)) {
+		t.Fatalf("used %d bytes, want the shared file counted once (%d)", me.Storage.UsedBytes, len(content))
+	}
+}
+
+func TestAttachmentUploadLimits(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.Storage.MaxUploadSize = 100
+		cfg.Storage.UserQuota = 150
+	}})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Photos").Id.String()
+
+	if resp, _ := s.upload(token, todo, "big.txt", bytes.Repeat([]byte("a"), 101)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: status %d, want 413", resp.StatusCode)
+	}
+	if resp, body := s.upload(token, todo, "one.txt", bytes.Repeat([]byte("b"), 100)); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload within limits: status %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := s.upload(token, todo, "two.txt", bytes.Repeat([]byte("c"), 60)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload past quota: status %d, want 413", resp.StatusCode)
+	}
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects, want only the accepted upload", got)
+	}
+}
+
+func TestAttachmentUploadRejectsInfectedFiles(t *testing.T) {
+	s := newTestServer(t, serverOptions{scanner: stubScanner{signature: "Eicar-Test-Signature"}})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Downloads").Id.String()
+
+	resp, body := s.upload(token, todo, "eicar.txt", []byte("not really a virus"))
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("infected upload: status %d, want 422: %s", resp.StatusCode, body)
+	}
+	if got := s.storedObjects(); got != 0 {
+		t.Fatalf("stored %d objects after rejecting the upload, want 0", got)
+	}
+}
+
+func TestAttachmentScannedBeforeStorage(t *testing.T) {
+	var s *testServer
+	storedDuringScan := -1
+	s = newTestServer(t, serverOptions{scanner: stubScanner{onScan: func() { storedDuringScan = s.storedObjects() }}})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Downloads").Id.String()
+
+	if resp, body := s.upload(token, todo, "notes.txt", []byte("harmless")); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+	}
+	if storedDuringScan != 0 {
+		t.Fatalf("stored %d objects while scanning, want the file held back until the verdict", storedDuringScan)
+	}
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects after a clean scan, want 1", got)
+	}
+}
+
+func TestAttachmentUploadRecordsCleanScan(t *testing.T) {
+	s := newTestServer(t, serverOptions{scanner: stubScanner{}})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Downloads").Id.String()
+
+	resp, body := s.upload(token, todo, "notes.txt", []byte("harmless"))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+	}
+	var info models.AttachmentInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatalf("decode upload response: %v", err)
+	}
+	if info.ScanStatus != models.Clean {
+		t.Fatalf("got scan status %q, want clean", info.ScanStatus)
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Video").Id.String()
+	content := []byte("first half|second half")
+	uploads := "/todos/" + todo + "/attachments/uploads"
+
+	header := http.Header{}
+	header.Set("Tus-Resumable", "1.0.0")
+	header.Set("Upload-Length", strconv.Itoa(len(content)))
+	header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("clip.txt")))
+	resp, body := s.do(http.MethodPost, uploads+"/", token, nil, header)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create upload: status %d: %s", resp.StatusCode, body)
+	}
+	location := resp.Header.Get("Location")
+	uploadPath := uploads + "/" + location[len(location)-36:]
+
+	patch := func(offset int, chunk []byte) *http.Response {
+		header := http.Header{}
+		header.Set("Tus-Resumable", "1.0.0")
+		header.Set("Content-Type", "application/offset+octet-stream")
+		header.Set("Upload-Offset", strconv.Itoa(offset))
+		resp, body := s.do(http.MethodPatch, uploadPath, token, bytes.NewReader(chunk), header)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("patch at %d: status %d: %s", offset, resp.StatusCode, body)
+		}
+		return resp
+	}
+
+	half := 10
+	if got := patch(0, content[:half]).Header.Get("Upload-Offset"); got != strconv.Itoa(half) {
+		t.Fatalf("got offset %s after first chunk, want %d", got, half)
+	}
+
+	header = http.Header{}
+	header.Set("Tus-Resumable", "1.0.0")
+	if resp, _ := s.do(http.MethodHead, uploadPath, token, nil, header); resp.Header.Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("HEAD reports offset %s, want %d", resp.Header.Get("Upload-Offset"), half)
+	}
+
+	patch(half, content[half:])
+
+	var attachments []models.AttachmentInfo
+	s.doJSON(http.MethodGet, "/todos/"+todo+"/attachments", token, nil, http.StatusOK, &attachments)
+	if len(attachments) != 1 || attachments[0].FileName != "clip.txt" || attachments[0].Size != int64(len(content)) {
+		t.Fatalf("got attachments %+v, want clip.txt", attachments)
+	}
+}
+
+func TestResumableUploadPendingLimits(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.Storage.UserQuota = 100
+		cfg.Storage.Resumable.MaxPending = 2
+	}})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Videos").Id.String()
+	uploads := "/todos/" + todo + "/attachments/uploads"
+
+	create := func(token, todo string, length, wantStatus int) string {
+		t.Helper()
+		header := http.Header{}
+		header.Set("Tus-Resumable", "1.0.0")
+		header.Set("Upload-Length", strconv.Itoa(length))
+		header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("clip.txt")))
+		resp, body := s.do(http.MethodPost, "/todos/"+todo+"/attachments/uploads/", token, nil, header)
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("create %d byte upload: status %d, want %d: %s", length, resp.StatusCode, wantStatus, body)
+		}
+		return resp.Header.Get("Location")
+	}
+
+	first := create(token, todo, 60, http.StatusCreated)
+	// Declared lengths count against the quota before any bytes arrive
+	create(token, todo, 50, http.StatusRequestEntityTooLarge)
+	create(token, todo, 40, http.StatusCreated)
+	create(token, todo, 1, http.StatusTooManyRequests)
+
+	header := http.Header{}
+	header.Set("Tus-Resumable", "1.0.0")
+	if resp, body := s.do(http.MethodDelete, uploads+"/"+first[len(first)-36:], token, nil, header); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("terminate upload: status %d: %s", resp.StatusCode, body)
+	}
+	create(token, todo, 60, http.StatusCreated)
+
+	// Stored attachments leave that much less room for new uploads
+	bob := s.signup("bob")
+	bobTodo := s.createTodo(bob, "Stored").Id.String()
+	if resp, body := s.upload(bob, bobTodo, "big.txt", bytes.Repeat([]byte("b"), 90)); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", resp.StatusCode, body)
+	}
+	create(bob, bobTodo, 20, http.StatusRequestEntityTooLarge)
+	create(bob, bobTodo, 10, http.StatusCreated)
+}
+
+func TestAttachmentsAreIsolatedPerUser(t *testing.T) {
+	s := newTestServer(t, serverOptions{local: true})
+	alice := s.signup("alice")
+	bob := s.signup("bob")
+
+	todo := s.createTodo(alice, "Private").Id.String()
+	info := s.uploadInfo(alice, todo, "diary.txt", []byte("dear diary"))
+	attachment := info.FileId.String()
+
+	s.doJSON(http.MethodGet, "/todos/"+todo, bob, nil, http.StatusNotFound, nil)
+	s.doJSON(http.MethodGet, "/todos/"+todo+"/attachments", bob, nil, http.StatusNotFound, nil)
+	if resp, _ := s.do(http.MethodGet, "/attachments/"+attachment+"/download", bob, nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("bob downloading alice's attachment: status %d, want 404", resp.StatusCode)
+	}
+	if resp, _ := s.get(info.FileUrl, bob); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("bob fetching alice's file: status %d, want 404", resp.StatusCode)
+	}
+	s.doJSON(http.MethodDelete, "/todos/"+todo+"/attachments/"+attachment, bob, nil, http.StatusNotFound, nil)
+	s.doJSON(http.MethodDelete, "/todos/"+todo, bob, nil, http.StatusNotFound, nil)
+
+	// Bob's own todo doesn't let him reach alice's attachment either
+	bobTodo := s.createTodo(bob, "Mine").Id.String()
+	s.doJSON(http.MethodDelete, "/todos/"+bobTodo+"/attachments/"+attachment, bob, nil, http.StatusNotFound, nil)
+
+	if got := s.storedObjects(); got != 1 {
+		t.Fatalf("stored %d objects, want alice's file untouched", got)
+	}
+	resp, body := s.get(info.FileUrl, alice)
+	if resp.StatusCode != http.StatusOK || string(body) != "dear diary" {
+		t.Fatalf("alice fetching her file: status %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestLocalDownloadHeaders(t *testing.T) {
+	s := newTestServer(t, serverOptions{local: true})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Notes").Id.String()
+	content := []byte("same text in two files")
+
+	// Both attachments share one stored file, and each keeps its own name
+	first := s.uploadInfo(token, todo, "first.txt", content)
+	second := s.uploadInfo(token, todo, "second.txt", content)
+	for _, info := range []models.AttachmentInfo{first, second} {
+		resp, body := s.get(info.FileUrl, token)
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+			t.Fatalf("fetch %s: status %d: %s", info.FileName, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("Content-Type"); got != info.ContentType {
+			t.Fatalf("%s served as %q, want %q", info.FileName, got, info.ContentType)
+		}
+		if got, want := resp.Header.Get("Content-Disposition"), service.ContentDisposition(info.ContentType, info.FileName); got != want {
+			t.Fatalf("got Content-Disposition %q, want %q", got, want)
+		}
+		if resp.Header.Get("X-Content-Type-Options") != "nosniff" || resp.Header.Get("Content-Security-Policy") != "sandbox" {
+			t.Fatalf("%s served without nosniff and sandbox headers: %v", info.FileName, resp.Header)
+		}
+	}
+}
+
+// twoToneImage is a w×h image whose left half is red and right half is blue
+func twoToneImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// jpegWithExif encodes img as a JPEG with an APP1 segment holding "Exif\0\0" and tiff
+func jpegWithExif(t *testing.T, img image.Image, tiff []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(2+len(segment)))
+	data := append([]byte{}, buf.Bytes()[:2]...) // SOI
+	data = append(append(data, app1...), segment...)
+	return append(data, buf.Bytes()[2:]...)
+}
+
+// exifTIFF is a big-endian TIFF structure whose IFD0 sits at ifdOffset and holds one
+// entry for the orientation tag, declaring count entries in all
+func exifTIFF(ifdOffset uint32, count, valueType, orientation uint16) []byte {
+	tiff := binary.BigEndian.AppendUint16([]byte("MM"), 42)
+	tiff = binary.BigEndian.AppendUint32(tiff, ifdOffset)
+	tiff = binary.BigEndian.AppendUint16(tiff, count)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, valueType)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)                     // Value padding
+	return binary.BigEndian.AppendUint32(tiff, 0) // No next IFD
+}
+
+// fetchThumbnail downloads a thumbnail URL and decodes it
+func (s *testServer) fetchThumbnail(url *string, token string) (image.Image, string) {
+	s.t.Helper()
+
+	if url == nil {
+		s.t.Fatal("attachment has no thumbnail URL")
+	}
+	resp, body := s.get(*url, token)
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("fetch thumbnail: status %d: %s", resp.StatusCode, body)
+	}
+	img, format, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		s.t.Fatalf("decode thumbnail: %v", err)
+	}
+	return img, format
+}
+
+func TestAttachmentThumbnails(t *testing.T) {
+	s := newTestServer(t, serverOptions{local: true})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Photos").Id.String()
+
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, twoToneImage(300, 200)); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	info := s.uploadInfo(token, todo, "photo.png", photo.Bytes())
+
+	// Opaque images get JPEG thumbnails scaled to fit, keeping the aspect ratio
+	for _, tt := range []struct {
+		name string
+		url  *string
+		want image.Point
+	}{
+		{"small", info.ThumbnailSmallUrl, image.Pt(64, 42)},
+		{"large", info.ThumbnailLargeUrl, image.Pt(256, 170)},
+	} {
+		img, format := s.fetchThumbnail(tt.url, token)
+		if format != "jpeg" || img.Bounds().Size() != tt.want {
+			t.Fatalf("%s thumbnail is a %s of %v, want a jpeg of %v", tt.name, format, img.Bounds().Size(), tt.want)
+		}
+	}
+
+	// Transparency survives as PNG
+	var clear bytes.Buffer
+	if err := png.Encode(&clear, image.NewNRGBA(image.Rect(0, 0, 40, 80))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	info = s.uploadInfo(token, todo, "icon.png", clear.Bytes())
+	if img, format := s.fetchThumbnail(info.ThumbnailSmallUrl, token); format != "png" || img.Bounds().Size() != image.Pt(32, 64) {
+		t.Fatalf("small thumbnail is a %s of %v, want a png of 32x64", format, img.Bounds().Size())
+	}
+	if img, _ := s.fetchThumbnail(info.ThumbnailLargeUrl, token); img.Bounds().Size() != image.Pt(40, 80) {
+		t.Fatalf("large thumbnail is %v, want the image's own 40x80", img.Bounds().Size())
+	}
+
+	info = s.uploadInfo(token, todo, "notes.txt", []byte("not an image"))
+	if info.ThumbnailSmallUrl != nil || info.ThumbnailLargeUrl != nil {
+		t.Fatalf("text attachment got thumbnails %v and %v", info.ThumbnailSmallUrl, info.ThumbnailLargeUrl)
+	}
+}
+
+func TestAttachmentThumbnailFollowsExifOrientation(t *testing.T) {
+	s := newTestServer(t, serverOptions{local: true})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Photos").Id.String()
+
+	// A phone held upright stores the pixels sideways and says to turn them 90° clockwise
+	photo := jpegWithExif(t, twoToneImage(300, 200), exifTIFF(8, 1, 3, 6))
+	info := s.uploadInfo(token, todo, "portrait.jpg", photo)
+
+	img, _ := s.fetchThumbnail(info.ThumbnailLargeUrl, token)
+	if img.Bounds().Size() != image.Pt(170, 256) {
+		t.Fatalf("thumbnail is %v, want it turned upright to 170x256", img.Bounds().Size())
+	}
+	// The stored left edge, red, ends up on top
+	isRed := func(c color.Color) bool {
+		r, g, b, _ := c.RGBA()
+		return r > 0xC000 && g < 0x4000 && b < 0x4000
+	}
+	isBlue := func(c color.Color) bool {
+		r, g, b, _ := c.RGBA()
+		return b > 0xC000 && r < 0x4000 && g < 0x4000
+	}
+	if top, bottom := img.At(85, 20), img.At(85, 236); !isRed(top) || !isBlue(bottom) {
+		t.Fatalf("got %v on top and %v at the bottom, want red over blue", top, bottom)
+	}
+	if small, _ := s.fetchThumbnail(info.ThumbnailSmallUrl, token); small.Bounds().Size() != image.Pt(42, 64) {
+		t.Fatalf("small thumbnail is %v, want 42x64", small.Bounds().Size())
+	}
+}
+
+func TestAttachmentMalformedExif(t *testing.T) {
+	s := newTestServer(t, serverOptions{local: true})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Photos").Id.String()
+	img := twoToneImage(300, 200)
+
+	// Each of these still decodes as an image; the broken EXIF is ignored, not trusted
+	for _, tt := range []struct {
+		name string
+		tiff []byte
+	}{
+		{"empty TIFF", nil},
+		{"truncated TIFF header", []byte("MM\x00")},
+		{"unknown byte order", append([]byte("XX"), exifTIFF(8, 1, 3, 6)[2:]...)},
+		{"IFD inside the header", exifTIFF(4, 1, 3, 6)},
+		{"IFD past the end", exifTIFF(0xFFFFFFF0, 1, 3, 6)},
+		{"entry cut off", exifTIFF(8, 0xFFFF, 3, 6)[:16]},
+		{"orientation not a short", exifTIFF(8, 1, 4, 6)},
+		{"orientation out of range", exifTIFF(8, 1, 3, 9)},
+	} {
+		info := s.uploadInfo(token, todo, "photo.jpg", jpegWithExif(t, img, tt.tiff))
+		thumb, _ := s.fetchThumbnail(info.ThumbnailLargeUrl, token)
+		if thumb.Bounds().Size() != image.Pt(256, 170) {
+			t.Fatalf("%s: thumbnail is %v, want the stored 256x170", tt.name, thumb.Bounds().Size())
+		}
+	}
+
+	// These don't decode at all, so they're stored without thumbnails
+	valid := jpegWithExif(t, img, exifTIFF(8, 1, 3, 6))
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"EXIF segment cut off", valid[:20]},
+		{"segment longer than the file", append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}, "Exif\x00\x00MM"...)},
+		{"segment length below its own size", append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}, valid[2:]...)},
+	} {
+		info := s.uploadInfo(token, todo, "broken.jpg", tt.data)
+		if info.ThumbnailSmallUrl != nil || info.ThumbnailLargeUrl != nil {
+			t.Fatalf("%s: got thumbnails for an image that doesn't decode", tt.name)
+		}
+	}
+}
+
+// prefixedStorage lays objects out below a base directory, like GCS or S3 with baseDir set
+type prefixedStorage struct {
+	service.FileStorageService
+	prefix string
+}
+
+func (p prefixedStorage) ObjectName(key string) string {
+	return path.Join(p.prefix, key)
+}
+
+func TestStorageMigration(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Moving").Id.String()
+
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, image.NewNRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	s.uploadInfo(token, todo, "photo.png", photo.Bytes()) // Stored with two thumbnails
+	s.uploadInfo(token, todo, "notes.txt", []byte("packing list"))
+	s.uploadInfo(token, todo, "copy.txt", []byte("packing list")) // Shares the file above
+	files := s.storedObjects()
+	if files != 4 {
+		t.Fatalf("stored %d objects, want the photo, its thumbnails and one text file", files)
+	}
+
+	ctx := context.Background()
+	destination := prefixedStorage{service.NewMemoryStorageService(slog.Default()), "attachments"}
+	migrator := service.NewStorageMigrator(s.storage, destination, s.repos.AttachmentRepo)
+
+	report, err := migrator.Migrate(ctx, service.StorageMigrationOptions{DryRun: true, Workers: 2})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Files != files || report.Copied != files || report.Rewritten != 0 {
+		t.Fatalf("dry run reported %+v, want %d files to copy", report, files)
+	}
+	if err := destination.List(ctx, func(obj service.StoredObject) error {
+		return fmt.Errorf("dry run wrote %s", obj.StorageID)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = migrator.Migrate(ctx, service.StorageMigrationOptions{Verify: true, Workers: 2})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Three attachment rows and the two blobs they share point at the new paths
+	if report.Copied != files || report.Verified != files || report.Rewritten != 5 {
+		t.Fatalf("migration reported %+v", report)
+	}
+
+	stored, err := s.repos.AttachmentRepo.ListStoredFiles(ctx)
+	if err != nil {
+		t.Fatalf("list stored files: %v", err)
+	}
+	for _, file := range stored {
+		oldPath, ok := strings.CutPrefix(file.StoragePath, "attachments/")
+		if !ok {
+			t.Fatalf("%s still points at the old storage", file.StoragePath)
+		}
+		want, err := s.storage.Download(ctx, oldPath)
+		if err != nil {
+			t.Fatalf("read source %s: %v", oldPath, err)
+		}
+		got, err := destination.Download(ctx, file.StoragePath)
+		if err != nil {
+			t.Fatalf("read copy %s: %v", file.StoragePath, err)
+		}
+		wantData, _ := io.ReadAll(want)
+		gotData, _ := io.ReadAll(got)
+		if !bytes.Equal(gotData, wantData) {
+			t.Fatalf("copy of %s differs from the source", oldPath)
+		}
+	}
+
+	// Running it again finds every file already in place
+	report, err = migrator.Migrate(ctx, service.StorageMigrationOptions{})
+	if err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+	if report.Present != files || report.Copied != 0 || report.Rewritten != 0 {
+		t.Fatalf("second migration reported %+v, want everything present", report)
+	}
+}
+
+func TestStorageMigrationKeepsReferencesOnFailure(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Moving").Id.String()
+	s.uploadInfo(token, todo, "a.txt", []byte("first file"))
+	s.uploadInfo(token, todo, "b.txt", []byte("second file"))
+
+	ctx := context.Background()
+	destination := &failingStorage{FileStorageService: service.NewMemoryStorageService(slog.Default()), failures: 1}
+	migrator := service.NewStorageMigrator(s.storage, prefixedStorage{destination, "attachments"}, s.repos.AttachmentRepo)
+
+	report, err := migrator.Migrate(ctx, service.StorageMigrationOptions{Workers: 1})
+	if err == nil || report.Failed != 1 || report.Copied != 1 || report.Rewritten != 0 {
+		t.Fatalf("got %+v, %v; want one failure and no rewritten references", report, err)
+	}
+	stored, err := s.repos.AttachmentRepo.ListStoredFiles(ctx)
+	if err != nil {
+		t.Fatalf("list stored files: %v", err)
+	}
+	for _, file := range stored {
+		if strings.HasPrefix(file.StoragePath, "attachments/") {
+			t.Fatalf("%s was repointed although the migration failed", file.StoragePath)
+		}
+	}
+
+	// The rerun resumes, copying only what failed
+	report, err = migrator.Migrate(ctx, service.StorageMigrationOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if report.Copied != 1 || report.Present != 1 || report.Rewritten != 4 { // Two attachments and their blobs
+		t.Fatalf("resume reported %+v", report)
+	}
+}
+
+// failingStorage fails the first few Puts
+type failingStorage struct {
+	service.FileStorageService
+	failures int
+}
+
+func (f *failingStorage) Put(ctx context.Context, storageID, originalFilename, contentType string, reader io.Reader, size int64) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("destination unavailable")
+	}
+	return f.FileStorageService.Put(ctx, storageID, originalFilename, contentType, reader, size)
+}
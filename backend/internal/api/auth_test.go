@@ -0,0 +1,1414 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/api/models"
+	"github.com/Sosokker/todolist-backend/internal/auth"
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+func TestSignupAndLogin(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+
+	password := "password123"
+	s.doJSON(http.MethodPost, "/auth/signup", "", models.SignupRequest{
+		Username: "alice2",
+		Email:    "alice@example.com",
+		Password: &password,
+	}, http.StatusConflict, nil)
+
+	wrong := "not-the-password"
+	s.doJSON(http.MethodPost, "/auth/login", "", models.LoginRequest{Email: "alice@example.com", Password: &wrong}, http.StatusUnauthorized, nil)
+
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.Username != "alice" || me.Email != "alice@example.com" {
+		t.Fatalf("got user %q <%s>, want alice <alice@example.com>", me.Username, me.Email)
+	}
+	if me.Storage == nil || me.Storage.UsedBytes != 0 {
+		t.Fatalf("got storage %+v, want 0 bytes used", me.Storage)
+	}
+}
+
+func TestSignupValidation(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+
+	short := "123"
+	s.doJSON(http.MethodPost, "/auth/signup", "", models.SignupRequest{
+		Username: "bob",
+		Email:    "bob@example.com",
+		Password: &short,
+	}, http.StatusBadRequest, nil)
+}
+
+// tryLogin posts a password login and returns the response status and Retry-After header
+func (s *testServer) tryLogin(username, password string) (int, string) {
+	s.t.Helper()
+	return s.tryLoginFrom("", username, password)
+}
+
+// tryLoginFrom is tryLogin with an X-Forwarded-For header, unless forwardedFor is empty
+func (s *testServer) tryLoginFrom(forwardedFor, username, password string) (int, string) {
+	s.t.Helper()
+
+	body, _ := json.Marshal(models.LoginRequest{Email: openapi_types.Email(username + "@example.com"), Password: &password})
+	header := http.Header{"Content-Type": {"application/json"}}
+	if forwardedFor != "" {
+		header.Set("X-Forwarded-For", forwardedFor)
+	}
+	resp, _ := s.do(http.MethodPost, "/auth/login", "", bytes.NewReader(body), header)
+	return resp.StatusCode, resp.Header.Get("Retry-After")
+}
+
+func TestLoginBackoffAndLockout(t *testing.T) {
+	// Delays run from when an attempt starts, so this has to be well above a bcrypt check
+	const baseDelay = 250 * time.Millisecond
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.LoginThrottle = config.LoginThrottleConfig{
+			Enabled:          true,
+			AccountThreshold: 3,
+			IPThreshold:      100,
+			BaseDelay:        baseDelay,
+			LockoutDuration:  time.Hour,
+			MaxLockout:       24 * time.Hour,
+			ResetAfter:       24 * time.Hour,
+		}
+	}})
+	s.signup("alice")
+	s.signup("bob")
+
+	// Every failure doubles the wait, and the right password doesn't get through it
+	if status, _ := s.tryLogin("alice", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("first wrong password: got status %d, want 401", status)
+	}
+	if status, retryAfter := s.tryLogin("alice", "password123"); status != http.StatusTooManyRequests || retryAfter != "1" {
+		t.Fatalf("login during backoff: got status %d, Retry-After %q, want 429 and 1", status, retryAfter)
+	}
+	time.Sleep(baseDelay)
+	if status, _ := s.tryLogin("alice", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("second wrong password: got status %d, want 401", status)
+	}
+	time.Sleep(baseDelay)
+	if status, _ := s.tryLogin("alice", "wrong-password"); status != http.StatusTooManyRequests {
+		t.Fatalf("attempt before the doubled delay: got status %d, want 429", status)
+	}
+	time.Sleep(baseDelay)
+
+	// The third failure reaches the threshold and locks the account out
+	if status, _ := s.tryLogin("alice", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("third wrong password: got status %d, want 401", status)
+	}
+	time.Sleep(baseDelay * 8)
+	status, retryAfter := s.tryLogin("alice", "password123")
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("login during lockout: got status %d, want 429", status)
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err != nil || seconds < 3500 || seconds > 3600 {
+		t.Fatalf("got Retry-After %q during lockout, want about an hour", retryAfter)
+	}
+
+	// Other accounts from the same address aren't affected, and a success clears their count
+	if status, _ := s.tryLogin("bob", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("bob wrong password: got status %d, want 401", status)
+	}
+	time.Sleep(baseDelay)
+	s.login("bob")
+	if status, _ := s.tryLogin("bob", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("bob wrong password after login: got status %d, want 401", status)
+	}
+	time.Sleep(baseDelay) // A count that survived the login would make this wait 2*baseDelay
+	s.login("bob")
+}
+
+func TestLoginLockoutPerAddress(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.LoginThrottle = config.LoginThrottleConfig{
+			Enabled:          true,
+			AccountThreshold: 100,
+			IPThreshold:      3,
+			BaseDelay:        time.Nanosecond,
+			LockoutDuration:  time.Hour,
+			MaxLockout:       24 * time.Hour,
+			ResetAfter:       24 * time.Hour,
+		}
+	}})
+	s.signup("alice")
+
+	// Spraying guesses across accounts, existing or not, locks out the address
+	for _, username := range []string{"alice", "nobody", "someone"} {
+		time.Sleep(time.Millisecond)
+		if status, _ := s.tryLogin(username, "wrong-password"); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password for %s: got status %d, want 401", username, status)
+		}
+	}
+	if status, retryAfter := s.tryLogin("alice", "password123"); status != http.StatusTooManyRequests || retryAfter == "" {
+		t.Fatalf("login from a locked out address: got status %d, Retry-After %q, want 429 with Retry-After", status, retryAfter)
+	}
+	// Forwarded headers from a peer that isn't a trusted proxy don't change the address
+	if status, _ := s.tryLoginFrom("203.0.113.7", "alice", "password123"); status != http.StatusTooManyRequests {
+		t.Fatalf("login with a spoofed X-Forwarded-For: got status %d, want 429", status)
+	}
+}
+
+func TestLoginLockoutBehindTrustedProxy(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"127.0.0.1", "::1", "10.0.0.0/8"}
+		cfg.LoginThrottle = config.LoginThrottleConfig{
+			Enabled:          true,
+			AccountThreshold: 100,
+			IPThreshold:      3,
+			BaseDelay:        time.Nanosecond,
+			LockoutDuration:  time.Hour,
+			MaxLockout:       24 * time.Hour,
+			ResetAfter:       24 * time.Hour,
+		}
+	}})
+	s.signup("alice")
+
+	for _, username := range []string{"alice", "nobody", "someone"} {
+		time.Sleep(time.Millisecond)
+		if status, _ := s.tryLoginFrom("203.0.113.7, 10.1.2.3", username, "wrong-password"); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password for %s: got status %d, want 401", username, status)
+		}
+	}
+	// The client is the rightmost address that isn't a proxy, whatever it puts in front of it
+	if status, _ := s.tryLoginFrom("198.51.100.1, 203.0.113.7", "alice", "password123"); status != http.StatusTooManyRequests {
+		t.Fatalf("login from the locked out client: got status %d, want 429", status)
+	}
+	if status, _ := s.tryLoginFrom("203.0.113.8", "alice", "password123"); status != http.StatusOK {
+		t.Fatalf("login from another client behind the proxy: got status %d, want 200", status)
+	}
+}
+
+func TestConcurrentLoginGuesses(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.LoginThrottle = config.LoginThrottleConfig{
+			Enabled:          true,
+			AccountThreshold: 3,
+			IPThreshold:      100,
+			BaseDelay:        time.Hour,
+			LockoutDuration:  time.Hour,
+			MaxLockout:       24 * time.Hour,
+			ResetAfter:       24 * time.Hour,
+		}
+	}})
+	s.signup("alice")
+
+	// Guesses sent at once are each charged before the password is checked, so only one gets an answer
+	const guesses = 10
+	wrong := "wrong-password"
+	body, _ := json.Marshal(models.LoginRequest{Email: "alice@example.com", Password: &wrong})
+	statuses := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(s.srv.URL+basePath+"/auth/login", "application/json", bytes.NewReader(body))
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] != 1 || counts[http.StatusTooManyRequests] != guesses-1 {
+		t.Fatalf("got statuses %v, want one 401 and %d 429", counts, guesses-1)
+	}
+
+	// Refused guesses weren't counted, one failure isn't a lockout yet
+	attempts, err := s.repos.LoginAttemptRepo.Get(context.Background(), "account:alice@example.com")
+	if err != nil || attempts.Failures != 1 {
+		t.Fatalf("got %+v, %v, want 1 failure", attempts, err)
+	}
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+
+	s.doJSON(http.MethodGet, "/todos", "", nil, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodGet, "/todos", "not-a-jwt", nil, http.StatusUnauthorized, nil)
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("carol")
+	s.signup("dave")
+
+	newName := "caroline"
+	var me models.User
+	s.doJSON(http.MethodPatch, "/users/me", token, models.UpdateUserRequest{Username: &newName}, http.StatusOK, &me)
+	if me.Username != newName {
+		t.Fatalf("got username %q, want %q", me.Username, newName)
+	}
+
+	taken := "dave"
+	s.doJSON(http.MethodPatch, "/users/me", token, models.UpdateUserRequest{Username: &taken}, http.StatusConflict, nil)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	login := s.signupTokens("erin")
+	if login.RefreshToken == "" || login.ExpiresIn <= 0 {
+		t.Fatalf("got login response %+v, want a refresh token and expiresIn", login)
+	}
+
+	var refreshed models.LoginResponse
+	s.doJSON(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: &login.RefreshToken}, http.StatusOK, &refreshed)
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatalf("got refresh token %q, want a new one", refreshed.RefreshToken)
+	}
+	s.doJSON(http.MethodGet, "/users/me", refreshed.AccessToken, nil, http.StatusOK, nil)
+
+	// Reusing the rotated token revokes the family, including the token it was rotated into
+	s.doJSON(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: &login.RefreshToken}, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: &refreshed.RefreshToken}, http.StatusUnauthorized, nil)
+
+	unknown := "not-a-refresh-token"
+	s.doJSON(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: &unknown}, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodPost, "/auth/refresh", "", nil, http.StatusUnauthorized, nil)
+}
+
+func TestRefreshTokenCookie(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	login := s.signupTokens("frank")
+
+	header := http.Header{}
+	header.Set("Cookie", "refresh_token="+login.RefreshToken)
+	resp, data := s.do(http.MethodPost, "/auth/refresh", "", nil, header)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("refresh with cookie: status %d: %s", resp.StatusCode, data)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range resp.Cookies() {
+		cookies[c.Name] = c
+	}
+	refresh, access := cookies["refresh_token"], cookies["jwt_token"]
+	if refresh == nil || refresh.Value == "" || refresh.Value == login.RefreshToken || !refresh.HttpOnly {
+		t.Fatalf("got refresh cookie %+v, want a new HttpOnly token", refresh)
+	}
+	if refresh.Path != basePath+"/auth" {
+		t.Fatalf("got refresh cookie path %q, want %q", refresh.Path, basePath+"/auth")
+	}
+	if access == nil || access.Value == "" {
+		t.Fatalf("got access cookie %+v, want a JWT", access)
+	}
+	s.doJSON(http.MethodGet, "/users/me", access.Value, nil, http.StatusOK, nil)
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	login := s.signupTokens("grace")
+
+	s.doJSON(http.MethodPost, "/auth/logout", login.AccessToken, models.RefreshRequest{RefreshToken: &login.RefreshToken}, http.StatusNoContent, nil)
+	s.doJSON(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: &login.RefreshToken}, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodGet, "/users/me", login.AccessToken, nil, http.StatusUnauthorized, nil)
+
+	// Other sessions are untouched
+	other := s.login("grace")
+	s.doJSON(http.MethodGet, "/users/me", other.AccessToken, nil, http.StatusOK, nil)
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	laptop := s.signupTokens("heidi")
+	phone := s.login("heidi")
+	bystander := s.signupTokens("ivan")
+
+	s.doJSON(http.MethodPost, "/auth/logout-all", phone.AccessToken, nil, http.StatusNoContent, nil)
+
+	for _, session := range []models.LoginResponse{laptop, phone} {
+		s.doJSON(http.MethodGet, "/users/me", session.AccessToken, nil, http.StatusUnauthorized, nil)
+		s.doJSON(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: &session.RefreshToken}, http.StatusUnauthorized, nil)
+	}
+	s.doJSON(http.MethodGet, "/users/me", bystander.AccessToken, nil, http.StatusOK, nil)
+
+	fresh := s.login("heidi")
+	s.doJSON(http.MethodGet, "/users/me", fresh.AccessToken, nil, http.StatusOK, nil)
+}
+
+var (
+	verifyLinkPattern = regexp.MustCompile(`http://frontend\.test/verify-email\?\S+`)
+	resetLinkPattern  = regexp.MustCompile(`http://frontend\.test/reset-password\?\S+`)
+)
+
+// verificationToken returns the token from the newest verification email sent to address
+func (s *testServer) verificationToken(address string) string {
+	s.t.Helper()
+	return s.mailedToken(address, verifyLinkPattern)
+}
+
+// mailedToken returns the token from the newest link matching pattern in the mail sent to address.
+// Some mail is sent in the background, so it waits a little for one to arrive.
+func (s *testServer) mailedToken(address string, pattern *regexp.Regexp) string {
+	s.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msgs := s.mail.to(address)
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if link := pattern.FindString(msgs[i].Body); link != "" {
+				u, err := url.Parse(link)
+				if err != nil || u.Query().Get("token") == "" {
+					s.t.Fatalf("no token in link %q", link)
+				}
+				return u.Query().Get("token")
+			}
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("no email with a link matching %s sent to %s", pattern, address)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAsymmetricJWTKeys(t *testing.T) {
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingDER, err := x509.MarshalPKCS8PrivateKey(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retiredKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retiredDER, err := x509.MarshalPKIXPublicKey(&retiredKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.JWT.SigningKey = "current"
+		cfg.JWT.Keys = []config.JWTKeyConfig{
+			{ID: "current", Algorithm: "EdDSA", PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: signingDER}))},
+			{ID: "retired", Algorithm: "RS256", PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: retiredDER}))},
+		}
+	}})
+	token := s.signup("alice")
+
+	// The published keys verify the access token without the secret
+	resp, err := http.Get(s.srv.URL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var jwks struct {
+		Keys []struct {
+			Kty, Kid, Alg, Use, Crv, X, N, E string
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		t.Fatalf("decode jwks: %v", err)
+	}
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "current" || jwks.Keys[1].Kid != "retired" || jwks.Keys[1].Kty != "RSA" {
+		t.Fatalf("got jwks %+v, want the current and retired keys", jwks.Keys)
+	}
+	published, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// What another service does: check the key, issuer, audience and typ
+	verify := func(token string) (*auth.Claims, error) {
+		parsed, err := jwt.ParseWithClaims(token, &auth.Claims{}, func(tok *jwt.Token) (any, error) {
+			if tok.Header["kid"] != jwks.Keys[0].Kid {
+				return nil, fmt.Errorf("got kid %v, want %s", tok.Header["kid"], jwks.Keys[0].Kid)
+			}
+			if tok.Header["typ"] != "at+jwt" {
+				return nil, fmt.Errorf("got typ %v, want at+jwt", tok.Header["typ"])
+			}
+			return ed25519.PublicKey(published), nil
+		}, jwt.WithValidMethods([]string{jwks.Keys[0].Alg}), jwt.WithIssuer("todolist"), jwt.WithAudience("todolist-api"))
+		if err != nil {
+			return nil, err
+		}
+		return parsed.Claims.(*auth.Claims), nil
+	}
+	claims, err := verify(token)
+	if err != nil {
+		t.Fatalf("verify access token with the published key: %v", err)
+	}
+
+	// The backend's other tokens share the keys but can't pass for access tokens
+	s.enableTOTP(token)
+	if _, err := verify(s.mfaChallenge("alice")); err == nil {
+		t.Fatal("an mfa challenge passed as an access token")
+	}
+
+	// Tokens from before the rotation keep working; HS256 with the secret no longer does
+	forge := func(method jwt.SigningMethod, kid string, key any, audience string) string {
+		forged := jwt.NewWithClaims(method, &auth.Claims{
+			UserID:       claims.UserID,
+			TokenVersion: claims.TokenVersion,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        uuid.NewString(),
+				Issuer:    "todolist",
+				Audience:  jwt.ClaimStrings{audience},
+				Subject:   claims.Subject,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+		forged.Header["typ"] = "at+jwt"
+		if kid != "" {
+			forged.Header["kid"] = kid
+		}
+		signed, err := forged.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	s.doJSON(http.MethodGet, "/users/me", forge(jwt.SigningMethodRS256, "retired", retiredKey, "todolist-api"), nil, http.StatusOK, nil)
+	s.doJSON(http.MethodGet, "/users/me", forge(jwt.SigningMethodRS256, "retired", retiredKey, "todolist-api:mfa"), nil, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodGet, "/users/me", forge(jwt.SigningMethodHS256, "", []byte("test-secret"), "todolist-api"), nil, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodGet, "/users/me", forge(jwt.SigningMethodRS256, "current", retiredKey, "todolist-api"), nil, http.StatusUnauthorized, nil)
+}
+
+func TestEmailVerification(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("judy")
+
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.EmailVerified == nil || *me.EmailVerified {
+		t.Fatalf("got emailVerified %v after signup, want false", me.EmailVerified)
+	}
+	verifyToken := s.verificationToken("judy@example.com")
+
+	// Signup just sent one, so a resend is throttled
+	resp, data := s.do(http.MethodPost, "/auth/verify-email/resend", token, nil, nil)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("resend: status %d, Retry-After %q, want 429 with Retry-After: %s", resp.StatusCode, resp.Header.Get("Retry-After"), data)
+	}
+
+	s.doJSON(http.MethodPost, "/auth/verify-email", "", models.VerifyEmailRequest{Token: verifyToken + "x"}, http.StatusBadRequest, nil)
+	s.doJSON(http.MethodPost, "/auth/verify-email", "", models.VerifyEmailRequest{Token: verifyToken}, http.StatusOK, &me)
+	if me.EmailVerified == nil || !*me.EmailVerified {
+		t.Fatalf("got emailVerified %v after verifying, want true", me.EmailVerified)
+	}
+
+	// Renaming the user keeps the address verified
+	newName := "judith"
+	s.doJSON(http.MethodPatch, "/users/me", token, models.UpdateUserRequest{Username: &newName}, http.StatusOK, &me)
+	if me.EmailVerified == nil || !*me.EmailVerified {
+		t.Fatalf("got emailVerified %v after rename, want true", me.EmailVerified)
+	}
+	s.doJSON(http.MethodPost, "/auth/verify-email/resend", token, nil, http.StatusConflict, nil)
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.Email.RequireVerified = true
+	}})
+	token := s.signup("mallory")
+
+	s.doJSON(http.MethodGet, "/todos", token, nil, http.StatusForbidden, nil)
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, nil)
+
+	s.doJSON(http.MethodPost, "/auth/verify-email", "", models.VerifyEmailRequest{Token: s.verificationToken("mallory@example.com")}, http.StatusOK, nil)
+	s.doJSON(http.MethodGet, "/todos", token, nil, http.StatusOK, nil)
+}
+
+func TestPasswordReset(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	s.signup("ivan")
+	before := s.login("ivan")
+
+	// Unknown addresses get the same answer and no mail
+	s.doJSON(http.MethodPost, "/auth/password/forgot", "", models.ForgotPasswordRequest{Email: "nobody@example.com"}, http.StatusAccepted, nil)
+	s.doJSON(http.MethodPost, "/auth/password/forgot", "", models.ForgotPasswordRequest{Email: "ivan@example.com"}, http.StatusAccepted, nil)
+	resetToken := s.mailedToken("ivan@example.com", resetLinkPattern)
+	if msgs := s.mail.to("nobody@example.com"); len(msgs) != 0 {
+		t.Fatalf("got %d emails to an unknown address, want none", len(msgs))
+	}
+
+	s.doJSON(http.MethodPost, "/auth/password/reset", "", models.ResetPasswordRequest{Token: resetToken, Password: "short"}, http.StatusBadRequest, nil)
+	s.doJSON(http.MethodPost, "/auth/password/reset", "", models.ResetPasswordRequest{Token: resetToken + "x", Password: "newpassword"}, http.StatusBadRequest, nil)
+	s.doJSON(http.MethodPost, "/auth/password/reset", "", models.ResetPasswordRequest{Token: resetToken, Password: "newpassword"}, http.StatusNoContent, nil)
+	// Single use
+	s.doJSON(http.MethodPost, "/auth/password/reset", "", models.ResetPasswordRequest{Token: resetToken, Password: "otherpassword"}, http.StatusBadRequest, nil)
+
+	// Sessions from before the reset are gone
+	s.doJSON(http.MethodGet, "/users/me", before.AccessToken, nil, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: &before.RefreshToken}, http.StatusUnauthorized, nil)
+
+	oldPassword, newPassword := "password123", "newpassword"
+	s.doJSON(http.MethodPost, "/auth/login", "", models.LoginRequest{Email: "ivan@example.com", Password: &oldPassword}, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodPost, "/auth/login", "", models.LoginRequest{Email: "ivan@example.com", Password: &newPassword}, http.StatusOK, nil)
+}
+
+// totpCode returns the authenticator code for now plus offset time steps. Each step is
+// accepted once, so a test that needs several codes moves on to the next step.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("totp code: %v", err)
+	}
+	return code
+}
+
+// enableTOTP turns on two-factor authentication for the user and returns the secret and recovery codes
+func (s *testServer) enableTOTP(token string) (string, []string) {
+	s.t.Helper()
+
+	var enrollment models.TotpEnrollment
+	s.doJSON(http.MethodPost, "/auth/mfa/totp", token, nil, http.StatusOK, &enrollment)
+	if !strings.HasPrefix(enrollment.OtpauthUri, "otpauth://totp/Todolist:") || !strings.Contains(enrollment.OtpauthUri, "secret="+enrollment.Secret) {
+		s.t.Fatalf("unexpected provisioning URI %q", enrollment.OtpauthUri)
+	}
+	var recovery models.RecoveryCodes
+	s.doJSON(http.MethodPost, "/auth/mfa/totp/confirm", token, models.MfaCodeRequest{Code: totpCode(s.t, enrollment.Secret, 0)}, http.StatusOK, &recovery)
+	return enrollment.Secret, recovery.Codes
+}
+
+// mfaChallenge logs in a user with two-factor authentication and returns the challenge token
+func (s *testServer) mfaChallenge(username string) string {
+	s.t.Helper()
+
+	password := "password123"
+	var challenge models.MfaChallengeResponse
+	s.doJSON(http.MethodPost, "/auth/login", "", models.LoginRequest{Email: openapi_types.Email(username + "@example.com"), Password: &password}, http.StatusAccepted, &challenge)
+	return challenge.MfaToken
+}
+
+func TestTOTPLogin(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("oscar")
+
+	var status models.MfaStatus
+	s.doJSON(http.MethodGet, "/auth/mfa", token, nil, http.StatusOK, &status)
+	if status.TotpEnabled {
+		t.Fatal("totp enabled before enrolling")
+	}
+
+	// Logins keep working while the enrollment is unconfirmed
+	var enrollment models.TotpEnrollment
+	s.doJSON(http.MethodPost, "/auth/mfa/totp", token, nil, http.StatusOK, &enrollment)
+	s.login("oscar")
+	s.doJSON(http.MethodPost, "/auth/mfa/totp/confirm", token, models.MfaCodeRequest{Code: "000000x"}, http.StatusBadRequest, nil)
+
+	secret, recoveryCodes := s.enableTOTP(token)
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(recoveryCodes))
+	}
+	s.doJSON(http.MethodPost, "/auth/mfa/totp", token, nil, http.StatusConflict, nil)
+
+	challenge := s.mfaChallenge("oscar")
+	s.doJSON(http.MethodGet, "/users/me", challenge, nil, http.StatusUnauthorized, nil)
+	// Codes up to the one that confirmed the app are used up
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: challenge, Code: totpCode(t, secret, -1)}, http.StatusUnauthorized, nil)
+	var login models.LoginResponse
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: challenge, Code: totpCode(t, secret, 1)}, http.StatusOK, &login)
+	s.doJSON(http.MethodGet, "/users/me", login.AccessToken, nil, http.StatusOK, nil)
+	// A challenge logs in once
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: challenge, Code: recoveryCodes[0]}, http.StatusUnauthorized, nil)
+
+	// Recovery codes work once each, with or without the dash
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: s.mfaChallenge("oscar"), Code: strings.ToUpper(strings.ReplaceAll(recoveryCodes[1], "-", ""))}, http.StatusOK, nil)
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: s.mfaChallenge("oscar"), Code: recoveryCodes[1]}, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodGet, "/auth/mfa", token, nil, http.StatusOK, &status)
+	if !status.TotpEnabled || status.RecoveryCodesLeft != 9 {
+		t.Fatalf("got status %+v, want enabled with 9 recovery codes left", status)
+	}
+
+	// Too many wrong codes kill the challenge
+	challenge = s.mfaChallenge("oscar")
+	for range 3 {
+		s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: challenge, Code: "wrong"}, http.StatusUnauthorized, nil)
+	}
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: challenge, Code: recoveryCodes[2]}, http.StatusUnauthorized, nil)
+
+	time.Sleep(60 * time.Millisecond) // They also locked the factor briefly
+	s.doJSON(http.MethodDelete, "/auth/mfa/totp", token, models.MfaCodeRequest{Code: recoveryCodes[2]}, http.StatusNoContent, nil)
+	s.login("oscar")
+}
+
+func TestTOTPLockoutSurvivesNewLogins(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.MFA.LockoutDuration = 500 * time.Millisecond
+	}})
+	token := s.signup("olive")
+	_, recoveryCodes := s.enableTOTP(token)
+
+	guess := func() {
+		t.Helper()
+		challenge := s.mfaChallenge("olive")
+		for range 3 {
+			s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: challenge, Code: "wrong"}, http.StatusUnauthorized, nil)
+		}
+	}
+	locked := func(code string) {
+		t.Helper()
+		body, err := json.Marshal(models.MfaVerifyRequest{MfaToken: s.mfaChallenge("olive"), Code: code})
+		if err != nil {
+			t.Fatalf("encode request: %v", err)
+		}
+		resp, _ := s.do(http.MethodPost, "/auth/mfa/verify", "", bytes.NewReader(body), http.Header{"Content-Type": {"application/json"}})
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+			t.Fatalf("got %d with Retry-After %q, want 429 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	// A fresh login doesn't buy more guesses, and even a good code waits out the lockout
+	guess()
+	locked(recoveryCodes[0])
+	locked("wrong")
+
+	// The next lockout lasts twice as long
+	time.Sleep(600 * time.Millisecond)
+	guess()
+	time.Sleep(600 * time.Millisecond)
+	locked(recoveryCodes[0])
+	time.Sleep(500 * time.Millisecond)
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: s.mfaChallenge("olive"), Code: recoveryCodes[0]}, http.StatusOK, nil)
+
+	// A good code starts the backoff over
+	guess()
+	time.Sleep(600 * time.Millisecond)
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: s.mfaChallenge("olive"), Code: recoveryCodes[1]}, http.StatusOK, nil)
+}
+
+func TestTOTPGuessingFromSessionLogsOut(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("peggy")
+	secret, _ := s.enableTOTP(token)
+
+	var recovery models.RecoveryCodes
+	s.doJSON(http.MethodPost, "/auth/mfa/recovery-codes", token, models.MfaCodeRequest{Code: totpCode(t, secret, 1)}, http.StatusOK, &recovery)
+	if len(recovery.Codes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(recovery.Codes))
+	}
+
+	for range 3 {
+		s.doJSON(http.MethodDelete, "/auth/mfa/totp", token, models.MfaCodeRequest{Code: "12345"}, http.StatusUnauthorized, nil)
+	}
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusUnauthorized, nil)
+}
+
+// passkey is a software authenticator holding one P-256 credential
+type passkey struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	signCount  uint32
+	flags      byte
+	origin     string
+}
+
+func newPasskey(t *testing.T) *passkey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate passkey: %v", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &passkey{t: t, key: key, id: id, flags: 0x01 | 0x04, origin: "http://frontend.test"}
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	}
+}
+
+func cborInt(i int64) []byte {
+	if i < 0 {
+		return cborHead(1, uint64(-1-i))
+	}
+	return cborHead(0, uint64(i))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, uint64(len(s))), s...) }
+
+func b64url(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func (p *passkey) clientData(ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]any{"type": ceremony, "challenge": challenge, "origin": p.origin, "crossOrigin": false})
+	if err != nil {
+		p.t.Fatalf("encode client data: %v", err)
+	}
+	return data
+}
+
+func (p *passkey) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := p.flags
+	if attested {
+		flags |= 0x40
+	}
+	data := binary.BigEndian.AppendUint32(append(rpIDHash[:], flags), p.signCount)
+	if !attested {
+		return data
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(p.id)))
+	data = append(data, p.id...)
+	var x, y [32]byte
+	p.key.X.FillBytes(x[:])
+	p.key.Y.FillBytes(y[:])
+	data = append(data, cborHead(5, 5)...)
+	for _, field := range [][]byte{
+		cborInt(1), cborInt(2), // kty: EC2
+		cborInt(3), cborInt(-7), // alg: ES256
+		cborInt(-1), cborInt(1), // crv: P-256
+		cborInt(-2), cborBytes(x[:]),
+		cborInt(-3), cborBytes(y[:]),
+	} {
+		data = append(data, field...)
+	}
+	return data
+}
+
+// register answers navigator.credentials.create()
+func (p *passkey) register(options models.PublicKeyCredentialCreationOptions) models.RegistrationCredential {
+	p.userHandle, _ = base64.RawURLEncoding.DecodeString(options.User.Id)
+	attestation := append(cborHead(5, 3), cborText("fmt")...)
+	attestation = append(attestation, cborText("none")...)
+	attestation = append(attestation, cborText("attStmt")...)
+	attestation = append(attestation, cborHead(5, 0)...)
+	attestation = append(attestation, cborText("authData")...)
+	attestation = append(attestation, cborBytes(p.authData(options.Rp.Id, true))...)
+	return models.RegistrationCredential{
+		Id:   b64url(p.id),
+		Type: "public-key",
+		Response: models.AuthenticatorAttestationResponse{
+			ClientDataJSON:    b64url(p.clientData("webauthn.create", options.Challenge)),
+			AttestationObject: b64url(attestation),
+		},
+	}
+}
+
+// assert answers navigator.credentials.get()
+func (p *passkey) assert(options models.PublicKeyCredentialRequestOptions) models.AuthenticationCredential {
+	p.signCount++
+	authData := p.authData(options.RpId, false)
+	clientData := p.clientData("webauthn.get", options.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, p.key, digest[:])
+	if err != nil {
+		p.t.Fatalf("sign assertion: %v", err)
+	}
+	userHandle := b64url(p.userHandle)
+	return models.AuthenticationCredential{
+		Id:   b64url(p.id),
+		Type: "public-key",
+		Response: models.AuthenticatorAssertionResponse{
+			ClientDataJSON:    b64url(clientData),
+			AuthenticatorData: b64url(authData),
+			Signature:         b64url(signature),
+			UserHandle:        &userHandle,
+		},
+	}
+}
+
+// registerPasskey adds a new passkey to the user's account
+func (s *testServer) registerPasskey(token, name string) *passkey {
+	s.t.Helper()
+
+	var options models.WebauthnRegistrationOptions
+	s.doJSON(http.MethodPost, "/auth/webauthn/register/begin", token, nil, http.StatusOK, &options)
+	p := newPasskey(s.t)
+	s.doJSON(http.MethodPost, "/auth/webauthn/register/finish", token, models.WebauthnRegistrationRequest{
+		SessionToken: options.SessionToken,
+		Name:         &name,
+		Credential:   p.register(options.PublicKey),
+	}, http.StatusCreated, nil)
+	return p
+}
+
+// passkeyLogin runs a passkey login and checks its status
+func (s *testServer) passkeyLogin(p *passkey, wantStatus int, out any) {
+	s.t.Helper()
+
+	var options models.WebauthnLoginOptions
+	s.doJSON(http.MethodPost, "/auth/webauthn/login/begin", "", nil, http.StatusOK, &options)
+	s.doJSON(http.MethodPost, "/auth/webauthn/login/finish", "", models.WebauthnLoginRequest{
+		SessionToken: options.SessionToken,
+		Credential:   p.assert(options.PublicKey),
+	}, wantStatus, out)
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("victor")
+
+	var options models.WebauthnRegistrationOptions
+	s.doJSON(http.MethodPost, "/auth/webauthn/register/begin", token, nil, http.StatusOK, &options)
+	if options.PublicKey.Rp.Id != "frontend.test" || len(options.PublicKey.ExcludeCredentials) != 0 {
+		t.Fatalf("got rp %+v excluding %d credentials, want frontend.test excluding none", options.PublicKey.Rp, len(options.PublicKey.ExcludeCredentials))
+	}
+	laptop := newPasskey(t)
+	registration := models.WebauthnRegistrationRequest{SessionToken: options.SessionToken, Credential: laptop.register(options.PublicKey)}
+	var cred models.WebauthnCredential
+	s.doJSON(http.MethodPost, "/auth/webauthn/register/finish", token, registration, http.StatusCreated, &cred)
+	if cred.Name != "Passkey" || cred.LastUsedAt != nil {
+		t.Fatalf("got credential %+v, want an unused one named Passkey", cred)
+	}
+	// A registration session works once
+	s.doJSON(http.MethodPost, "/auth/webauthn/register/finish", token, registration, http.StatusUnauthorized, nil)
+
+	s.doJSON(http.MethodPost, "/auth/webauthn/register/begin", token, nil, http.StatusOK, &options)
+	if len(options.PublicKey.ExcludeCredentials) != 1 {
+		t.Fatalf("got %d excluded credentials, want 1", len(options.PublicKey.ExcludeCredentials))
+	}
+	// Another site's page can't finish the ceremony
+	phone := newPasskey(t)
+	phone.origin = "http://evil.test"
+	s.doJSON(http.MethodPost, "/auth/webauthn/register/finish", token, models.WebauthnRegistrationRequest{
+		SessionToken: options.SessionToken,
+		Credential:   phone.register(options.PublicKey),
+	}, http.StatusBadRequest, nil)
+
+	var login models.LoginResponse
+	s.passkeyLogin(laptop, http.StatusOK, &login)
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", login.AccessToken, nil, http.StatusOK, &me)
+	if me.Username != "victor" {
+		t.Fatalf("logged in as %q, want victor", me.Username)
+	}
+	var creds []models.WebauthnCredential
+	s.doJSON(http.MethodGet, "/auth/webauthn/credentials", token, nil, http.StatusOK, &creds)
+	if len(creds) != 1 || creds[0].Id != cred.Id || creds[0].LastUsedAt == nil {
+		t.Fatalf("got credentials %+v, want %s marked as used", creds, cred.Id)
+	}
+
+	// A login session works once
+	var loginOptions models.WebauthnLoginOptions
+	s.doJSON(http.MethodPost, "/auth/webauthn/login/begin", "", nil, http.StatusOK, &loginOptions)
+	assertion := models.WebauthnLoginRequest{SessionToken: loginOptions.SessionToken, Credential: laptop.assert(loginOptions.PublicKey)}
+	s.doJSON(http.MethodPost, "/auth/webauthn/login/finish", "", assertion, http.StatusOK, nil)
+	s.doJSON(http.MethodPost, "/auth/webauthn/login/finish", "", assertion, http.StatusUnauthorized, nil)
+
+	// A copy of the key gives itself away by counting from where it was copied
+	clone := *laptop
+	clone.signCount = 1
+	s.passkeyLogin(&clone, http.StatusUnauthorized, nil)
+
+	// So does a forged signature
+	forger := newPasskey(t)
+	forger.id, forger.userHandle = laptop.id, laptop.userHandle
+	forger.signCount = 100
+	s.passkeyLogin(forger, http.StatusUnauthorized, nil)
+
+	// Just touching the key isn't enough when user verification is required
+	laptop.flags = 0x01
+	s.passkeyLogin(laptop, http.StatusUnauthorized, nil)
+	laptop.flags = 0x01 | 0x04
+
+	s.doJSON(http.MethodDelete, "/auth/webauthn/credentials/"+cred.Id.String(), s.signup("walter"), nil, http.StatusNotFound, nil)
+	s.doJSON(http.MethodDelete, "/auth/webauthn/credentials/"+cred.Id.String(), token, nil, http.StatusNoContent, nil)
+	s.passkeyLogin(laptop, http.StatusUnauthorized, nil)
+}
+
+func TestPasskeyWithoutUserVerificationNeedsTOTP(t *testing.T) {
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) { cfg.WebAuthn.UserVerification = "preferred" }})
+	token := s.signup("wendy")
+	key := s.registerPasskey(token, "Security key")
+	key.flags = 0x01
+
+	s.passkeyLogin(key, http.StatusOK, nil)
+
+	secret, _ := s.enableTOTP(token)
+	var challenge models.MfaChallengeResponse
+	s.passkeyLogin(key, http.StatusAccepted, &challenge)
+	s.doJSON(http.MethodPost, "/auth/mfa/verify", "", models.MfaVerifyRequest{MfaToken: challenge.MfaToken, Code: totpCode(t, secret, 1)}, http.StatusOK, nil)
+
+	// A PIN or biometric counts as the second factor
+	key.flags = 0x01 | 0x04
+	s.passkeyLogin(key, http.StatusOK, nil)
+}
+
+func TestAPITokens(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	session := s.signup("quinn")
+	todo := s.createTodo(session, "Write the script")
+
+	var created models.CreatedApiToken
+	s.doJSON(http.MethodPost, "/auth/tokens", session, models.CreateApiTokenRequest{
+		Name:   "backup script",
+		Scopes: []string{"tags:write", "todos:read", "todos:read"},
+	}, http.StatusCreated, &created)
+	if !strings.HasPrefix(created.Token, auth.APITokenPrefix) || !slices.Equal(created.Scopes, []string{"todos:read", "tags:write"}) {
+		t.Fatalf("got token %+v, want a %s token with todos:read and tags:write", created, auth.APITokenPrefix)
+	}
+	token := created.Token
+
+	// Each route needs its scope, and the account itself is off limits
+	s.doJSON(http.MethodGet, "/todos/"+todo.Id.String(), token, nil, http.StatusOK, nil)
+	s.doJSON(http.MethodPatch, "/todos/"+todo.Id.String(), token, models.UpdateTodoRequest{}, http.StatusForbidden, nil)
+	s.doJSON(http.MethodPost, "/tags", token, models.CreateTagRequest{Name: "scripted"}, http.StatusCreated, nil)
+	s.doJSON(http.MethodGet, "/tags", token, nil, http.StatusForbidden, nil)
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusForbidden, nil)
+	s.doJSON(http.MethodPost, "/auth/tokens", token, models.CreateApiTokenRequest{Name: "more", Scopes: []string{"todos:read"}}, http.StatusForbidden, nil)
+	s.doJSON(http.MethodPost, "/auth/logout-all", token, nil, http.StatusForbidden, nil)
+
+	var tokens []models.ApiToken
+	s.doJSON(http.MethodGet, "/auth/tokens", session, nil, http.StatusOK, &tokens)
+	if len(tokens) != 1 || tokens[0].Id != created.Id || tokens[0].LastUsedAt == nil || tokens[0].ExpiresAt != nil {
+		t.Fatalf("got tokens %+v, want the backup script token, used and without expiry", tokens)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	s.doJSON(http.MethodPost, "/auth/tokens", session, models.CreateApiTokenRequest{Name: "x", Scopes: []string{"todos:delete"}}, http.StatusBadRequest, nil)
+	s.doJSON(http.MethodPost, "/auth/tokens", session, models.CreateApiTokenRequest{Name: "x", Scopes: []string{}}, http.StatusBadRequest, nil)
+	s.doJSON(http.MethodPost, "/auth/tokens", session, models.CreateApiTokenRequest{Name: "x", Scopes: []string{"todos:read"}, ExpiresAt: &past}, http.StatusBadRequest, nil)
+
+	// Logging out everywhere ends sessions, not integrations
+	s.doJSON(http.MethodPost, "/auth/logout-all", session, nil, http.StatusNoContent, nil)
+	s.doJSON(http.MethodGet, "/todos", token, nil, http.StatusOK, nil)
+
+	session = s.login("quinn").AccessToken
+	s.doJSON(http.MethodDelete, "/auth/tokens/"+created.Id.String(), s.signup("mallory"), nil, http.StatusNotFound, nil)
+	s.doJSON(http.MethodDelete, "/auth/tokens/"+created.Id.String(), session, nil, http.StatusNoContent, nil)
+	s.doJSON(http.MethodGet, "/todos", token, nil, http.StatusUnauthorized, nil)
+	s.doJSON(http.MethodGet, "/todos", auth.APITokenPrefix+"forged", nil, http.StatusUnauthorized, nil)
+}
+
+// mockOIDC is a minimal OpenID Connect provider: discovery, a key set, and a token endpoint
+// that issues an RS256 ID token for whatever the test granted behind each code
+type mockOIDC struct {
+	t     *testing.T
+	srv   *httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]oidcGrant
+}
+
+// oidcGrant is a login the user finished at the provider. edit, if set, changes the ID token claims.
+type oidcGrant struct {
+	claims    jwt.MapClaims
+	challenge string // PKCE code challenge from the authorization request
+	edit      func(jwt.MapClaims)
+}
+
+const mockClientID = "todolist"
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate provider key: %v", err)
+	}
+	m := &mockOIDC{t: t, key: key, codes: make(map[string]oidcGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256",
+			"n": b64url(key.N.Bytes()), "e": b64url(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", m.token)
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	m.mu.Lock()
+	grant, found := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code")) // Codes work once
+	m.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if clientID != mockClientID || secret != "secret" || !found || b64url(verifier[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{"iss": m.srv.URL, "aud": mockClientID, "iat": time.Now().Unix(), "exp": time.Now().Add(5 * time.Minute).Unix()}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	if grant.edit != nil {
+		grant.edit(claims)
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "k1"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		m.t.Errorf("sign id token: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"access_token": "at", "token_type": "Bearer", "expires_in": 300, "id_token": signed})
+}
+
+// oauthStart is a login begun at /auth/{provider}/login, or a link begun at /auth/{provider}/link
+type oauthStart struct {
+	state, nonce, challenge string
+	cookie                  *http.Cookie
+	link                    *http.Cookie // Only for links
+}
+
+func (s *testServer) beginOAuth(provider string) oauthStart {
+	s.t.Helper()
+
+	resp, body := s.do(http.MethodGet, "/auth/"+provider+"/login", "", nil, nil)
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		s.t.Fatalf("login with %s: status %d: %s", provider, resp.StatusCode, body)
+	}
+	return s.oauthStart(resp.Header.Get("Location"), resp.Cookies())
+}
+
+func (s *testServer) beginOAuthLink(token, provider string) oauthStart {
+	s.t.Helper()
+
+	resp, body := s.do(http.MethodPost, "/auth/"+provider+"/link", token, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("link %s: status %d: %s", provider, resp.StatusCode, body)
+	}
+	var link models.OAuthLinkStart
+	if err := json.Unmarshal(body, &link); err != nil {
+		s.t.Fatalf("decode link start: %v", err)
+	}
+	start := s.oauthStart(link.AuthorizationUrl, resp.Cookies())
+	if start.link == nil {
+		s.t.Fatalf("link set no link cookie")
+	}
+	return start
+}
+
+// oauthStart reads the authorization request the browser is sent to, and the cookies for the callback
+func (s *testServer) oauthStart(authorizationURL string, cookies []*http.Cookie) oauthStart {
+	s.t.Helper()
+
+	location, err := url.Parse(authorizationURL)
+	if err != nil {
+		s.t.Fatalf("parse provider URL: %v", err)
+	}
+	q := location.Query()
+	if q.Get("client_id") != mockClientID || q.Get("code_challenge_method") != "S256" {
+		s.t.Fatalf("got authorization request %s, want client %s with an S256 challenge", location, mockClientID)
+	}
+	start := oauthStart{state: q.Get("state"), nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	for _, c := range cookies {
+		switch {
+		case c.Name == auth.StateCookieName:
+			start.cookie = c
+		case c.Name == auth.LinkCookieName && c.Value != "":
+			start.link = c
+		}
+	}
+	if start.cookie == nil {
+		s.t.Fatalf("login set no state cookie")
+	}
+	return start
+}
+
+// grant makes the provider accept code for the login in start, as the account in claims
+func (m *mockOIDC) grant(start oauthStart, claims jwt.MapClaims, edit func(jwt.MapClaims)) string {
+	claims["nonce"] = start.nonce
+	code := uuid.NewString()
+	m.mu.Lock()
+	m.codes[code] = oidcGrant{claims: claims, challenge: start.challenge, edit: edit}
+	m.mu.Unlock()
+	return code
+}
+
+// oauthCallback returns where the callback redirects the browser. Nil cookies aren't sent.
+func (s *testServer) oauthCallback(provider, code, state string, cookies ...*http.Cookie) string {
+	s.t.Helper()
+
+	header := http.Header{}
+	for _, c := range cookies {
+		if c != nil {
+			header.Add("Cookie", c.String())
+		}
+	}
+	resp, body := s.do(http.MethodGet, "/auth/"+provider+"/callback?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(state), "", nil, header)
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		s.t.Fatalf("%s callback: status %d: %s", provider, resp.StatusCode, body)
+	}
+	return resp.Header.Get("Location")
+}
+
+// oidcLogin logs in at the mock provider as the account in claims and returns the access token
+func (s *testServer) oidcLogin(m *mockOIDC, claims jwt.MapClaims) string {
+	s.t.Helper()
+
+	start := s.beginOAuth("mock")
+	location := s.oauthCallback("mock", m.grant(start, claims, nil), start.state, start.cookie)
+	token, ok := strings.CutPrefix(location, "/oauth/callback#access_token=")
+	if !ok {
+		s.t.Fatalf("callback redirected to %s, want the frontend with a token", location)
+	}
+	token, _ = url.QueryUnescape(token)
+	return token
+}
+
+// oidcLink links the account in claims at the mock provider and returns the fragment the
+// callback hands the frontend: a link token to confirm, or an error
+func (s *testServer) oidcLink(m *mockOIDC, token string, claims jwt.MapClaims) url.Values {
+	s.t.Helper()
+
+	start := s.beginOAuthLink(token, "mock")
+	location := s.oauthCallback("mock", m.grant(start, claims, nil), start.state, start.cookie, start.link)
+	fragment, ok := strings.CutPrefix(location, "/oauth/link#")
+	if !ok {
+		s.t.Fatalf("link callback redirected to %s, want the frontend's link page", location)
+	}
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		s.t.Fatalf("parse link fragment %q: %v", fragment, err)
+	}
+	return values
+}
+
+func newOIDCTestServer(t *testing.T) (*testServer, *mockOIDC) {
+	m := newMockOIDC(t)
+	s := newTestServer(t, serverOptions{cfg: func(cfg *config.Config) {
+		cfg.OAuth.Providers = map[string]config.OAuthProviderConfig{"mock": {
+			Name:         "Mock",
+			Type:         config.OAuthProviderOIDC,
+			Issuer:       m.srv.URL,
+			ClientID:     mockClientID,
+			ClientSecret: "secret",
+			RedirectURL:  "http://api.test/api/v1/auth/mock/callback",
+			Scopes:       []string{"openid", "email", "profile"},
+		}}
+	}})
+	return s, m
+}
+
+func TestOIDCLogin(t *testing.T) {
+	s, m := newOIDCTestServer(t)
+
+	var providers []models.OAuthProvider
+	s.doJSON(http.MethodGet, "/auth/providers", "", nil, http.StatusOK, &providers)
+	if len(providers) != 1 || providers[0].Id != "mock" || providers[0].Name != "Mock" {
+		t.Fatalf("got providers %+v, want just mock", providers)
+	}
+	s.doJSON(http.MethodGet, "/auth/nope/login", "", nil, http.StatusNotFound, nil)
+
+	token := s.oidcLogin(m, jwt.MapClaims{"sub": "wendy-1", "email": "wendy@example.com", "email_verified": true, "name": "Wendy"})
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.Username != "Wendy" || string(me.Email) != "wendy@example.com" || me.EmailVerified == nil || !*me.EmailVerified {
+		t.Fatalf("got user %+v, want a verified Wendy", me)
+	}
+
+	// The subject identifies the account, even after its email changed at the provider
+	token = s.oidcLogin(m, jwt.MapClaims{"sub": "wendy-1", "email": "wendy@elsewhere.test", "email_verified": true})
+	var again models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &again)
+	if *again.Id != *me.Id {
+		t.Fatalf("second login got user %s, want %s", *again.Id, *me.Id)
+	}
+
+	// Another account with a taken name still gets in
+	token = s.oidcLogin(m, jwt.MapClaims{"sub": "wendy-2", "email": "wendy2@example.com", "email_verified": true, "name": "Wendy"})
+	var other models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &other)
+	if *other.Id == *me.Id || !strings.HasPrefix(other.Username, "Wendy-") {
+		t.Fatalf("got user %+v, want a new user with a suffixed name", other)
+	}
+
+	password := "password123"
+	var loginErr models.Error
+	s.doJSON(http.MethodPost, "/auth/login", "", models.LoginRequest{Email: "wendy@example.com", Password: &password}, http.StatusUnauthorized, &loginErr)
+	if !strings.Contains(loginErr.Message, "Mock") {
+		t.Fatalf("got %q, want a hint to log in with Mock", loginErr.Message)
+	}
+}
+
+func TestOIDCAccountLinking(t *testing.T) {
+	s, m := newOIDCTestServer(t)
+	token := s.signup("xavier")
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	account := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "x", "email": "xavier@example.com", "email_verified": true}
+	}
+
+	// Logging in with the same address doesn't get into the existing account, verified or not
+	start := s.beginOAuth("mock")
+	if location := s.oauthCallback("mock", m.grant(start, account(), nil), start.state, start.cookie); location != "/login?error=auth_conflict" {
+		t.Fatalf("login with a taken email redirected to %s, want auth_conflict", location)
+	}
+
+	link := s.oidcLink(m, token, account())
+	if link.Get("provider") != "mock" || link.Get("email") != "xavier@example.com" || link.Get("link_token") == "" {
+		t.Fatalf("got link fragment %v, want a token for xavier's mock account", link)
+	}
+	// Nothing is linked until the user confirms
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.Identities == nil || len(*me.Identities) != 0 {
+		t.Fatalf("got identities %v before confirming, want none", me.Identities)
+	}
+
+	confirm := models.ConfirmOAuthLinkRequest{LinkToken: link.Get("link_token")}
+	s.doJSON(http.MethodPost, "/auth/identities/confirm", s.signup("mallory"), confirm, http.StatusForbidden, nil)
+	var identity models.UserIdentity
+	s.doJSON(http.MethodPost, "/auth/identities/confirm", token, confirm, http.StatusCreated, &identity)
+	if identity.Provider != "mock" || identity.Email == nil || *identity.Email != "xavier@example.com" {
+		t.Fatalf("got identity %+v, want xavier's mock account", identity)
+	}
+	s.doJSON(http.MethodPost, "/auth/identities/confirm", token, confirm, http.StatusUnauthorized, nil)
+
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.Identities == nil || len(*me.Identities) != 1 || (*me.Identities)[0].Id != identity.Id {
+		t.Fatalf("got identities %v, want the linked one", me.Identities)
+	}
+	var linked models.User
+	s.doJSON(http.MethodGet, "/users/me", s.oidcLogin(m, account()), nil, http.StatusOK, &linked)
+	if *linked.Id != *me.Id {
+		t.Fatalf("linked account logged in as %s, want %s", *linked.Id, *me.Id)
+	}
+
+	// One account per provider, and an account links to one user
+	s.doJSON(http.MethodPost, "/auth/mock/link", token, nil, http.StatusConflict, nil)
+	if got := s.oidcLink(m, s.signup("yvonne"), account()); got.Get("error") != "link_conflict" {
+		t.Fatalf("linking a taken account got %v, want link_conflict", got)
+	}
+
+	// The password still logs in, so the account can go
+	s.doJSON(http.MethodDelete, "/auth/identities/"+identity.Id.String(), token, nil, http.StatusNoContent, nil)
+	s.doJSON(http.MethodDelete, "/auth/identities/"+identity.Id.String(), token, nil, http.StatusNotFound, nil)
+	s.login("xavier")
+}
+
+func TestUnlinkKeepsALoginMethod(t *testing.T) {
+	s, m := newOIDCTestServer(t)
+	token := s.oidcLogin(m, jwt.MapClaims{"sub": "zed", "email": "zed@example.com", "email_verified": true})
+	var me models.User
+	s.doJSON(http.MethodGet, "/users/me", token, nil, http.StatusOK, &me)
+	if me.Identities == nil || len(*me.Identities) != 1 {
+		t.Fatalf("got identities %v, want the account zed signed up with", me.Identities)
+	}
+	first := (*me.Identities)[0]
+
+	var unlinkErr models.Error
+	s.doJSON(http.MethodDelete, "/auth/identities/"+first.Id.String(), token, nil, http.StatusConflict, &unlinkErr)
+	if !strings.Contains(unlinkErr.Message, "only way to log in") {
+		t.Fatalf("got %q, want an explanation", unlinkErr.Message)
+	}
+	s.doJSON(http.MethodDelete, "/auth/identities/"+first.Id.String(), s.signup("mallory"), nil, http.StatusNotFound, nil)
+
+	// A passkey is another way in
+	s.registerPasskey(token, "Laptop")
+	s.doJSON(http.MethodDelete, "/auth/identities/"+first.Id.String(), token, nil, http.StatusNoContent, nil)
+}
+
+func TestOIDCRejectsForgedLogins(t *testing.T) {
+	s, m := newOIDCTestServer(t)
+	account := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "yolanda", "email": "yolanda@example.com", "email_verified": true}
+	}
+
+	tests := []struct {
+		name  string
+		login func() string // Returns where the callback redirected
+		want  string
+	}{
+		{"nonce from another login", func() string {
+			start := s.beginOAuth("mock")
+			code := m.grant(start, account(), func(c jwt.MapClaims) { c["nonce"] = s.beginOAuth("mock").nonce })
+			return s.oauthCallback("mock", code, start.state, start.cookie)
+		}, "/login?error=auth_failed"},
+		{"token for another client", func() string {
+			start := s.beginOAuth("mock")
+			code := m.grant(start, account(), func(c jwt.MapClaims) { c["aud"] = "someone-else" })
+			return s.oauthCallback("mock", code, start.state, start.cookie)
+		}, "/login?error=auth_failed"},
+		{"expired token", func() string {
+			start := s.beginOAuth("mock")
+			code := m.grant(start, account(), func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() })
+			return s.oauthCallback("mock", code, start.state, start.cookie)
+		}, "/login?error=auth_failed"},
+		{"other issuer", func() string {
+			start := s.beginOAuth("mock")
+			code := m.grant(start, account(), func(c jwt.MapClaims) { c["iss"] = "http://evil.test" })
+			return s.oauthCallback("mock", code, start.state, start.cookie)
+		}, "/login?error=auth_failed"},
+		{"code from another browser", func() string {
+			// The victim's code arrives with the attacker's state and cookie; the PKCE verifier doesn't match
+			victim := s.beginOAuth("mock")
+			attacker := s.beginOAuth("mock")
+			return s.oauthCallback("mock", m.grant(victim, account(), nil), attacker.state, attacker.cookie)
+		}, "/login?error=auth_failed"},
+		{"state mismatch", func() string {
+			start := s.beginOAuth("mock")
+			return s.oauthCallback("mock", m.grant(start, account(), nil), "forged", start.cookie)
+		}, "/login?error=state_mismatch"},
+		{"no state cookie", func() string {
+			start := s.beginOAuth("mock")
+			return s.oauthCallback("mock", m.grant(start, account(), nil), start.state, nil)
+		}, "/login?error=state_missing"},
+		{"replayed code", func() string {
+			start := s.beginOAuth("mock")
+			code := m.grant(start, account(), nil)
+			s.oauthCallback("mock", code, start.state, start.cookie)
+			return s.oauthCallback("mock", code, start.state, start.cookie)
+		}, "/login?error=auth_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.login(); got != tt.want {
+				t.Fatalf("redirected to %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,9 +20,9 @@ import (
 	"github.com/Sosokker/todolist-backend/internal/config"
 	"github.com/Sosokker/todolist-backend/internal/domain"
 	"github.com/Sosokker/todolist-backend/internal/service"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	openapi_types "github.com/oapi-codegen/runtime/types"
-	"golang.org/x/oauth2"
 )
 
 // Compile-time check to ensure ApiHandler implements the interface
@@ -75,6 +80,16 @@ func SendJSONError(w http.ResponseWriter, err error, defaultStatusCode int, logg
 		statusCode = http.StatusConflict
 	case errors.Is(err, domain.ErrValidation), errors.Is(err, domain.ErrBadRequest):
 		statusCode = http.StatusBadRequest
+	case errors.Is(err, domain.ErrTooLarge):
+		statusCode = http.StatusRequestEntityTooLarge
+	case errors.Is(err, domain.ErrInfected):
+		statusCode = http.StatusUnprocessableEntity
+	case errors.Is(err, domain.ErrTooManyRequests):
+		statusCode = http.StatusTooManyRequests
+		var retryErr *domain.RetryAfterError
+		if errors.As(err, &retryErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+		}
 	case errors.Is(err, domain.ErrInternalServer):
 		statusCode = http.StatusInternalServerError
 		respErr.Message = "An internal error occurred."
@@ -121,6 +136,17 @@ func mapDomainUserToApi(user *domain.User) *models.User {
 		UpdatedAt:     &updatedAt}
 }
 
+func mapDomainStorageUsageToApi(usage *domain.StorageUsage) *models.StorageUsage {
+	if usage == nil {
+		return nil
+	}
+	return &models.StorageUsage{
+		UsedBytes:     usage.Used,
+		QuotaBytes:    usage.Quota,
+		MaxUploadSize: usage.MaxUploadSize,
+	}
+}
+
 func mapDomainTagToApi(tag *domain.Tag) *models.Tag {
 	if tag == nil {
 		return nil
@@ -139,7 +165,7 @@ func mapDomainTagToApi(tag *domain.Tag) *models.Tag {
 		UpdatedAt: &updatedAt}
 }
 
-func mapDomainTodoToApi(todo *domain.Todo, attachmentInfos []models.AttachmentInfo) *models.Todo { // Takes AttachmentInfo now
+func mapDomainTodoToApi(todo *domain.Todo) *models.Todo {
 	if todo == nil {
 		return nil
 	}
@@ -156,6 +182,17 @@ func mapDomainTodoToApi(todo *domain.Todo, attachmentInfos []models.AttachmentIn
 		tagIDs[i] = openapi_types.UUID(domainID)
 	}
 
+	apiAttachments := make([]models.AttachmentInfo, len(todo.Attachments))
+	// attachmentUrl is kept for older clients and points at the newest image
+	var attachmentURL *string
+	for i, info := range todo.Attachments {
+		apiAttachments[i] = *mapDomainAttachmentInfoToApi(&info)
+		if strings.HasPrefix(info.ContentType, "image/") && info.FileURL != "" {
+			fileURL := info.FileURL
+			attachmentURL = &fileURL
+		}
+	}
+
 	todoID := openapi_types.UUID(todo.ID)
 	userID := openapi_types.UUID(todo.UserID)
 	createdAt := todo.CreatedAt
@@ -169,7 +206,8 @@ func mapDomainTodoToApi(todo *domain.Todo, attachmentInfos []models.AttachmentIn
 		Status:        models.TodoStatus(todo.Status),
 		Deadline:      todo.Deadline,
 		TagIds:        tagIDs,
-		AttachmentUrl: todo.AttachmentUrl,
+		Attachments:   &apiAttachments,
+		AttachmentUrl: attachmentURL,
 		Subtasks:      &apiSubtasks,
 		CreatedAt:     &createdAt,
 		UpdatedAt:     &updatedAt,
@@ -199,73 +237,657 @@ func mapDomainAttachmentInfoToApi(info *domain.AttachmentInfo) *models.Attachmen
 		return nil
 	}
 	return &models.AttachmentInfo{
-		FileId:      info.FileID,
+		FileId:      openapi_types.UUID(info.FileID),
 		FileName:    info.FileName,
 		FileUrl:     info.FileURL,
 		ContentType: info.ContentType,
 		Size:        info.Size,
+		UploadedAt:  info.UploadedAt,
+
+		ThumbnailSmallUrl: info.ThumbnailSmallURL,
+		ThumbnailLargeUrl: info.ThumbnailLargeURL,
+		ScanStatus:        models.AttachmentInfoScanStatus(info.ScanStatus),
+	}
+}
+
+func mapDomainWebAuthnCredentialToApi(cred *domain.WebAuthnCredential) models.WebauthnCredential {
+	return models.WebauthnCredential{
+		Id:         openapi_types.UUID(cred.ID),
+		Name:       cred.Name,
+		CreatedAt:  cred.CreatedAt,
+		LastUsedAt: cred.LastUsedAt,
+	}
+}
+
+func mapDomainAPITokenToApi(token *domain.APIToken) models.ApiToken {
+	return models.ApiToken{
+		Id:         openapi_types.UUID(token.ID),
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+func mapDomainUserIdentityToApi(identity *domain.UserIdentity) models.UserIdentity {
+	return models.UserIdentity{
+		Id:          openapi_types.UUID(identity.ID),
+		Provider:    identity.Provider,
+		Email:       identity.Email,
+		CreatedAt:   identity.CreatedAt,
+		LastLoginAt: identity.LastLoginAt,
+	}
+}
+
+func mapWebAuthnCreationOptionsToApi(options *service.WebAuthnCreationOptions) models.PublicKeyCredentialCreationOptions {
+	params := make([]models.PublicKeyCredentialParameters, len(options.Algorithms))
+	for i, alg := range options.Algorithms {
+		params[i] = models.PublicKeyCredentialParameters{Type: "public-key", Alg: alg}
+	}
+	exclude := make([]models.PublicKeyCredentialDescriptor, len(options.ExcludeCredentials))
+	for i, id := range options.ExcludeCredentials {
+		exclude[i] = models.PublicKeyCredentialDescriptor{Type: "public-key", Id: base64.RawURLEncoding.EncodeToString(id)}
+	}
+	return models.PublicKeyCredentialCreationOptions{
+		Rp: models.PublicKeyCredentialRpEntity{Id: options.RPID, Name: options.RPName},
+		User: models.PublicKeyCredentialUserEntity{
+			Id:          base64.RawURLEncoding.EncodeToString(options.UserHandle),
+			Name:        options.UserName,
+			DisplayName: options.UserDisplayName,
+		},
+		Challenge:          base64.RawURLEncoding.EncodeToString(options.Challenge),
+		PubKeyCredParams:   params,
+		Timeout:            options.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		// Discoverable credentials are what let the login start without an email address
+		AuthenticatorSelection: models.AuthenticatorSelectionCriteria{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   options.UserVerification,
+		},
+		Attestation: "none",
 	}
 }
 
 // --- Auth Handlers ---
 
-func (h *ApiHandler) SignupUserApi(w http.ResponseWriter, r *http.Request) {
-	var body models.SignupRequest
+func (h *ApiHandler) SignupUserApi(w http.ResponseWriter, r *http.Request) {
+	var body models.SignupRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	creds := service.SignupCredentials{
+		Username: body.Username,
+		Email:    string(body.Email),
+		Password: *body.Password,
+	}
+
+	user, err := h.services.Auth.Signup(r.Context(), creds)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	// The account exists either way; the user can ask for another email
+	if err := h.services.Email.SendVerification(r.Context(), user.ID); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to send verification email after signup", "error", err, "userId", user.ID)
+	}
+
+	SendJSONResponse(w, http.StatusCreated, mapDomainUserToApi(user), h.logger)
+}
+
+func (h *ApiHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body models.VerifyEmailRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	user, err := h.services.Email.VerifyEmail(r.Context(), body.Token)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, mapDomainUserToApi(user), h.logger)
+}
+
+func (h *ApiHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	if err := h.services.Email.SendVerification(r.Context(), userID); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ApiHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var body models.ForgotPasswordRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	if err := h.services.PasswordReset.RequestReset(r.Context(), string(body.Email)); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	// Same answer whether or not the account exists
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *ApiHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body models.ResetPasswordRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	if err := h.services.PasswordReset.ResetPassword(r.Context(), body.Token, body.Password); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ApiHandler) LoginUserApi(w http.ResponseWriter, r *http.Request) {
+	var body models.LoginRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	creds := service.LoginCredentials{
+		Email:    string(body.Email),
+		Password: *body.Password,
+		ClientIP: clientIP(r),
+	}
+
+	tokens, challenge, err := h.services.Auth.Login(r.Context(), creds)
+	if err != nil {
+		SendJSONError(w, err, http.StatusUnauthorized, h.logger)
+		return
+	}
+	if challenge != nil {
+		SendJSONResponse(w, http.StatusAccepted, models.MfaChallengeResponse{
+			MfaToken:  challenge.Token,
+			ExpiresIn: int64(time.Until(challenge.ExpiresAt).Seconds()),
+		}, h.logger)
+		return
+	}
+
+	h.setAuthCookies(w, tokens)
+	SendJSONResponse(w, http.StatusOK, mapAuthTokensToApi(tokens), h.logger)
+}
+
+func (h *ApiHandler) RefreshTokens(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := h.refreshTokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.services.Auth.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		if errors.Is(err, domain.ErrUnauthorized) {
+			h.clearAuthCookies(w) // The cookie is dead either way, stop the browser from sending it
+		}
+		SendJSONError(w, err, http.StatusUnauthorized, h.logger)
+		return
+	}
+
+	h.setAuthCookies(w, tokens)
+	SendJSONResponse(w, http.StatusOK, mapAuthTokensToApi(tokens), h.logger)
+}
+
+func (h *ApiHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := h.refreshTokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if refreshToken != "" {
+		err := h.services.Auth.RevokeRefreshToken(r.Context(), refreshToken)
+		if err != nil && !errors.Is(err, domain.ErrUnauthorized) { // An unknown token has nothing left to revoke
+			SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+			return
+		}
+	}
+	// AuthMiddleware already accepted this token, so it only fails on a storage error
+	if err := h.services.Auth.RevokeAccessToken(r.Context(), extractToken(r, h.cfg)); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	h.clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ApiHandler) LogoutAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	if err := h.services.Auth.LogoutEverywhere(r.Context(), userID); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	h.clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ApiHandler) VerifyMfa(w http.ResponseWriter, r *http.Request) {
+	var body models.MfaVerifyRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	tokens, err := h.services.Auth.VerifyMFA(r.Context(), body.MfaToken, body.Code)
+	if err != nil {
+		SendJSONError(w, err, http.StatusUnauthorized, h.logger)
+		return
+	}
+
+	h.setAuthCookies(w, tokens)
+	SendJSONResponse(w, http.StatusOK, mapAuthTokensToApi(tokens), h.logger)
+}
+
+func (h *ApiHandler) GetMfaStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	status, err := h.services.MFA.Status(r.Context(), userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, models.MfaStatus{
+		TotpEnabled:       status.TOTPEnabled,
+		RecoveryCodesLeft: status.RecoveryCodesLeft,
+	}, h.logger)
+}
+
+func (h *ApiHandler) EnrollTotp(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	enrollment, err := h.services.MFA.EnrollTOTP(r.Context(), userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, models.TotpEnrollment{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.URI,
+	}, h.logger)
+}
+
+func (h *ApiHandler) ConfirmTotp(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	var body models.MfaCodeRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	codes, err := h.services.MFA.ConfirmTOTP(r.Context(), userID, body.Code)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, models.RecoveryCodes{Codes: codes}, h.logger)
+}
+
+func (h *ApiHandler) DisableTotp(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	var body models.MfaCodeRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	if err := h.services.MFA.DisableTOTP(r.Context(), userID, body.Code); err != nil {
+		h.sendMFACodeError(w, r, userID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ApiHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	var body models.MfaCodeRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	codes, err := h.services.MFA.RegenerateRecoveryCodes(r.Context(), userID, body.Code)
+	if err != nil {
+		h.sendMFACodeError(w, r, userID, err)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, models.RecoveryCodes{Codes: codes}, h.logger)
+}
+
+// sendMFACodeError reports a failed second-factor check made from a logged-in session. After
+// too many wrong codes the user is logged out everywhere, so a stolen session can't keep guessing.
+func (h *ApiHandler) sendMFACodeError(w http.ResponseWriter, r *http.Request, userID uuid.UUID, err error) {
+	if errors.Is(err, service.ErrMFAAttemptsExhausted) {
+		if logoutErr := h.services.Auth.LogoutEverywhere(r.Context(), userID); logoutErr != nil {
+			SendJSONError(w, logoutErr, http.StatusInternalServerError, h.logger)
+			return
+		}
+		h.clearAuthCookies(w)
+	}
+	SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+}
+
+// --- Passkey Handlers ---
+
+func (h *ApiHandler) BeginWebauthnRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	options, sessionToken, err := h.services.Auth.BeginWebAuthnRegistration(r.Context(), userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, models.WebauthnRegistrationOptions{
+		SessionToken: sessionToken,
+		PublicKey:    mapWebAuthnCreationOptionsToApi(options),
+	}, h.logger)
+}
+
+func (h *ApiHandler) FinishWebauthnRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	var body models.WebauthnRegistrationRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	attestation := service.WebAuthnAttestation{}
+	if body.Name != nil {
+		attestation.Name = *body.Name
+	}
+	if err := decodeWebAuthnFields([]webAuthnField{
+		{body.Credential.Response.ClientDataJSON, &attestation.ClientDataJSON},
+		{body.Credential.Response.AttestationObject, &attestation.AttestationObject},
+	}); err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+
+	cred, err := h.services.Auth.FinishWebAuthnRegistration(r.Context(), userID, body.SessionToken, attestation)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusCreated, mapDomainWebAuthnCredentialToApi(cred), h.logger)
+}
+
+func (h *ApiHandler) BeginWebauthnLogin(w http.ResponseWriter, r *http.Request) {
+	options, sessionToken, err := h.services.Auth.BeginWebAuthnLogin(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, models.WebauthnLoginOptions{
+		SessionToken: sessionToken,
+		PublicKey: models.PublicKeyCredentialRequestOptions{
+			Challenge:        base64.RawURLEncoding.EncodeToString(options.Challenge),
+			RpId:             options.RPID,
+			Timeout:          options.Timeout.Milliseconds(),
+			UserVerification: options.UserVerification,
+			AllowCredentials: []models.PublicKeyCredentialDescriptor{},
+		},
+	}, h.logger)
+}
+
+func (h *ApiHandler) FinishWebauthnLogin(w http.ResponseWriter, r *http.Request) {
+	var body models.WebauthnLoginRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	var assertion service.WebAuthnAssertion
+	fields := []webAuthnField{
+		{body.Credential.Id, &assertion.CredentialID},
+		{body.Credential.Response.ClientDataJSON, &assertion.ClientDataJSON},
+		{body.Credential.Response.AuthenticatorData, &assertion.AuthenticatorData},
+		{body.Credential.Response.Signature, &assertion.Signature},
+	}
+	if body.Credential.Response.UserHandle != nil {
+		fields = append(fields, webAuthnField{*body.Credential.Response.UserHandle, &assertion.UserHandle})
+	}
+	if err := decodeWebAuthnFields(fields); err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+
+	tokens, challenge, err := h.services.Auth.FinishWebAuthnLogin(r.Context(), body.SessionToken, assertion)
+	if err != nil {
+		SendJSONError(w, err, http.StatusUnauthorized, h.logger)
+		return
+	}
+	if challenge != nil {
+		SendJSONResponse(w, http.StatusAccepted, models.MfaChallengeResponse{
+			MfaToken:  challenge.Token,
+			ExpiresIn: int64(time.Until(challenge.ExpiresAt).Seconds()),
+		}, h.logger)
+		return
+	}
+
+	h.setAuthCookies(w, tokens)
+	SendJSONResponse(w, http.StatusOK, mapAuthTokensToApi(tokens), h.logger)
+}
+
+func (h *ApiHandler) ListWebauthnCredentials(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	creds, err := h.services.Auth.ListWebAuthnCredentials(r.Context(), userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	apiCreds := make([]models.WebauthnCredential, len(creds))
+	for i := range creds {
+		apiCreds[i] = mapDomainWebAuthnCredentialToApi(&creds[i])
+	}
+	SendJSONResponse(w, http.StatusOK, apiCreds, h.logger)
+}
+
+func (h *ApiHandler) DeleteWebauthnCredential(w http.ResponseWriter, r *http.Request, credentialId openapi_types.UUID) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	if err := h.services.Auth.DeleteWebAuthnCredential(r.Context(), userID, uuid.UUID(credentialId)); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ApiHandler) ListApiTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	tokens, err := h.services.Auth.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	apiTokens := make([]models.ApiToken, len(tokens))
+	for i := range tokens {
+		apiTokens[i] = mapDomainAPITokenToApi(&tokens[i])
+	}
+	SendJSONResponse(w, http.StatusOK, apiTokens, h.logger)
+}
+
+func (h *ApiHandler) CreateApiToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	var body models.CreateApiTokenRequest
 	if !parseAndValidateBody(w, r, &body, h.logger) {
 		return
 	}
 
-	creds := service.SignupCredentials{
-		Username: body.Username,
-		Email:    string(body.Email),
-		Password: *body.Password,
+	token, info, err := h.services.Auth.CreateAPIToken(r.Context(), userID, service.CreateAPITokenInput{
+		Name:      body.Name,
+		Scopes:    body.Scopes,
+		ExpiresAt: body.ExpiresAt,
+	})
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
 	}
 
-	user, err := h.services.Auth.Signup(r.Context(), creds)
+	created := mapDomainAPITokenToApi(info)
+	SendJSONResponse(w, http.StatusCreated, models.CreatedApiToken{
+		Id:         created.Id,
+		Name:       created.Name,
+		Scopes:     created.Scopes,
+		CreatedAt:  created.CreatedAt,
+		ExpiresAt:  created.ExpiresAt,
+		LastUsedAt: created.LastUsedAt,
+		Token:      token,
+	}, h.logger)
+}
+
+func (h *ApiHandler) DeleteApiToken(w http.ResponseWriter, r *http.Request, tokenId openapi_types.UUID) {
+	userID, err := GetUserIDFromContext(r.Context())
 	if err != nil {
 		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
 		return
 	}
 
-	SendJSONResponse(w, http.StatusCreated, mapDomainUserToApi(user), h.logger)
+	if err := h.services.Auth.DeleteAPIToken(r.Context(), userID, uuid.UUID(tokenId)); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *ApiHandler) LoginUserApi(w http.ResponseWriter, r *http.Request) {
-	var body models.LoginRequest
-	if !parseAndValidateBody(w, r, &body, h.logger) {
-		return
+// webAuthnField is a base64url value from a credential and where its bytes go
+type webAuthnField struct {
+	value string
+	dst   *[]byte
+}
+
+// decodeWebAuthnFields decodes base64url values, as PublicKeyCredential.toJSON() produces them.
+// Padding is tolerated for clients that encode by hand.
+func decodeWebAuthnFields(fields []webAuthnField) error {
+	for _, f := range fields {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(f.value, "="))
+		if err != nil {
+			return fmt.Errorf("credential fields must be base64url: %w", domain.ErrBadRequest)
+		}
+		*f.dst = decoded
 	}
+	return nil
+}
 
-	creds := service.LoginCredentials{
-		Email:    string(body.Email),
-		Password: *body.Password,
+// refreshTokenFromRequest takes the refresh token from an optional JSON body, falling back to
+// the refresh cookie like extractToken falls back to the JWT cookie. An empty token is not an error.
+func (h *ApiHandler) refreshTokenFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		SendJSONError(w, fmt.Errorf("invalid request body: %w", domain.ErrBadRequest), http.StatusBadRequest, h.logger)
+		return "", false
+	}
+	if body.RefreshToken != nil && *body.RefreshToken != "" {
+		return *body.RefreshToken, true
 	}
+	if cookie, err := r.Cookie(h.cfg.JWT.RefreshCookieName); err == nil {
+		return cookie.Value, true
+	}
+	return "", true
+}
 
-	token, _, err := h.services.Auth.Login(r.Context(), creds)
-	if err != nil {
-		SendJSONError(w, err, http.StatusUnauthorized, h.logger)
-		return
+func mapAuthTokensToApi(tokens *service.AuthTokens) models.LoginResponse {
+	return models.LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(tokens.AccessExpiresAt).Seconds()),
+		RefreshToken: tokens.RefreshToken,
 	}
+}
 
+// setAuthCookies sets the JWT cookie and the refresh cookie. The refresh cookie is scoped to
+// the auth routes so it isn't sent along with every API request.
+func (h *ApiHandler) setAuthCookies(w http.ResponseWriter, tokens *service.AuthTokens) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     h.cfg.JWT.CookieName,
-		Value:    token,
+		Value:    tokens.AccessToken,
 		Path:     h.cfg.JWT.CookiePath,
 		Domain:   h.cfg.JWT.CookieDomain,
-		Expires:  time.Now().Add(time.Duration(h.cfg.JWT.ExpiryMinutes) * time.Minute),
+		Expires:  tokens.AccessExpiresAt,
 		HttpOnly: h.cfg.JWT.CookieHttpOnly,
 		Secure:   h.cfg.JWT.CookieSecure,
 		SameSite: parseSameSite(h.cfg.JWT.CookieSameSite),
 	})
-
-	resp := models.LoginResponse{
-		AccessToken: token,
-		TokenType:   "Bearer",
-	}
-	SendJSONResponse(w, http.StatusOK, resp, h.logger)
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.cfg.JWT.RefreshCookieName,
+		Value:    tokens.RefreshToken,
+		Path:     h.cfg.JWT.RefreshCookiePath,
+		Domain:   h.cfg.JWT.CookieDomain,
+		Expires:  tokens.RefreshExpiresAt,
+		HttpOnly: true,
+		Secure:   h.cfg.JWT.CookieSecure,
+		SameSite: parseSameSite(h.cfg.JWT.CookieSameSite),
+	})
 }
 
-func (h *ApiHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+func (h *ApiHandler) clearAuthCookies(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     h.cfg.JWT.CookieName,
 		Value:    "",
@@ -277,8 +899,17 @@ func (h *ApiHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
 		Secure:   h.cfg.JWT.CookieSecure,
 		SameSite: parseSameSite(h.cfg.JWT.CookieSameSite),
 	})
-
-	w.WriteHeader(http.StatusNoContent)
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.cfg.JWT.RefreshCookieName,
+		Value:    "",
+		Path:     h.cfg.JWT.RefreshCookiePath,
+		Domain:   h.cfg.JWT.CookieDomain,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.cfg.JWT.CookieSecure,
+		SameSite: parseSameSite(h.cfg.JWT.CookieSameSite),
+	})
 }
 
 // Helper to parse SameSite string to http.SameSite type
@@ -295,105 +926,221 @@ func parseSameSite(s string) http.SameSite {
 	}
 }
 
-// --- Google OAuth Handlers ---
+// --- External Login Handlers ---
+
+// jwksMaxAge is how long clients may cache the JWK set. A key must be published at least
+// this long before it becomes jwt.signingKey.
+const jwksMaxAge = 5 * time.Minute
+
+// GetJWKS serves the public keys access tokens are signed with, at /.well-known/jwks.json.
+// Consumers should fetch it again when a token names a kid they don't know.
+func (h *ApiHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	SendJSONResponse(w, http.StatusOK, h.services.Auth.JWKS(), h.logger)
+}
+
+func (h *ApiHandler) ListOAuthProviders(w http.ResponseWriter, r *http.Request) {
+	providers := h.services.Auth.OAuthProviders()
+	resp := make([]models.OAuthProvider, len(providers))
+	for i, p := range providers {
+		resp[i] = models.OAuthProvider{Id: p.ID, Name: p.Name}
+	}
+	SendJSONResponse(w, http.StatusOK, resp, h.logger)
+}
 
-func (h *ApiHandler) InitiateGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	oauthCfg := h.services.Auth.GetGoogleAuthConfig()
+func (h *ApiHandler) InitiateOAuthLogin(w http.ResponseWriter, r *http.Request, provider string) {
+	ctx := r.Context()
 	state := uuid.NewString()
 
-	signedState := auth.SignState(state, []byte(h.cfg.OAuth.Google.StateSecret))
+	redirectURL, err := h.services.Auth.OAuthLoginURL(ctx, provider, state)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     auth.StateCookieName,
-		Value:    signedState,
-		Path:     "/",
-		Expires:  time.Now().Add(auth.StateExpiry + 1*time.Minute),
-		HttpOnly: true,
-		Secure:   h.cfg.JWT.CookieSecure,
-		SameSite: http.SameSiteLaxMode,
-	})
+	h.setOAuthCookie(w, auth.StateCookieName, auth.SignState(state, []byte(h.cfg.OAuth.StateSecret)))
+	// A link flow abandoned at the provider mustn't turn this login into a link
+	h.clearOAuthCookie(w, auth.LinkCookieName)
 
-	redirectURL := oauthCfg.AuthCodeURL(state, oauth2.AccessTypeOffline)
-	h.logger.Debug("Redirecting to Google OAuth", "url", redirectURL)
+	h.logger.Debug("Redirecting to OAuth provider", "provider", provider, "url", redirectURL)
 	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
-func (h *ApiHandler) HandleGoogleCallback(w http.ResponseWriter, r *http.Request) {
+func (h *ApiHandler) BeginOAuthLink(w http.ResponseWriter, r *http.Request, provider string) {
+	ctx := r.Context()
+	userID, err := GetUserIDFromContext(ctx)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	state := uuid.NewString()
+
+	authURL, intent, err := h.services.Auth.BeginOAuthLink(ctx, userID, provider, state)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	// The provider redirects the browser to the shared callback; the intent cookie tells it this is a link
+	h.setOAuthCookie(w, auth.StateCookieName, auth.SignState(state, []byte(h.cfg.OAuth.StateSecret)))
+	h.setOAuthCookie(w, auth.LinkCookieName, intent)
+
+	SendJSONResponse(w, http.StatusOK, models.OAuthLinkStart{AuthorizationUrl: authURL}, h.logger)
+}
+
+func (h *ApiHandler) HandleOAuthCallback(w http.ResponseWriter, r *http.Request, provider string) {
 	ctx := r.Context()
 	receivedCode := r.URL.Query().Get("code")
 	receivedState := r.URL.Query().Get("state")
 
+	// Links finish on the frontend's link page, logins on its login page
+	linkCookie, _ := r.Cookie(auth.LinkCookieName)
+	errorURL := "/login?error="
+	if linkCookie != nil {
+		h.clearOAuthCookie(w, auth.LinkCookieName)
+		errorURL = h.cfg.Frontend.Url + "/oauth/link#error="
+	}
+
 	stateCookie, err := r.Cookie(auth.StateCookieName)
 	if err != nil {
-		h.logger.WarnContext(ctx, "OAuth state cookie missing or error", "error", err)
-		http.Redirect(w, r, "/login?error=state_missing", http.StatusTemporaryRedirect)
+		h.logger.WarnContext(ctx, "OAuth state cookie missing or error", "error", err, "provider", provider)
+		http.Redirect(w, r, errorURL+"state_missing", http.StatusTemporaryRedirect)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     auth.StateCookieName,
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   h.cfg.JWT.CookieSecure,
-		SameSite: http.SameSiteLaxMode,
-	})
+	h.clearOAuthCookie(w, auth.StateCookieName)
 
-	originalState, err := auth.VerifyAndExtractState(stateCookie.Value, []byte(h.cfg.OAuth.Google.StateSecret))
+	originalState, err := auth.VerifyAndExtractState(stateCookie.Value, []byte(h.cfg.OAuth.StateSecret))
 	if err != nil {
 		h.logger.WarnContext(ctx, "OAuth state verification failed", "error", err, "receivedState", receivedState)
 		errorParam := "state_invalid"
 		if errors.Is(err, auth.ErrStateExpired) {
 			errorParam = "state_expired"
 		}
-		http.Redirect(w, r, "/login?error="+errorParam, http.StatusTemporaryRedirect)
+		http.Redirect(w, r, errorURL+errorParam, http.StatusTemporaryRedirect)
 		return
 	}
 
 	if receivedState == "" || receivedState != originalState {
 		h.logger.WarnContext(ctx, "OAuth state mismatch", "received", receivedState, "expected", originalState)
-		http.Redirect(w, r, "/login?error=state_mismatch", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, errorURL+"state_mismatch", http.StatusTemporaryRedirect)
 		return
 	}
 
 	if receivedCode == "" {
 		errorDesc := r.URL.Query().Get("error_description")
-		h.logger.WarnContext(ctx, "Missing OAuth code parameter in callback", "error_desc", errorDesc)
+		h.logger.WarnContext(ctx, "Missing OAuth code parameter in callback", "error_desc", errorDesc, "provider", provider)
 		errorParam := url.QueryEscape(r.URL.Query().Get("error"))
 		if errorParam == "" {
 			errorParam = "missing_code"
 		}
-		http.Redirect(w, r, "/login?error="+errorParam, http.StatusTemporaryRedirect)
+		http.Redirect(w, r, errorURL+errorParam, http.StatusTemporaryRedirect)
+		return
+	}
+
+	if linkCookie != nil {
+		h.finishOAuthLink(w, r, provider, receivedCode, originalState, linkCookie.Value)
 		return
 	}
 
-	token, user, err := h.services.Auth.HandleGoogleCallback(ctx, receivedCode)
+	tokens, user, err := h.services.Auth.HandleOAuthCallback(ctx, provider, receivedCode, originalState)
 	if err != nil {
-		h.logger.ErrorContext(ctx, "Google callback handling failed in service", "error", err)
+		h.logger.WarnContext(ctx, "OAuth callback handling failed in service", "error", err, "provider", provider)
 		errorParam := "auth_failed"
 		if errors.Is(err, domain.ErrConflict) {
 			errorParam = "auth_conflict"
 		}
-		http.Redirect(w, r, "/login?error="+errorParam, http.StatusTemporaryRedirect)
+		http.Redirect(w, r, errorURL+errorParam, http.StatusTemporaryRedirect)
+		return
+	}
+
+	h.setAuthCookies(w, tokens)
+
+	// Only the access token goes in the URL; the refresh token stays in its HTTP-only cookie
+	redirectURL := fmt.Sprintf("%s/oauth/callback#access_token=%s", h.cfg.Frontend.Url, url.QueryEscape(tokens.AccessToken))
+	h.logger.InfoContext(ctx, "OAuth login successful", "userId", user.ID, "provider", provider)
+	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+}
+
+// finishOAuthLink sends the browser to the frontend's link page, which shows the account and
+// confirms with the link token. Nothing is linked until then.
+func (h *ApiHandler) finishOAuthLink(w http.ResponseWriter, r *http.Request, provider, code, state, intent string) {
+	ctx := r.Context()
+	pending, err := h.services.Auth.HandleOAuthLinkCallback(ctx, provider, code, state, intent)
+	if err != nil {
+		h.logger.WarnContext(ctx, "OAuth link callback failed in service", "error", err, "provider", provider)
+		errorParam := "link_failed"
+		if errors.Is(err, domain.ErrConflict) {
+			errorParam = "link_conflict"
+		}
+		http.Redirect(w, r, h.cfg.Frontend.Url+"/oauth/link#error="+errorParam, http.StatusTemporaryRedirect)
+		return
+	}
+
+	fragment := url.Values{"link_token": {pending.Token}, "provider": {pending.Provider}}
+	if pending.Email != "" {
+		fragment.Set("email", pending.Email)
+	}
+	http.Redirect(w, r, h.cfg.Frontend.Url+"/oauth/link#"+fragment.Encode(), http.StatusTemporaryRedirect)
+}
+
+func (h *ApiHandler) ConfirmOAuthLink(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	var body models.ConfirmOAuthLinkRequest
+	if !parseAndValidateBody(w, r, &body, h.logger) {
+		return
+	}
+
+	identity, err := h.services.Auth.ConfirmOAuthLink(r.Context(), userID, body.LinkToken)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	SendJSONResponse(w, http.StatusCreated, mapDomainUserIdentityToApi(identity), h.logger)
+}
+
+func (h *ApiHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request, identityId openapi_types.UUID) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	if err := h.services.Auth.UnlinkIdentity(r.Context(), userID, uuid.UUID(identityId)); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
+// setOAuthCookie sets a cookie that has to survive the round trip to a provider
+func (h *ApiHandler) setOAuthCookie(w http.ResponseWriter, name, value string) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     h.cfg.JWT.CookieName,
-		Value:    token,
-		Path:     h.cfg.JWT.CookiePath,
-		Domain:   h.cfg.JWT.CookieDomain,
-		Expires:  time.Now().Add(time.Duration(h.cfg.JWT.ExpiryMinutes) * time.Minute),
-		HttpOnly: h.cfg.JWT.CookieHttpOnly,
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Now().Add(auth.StateExpiry + 1*time.Minute),
+		HttpOnly: true,
 		Secure:   h.cfg.JWT.CookieSecure,
-		SameSite: parseSameSite(h.cfg.JWT.CookieSameSite),
+		SameSite: http.SameSiteLaxMode,
 	})
+}
 
-	redirectURL := fmt.Sprintf("%s/oauth/callback#access_token=%s", h.cfg.Frontend.Url, url.QueryEscape(token))
-	h.logger.InfoContext(ctx, "Google OAuth login successful", "userId", user.ID, "email", user.Email, "redirectingTo", redirectURL)
-	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+func (h *ApiHandler) clearOAuthCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.cfg.JWT.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
 
 // --- User Handlers ---
@@ -421,11 +1168,38 @@ func (h *ApiHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		SendJSONError(w, domain.ErrInternalServer, http.StatusInternalServerError, logger)
 		return
 	}
+	apiUser.Storage = h.storageUsage(ctx, userID, logger)
+	apiUser.Identities = h.linkedIdentities(ctx, userID, logger)
 
 	logger.DebugContext(ctx, "Successfully retrieved current user")
 	SendJSONResponse(w, http.StatusOK, apiUser, logger)
 }
 
+// storageUsage loads the usage block for /users/me. A failure is logged and leaves it
+// out rather than failing the request the frontend needs to load the session.
+func (h *ApiHandler) storageUsage(ctx context.Context, userID uuid.UUID, logger *slog.Logger) *models.StorageUsage {
+	usage, err := h.services.Todo.StorageUsage(ctx, userID)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to load storage usage", "error", err)
+		return nil
+	}
+	return mapDomainStorageUsageToApi(usage)
+}
+
+// linkedIdentities loads the identities for /users/me, leaving them out on failure like storageUsage
+func (h *ApiHandler) linkedIdentities(ctx context.Context, userID uuid.UUID, logger *slog.Logger) *[]models.UserIdentity {
+	identities, err := h.services.Auth.ListIdentities(ctx, userID)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to load linked identities", "error", err)
+		return nil
+	}
+	apiIdentities := make([]models.UserIdentity, len(identities))
+	for i := range identities {
+		apiIdentities[i] = mapDomainUserIdentityToApi(&identities[i])
+	}
+	return &apiIdentities
+}
+
 func (h *ApiHandler) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := h.logger.With(slog.String("handler", "UpdateCurrentUser"))
@@ -459,6 +1233,8 @@ func (h *ApiHandler) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
 		SendJSONError(w, domain.ErrInternalServer, http.StatusInternalServerError, logger)
 		return
 	}
+	apiUser.Storage = h.storageUsage(ctx, userID, logger)
+	apiUser.Identities = h.linkedIdentities(ctx, userID, logger)
 
 	logger.InfoContext(ctx, "Successfully updated current user")
 	SendJSONResponse(w, http.StatusOK, apiUser, logger)
@@ -619,11 +1395,11 @@ func (h *ApiHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Newly created todo won't have attachments yet
-	apiTodo := mapDomainTodoToApi(todo, []models.AttachmentInfo{})
+	apiTodo := mapDomainTodoToApi(todo)
 	SendJSONResponse(w, http.StatusCreated, apiTodo, h.logger)
 }
 
-// ListTodos remains the same, doesn't include full attachment details for performance
+// ListTodos includes attachments, which the service loads in one batch query
 func (h *ApiHandler) ListTodos(w http.ResponseWriter, r *http.Request, params ListTodosParams) {
 	userID, err := GetUserIDFromContext(r.Context())
 	if err != nil {
@@ -658,14 +1434,7 @@ func (h *ApiHandler) ListTodos(w http.ResponseWriter, r *http.Request, params Li
 
 	apiTodos := make([]models.Todo, len(todos))
 	for i, todo := range todos {
-		// For list view, if there is an attachmentUrl, include it as a single-item array
-		var attachmentInfos []models.AttachmentInfo
-		if todo.AttachmentUrl != nil && *todo.AttachmentUrl != "" {
-			attachmentInfos = []models.AttachmentInfo{{FileId: *todo.AttachmentUrl}}
-		} else {
-			attachmentInfos = []models.AttachmentInfo{}
-		}
-		mappedTodo := mapDomainTodoToApi(&todo, attachmentInfos)
+		mappedTodo := mapDomainTodoToApi(&todo)
 		if mappedTodo != nil {
 			apiTodos[i] = *mappedTodo
 		}
@@ -674,7 +1443,6 @@ func (h *ApiHandler) ListTodos(w http.ResponseWriter, r *http.Request, params Li
 	SendJSONResponse(w, http.StatusOK, apiTodos, h.logger)
 }
 
-// GetTodoById updated for single attachmentUrl
 func (h *ApiHandler) GetTodoById(w http.ResponseWriter, r *http.Request, todoId openapi_types.UUID) {
 	ctx := r.Context()
 	userID, err := GetUserIDFromContext(ctx)
@@ -690,15 +1458,7 @@ func (h *ApiHandler) GetTodoById(w http.ResponseWriter, r *http.Request, todoId
 		return
 	}
 
-	// Map attachmentUrl to API model as a single-item array if present
-	var apiAttachmentInfos []models.AttachmentInfo
-	if todo.AttachmentUrl != nil && *todo.AttachmentUrl != "" {
-		apiAttachmentInfos = []models.AttachmentInfo{{FileId: *todo.AttachmentUrl}}
-	} else {
-		apiAttachmentInfos = []models.AttachmentInfo{}
-	}
-
-	apiTodo := mapDomainTodoToApi(todo, apiAttachmentInfos)
+	apiTodo := mapDomainTodoToApi(todo)
 	SendJSONResponse(w, http.StatusOK, apiTodo, h.logger)
 }
 
@@ -743,15 +1503,7 @@ func (h *ApiHandler) UpdateTodoById(w http.ResponseWriter, r *http.Request, todo
 		return
 	}
 
-	// Prepare attachment info for API response using AttachmentUrl field
-	var apiAttachmentInfos []models.AttachmentInfo
-	if todo.AttachmentUrl != nil && *todo.AttachmentUrl != "" {
-		apiAttachmentInfos = []models.AttachmentInfo{{FileId: *todo.AttachmentUrl}}
-	} else {
-		apiAttachmentInfos = []models.AttachmentInfo{}
-	}
-
-	apiTodo := mapDomainTodoToApi(todo, apiAttachmentInfos)
+	apiTodo := mapDomainTodoToApi(todo)
 	SendJSONResponse(w, http.StatusOK, apiTodo, h.logger)
 }
 
@@ -775,7 +1527,28 @@ func (h *ApiHandler) DeleteTodoById(w http.ResponseWriter, r *http.Request, todo
 
 // --- Attachment Handlers ---
 
-func (h *ApiHandler) DeleteTodoAttachment(w http.ResponseWriter, r *http.Request, todoId openapi_types.UUID) {
+func (h *ApiHandler) ListTodoAttachments(w http.ResponseWriter, r *http.Request, todoId openapi_types.UUID) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	domainTodoID := uuid.UUID(todoId)
+
+	infos, err := h.services.Todo.ListAttachments(r.Context(), domainTodoID, userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	apiInfos := make([]models.AttachmentInfo, len(infos))
+	for i, info := range infos {
+		apiInfos[i] = *mapDomainAttachmentInfoToApi(&info)
+	}
+	SendJSONResponse(w, http.StatusOK, apiInfos, h.logger)
+}
+
+func (h *ApiHandler) DeleteTodoAttachment(w http.ResponseWriter, r *http.Request, todoId openapi_types.UUID, attachmentId openapi_types.UUID) {
 	ctx := r.Context()
 	userID, err := GetUserIDFromContext(ctx)
 	if err != nil {
@@ -783,20 +1556,61 @@ func (h *ApiHandler) DeleteTodoAttachment(w http.ResponseWriter, r *http.Request
 		return
 	}
 	domainTodoID := uuid.UUID(todoId)
+	domainAttachmentID := uuid.UUID(attachmentId)
 
-	h.logger.DebugContext(ctx, "Request to delete attachment", "todoId", todoId)
+	h.logger.DebugContext(ctx, "Request to delete attachment", "todoId", todoId, "attachmentId", attachmentId)
 
-	err = h.services.Todo.DeleteAttachment(ctx, domainTodoID, userID)
+	err = h.services.Todo.DeleteAttachment(ctx, domainTodoID, domainAttachmentID, userID)
 	if err != nil {
 		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
 		return
 	}
 
-	h.logger.InfoContext(ctx, "Attachment deleted successfully", "todoId", todoId)
+	h.logger.InfoContext(ctx, "Attachment deleted successfully", "todoId", todoId, "attachmentId", attachmentId)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *ApiHandler) UploadOrReplaceTodoAttachment(w http.ResponseWriter, r *http.Request, todoId openapi_types.UUID) {
+// DownloadAttachment redirects to a URL minted for this request, so clients can
+// keep a stable link while the signed URLs behind it stay short-lived.
+func (h *ApiHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request, attachmentId openapi_types.UUID) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	fileURL, err := h.services.Todo.GetAttachmentDownloadURL(r.Context(), uuid.UUID(attachmentId), userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, fileURL, http.StatusFound)
+}
+
+// multipartOverhead is the room left on top of the upload limit for multipart
+// boundaries and part headers when capping the raw request body.
+const multipartOverhead = 64 << 10
+
+// uploadContext gives an upload request its own time budget, since large uploads
+// outlive the server-wide timeouts. The returned context isn't cancelled when the
+// client disconnects, so whatever was received can still be recorded.
+func (h *ApiHandler) uploadContext(w http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(h.cfg.Storage.UploadTimeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		h.logger.DebugContext(r.Context(), "Could not extend read deadline for upload", "error", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		h.logger.DebugContext(r.Context(), "Could not extend write deadline for upload", "error", err)
+	}
+	return context.WithDeadline(context.WithoutCancel(r.Context()), deadline)
+}
+
+// UploadTodoAttachment streams the "file" part of a multipart body straight into
+// storage instead of buffering it through ParseMultipartForm.
+func (h *ApiHandler) UploadTodoAttachment(w http.ResponseWriter, r *http.Request, todoId openapi_types.UUID) {
 	userID, err := GetUserIDFromContext(r.Context())
 	if err != nil {
 		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
@@ -804,39 +1618,111 @@ func (h *ApiHandler) UploadOrReplaceTodoAttachment(w http.ResponseWriter, r *htt
 	}
 	domainTodoID := uuid.UUID(todoId)
 
-	// Parse multipart form (limit to 10 MB)
-	err = r.ParseMultipartForm(10 << 20)
+	limit, err := h.services.Todo.UploadLimit(r.Context(), userID)
 	if err != nil {
-		SendJSONError(w, fmt.Errorf("failed to parse multipart form: %w", err), http.StatusBadRequest, h.logger)
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	if r.ContentLength > limit+multipartOverhead {
+		SendJSONError(w, fmt.Errorf("attachment exceeds the %d byte upload limit: %w", limit, domain.ErrTooLarge), http.StatusRequestEntityTooLarge, h.logger)
 		return
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit+multipartOverhead)
+
+	ctx, cancel := h.uploadContext(w, r)
+	defer cancel()
 
-	file, fileHeader, err := r.FormFile("file")
+	mr, err := r.MultipartReader()
 	if err != nil {
-		SendJSONError(w, fmt.Errorf("missing or invalid file: %w", err), http.StatusBadRequest, h.logger)
+		SendJSONError(w, fmt.Errorf("expected a multipart/form-data body: %w", domain.ErrBadRequest), http.StatusBadRequest, h.logger)
 		return
 	}
-	defer file.Close()
 
-	fileName := fileHeader.Filename
-	fileSize := fileHeader.Size
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.Is(err, io.EOF):
+				err = fmt.Errorf("missing file part: %w", domain.ErrBadRequest)
+			case errors.As(err, &maxBytesErr):
+				err = fmt.Errorf("attachment exceeds the %d byte upload limit: %w", limit, domain.ErrTooLarge)
+			default:
+				err = fmt.Errorf("failed to read multipart body: %w", domain.ErrBadRequest)
+			}
+			SendJSONError(w, err, http.StatusBadRequest, h.logger)
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close() // Skip unrelated form fields
+			continue
+		}
+
+		info, err := h.services.Todo.AddAttachment(ctx, domainTodoID, userID, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				err = fmt.Errorf("attachment exceeds the %d byte upload limit: %w", limit, domain.ErrTooLarge)
+			}
+			SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+			return
+		}
+
+		SendJSONResponse(w, http.StatusCreated, mapDomainAttachmentInfoToApi(info), h.logger)
+		return
+	}
+}
 
-	todo, err := h.services.Todo.AddAttachment(r.Context(), domainTodoID, userID, fileName, fileSize, file)
+// DownloadLocalFile streams an attachment kept by the local storage backend.
+// Files are only served to users with an attachment referencing them; others get a 404.
+// Deduplicated files live under the first uploader's prefix, so the prefix proves nothing.
+// The ?attachment= parameter in URLs we hand out picks which attachment's name is used.
+// The Content-Type is the one sniffed at upload, never derived from the file name.
+func (h *ApiHandler) DownloadLocalFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := GetUserIDFromContext(ctx)
 	if err != nil {
 		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
 		return
 	}
 
-	// Prepare attachment info for API response using AttachmentUrl field
-	var apiAttachmentInfos []models.AttachmentInfo
-	if todo.AttachmentUrl != nil && *todo.AttachmentUrl != "" {
-		apiAttachmentInfos = []models.AttachmentInfo{{FileId: *todo.AttachmentUrl}}
-	} else {
-		apiAttachmentInfos = []models.AttachmentInfo{}
+	fileServer, ok := h.services.Storage.(service.LocalFileServer)
+	if !ok {
+		SendJSONError(w, domain.ErrNotFound, http.StatusNotFound, h.logger)
+		return
 	}
 
-	apiTodo := mapDomainTodoToApi(todo, apiAttachmentInfos)
-	SendJSONResponse(w, http.StatusOK, apiTodo, h.logger)
+	storageID := chi.URLParam(r, "*")
+	var attachmentID *uuid.UUID
+	if raw := r.URL.Query().Get("attachment"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			SendJSONError(w, domain.ErrNotFound, http.StatusNotFound, h.logger)
+			return
+		}
+		attachmentID = &id
+	}
+
+	attachment, err := h.services.Todo.GetAttachmentByStorageID(ctx, userID, storageID, attachmentID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	file, info, err := fileServer.Open(ctx, storageID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	defer file.Close()
+
+	// Setting Content-Type first stops ServeContent from guessing it
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", service.ContentDisposition(attachment.ContentType, attachment.FileName))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(w, r, attachment.FileName, info.ModTime(), file)
 }
 
 // --- Subtask Handlers ---
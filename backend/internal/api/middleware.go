@@ -5,9 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"path"
+	"slices"
 	"strings"
 
+	"github.com/Sosokker/todolist-backend/internal/auth"
 	"github.com/Sosokker/todolist-backend/internal/config"
 	"github.com/Sosokker/todolist-backend/internal/domain"
 	"github.com/Sosokker/todolist-backend/internal/service"
@@ -19,10 +24,71 @@ type contextKey string
 const UserIDKey contextKey = "userID"
 
 var publicPaths = map[string]bool{
-	"/auth/signup":          true,
-	"/auth/login":           true,
-	"/auth/google/login":    true,
-	"/auth/google/callback": true,
+	"/auth/signup":                true,
+	"/auth/login":                 true,
+	"/auth/refresh":               true,
+	"/auth/mfa/verify":            true,
+	"/auth/webauthn/login/begin":  true,
+	"/auth/webauthn/login/finish": true,
+	"/auth/verify-email":          true,
+	"/auth/password/forgot":       true,
+	"/auth/password/reset":        true,
+	"/auth/providers":             true,
+}
+
+// publicPathPatterns are public routes with a path parameter, in path.Match syntax
+var publicPathPatterns = []string{
+	"/auth/*/login",    // External login, * is the provider
+	"/auth/*/callback", // Where the provider sends the browser back
+}
+
+// isPublicPath reports whether a path relative to the base path skips authentication
+func isPublicPath(relativePath string) bool {
+	if publicPaths[relativePath] {
+		return true
+	}
+	for _, pattern := range publicPathPatterns {
+		if ok, _ := path.Match(pattern, relativePath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// unverifiedPaths stay reachable for users who haven't verified their email when
+// email.requireVerified is set, so they can verify, see their account or log out
+var unverifiedPaths = map[string]bool{
+	"/users/me":                 true,
+	"/auth/logout":              true,
+	"/auth/logout-all":          true,
+	"/auth/verify-email/resend": true,
+}
+
+// apiTokenRoutes are the routes personal access tokens may use, by path prefix, with the scope
+// needed to read (GET, HEAD, OPTIONS) and to change anything. An empty scope, or a path not
+// listed, is off limits to API tokens, so a leaked one can't manage the account or mint more tokens.
+var apiTokenRoutes = []struct{ prefix, read, write string }{
+	{"/todos", domain.ScopeTodosRead, domain.ScopeTodosWrite}, // Includes subtasks, attachments and resumable uploads
+	{"/attachments", domain.ScopeTodosRead, domain.ScopeTodosWrite},
+	{"/files", domain.ScopeTodosRead, ""},
+	{"/tags", domain.ScopeTagsRead, domain.ScopeTagsWrite},
+	{"/users/me", domain.ScopeUserRead, ""},
+}
+
+// apiTokenScope returns the scope an API token needs for a request, or "" if API tokens can't make it
+func apiTokenScope(method, relativePath string) string {
+	for _, route := range apiTokenRoutes {
+		if relativePath != route.prefix && !strings.HasPrefix(relativePath, route.prefix+"/") {
+			continue
+		}
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return route.read
+		default:
+			return route.write
+		}
+	}
+	return ""
 }
 
 func AuthMiddleware(authService service.AuthService, cfg *config.Config) func(http.Handler) http.Handler {
@@ -32,7 +98,7 @@ func AuthMiddleware(authService service.AuthService, cfg *config.Config) func(ht
 			basePath := cfg.Server.BasePath
 			relativePath := strings.TrimPrefix(requestPath, basePath)
 
-			if _, isPublic := publicPaths[relativePath]; isPublic {
+			if isPublicPath(relativePath) {
 				slog.DebugContext(r.Context(), "Public path accessed, skipping auth", "path", requestPath)
 				next.ServeHTTP(w, r)
 				return
@@ -45,7 +111,15 @@ func AuthMiddleware(authService service.AuthService, cfg *config.Config) func(ht
 				return
 			}
 
-			claims, err := authService.ValidateJWT(tokenString)
+			// Personal access tokens work wherever JWTs do, within their scopes
+			var claims *domain.User
+			var apiToken *domain.APIToken
+			var err error
+			if auth.IsAPIToken(tokenString) {
+				claims, apiToken, err = authService.ValidateAPIToken(r.Context(), tokenString)
+			} else {
+				claims, err = authService.ValidateJWT(r.Context(), tokenString)
+			}
 			if err != nil {
 				slog.WarnContext(r.Context(), "Authentication failed: invalid token", "error", err, "path", requestPath)
 				SendJSONError(w, domain.ErrUnauthorized, http.StatusUnauthorized, slog.Default())
@@ -58,6 +132,26 @@ func AuthMiddleware(authService service.AuthService, cfg *config.Config) func(ht
 				return
 			}
 
+			if cfg.Email.RequireVerified && !claims.EmailVerified && !unverifiedPaths[relativePath] {
+				slog.WarnContext(r.Context(), "Access denied: email not verified", "userId", claims.ID, "path", requestPath)
+				SendJSONError(w, fmt.Errorf("verify your email address first: %w", domain.ErrForbidden), http.StatusForbidden, slog.Default())
+				return
+			}
+
+			if apiToken != nil {
+				scope := apiTokenScope(r.Method, relativePath)
+				if scope == "" {
+					slog.WarnContext(r.Context(), "Access denied: route not available to api tokens", "userId", claims.ID, "tokenId", apiToken.ID, "path", requestPath)
+					SendJSONError(w, fmt.Errorf("this endpoint can't be used with an api token: %w", domain.ErrForbidden), http.StatusForbidden, slog.Default())
+					return
+				}
+				if !slices.Contains(apiToken.Scopes, scope) {
+					slog.WarnContext(r.Context(), "Access denied: api token lacks scope", "userId", claims.ID, "tokenId", apiToken.ID, "scope", scope, "path", requestPath)
+					SendJSONError(w, fmt.Errorf("api token lacks the %s scope: %w", scope, domain.ErrForbidden), http.StatusForbidden, slog.Default())
+					return
+				}
+			}
+
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.ID)
 			slog.DebugContext(ctx, "Authentication successful", "userId", claims.ID)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -65,6 +159,85 @@ func AuthMiddleware(authService service.AuthService, cfg *config.Config) func(ht
 	}
 }
 
+// RealIPMiddleware replaces RemoteAddr with the client address a trusted reverse proxy
+// forwarded. X-Forwarded-For and X-Real-IP are only believed from a peer in trustedProxies
+// (addresses or CIDR ranges); anyone else could set them to dodge per-address throttling.
+// X-Forwarded-For is read from the right, skipping trusted proxies, since a client can put
+// anything at the left end.
+func RealIPMiddleware(trustedProxies []string) (func(http.Handler) http.Handler, error) {
+	trusted := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := parseTrustedProxy(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("server.trustedProxies: %q is not an address or CIDR range", proxy)
+		}
+		trusted = append(trusted, prefix)
+	}
+	isTrusted := func(addr netip.Addr) bool {
+		return slices.ContainsFunc(trusted, func(p netip.Prefix) bool { return p.Contains(addr) })
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer, err := netip.ParseAddr(clientIP(r)); err == nil && isTrusted(peer.Unmap()) {
+				if client, ok := forwardedClientIP(r, isTrusted); ok {
+					r.RemoteAddr = client.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func parseTrustedProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// forwardedClientIP returns the first address in X-Forwarded-For, from the right, that isn't
+// a trusted proxy, or X-Real-IP when there's no X-Forwarded-For. A hop that doesn't parse ends
+// the walk at the last good one, nothing left of it can be vouched for.
+func forwardedClientIP(r *http.Request, isTrusted func(netip.Addr) bool) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+		return addr.Unmap(), err == nil
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !isTrusted(client) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+// clientIP is the caller's address without the port. RealIPMiddleware has already replaced
+// RemoteAddr with the forwarded address when the request came through a trusted proxy.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
 func extractToken(r *http.Request, cfg *config.Config) string {
 	bearerToken := r.Header.Get("Authorization")
 	if parts := strings.Split(bearerToken, " "); len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
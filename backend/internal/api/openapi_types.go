@@ -14,6 +14,13 @@ const (
 	CookieAuthScopes = "CookieAuth.Scopes"
 )
 
+// Defines values for AttachmentInfoScanStatus.
+const (
+	Clean      AttachmentInfoScanStatus = "clean"
+	NotScanned AttachmentInfoScanStatus = "not_scanned"
+	ScanFailed AttachmentInfoScanStatus = "scan_failed"
+)
+
 // Defines values for CreateTodoRequestStatus.
 const (
 	CreateTodoRequestStatusCompleted  CreateTodoRequestStatus = "completed"
@@ -42,22 +49,95 @@ const (
 	ListTodosParamsStatusPending    ListTodosParamsStatus = "pending"
 )
 
+// ApiToken A personal access token. The token itself is only shown when it's created.
+type ApiToken struct {
+	CreatedAt time.Time `json:"createdAt"`
+
+	// ExpiresAt Null for tokens that don't expire.
+	ExpiresAt *time.Time         `json:"expiresAt"`
+	Id        openapi_types.UUID `json:"id"`
+
+	// LastUsedAt Updated at most once a minute.
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+}
+
 // AttachmentInfo Metadata about an uploaded attachment.
 type AttachmentInfo struct {
 	// ContentType MIME type of the uploaded file.
 	ContentType string `json:"contentType"`
 
-	// FileId Unique storage identifier/path for the file (used for deletion).
-	FileId string `json:"fileId"`
+	// FileId Unique identifier of the attachment (used for deletion).
+	FileId openapi_types.UUID `json:"fileId"`
 
 	// FileName Original name of the uploaded file.
 	FileName string `json:"fileName"`
 
-	// FileUrl URL to access the uploaded file (e.g., a signed GCS URL).
+	// FileUrl Short-lived URL to access the uploaded file, minted for this response (e.g., a signed GCS URL). Use `/attachments/{attachmentId}/download` for a link that doesn't expire.
 	FileUrl string `json:"fileUrl"`
 
+	// ScanStatus Malware scan verdict. Infected uploads are rejected, so they never appear here. `scan_failed` means the scanner was unavailable and the server is configured to accept files anyway.
+	ScanStatus AttachmentInfoScanStatus `json:"scanStatus"`
+
 	// Size Size of the uploaded file in bytes.
 	Size int64 `json:"size"`
+
+	// ThumbnailLargeUrl Short-lived URL of a 256px preview. Only set for image attachments.
+	ThumbnailLargeUrl *string `json:"thumbnailLargeUrl"`
+
+	// ThumbnailSmallUrl Short-lived URL of a 64px preview. Only set for image attachments.
+	ThumbnailSmallUrl *string `json:"thumbnailSmallUrl"`
+
+	// UploadedAt When the file was uploaded.
+	UploadedAt time.Time `json:"uploadedAt"`
+}
+
+// AttachmentInfoScanStatus Malware scan verdict. Infected uploads are rejected, so they never appear here. `scan_failed` means the scanner was unavailable and the server is configured to accept files anyway.
+type AttachmentInfoScanStatus string
+
+// AuthenticationCredential The PublicKeyCredential from navigator.credentials.get(), as produced by toJSON().
+type AuthenticationCredential struct {
+	Id       string                         `json:"id"`
+	RawId    *string                        `json:"rawId,omitempty"`
+	Response AuthenticatorAssertionResponse `json:"response"`
+	Type     string                         `json:"type"`
+}
+
+// AuthenticatorAssertionResponse defines model for AuthenticatorAssertionResponse.
+type AuthenticatorAssertionResponse struct {
+	AuthenticatorData string  `json:"authenticatorData"`
+	ClientDataJSON    string  `json:"clientDataJSON"`
+	Signature         string  `json:"signature"`
+	UserHandle        *string `json:"userHandle"`
+}
+
+// AuthenticatorAttestationResponse defines model for AuthenticatorAttestationResponse.
+type AuthenticatorAttestationResponse struct {
+	AttestationObject string `json:"attestationObject"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+}
+
+// AuthenticatorSelectionCriteria defines model for AuthenticatorSelectionCriteria.
+type AuthenticatorSelectionCriteria struct {
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	ResidentKey        string `json:"residentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// ConfirmOAuthLinkRequest Token from the fragment of the /oauth/link redirect.
+type ConfirmOAuthLinkRequest struct {
+	LinkToken string `json:"linkToken"`
+}
+
+// CreateApiTokenRequest A token to create for a script or integration.
+type CreateApiTokenRequest struct {
+	// ExpiresAt Omit for a token that works until it's revoked.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Name      string     `json:"name"`
+
+	// Scopes What the token may do: todos:read, todos:write, tags:read, tags:write, user:read. Todo scopes cover subtasks and attachments.
+	Scopes []string `json:"scopes"`
 }
 
 // CreateSubtaskRequest Data required to create a new Subtask.
@@ -91,6 +171,23 @@ type CreateTodoRequest struct {
 // CreateTodoRequestStatus defines model for CreateTodoRequest.Status.
 type CreateTodoRequestStatus string
 
+// CreatedApiToken defines model for CreatedApiToken.
+type CreatedApiToken struct {
+	CreatedAt time.Time `json:"createdAt"`
+
+	// ExpiresAt Null for tokens that don't expire.
+	ExpiresAt *time.Time         `json:"expiresAt"`
+	Id        openapi_types.UUID `json:"id"`
+
+	// LastUsedAt Updated at most once a minute.
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+
+	// Token Send as `Authorization: Bearer <token>`. It can't be shown again.
+	Token string `json:"token"`
+}
+
 // Error Standard error response format.
 type Error struct {
 	// Code HTTP status code or application-specific code.
@@ -103,6 +200,11 @@ type Error struct {
 // FileUploadResponse Metadata about an uploaded attachment.
 type FileUploadResponse = AttachmentInfo
 
+// ForgotPasswordRequest Address of the account whose password was forgotten.
+type ForgotPasswordRequest struct {
+	Email openapi_types.Email `json:"email"`
+}
+
 // LoginRequest Data required for logging in via email/password.
 type LoginRequest struct {
 	Email    openapi_types.Email `json:"email"`
@@ -114,10 +216,145 @@ type LoginResponse struct {
 	// AccessToken JWT access token.
 	AccessToken string `json:"accessToken"`
 
+	// ExpiresIn Seconds until the access token expires.
+	ExpiresIn int64 `json:"expiresIn"`
+
+	// RefreshToken Opaque refresh token, exchanged once at /auth/refresh for a new pair. Browser clients also get it in an HTTP-only cookie scoped to /auth.
+	RefreshToken string `json:"refreshToken"`
+
 	// TokenType Type of the token (always Bearer).
 	TokenType string `json:"tokenType"`
 }
 
+// MfaChallengeResponse Returned by /auth/login instead of tokens when the user has two-factor authentication. Send the token with a code to /auth/mfa/verify to finish logging in.
+type MfaChallengeResponse struct {
+	// ExpiresIn Seconds left to enter the code.
+	ExpiresIn int64  `json:"expiresIn"`
+	MfaToken  string `json:"mfaToken"`
+}
+
+// MfaCodeRequest Proof of the second factor for changing two-factor settings.
+type MfaCodeRequest struct {
+	// Code Six-digit code from the authenticator app or, except when confirming one, an unused recovery code.
+	Code string `json:"code"`
+}
+
+// MfaStatus defines model for MfaStatus.
+type MfaStatus struct {
+	RecoveryCodesLeft int `json:"recoveryCodesLeft"`
+
+	// TotpEnabled Whether logins need a code from an authenticator app.
+	TotpEnabled bool `json:"totpEnabled"`
+}
+
+// MfaVerifyRequest defines model for MfaVerifyRequest.
+type MfaVerifyRequest struct {
+	// Code Six-digit code from the authenticator app, or an unused recovery code.
+	Code string `json:"code"`
+
+	// MfaToken From the login response.
+	MfaToken string `json:"mfaToken"`
+}
+
+// OAuthLinkStart Send the browser to authorizationUrl; the provider redirects back to /auth/{provider}/callback, which finishes at <frontend>/oauth/link.
+type OAuthLinkStart struct {
+	AuthorizationUrl string `json:"authorizationUrl"`
+}
+
+// OAuthProvider An external login provider.
+type OAuthProvider struct {
+	// Id Key of the provider in /auth/{provider}/login.
+	Id string `json:"id"`
+
+	// Name Display name of the provider.
+	Name string `json:"name"`
+}
+
+// PublicKeyCredentialCreationOptions defines model for PublicKeyCredentialCreationOptions.
+type PublicKeyCredentialCreationOptions struct {
+	// Attestation Always `none`; attestation statements aren't checked.
+	Attestation            string                         `json:"attestation"`
+	AuthenticatorSelection AuthenticatorSelectionCriteria `json:"authenticatorSelection"`
+	Challenge              string                         `json:"challenge"`
+
+	// ExcludeCredentials Passkeys the user already has, so the same authenticator isn't registered twice.
+	ExcludeCredentials []PublicKeyCredentialDescriptor `json:"excludeCredentials"`
+	PubKeyCredParams   []PublicKeyCredentialParameters `json:"pubKeyCredParams"`
+	Rp                 PublicKeyCredentialRpEntity     `json:"rp"`
+
+	// Timeout Milliseconds.
+	Timeout int64                         `json:"timeout"`
+	User    PublicKeyCredentialUserEntity `json:"user"`
+}
+
+// PublicKeyCredentialDescriptor defines model for PublicKeyCredentialDescriptor.
+type PublicKeyCredentialDescriptor struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// PublicKeyCredentialParameters defines model for PublicKeyCredentialParameters.
+type PublicKeyCredentialParameters struct {
+	// Alg COSE algorithm identifier (-7 ES256, -8 EdDSA, -257 RS256).
+	Alg  int64  `json:"alg"`
+	Type string `json:"type"`
+}
+
+// PublicKeyCredentialRequestOptions No credentials are listed; the authenticator offers the passkeys it holds for the site.
+type PublicKeyCredentialRequestOptions struct {
+	AllowCredentials []PublicKeyCredentialDescriptor `json:"allowCredentials"`
+	Challenge        string                          `json:"challenge"`
+	RpId             string                          `json:"rpId"`
+
+	// Timeout Milliseconds.
+	Timeout          int64  `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+// PublicKeyCredentialRpEntity defines model for PublicKeyCredentialRpEntity.
+type PublicKeyCredentialRpEntity struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PublicKeyCredentialUserEntity defines model for PublicKeyCredentialUserEntity.
+type PublicKeyCredentialUserEntity struct {
+	DisplayName string `json:"displayName"`
+
+	// Id The user's UUID as 16 bytes. Authenticators return it as the userHandle when logging in.
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RecoveryCodes Single-use codes that stand in for the authenticator app. They're only shown this once.
+type RecoveryCodes struct {
+	Codes []string `json:"codes"`
+}
+
+// RefreshRequest Refresh token for API clients. Browser clients can send an empty body and rely on the refresh cookie.
+type RefreshRequest struct {
+	RefreshToken *string `json:"refreshToken,omitempty"`
+}
+
+// VerifyEmailRequest Token from the link in the verification email.
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// RegistrationCredential The PublicKeyCredential from navigator.credentials.create(), as produced by toJSON().
+type RegistrationCredential struct {
+	Id       string                           `json:"id"`
+	RawId    *string                          `json:"rawId,omitempty"`
+	Response AuthenticatorAttestationResponse `json:"response"`
+	Type     string                           `json:"type"`
+}
+
+// ResetPasswordRequest Token from the link in the password reset email and the new password.
+type ResetPasswordRequest struct {
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
 // SignupRequest Data required for signing up a new user via email/password.
 type SignupRequest struct {
 	Email    openapi_types.Email `json:"email"`
@@ -125,6 +362,18 @@ type SignupRequest struct {
 	Username string              `json:"username"`
 }
 
+// StorageUsage Attachment storage used by the current user and the limits that apply. Only returned by /users/me.
+type StorageUsage struct {
+	// MaxUploadSize Largest single attachment the user may upload, in bytes.
+	MaxUploadSize int64 `json:"maxUploadSize"`
+
+	// QuotaBytes Total attachment bytes the user may store. Omitted when there is no quota.
+	QuotaBytes *int64 `json:"quotaBytes,omitempty"`
+
+	// UsedBytes Total size of the user's attachments.
+	UsedBytes int64 `json:"usedBytes"`
+}
+
 // Subtask Represents a subtask associated with a Todo item.
 type Subtask struct {
 	// Completed Whether the subtask is completed.
@@ -158,10 +407,21 @@ type Tag struct {
 	UserId *openapi_types.UUID `json:"userId,omitempty"`
 }
 
+// TotpEnrollment What an authenticator app needs. Show otpauthUri as a QR code, or the secret for typing in by hand.
+type TotpEnrollment struct {
+	// OtpauthUri otpauth://totp/ provisioning URI (6 digits, 30 second period, SHA-1).
+	OtpauthUri string `json:"otpauthUri"`
+
+	// Secret Base32 secret.
+	Secret string `json:"secret"`
+}
+
 // Todo Represents a Todo item.
 type Todo struct {
-	// AttachmentUrl Publicly accessible URL of the attached image, if any.
+	// AttachmentUrl URL of the most recently uploaded image attachment, if any. Use `attachments` instead.
+	// Deprecated:
 	AttachmentUrl *string              `json:"attachmentUrl"`
+	Attachments   *[]AttachmentInfo    `json:"attachments,omitempty"`
 	CreatedAt     *time.Time           `json:"createdAt,omitempty"`
 	Deadline      *time.Time           `json:"deadline"`
 	Description   *string              `json:"description"`
@@ -220,8 +480,69 @@ type User struct {
 	// EmailVerified Indicates if the user's email has been verified (e.g., via OAuth or email confirmation).
 	EmailVerified *bool               `json:"emailVerified,omitempty"`
 	Id            *openapi_types.UUID `json:"id,omitempty"`
-	UpdatedAt     *time.Time          `json:"updatedAt,omitempty"`
-	Username      string              `json:"username"`
+
+	// Identities External accounts linked to the user. Only returned by /users/me.
+	Identities *[]UserIdentity `json:"identities,omitempty"`
+
+	// Storage Attachment storage used by the current user and the limits that apply. Only returned by /users/me.
+	Storage   *StorageUsage `json:"storage,omitempty"`
+	UpdatedAt *time.Time    `json:"updatedAt,omitempty"`
+	Username  string        `json:"username"`
+}
+
+// UserIdentity An account at an external provider that logs in as the current user.
+type UserIdentity struct {
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Email Address the provider last reported for the account.
+	Email       *string            `json:"email"`
+	Id          openapi_types.UUID `json:"id"`
+	LastLoginAt *time.Time         `json:"lastLoginAt"`
+
+	// Provider Key of the provider, as in /auth/providers.
+	Provider string `json:"provider"`
+}
+
+// WebauthnCredential A passkey registered to the current user.
+type WebauthnCredential struct {
+	CreatedAt  time.Time          `json:"createdAt"`
+	Id         openapi_types.UUID `json:"id"`
+	LastUsedAt *time.Time         `json:"lastUsedAt"`
+	Name       string             `json:"name"`
+}
+
+// WebauthnLoginOptions Options for navigator.credentials.get(). Send the authenticator's response with the session token to /auth/webauthn/login/finish before it expires (`webauthn.timeout`).
+type WebauthnLoginOptions struct {
+	// PublicKey No credentials are listed; the authenticator offers the passkeys it holds for the site.
+	PublicKey    PublicKeyCredentialRequestOptions `json:"publicKey"`
+	SessionToken string                            `json:"sessionToken"`
+}
+
+// WebauthnLoginRequest defines model for WebauthnLoginRequest.
+type WebauthnLoginRequest struct {
+	// Credential The PublicKeyCredential from navigator.credentials.get(), as produced by toJSON().
+	Credential AuthenticationCredential `json:"credential"`
+
+	// SessionToken From /auth/webauthn/login/begin.
+	SessionToken string `json:"sessionToken"`
+}
+
+// WebauthnRegistrationOptions Options for navigator.credentials.create(). Send the authenticator's response with the session token to /auth/webauthn/register/finish before it expires (`webauthn.timeout`).
+type WebauthnRegistrationOptions struct {
+	PublicKey    PublicKeyCredentialCreationOptions `json:"publicKey"`
+	SessionToken string                             `json:"sessionToken"`
+}
+
+// WebauthnRegistrationRequest defines model for WebauthnRegistrationRequest.
+type WebauthnRegistrationRequest struct {
+	// Credential The PublicKeyCredential from navigator.credentials.create(), as produced by toJSON().
+	Credential RegistrationCredential `json:"credential"`
+
+	// Name Label for telling passkeys apart. Defaults to "Passkey".
+	Name *string `json:"name,omitempty"`
+
+	// SessionToken From /auth/webauthn/register/begin.
+	SessionToken string `json:"sessionToken"`
 }
 
 // BadRequest Standard error response format.
@@ -236,9 +557,15 @@ type Forbidden = Error
 // InternalServerError Standard error response format.
 type InternalServerError = Error
 
+// MalwareDetected Standard error response format.
+type MalwareDetected = Error
+
 // NotFound Standard error response format.
 type NotFound = Error
 
+// PayloadTooLarge Standard error response format.
+type PayloadTooLarge = Error
+
 // Unauthorized Standard error response format.
 type Unauthorized = Error
 
@@ -253,17 +580,56 @@ type ListTodosParams struct {
 // ListTodosParamsStatus defines parameters for ListTodos.
 type ListTodosParamsStatus string
 
-// UploadOrReplaceTodoAttachmentMultipartBody defines parameters for UploadOrReplaceTodoAttachment.
-type UploadOrReplaceTodoAttachmentMultipartBody struct {
+// UploadTodoAttachmentMultipartBody defines parameters for UploadTodoAttachment.
+type UploadTodoAttachmentMultipartBody struct {
 	File openapi_types.File `json:"file"`
 }
 
+// ConfirmOAuthLinkJSONRequestBody defines body for ConfirmOAuthLink for application/json ContentType.
+type ConfirmOAuthLinkJSONRequestBody = ConfirmOAuthLinkRequest
+
 // LoginUserApiJSONRequestBody defines body for LoginUserApi for application/json ContentType.
 type LoginUserApiJSONRequestBody = LoginRequest
 
+// LogoutUserJSONRequestBody defines body for LogoutUser for application/json ContentType.
+type LogoutUserJSONRequestBody = RefreshRequest
+
+// RegenerateRecoveryCodesJSONRequestBody defines body for RegenerateRecoveryCodes for application/json ContentType.
+type RegenerateRecoveryCodesJSONRequestBody = MfaCodeRequest
+
+// DisableTotpJSONRequestBody defines body for DisableTotp for application/json ContentType.
+type DisableTotpJSONRequestBody = MfaCodeRequest
+
+// ConfirmTotpJSONRequestBody defines body for ConfirmTotp for application/json ContentType.
+type ConfirmTotpJSONRequestBody = MfaCodeRequest
+
+// VerifyMfaJSONRequestBody defines body for VerifyMfa for application/json ContentType.
+type VerifyMfaJSONRequestBody = MfaVerifyRequest
+
+// ForgotPasswordJSONRequestBody defines body for ForgotPassword for application/json ContentType.
+type ForgotPasswordJSONRequestBody = ForgotPasswordRequest
+
+// ResetPasswordJSONRequestBody defines body for ResetPassword for application/json ContentType.
+type ResetPasswordJSONRequestBody = ResetPasswordRequest
+
+// RefreshTokensJSONRequestBody defines body for RefreshTokens for application/json ContentType.
+type RefreshTokensJSONRequestBody = RefreshRequest
+
+// CreateApiTokenJSONRequestBody defines body for CreateApiToken for application/json ContentType.
+type CreateApiTokenJSONRequestBody = CreateApiTokenRequest
+
+// VerifyEmailJSONRequestBody defines body for VerifyEmail for application/json ContentType.
+type VerifyEmailJSONRequestBody = VerifyEmailRequest
+
 // SignupUserApiJSONRequestBody defines body for SignupUserApi for application/json ContentType.
 type SignupUserApiJSONRequestBody = SignupRequest
 
+// FinishWebauthnLoginJSONRequestBody defines body for FinishWebauthnLogin for application/json ContentType.
+type FinishWebauthnLoginJSONRequestBody = WebauthnLoginRequest
+
+// FinishWebauthnRegistrationJSONRequestBody defines body for FinishWebauthnRegistration for application/json ContentType.
+type FinishWebauthnRegistrationJSONRequestBody = WebauthnRegistrationRequest
+
 // CreateTagJSONRequestBody defines body for CreateTag for application/json ContentType.
 type CreateTagJSONRequestBody = CreateTagRequest
 
@@ -276,8 +642,8 @@ type CreateTodoJSONRequestBody = CreateTodoRequest
 // UpdateTodoByIdJSONRequestBody defines body for UpdateTodoById for application/json ContentType.
 type UpdateTodoByIdJSONRequestBody = UpdateTodoRequest
 
-// UploadOrReplaceTodoAttachmentMultipartRequestBody defines body for UploadOrReplaceTodoAttachment for multipart/form-data ContentType.
-type UploadOrReplaceTodoAttachmentMultipartRequestBody UploadOrReplaceTodoAttachmentMultipartBody
+// UploadTodoAttachmentMultipartRequestBody defines body for UploadTodoAttachment for multipart/form-data ContentType.
+type UploadTodoAttachmentMultipartRequestBody UploadTodoAttachmentMultipartBody
 
 // CreateSubtaskForTodoJSONRequestBody defines body for CreateSubtaskForTodo for application/json ContentType.
 type CreateSubtaskForTodoJSONRequestBody = CreateSubtaskRequest
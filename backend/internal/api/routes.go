@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RegisterRoutes mounts every API route under cfg.Server.BasePath, and the JWK set at the
+// root. The server and the tests both go through it, so they can't drift apart.
+func (h *ApiHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/.well-known/jwks.json", h.GetJWKS)
+
+	r.Route(h.cfg.Server.BasePath, func(subr chi.Router) {
+		subr.Post("/auth/signup", h.SignupUserApi)
+		subr.Post("/auth/login", h.LoginUserApi)
+		subr.Post("/auth/refresh", h.RefreshTokens)
+		subr.Post("/auth/mfa/verify", h.VerifyMfa)
+		subr.Post("/auth/webauthn/login/begin", h.BeginWebauthnLogin)
+		subr.Post("/auth/webauthn/login/finish", h.FinishWebauthnLogin)
+		subr.Post("/auth/verify-email", h.VerifyEmail)
+		subr.Post("/auth/password/forgot", h.ForgotPassword)
+		subr.Post("/auth/password/reset", h.ResetPassword)
+		subr.Get("/auth/providers", h.ListOAuthProviders)
+		subr.Get("/auth/{provider}/login", func(w http.ResponseWriter, r *http.Request) {
+			h.InitiateOAuthLogin(w, r, chi.URLParam(r, "provider"))
+		})
+		subr.Get("/auth/{provider}/callback", func(w http.ResponseWriter, r *http.Request) {
+			h.HandleOAuthCallback(w, r, chi.URLParam(r, "provider"))
+		})
+
+		subr.Group(func(prot chi.Router) {
+			prot.Use(AuthMiddleware(h.services.Auth, h.cfg))
+			prot.Get("/files/*", h.DownloadLocalFile)
+			prot.Route("/todos/{todoId}/attachments/uploads", func(tus chi.Router) {
+				tus.Use(TusMiddleware)
+				tus.Options("/", h.TusOptions)
+				tus.Post("/", h.TusCreateUpload)
+				tus.Head("/{uploadId}", h.TusGetUpload)
+				tus.Patch("/{uploadId}", h.TusPatchUpload)
+				tus.Delete("/{uploadId}", h.TusDeleteUpload)
+			})
+			HandlerFromMux(h, prot)
+		})
+	})
+}
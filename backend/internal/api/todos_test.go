@@ -0,0 +1,132 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Sosokker/todolist-backend/internal/api/models"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+func TestTodoLifecycle(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+
+	var tag models.Tag
+	s.doJSON(http.MethodPost, "/tags", token, models.CreateTagRequest{Name: "work"}, http.StatusCreated, &tag)
+	s.doJSON(http.MethodPost, "/tags", token, models.CreateTagRequest{Name: "work"}, http.StatusConflict, nil)
+
+	tagIDs := []openapi_types.UUID{*tag.Id}
+	var tagged models.Todo
+	s.doJSON(http.MethodPost, "/todos", token, models.CreateTodoRequest{Title: "Write report", TagIds: &tagIDs}, http.StatusCreated, &tagged)
+	if tagged.Status != models.TodoStatusPending {
+		t.Fatalf("got status %q, want pending", tagged.Status)
+	}
+	if len(tagged.TagIds) != 1 || tagged.TagIds[0] != *tag.Id {
+		t.Fatalf("got tags %v, want [%s]", tagged.TagIds, *tag.Id)
+	}
+	untagged := s.createTodo(token, "Buy milk")
+
+	var all []models.Todo
+	s.doJSON(http.MethodGet, "/todos", token, nil, http.StatusOK, &all)
+	if len(all) != 2 || *all[0].Id != *untagged.Id {
+		t.Fatalf("got %d todos, want 2 newest first", len(all))
+	}
+
+	var byTag []models.Todo
+	s.doJSON(http.MethodGet, "/todos?tagId="+tag.Id.String(), token, nil, http.StatusOK, &byTag)
+	if len(byTag) != 1 || *byTag[0].Id != *tagged.Id {
+		t.Fatalf("got %d todos for tag, want only %s", len(byTag), *tagged.Id)
+	}
+
+	completed := models.UpdateTodoRequestStatusCompleted
+	var updated models.Todo
+	s.doJSON(http.MethodPatch, "/todos/"+tagged.Id.String(), token, models.UpdateTodoRequest{Status: &completed}, http.StatusOK, &updated)
+	if updated.Status != models.TodoStatusCompleted || updated.Title != "Write report" {
+		t.Fatalf("got %q (%s), want completed todo with unchanged title", updated.Title, updated.Status)
+	}
+
+	var done []models.Todo
+	s.doJSON(http.MethodGet, "/todos?status=completed", token, nil, http.StatusOK, &done)
+	if len(done) != 1 || *done[0].Id != *tagged.Id {
+		t.Fatalf("got %d completed todos, want 1", len(done))
+	}
+
+	// Deleting the tag drops it from the todo
+	s.doJSON(http.MethodDelete, "/tags/"+tag.Id.String(), token, nil, http.StatusNoContent, nil)
+	var fetched models.Todo
+	s.doJSON(http.MethodGet, "/todos/"+tagged.Id.String(), token, nil, http.StatusOK, &fetched)
+	if len(fetched.TagIds) != 0 {
+		t.Fatalf("got tags %v after deleting the tag, want none", fetched.TagIds)
+	}
+
+	s.doJSON(http.MethodDelete, "/todos/"+tagged.Id.String(), token, nil, http.StatusNoContent, nil)
+	s.doJSON(http.MethodGet, "/todos/"+tagged.Id.String(), token, nil, http.StatusNotFound, nil)
+}
+
+func TestTodoValidation(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+
+	s.doJSON(http.MethodPost, "/todos", token, models.CreateTodoRequest{Title: ""}, http.StatusBadRequest, nil)
+
+	other := s.signup("bob")
+	var tag models.Tag
+	s.doJSON(http.MethodPost, "/tags", other, models.CreateTagRequest{Name: "bobs"}, http.StatusCreated, &tag)
+	tagIDs := []openapi_types.UUID{*tag.Id}
+	s.doJSON(http.MethodPost, "/todos", token, models.CreateTodoRequest{Title: "Borrowed tag", TagIds: &tagIDs}, http.StatusBadRequest, nil)
+}
+
+func TestTodosAreIsolatedPerUser(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	alice := s.signup("alice")
+	bob := s.signup("bob")
+
+	todo := s.createTodo(alice, "Private")
+	path := "/todos/" + todo.Id.String()
+
+	s.doJSON(http.MethodGet, path, bob, nil, http.StatusNotFound, nil)
+	title := "Hijacked"
+	s.doJSON(http.MethodPatch, path, bob, models.UpdateTodoRequest{Title: &title}, http.StatusNotFound, nil)
+	s.doJSON(http.MethodDelete, path, bob, nil, http.StatusNotFound, nil)
+	s.doJSON(http.MethodPost, path+"/subtasks", bob, models.CreateSubtaskRequest{Description: "Sneaky"}, http.StatusNotFound, nil)
+
+	var bobs []models.Todo
+	s.doJSON(http.MethodGet, "/todos", bob, nil, http.StatusOK, &bobs)
+	if len(bobs) != 0 {
+		t.Fatalf("bob sees %d todos, want 0", len(bobs))
+	}
+	s.doJSON(http.MethodGet, path, alice, nil, http.StatusOK, nil)
+}
+
+func TestSubtasks(t *testing.T) {
+	s := newTestServer(t, serverOptions{})
+	token := s.signup("alice")
+	todo := s.createTodo(token, "Move house")
+	path := "/todos/" + todo.Id.String() + "/subtasks"
+
+	var first, second models.Subtask
+	s.doJSON(http.MethodPost, path, token, models.CreateSubtaskRequest{Description: "Pack"}, http.StatusCreated, &first)
+	s.doJSON(http.MethodPost, path, token, models.CreateSubtaskRequest{Description: "Drive"}, http.StatusCreated, &second)
+
+	completed := true
+	var updated models.Subtask
+	s.doJSON(http.MethodPatch, path+"/"+first.Id.String(), token, models.UpdateSubtaskRequest{Completed: &completed}, http.StatusOK, &updated)
+	if !updated.Completed || updated.Description != "Pack" {
+		t.Fatalf("got %+v, want completed subtask with unchanged description", updated)
+	}
+
+	s.doJSON(http.MethodDelete, path+"/"+second.Id.String(), token, nil, http.StatusNoContent, nil)
+
+	var subtasks []models.Subtask
+	s.doJSON(http.MethodGet, path, token, nil, http.StatusOK, &subtasks)
+	if len(subtasks) != 1 || *subtasks[0].Id != *first.Id {
+		t.Fatalf("got %d subtasks, want only %s", len(subtasks), *first.Id)
+	}
+
+	var fetched models.Todo
+	s.doJSON(http.MethodGet, "/todos/"+todo.Id.String(), token, nil, http.StatusOK, &fetched)
+	if fetched.Subtasks == nil || len(*fetched.Subtasks) != 1 {
+		t.Fatalf("todo carries %v subtasks, want 1", fetched.Subtasks)
+	}
+}
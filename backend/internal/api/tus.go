@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Sosokker/todolist-backend/internal/api/models"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Resumable attachment uploads following the tus 1.0 protocol (https://tus.io/protocols/resumable-upload).
+// Supported extensions: creation, termination and expiration. These routes sit outside
+// the OpenAPI spec because tus is driven by headers rather than JSON bodies.
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+)
+
+// TusMiddleware sets Tus-Resumable on every response and rejects requests made for
+// another protocol version. OPTIONS is exempt so clients can discover what is supported.
+func TusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated
+// "key base64value" pairs, where the value may be omitted.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q is not valid base64: %w", key, domain.ErrBadRequest)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func parseUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	id, err := uuid.Parse(chi.URLParam(r, name))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid %s: %w", name, domain.ErrBadRequest)
+	}
+	return id, nil
+}
+
+func setUploadExpires(w http.ResponseWriter, upload *domain.AttachmentUpload) {
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// TusOptions reports the protocol version, extensions and deployment-wide size limit
+func (h *ApiHandler) TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.cfg.Storage.MaxUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreateUpload starts an upload. The file name comes from the "filename"
+// (or "name") metadata key; Upload-Length is required.
+func (h *ApiHandler) TusCreateUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	todoID, err := parseUUIDParam(r, "todoId")
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		SendJSONError(w, fmt.Errorf("deferred upload length is not supported: %w", domain.ErrBadRequest), http.StatusBadRequest, h.logger)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		SendJSONError(w, fmt.Errorf("missing or invalid Upload-Length: %w", domain.ErrBadRequest), http.StatusBadRequest, h.logger)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+	fileName := metadata["filename"]
+	if fileName == "" {
+		fileName = metadata["name"]
+	}
+
+	upload, err := h.services.Upload.Create(r.Context(), todoID, userID, fileName, length)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+upload.ID.String())
+	setUploadExpires(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusGetUpload reports how many bytes have been received so a client can resume
+func (h *ApiHandler) TusGetUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	todoID, err := parseUUIDParam(r, "todoId")
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+	uploadID, err := parseUUIDParam(r, "uploadId")
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+
+	upload, err := h.services.Upload.Get(r.Context(), todoID, uploadID, userID)
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	setUploadExpires(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatchUpload appends the request body at Upload-Offset. When the last byte
+// arrives the file is committed as an attachment before responding.
+func (h *ApiHandler) TusPatchUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	todoID, err := parseUUIDParam(r, "todoId")
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+	uploadID, err := parseUUIDParam(r, "uploadId")
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != tusContentType {
+		SendJSONResponse(w, http.StatusUnsupportedMediaType, models.Error{
+			Code:    http.StatusUnsupportedMediaType,
+			Message: "Content-Type must be " + tusContentType,
+		}, h.logger)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		SendJSONError(w, fmt.Errorf("missing or invalid Upload-Offset: %w", domain.ErrBadRequest), http.StatusBadRequest, h.logger)
+		return
+	}
+
+	ctx, cancel := h.uploadContext(w, r)
+	defer cancel()
+
+	upload, _, err := h.services.Upload.WriteChunk(ctx, todoID, uploadID, userID, offset, r.Body)
+	if upload != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+
+	if !upload.Complete() {
+		setUploadExpires(w, upload)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusDeleteUpload abandons an upload and frees the staged bytes
+func (h *ApiHandler) TusDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	todoID, err := parseUUIDParam(r, "todoId")
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+	uploadID, err := parseUUIDParam(r, "uploadId")
+	if err != nil {
+		SendJSONError(w, err, http.StatusBadRequest, h.logger)
+		return
+	}
+
+	if err := h.services.Upload.Terminate(r.Context(), todoID, uploadID, userID); err != nil {
+		SendJSONError(w, err, http.StatusInternalServerError, h.logger)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
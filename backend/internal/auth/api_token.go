@@ -0,0 +1,12 @@
+package auth
+
+import "strings"
+
+// APITokenPrefix starts every personal access token, so the middleware can tell them from
+// JWTs without parsing, and secret scanners can recognize leaked ones
+const APITokenPrefix = "tdl_pat_"
+
+// IsAPIToken reports whether a bearer token is a personal access token rather than a JWT
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want any
+	}{
+		{"small uint", []byte{0x05}, int64(5)},
+		{"uint8", []byte{0x18, 0x64}, int64(100)},
+		{"uint16", []byte{0x19, 0x01, 0x00}, int64(256)},
+		{"uint32", []byte{0x1a, 0x00, 0x01, 0x00, 0x00}, int64(65536)},
+		{"negative", []byte{0x20}, int64(-1)},
+		{"negative uint16", []byte{0x39, 0x01, 0x00}, int64(-257)},
+		{"byte string", []byte{0x43, 'a', 'b', 'c'}, []byte("abc")},
+		{"empty byte string", []byte{0x40}, []byte{}},
+		{"text string", []byte{0x63, 'a', 'b', 'c'}, "abc"},
+		{"array", []byte{0x82, 0x01, 0x20}, []any{int64(1), int64(-1)}},
+		{"map", []byte{0xa2, 0x01, 0x02, 0x61, 'k', 0xf5}, map[any]any{int64(1): int64(2), "k": true}},
+		{"tag", []byte{0xc2, 0x41, 0xff}, []byte{0xff}},
+		{"false", []byte{0xf4}, false},
+		{"null", []byte{0xf6}, nil},
+		{"float32", []byte{0xfa, 0x3f, 0xc0, 0x00, 0x00}, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := decodeCBOR(tt.data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+			if len(rest) != 0 {
+				t.Fatalf("got %d bytes left over, want none", len(rest))
+			}
+		})
+	}
+}
+
+func TestDecodeCBORReturnsTrailingBytes(t *testing.T) {
+	got, rest, err := decodeCBOR([]byte{0x41, 0x01, 0x02, 0x03})
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, []byte{0x01}) || !reflect.DeepEqual(rest, []byte{0x02, 0x03}) {
+		t.Fatalf("got %#v with %#v left over, want 0x01 with 0x0203", got, rest)
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"empty", nil, "unexpected end"},
+		{"truncated uint16 argument", []byte{0x19, 0x01}, "unexpected end"},
+		{"truncated uint64 argument", []byte{0x1b, 0x00, 0x00, 0x00}, "unexpected end"},
+		{"byte string past the end", []byte{0x45, 'a', 'b'}, "unexpected end"},
+		{"text string past the end", []byte{0x78, 0x20, 'a'}, "unexpected end"},
+		{"array missing items", []byte{0x83, 0x01, 0x02}, "unexpected end"},
+		{"map missing a value", []byte{0xa1, 0x01}, "unexpected end"},
+		// Declared lengths far beyond the input fail before anything is allocated for them
+		{"oversized byte string", []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "unexpected end"},
+		{"oversized array", []byte{0x9a, 0xff, 0xff, 0xff, 0xff, 0x01}, "unexpected end"},
+		{"oversized map", []byte{0xbb, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, "unexpected end"},
+		{"uint overflowing int64", []byte{0x1b, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, "overflows int64"},
+		{"negative overflowing int64", []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "overflows int64"},
+		{"indefinite byte string", []byte{0x5f, 0x41, 0x01, 0xff}, "indefinite lengths"},
+		{"indefinite map", []byte{0xbf, 0x01, 0x02, 0xff}, "indefinite lengths"},
+		{"reserved additional info", []byte{0x1c}, "indefinite lengths"},
+		{"byte string map key", []byte{0xa1, 0x41, 0x01, 0x02}, "unsupported map key type"},
+		{"array map key", []byte{0xa1, 0x80, 0x02}, "unsupported map key type"},
+		{"unassigned simple value", []byte{0xf0}, "unsupported simple value"},
+		{"too deeply nested", []byte(strings.Repeat("\x81", cborMaxDepth+2) + "\x01"), "nested too deeply"},
+		{"tags nested too deeply", []byte(strings.Repeat("\xc0", cborMaxDepth+2) + "\x01"), "nested too deeply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := decodeCBOR(tt.data)
+			if err == nil {
+				t.Fatalf("got %#v, want an error", got)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %q, want one containing %q", err, tt.wantErr)
+			}
+			if tt.wantErr == "unexpected end" && !errors.Is(err, errCBORTruncated) {
+				t.Fatalf("got error %v, want errCBORTruncated", err)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORAcceptsMaximumDepth(t *testing.T) {
+	data := []byte(strings.Repeat("\x81", cborMaxDepth) + "\x01")
+	if _, _, err := decodeCBOR(data); err != nil {
+		t.Fatalf("decode %d nested arrays: %v", cborMaxDepth, err)
+	}
+}
@@ -5,7 +5,46 @@ import (
 	"github.com/google/uuid"
 )
 
+// Token purposes. Each kind of token is only accepted where its purpose is expected.
+const (
+	PurposeAccess = ""    // Access tokens predate the claim, so they leave it out
+	PurposeMFA    = "mfa" // Proves the password was checked; exchanged with a second factor for an access token
+
+	// WebAuthn ceremony state, handed to the client between begin and finish. Challenge holds the challenge.
+	PurposeWebAuthnRegister = "webauthn_register"
+	PurposeWebAuthnLogin    = "webauthn_login"
+
+	// Linking an external account. The link intent rides in a cookie from the start of the flow to the
+	// provider's callback; the pending link goes to the frontend, which confirms it as the same user.
+	PurposeOAuthLink        = "oauth_link"
+	PurposeOAuthLinkPending = "oauth_link_pending"
+)
+
+// AccessTokenType is the typ header of access tokens (RFC 9068). The backend's other tokens
+// have none, so a verifier checking typ can't take them for access tokens either.
+const AccessTokenType = "at+jwt"
+
+// Audience is the aud claim of a token with the given purpose. Access tokens are for the
+// configured audience itself; every other purpose gets a suffixed one nobody else accepts.
+func Audience(audience, purpose string) string {
+	if purpose == PurposeAccess {
+		return audience
+	}
+	return audience + ":" + purpose
+}
+
+// Claims are the access token's claims. RegisteredClaims.ID is the jti, which
+// single tokens are revoked by.
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	TokenVersion int32     `json:"ver"` // Must match the user's token_version
+	Purpose      string    `json:"purpose,omitempty"`
+	Challenge    string    `json:"challenge,omitempty"` // Base64url, only in WebAuthn ceremony tokens
+
+	// Only in account linking tokens
+	Provider        string `json:"provider,omitempty"`
+	State           string `json:"state,omitempty"`     // The OAuth state of the flow a link intent belongs to
+	ExternalSubject string `json:"ext_sub,omitempty"`   // The account being linked, in pending links
+	ExternalEmail   string `json:"ext_email,omitempty"` // Shown to the user when confirming
 	jwt.RegisteredClaims
 }
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys
+const minRSAKeyBits = 2048
+
+// jwtKey is one key from jwt.keys
+type jwtKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer // nil for keys that only verify
+	public  crypto.PublicKey
+}
+
+// JWTKeys signs the backend's JWTs and verifies them. Tokens signed with an asymmetric
+// key carry its ID in the kid header; HS256 tokens signed with jwt.secret have none.
+type JWTKeys struct {
+	signing *jwtKey // nil signs with the secret
+	secret  []byte  // nil when HS256 tokens aren't accepted
+	keys    map[string]*jwtKey
+	order   []string // Key IDs in config order, for the JWK set
+}
+
+// NewJWTKeys loads jwt.keys. It fails on unreadable or weak keys, duplicate IDs, and a
+// signingKey that isn't one of the keys or has no private key.
+func NewJWTKeys(cfg config.JWTConfig) (*JWTKeys, error) {
+	k := &JWTKeys{keys: make(map[string]*jwtKey, len(cfg.Keys))}
+	for i, keyCfg := range cfg.Keys {
+		key, err := loadJWTKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.keys[%d]: %w", i, err)
+		}
+		if _, ok := k.keys[key.id]; ok {
+			return nil, fmt.Errorf("jwt.keys[%d]: duplicate id %q", i, key.id)
+		}
+		k.keys[key.id] = key
+		k.order = append(k.order, key.id)
+	}
+
+	if cfg.SigningKey == "" {
+		k.secret = []byte(cfg.Secret)
+		return k, nil
+	}
+	signing, ok := k.keys[cfg.SigningKey]
+	if !ok {
+		return nil, fmt.Errorf("jwt.signingKey: no key with id %q", cfg.SigningKey)
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("jwt.signingKey: key %q has no private key", cfg.SigningKey)
+	}
+	k.signing = signing
+	if cfg.AcceptSecret && cfg.Secret != "" {
+		k.secret = []byte(cfg.Secret)
+	}
+	return k, nil
+}
+
+func loadJWTKey(cfg config.JWTKeyConfig) (*jwtKey, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	key := &jwtKey{id: cfg.ID}
+	switch cfg.Algorithm {
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, want RS256 or EdDSA", cfg.Algorithm)
+	}
+
+	privatePEM, err := pemSetting(cfg.PrivateKey, cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := pemSetting(cfg.PublicKey, cfg.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case privatePEM != nil && publicPEM != nil:
+		return nil, errors.New("set a private key or a public key, not both")
+	case privatePEM != nil:
+		if key.private, err = parsePrivateKey(privatePEM); err != nil {
+			return nil, err
+		}
+		key.public = key.private.Public()
+	case publicPEM != nil:
+		if key.public, err = parsePublicKey(publicPEM); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("a private or public key is required")
+	}
+
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if key.method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("RSA key can't be used with %s", cfg.Algorithm)
+		}
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key is %d bits, at least %d are required", pub.N.BitLen(), minRSAKeyBits)
+		}
+	case ed25519.PublicKey:
+		if key.method != jwt.SigningMethodEdDSA {
+			return nil, fmt.Errorf("Ed25519 key can't be used with %s", cfg.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.public)
+	}
+	return key, nil
+}
+
+// pemSetting returns the PEM given inline or in a file, or nil when neither is set
+func pemSetting(inline, file string) ([]byte, error) {
+	if inline != "" && file != "" {
+		return nil, errors.New("a key can't be set both inline and as a file")
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read key file: %w", err)
+		}
+		return data, nil
+	}
+	if strings.TrimSpace(inline) != "" {
+		return []byte(inline), nil
+	}
+	return nil, nil
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q for a private key", block.Type)
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("public key is not a PEM PUBLIC KEY block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	return key, nil
+}
+
+// Sign signs claims with the signing key, or with HS256 and the secret when there is none.
+// A non-empty typ replaces the default JWT typ header.
+func (k *JWTKeys) Sign(claims jwt.Claims, typ string) (string, error) {
+	method, key := jwt.SigningMethod(jwt.SigningMethodHS256), interface{}(k.secret)
+	if k.signing != nil {
+		method, key = k.signing.method, k.signing.private
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if k.signing != nil {
+		token.Header["kid"] = k.signing.id
+	}
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(key)
+}
+
+// Keyfunc picks the key a token is verified with, for jwt.Parse. The token's alg must be
+// the one configured for its kid, so a public key is never used as an HMAC secret.
+func (k *JWTKeys) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if k.secret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.secret, nil
+	}
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method != key.method {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.public, nil
+}
+
+// ValidMethods lists the algorithms Keyfunc can accept, for jwt.WithValidMethods
+func (k *JWTKeys) ValidMethods() []string {
+	var methods []string
+	if k.secret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	for _, key := range k.keys {
+		if !slices.Contains(methods, key.method.Alg()) {
+			methods = append(methods, key.method.Alg())
+		}
+	}
+	return methods
+}
+
+// JWKS returns the public half of every asymmetric key. The secret is never published,
+// so HS256 tokens can only be verified by this backend.
+func (k *JWTKeys) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(k.order))}
+	for _, id := range k.order {
+		key := k.keys[id]
+		jwk := JSONWebKey{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
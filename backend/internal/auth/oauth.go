@@ -3,98 +3,97 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/Sosokker/todolist-backend/internal/config"
 	"golang.org/x/oauth2"
-	googleOAuth "golang.org/x/oauth2/google"
 )
 
-// GoogleUserInfo holds user details fetched from Google.
-type GoogleUserInfo struct {
-	ID            string `json:"sub"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"email_verified"`
-	Name          string `json:"name"`
-	Picture       string `json:"picture"`
-}
+var (
+	// ErrOAuthRejected means the provider or its tokens didn't prove who the user is
+	ErrOAuthRejected = errors.New("oauth login rejected")
+	// ErrOAuthProviderUnavailable means the provider couldn't be reached or answered nonsense
+	ErrOAuthProviderUnavailable = errors.New("oauth provider unavailable")
+)
 
-// OAuthProvider defines the interface for OAuth operations.
-type OAuthProvider interface {
-	GetAuthCodeURL(state string) string
-	ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error)
-	FetchUserInfo(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error)
-	GetOAuth2Config() *oauth2.Config // Expose underlying config if needed
-}
+// maxProviderResponse caps discovery documents, key sets and user info responses
+const maxProviderResponse = 1 << 20
 
-// googleOAuthProvider implements OAuthProvider for Google.
-type googleOAuthProvider struct {
-	cfg *oauth2.Config
+// ExternalIdentity is who a user is at an external provider
+type ExternalIdentity struct {
+	Subject       string // Stable account ID at the provider, never reassigned
+	Email         string // May be empty
+	EmailVerified bool   // The provider vouches that the user controls Email
+	Name          string
 }
 
-// NewGoogleOAuthProvider creates a new provider instance configured for Google.
-func NewGoogleOAuthProvider(appCfg *config.Config) OAuthProvider {
-	return &googleOAuthProvider{
-		cfg: &oauth2.Config{
-			ClientID:     appCfg.OAuth.Google.ClientID,
-			ClientSecret: appCfg.OAuth.Google.ClientSecret,
-			RedirectURL:  appCfg.OAuth.Google.RedirectURL,
-			Scopes:       appCfg.OAuth.Google.Scopes,
-			Endpoint:     googleOAuth.Endpoint,
-		},
-	}
+// OAuthProvider runs the authorization code flow against one external provider
+type OAuthProvider interface {
+	ID() string   // Key under oauth.providers
+	Name() string // For display
+	// AuthCodeURL is where to send the browser. The nonce and PKCE verifier must be
+	// passed to Exchange again when the provider redirects back.
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange redeems the code from the callback and returns the authenticated account
+	Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalIdentity, error)
 }
 
-// GetAuthCodeURL generates the URL for Google's consent page.
-func (g *googleOAuthProvider) GetAuthCodeURL(state string) string {
-	// Add options like AccessTypeOffline to get a refresh token,
-	authURL := g.cfg.AuthCodeURL(state, oauth2.AccessTypeOffline /*, oauth2.ApprovalForce, oauth2.SetAuthURLParam("prompt", "select_account") */)
-	return authURL
+// NewOAuthProvider creates the provider configured under oauth.providers.<id>.
+// A nil client uses one with a 10 second timeout.
+func NewOAuthProvider(id string, cfg config.OAuthProviderConfig, client *http.Client) OAuthProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Type == config.OAuthProviderGitHub {
+		return newGitHubProvider(id, cfg, client)
+	}
+	return newOIDCProvider(id, cfg, client)
 }
 
-// ExchangeCode exchanges the authorization code for an access token and refresh token.
-func (g *googleOAuthProvider) ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error) {
-	token, err := g.cfg.Exchange(ctx, code)
+// getJSON fetches url into dst. A non-nil token is sent as a bearer token.
+func getJSON(ctx context.Context, client *http.Client, url string, token *oauth2.Token, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to exchange google auth code '%s': %w", code, err)
+		return fmt.Errorf("%w: %v", ErrOAuthProviderUnavailable, err)
 	}
-	if !token.Valid() {
-		return nil, fmt.Errorf("exchanged token is invalid")
+	req.Header.Set("Accept", "application/json")
+	if token != nil {
+		token.SetAuthHeader(req)
 	}
-	return token, nil
-}
-
-// FetchUserInfo uses the access token to get user details from Google's UserInfo endpoint.
-func (g *googleOAuthProvider) FetchUserInfo(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
-	client := g.cfg.Client(ctx, token)
-
-	userInfoURL := "https://www.googleapis.com/oauth2/v3/userinfo" // v3 is common
-	resp, err := client.Get(userInfoURL)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to request google user info from %s: %w", userInfoURL, err)
+		return fmt.Errorf("%w: GET %s: %v", ErrOAuthProviderUnavailable, url, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("google user info request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponse))
+	if err != nil {
+		return fmt.Errorf("%w: GET %s: %v", ErrOAuthProviderUnavailable, url, err)
 	}
-
-	var userInfo GoogleUserInfo
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode google user info response: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: GET %s returned status %d: %s", ErrOAuthProviderUnavailable, url, resp.StatusCode, body)
 	}
-
-	if userInfo.ID == "" || userInfo.Email == "" {
-		return nil, fmt.Errorf("invalid user info received from google (missing ID or Email)")
+	if err := json.Unmarshal(body, dst); err != nil {
+		return fmt.Errorf("%w: GET %s: %v", ErrOAuthProviderUnavailable, url, err)
 	}
-
-	return &userInfo, nil
+	return nil
 }
 
-// GetOAuth2Config returns the underlying oauth2.Config object.
-func (g *googleOAuthProvider) GetOAuth2Config() *oauth2.Config {
-	return g.cfg
+// exchangeCode redeems an authorization code with PKCE, using client for the token request
+func exchangeCode(ctx context.Context, client *http.Client, cfg *oauth2.Config, code, verifier string) (*oauth2.Token, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			// The provider refused the code: replayed, expired, or a PKCE mismatch
+			return nil, fmt.Errorf("%w: code exchange rejected: %s", ErrOAuthRejected, retrieveErr.ErrorCode)
+		}
+		return nil, fmt.Errorf("%w: code exchange: %v", ErrOAuthProviderUnavailable, err)
+	}
+	return token, nil
 }
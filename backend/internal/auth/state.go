@@ -3,6 +3,7 @@ package auth
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 
 const (
 	StateCookieName = "oauth_state"
+	LinkCookieName  = "oauth_link" // Holds the link intent while a link flow is at the provider
 	StateSeparator  = "."
 	StateExpiry     = 10 * time.Minute
 )
@@ -70,3 +72,12 @@ func VerifyAndExtractState(signedState string, secretKey []byte) (string, error)
 
 	return originalState, nil
 }
+
+// DeriveFromState derives a per-login secret, such as the OpenID Connect nonce or the PKCE
+// verifier, from the state value and a label. The callback can derive it again from the
+// verified state, so nothing needs to be stored between the redirect and the callback.
+func DeriveFromState(stateValue, label string, secretKey []byte) string {
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte(label + StateSeparator + stateValue))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
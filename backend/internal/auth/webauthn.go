@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// WebAuthn (https://www.w3.org/TR/webauthn-2/) relying party checks for passkeys. Attestation
+// statements aren't verified: any authenticator is accepted, so the "none" conveyance is all
+// that's asked for.
+
+var ErrInvalidWebAuthn = errors.New("invalid webauthn response")
+
+// COSE algorithm identifiers offered for new credentials, most preferred first
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+var WebAuthnAlgorithms = []int64{COSEAlgES256, COSEAlgEdDSA, COSEAlgRS256}
+
+const webAuthnChallengeBytes = 32
+
+// Authenticator data flags
+const (
+	authDataUserPresent  = 0x01
+	authDataUserVerified = 0x04
+	authDataAttested     = 0x40
+)
+
+// WebAuthnRelyingParty is the server side of the ceremonies
+type WebAuthnRelyingParty struct {
+	ID                      string   // Domain the credentials are scoped to
+	Origins                 []string // Where the browser may run the ceremony, e.g. https://app.example.com
+	RequireUserVerification bool     // Demand a PIN or biometric, not just a tap
+}
+
+// WebAuthnCredential is what registration establishes
+type WebAuthnCredential struct {
+	ID        []byte // Credential ID, chosen by the authenticator
+	PublicKey []byte // COSE_Key, kept as is and parsed again for every login
+	SignCount uint32
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte // Only with the attested flag
+	publicKey    []byte
+}
+
+// NewWebAuthnChallenge returns a random challenge for one ceremony
+func NewWebAuthnChallenge() ([]byte, error) {
+	b := make([]byte, webAuthnChallengeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// VerifyRegistration checks an AuthenticatorAttestationResponse against the challenge
+// it was created for and returns the new credential
+func (rp *WebAuthnRelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*WebAuthnCredential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrInvalidWebAuthn, err)
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrInvalidWebAuthn)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object has no authData", ErrInvalidWebAuthn)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&authDataAttested == 0 {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidWebAuthn)
+	}
+	if _, _, err := parseCOSEKey(authData.publicKey); err != nil { // Fail now rather than at every login
+		return nil, err
+	}
+
+	return &WebAuthnCredential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks an AuthenticatorAssertionResponse made with a stored credential. It returns
+// the authenticator's new signature counter and whether the user was verified, not just present.
+func (rp *WebAuthnRelyingParty) VerifyAssertion(
+	challenge, publicKey, clientDataJSON, rawAuthData, signature []byte,
+) (signCount uint32, userVerified bool, err error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, false, err
+	}
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, false, err
+	}
+
+	key, alg, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, false, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clip(rawAuthData), clientDataHash[:]...)
+	if !verifyCOSESignature(key, alg, signed, signature) {
+		return 0, false, fmt.Errorf("%w: bad signature", ErrInvalidWebAuthn)
+	}
+	return authData.signCount, authData.flags&authDataUserVerified != 0, nil
+}
+
+// SignCountAdvanced reports whether an assertion's signature counter may follow the stored
+// one. Authenticators that count signatures must count up, anything else suggests a cloned
+// key; those that don't count always send 0.
+func SignCountAdvanced(stored, received uint32) bool {
+	return received > stored || (received == 0 && stored == 0)
+}
+
+func (rp *WebAuthnRelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var clientData collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrInvalidWebAuthn, err)
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: client data is for %q", ErrInvalidWebAuthn, clientData.Type)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidWebAuthn)
+	}
+	if !slices.Contains(rp.Origins, clientData.Origin) || clientData.CrossOrigin {
+		return fmt.Errorf("%w: unexpected origin %q", ErrInvalidWebAuthn, clientData.Origin)
+	}
+	return nil
+}
+
+func (rp *WebAuthnRelyingParty) verifyAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: credential is for another relying party", ErrInvalidWebAuthn)
+	}
+	if authData.flags&authDataUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidWebAuthn)
+	}
+	if rp.RequireUserVerification && authData.flags&authDataUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user not verified", ErrInvalidWebAuthn)
+	}
+	return authData, nil
+}
+
+// parseAuthenticatorData splits the authenticator data structure (WebAuthn section 6.1)
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidWebAuthn)
+	}
+	authData := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if authData.flags&authDataAttested == 0 {
+		return authData, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 { // AAGUID and credential ID length
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidWebAuthn)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, fmt.Errorf("%w: credential ID truncated", ErrInvalidWebAuthn)
+	}
+	authData.credentialID = rest[:idLen:idLen]
+	rest = rest[idLen:]
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: credential public key: %v", ErrInvalidWebAuthn, err)
+	}
+	authData.publicKey = rest[: len(rest)-len(after) : len(rest)-len(after)]
+	return authData, nil
+}
+
+// parseCOSEKey reads an ES256 (P-256), EdDSA (Ed25519) or RS256 public key
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: public key: %v", ErrInvalidWebAuthn, err)
+	}
+	m, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: public key is not a map", ErrInvalidWebAuthn)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	x, _ := m[int64(-2)].([]byte)
+	y, _ := m[int64(-3)].([]byte)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256 && crv == 1 && len(x) == 32 && len(y) == 32:
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil { // Rejects points off the curve
+			return nil, 0, fmt.Errorf("%w: public key: %v", ErrInvalidWebAuthn, err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, alg, nil
+	case kty == 1 && alg == COSEAlgEdDSA && crv == 6 && len(x) == ed25519.PublicKeySize:
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, fmt.Errorf("%w: unsupported RSA key", ErrInvalidWebAuthn)
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, alg, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unsupported key type %d with algorithm %d", ErrInvalidWebAuthn, kty, alg)
+}
+
+func verifyCOSESignature(key crypto.PublicKey, alg int64, message, signature []byte) bool {
+	switch alg {
+	case COSEAlgES256:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature)
+	case COSEAlgEdDSA:
+		return ed25519.Verify(key.(ed25519.PublicKey), message, signature)
+	case COSEAlgRS256:
+		digest := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+const (
+	testRPID   = "app.example.com"
+	testOrigin = "https://app.example.com"
+)
+
+func testRelyingParty() *WebAuthnRelyingParty {
+	return &WebAuthnRelyingParty{ID: testRPID, Origins: []string{testOrigin}}
+}
+
+// cborPairs is a CBOR map whose keys keep their order when encoded
+type cborPairs [][2]any
+
+// encodeCBOR encodes the types decodeCBOR produces, for building test input
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= math.MaxUint8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= math.MaxUint16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []any:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case cborPairs:
+		out := head(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(append(out, encodeCBOR(pair[0])...), encodeCBOR(pair[1])...)
+		}
+		return out
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+// testAuthenticator holds one credential key pair
+type testAuthenticator struct {
+	alg    int64
+	signer crypto.Signer
+}
+
+func newTestAuthenticator(t *testing.T, alg int64) *testAuthenticator {
+	t.Helper()
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case COSEAlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case COSEAlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case COSEAlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return &testAuthenticator{alg: alg, signer: signer}
+}
+
+// coseKey is the credential public key as a COSE_Key
+func (a *testAuthenticator) coseKey() []byte {
+	switch pub := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, pub.X.FillBytes(make([]byte, 32))}, {-3, pub.Y.FillBytes(make([]byte, 32))}})
+	case ed25519.PublicKey:
+		return encodeCBOR(cborPairs{{1, 1}, {3, COSEAlgEdDSA}, {-1, 6}, {-2, []byte(pub)}})
+	case *rsa.PublicKey:
+		return encodeCBOR(cborPairs{{1, 3}, {3, COSEAlgRS256}, {-1, pub.N.Bytes()}, {-2, big.NewInt(int64(pub.E)).Bytes()}})
+	}
+	panic("coseKey: unsupported key")
+}
+
+func (a *testAuthenticator) sign(t *testing.T, message []byte) []byte {
+	t.Helper()
+	var signature []byte
+	var err error
+	switch a.alg {
+	case COSEAlgEdDSA:
+		signature, err = a.signer.Sign(rand.Reader, message, crypto.Hash(0))
+	default:
+		digest := sha256.Sum256(message)
+		signature, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signature
+}
+
+func testClientData(ceremony string, challenge []byte, origin string, crossOrigin bool) []byte {
+	data, _ := json.Marshal(collectedClientData{
+		Type:        ceremony,
+		Challenge:   base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:      origin,
+		CrossOrigin: crossOrigin,
+	})
+	return data
+}
+
+// testAuthData builds authenticator data, with attested credential data when coseKey is set
+func testAuthData(rpID string, flags byte, signCount uint32, credentialID, coseKey []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := binary.BigEndian.AppendUint32(append(rpIDHash[:], flags), signCount)
+	if coseKey == nil {
+		return data
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(credentialID)))
+	return append(append(data, credentialID...), coseKey...)
+}
+
+func testAttestationObject(authData []byte) []byte {
+	return encodeCBOR(cborPairs{{"fmt", "none"}, {"attStmt", cborPairs{}}, {"authData", authData}})
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	challenge := []byte("registration-challenge-32-bytes!")
+	credentialID := []byte("credential-1")
+	es256 := newTestAuthenticator(t, COSEAlgES256)
+	key := es256.coseKey()
+	flags := byte(authDataUserPresent | authDataUserVerified | authDataAttested)
+	validClientData := testClientData("webauthn.create", challenge, testOrigin, false)
+	validAuthData := testAuthData(testRPID, flags, 0, credentialID, key)
+
+	tests := []struct {
+		name              string
+		rp                *WebAuthnRelyingParty
+		clientData        []byte
+		attestationObject []byte
+		wantErr           bool
+	}{
+		{"valid ES256", nil, validClientData, testAttestationObject(validAuthData), false},
+		{"valid EdDSA", nil, validClientData, testAttestationObject(testAuthData(testRPID, flags, 0, credentialID, newTestAuthenticator(t, COSEAlgEdDSA).coseKey())), false},
+		{"valid RS256", nil, validClientData, testAttestationObject(testAuthData(testRPID, flags, 0, credentialID, newTestAuthenticator(t, COSEAlgRS256).coseKey())), false},
+
+		// Client data
+		{"login client data", nil, testClientData("webauthn.get", challenge, testOrigin, false), testAttestationObject(validAuthData), true},
+		{"other challenge", nil, testClientData("webauthn.create", []byte("another-challenge"), testOrigin, false), testAttestationObject(validAuthData), true},
+		{"other origin", nil, testClientData("webauthn.create", challenge, "https://evil.example.com", false), testAttestationObject(validAuthData), true},
+		{"cross origin", nil, testClientData("webauthn.create", challenge, testOrigin, true), testAttestationObject(validAuthData), true},
+		{"client data not json", nil, []byte("{"), testAttestationObject(validAuthData), true},
+
+		// Authenticator data
+		{"other relying party", nil, validClientData, testAttestationObject(testAuthData("evil.example.com", flags, 0, credentialID, key)), true},
+		{"user not present", nil, validClientData, testAttestationObject(testAuthData(testRPID, authDataUserVerified|authDataAttested, 0, credentialID, key)), true},
+		{"user present but not verified", nil, validClientData, testAttestationObject(testAuthData(testRPID, authDataUserPresent|authDataAttested, 0, credentialID, key)), false},
+		{"user not verified when required", &WebAuthnRelyingParty{ID: testRPID, Origins: []string{testOrigin}, RequireUserVerification: true}, validClientData, testAttestationObject(testAuthData(testRPID, authDataUserPresent|authDataAttested, 0, credentialID, key)), true},
+		{"no attested credential", nil, validClientData, testAttestationObject(testAuthData(testRPID, authDataUserPresent|authDataUserVerified, 0, nil, nil)), true},
+		{"authenticator data too short", nil, validClientData, testAttestationObject(validAuthData[:36]), true},
+		{"attested credential data too short", nil, validClientData, testAttestationObject(validAuthData[:37+17]), true},
+		{"credential ID truncated", nil, validClientData, testAttestationObject(validAuthData[:37+18+len(credentialID)-1]), true},
+		{"public key truncated", nil, validClientData, testAttestationObject(validAuthData[:len(validAuthData)-1]), true},
+
+		// Attestation object
+		{"attestation object truncated", nil, validClientData, testAttestationObject(validAuthData)[:20], true},
+		{"attestation object is an array", nil, validClientData, encodeCBOR([]any{"none", validAuthData}), true},
+		{"no authData", nil, validClientData, encodeCBOR(cborPairs{{"fmt", "none"}}), true},
+		{"authData is text", nil, validClientData, encodeCBOR(cborPairs{{"authData", string(validAuthData)}}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := tt.rp
+			if rp == nil {
+				rp = testRelyingParty()
+			}
+			cred, err := rp.VerifyRegistration(challenge, tt.clientData, tt.attestationObject)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got credential %x, want an error", cred.ID)
+				}
+				if !errors.Is(err, ErrInvalidWebAuthn) {
+					t.Fatalf("got error %v, want ErrInvalidWebAuthn", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify registration: %v", err)
+			}
+			if string(cred.ID) != string(credentialID) || cred.SignCount != 0 {
+				t.Fatalf("got credential %x with count %d, want %x with 0", cred.ID, cred.SignCount, credentialID)
+			}
+			if _, _, err := parseCOSEKey(cred.PublicKey); err != nil {
+				t.Fatalf("stored public key doesn't parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	challenge := []byte("login-challenge-of-32-bytes-long")
+	es256 := newTestAuthenticator(t, COSEAlgES256)
+	eddsa := newTestAuthenticator(t, COSEAlgEdDSA)
+	rs256 := newTestAuthenticator(t, COSEAlgRS256)
+	clientData := testClientData("webauthn.get", challenge, testOrigin, false)
+	flags := byte(authDataUserPresent | authDataUserVerified)
+
+	// assertion signs authData and clientData with the authenticator's key
+	type assertion struct{ clientData, authData, signature []byte }
+	signed := func(a *testAuthenticator, clientData, authData []byte) assertion {
+		clientDataHash := sha256.Sum256(clientData)
+		return assertion{clientData, authData, a.sign(t, append(append([]byte{}, authData...), clientDataHash[:]...))}
+	}
+	valid := signed(es256, clientData, testAuthData(testRPID, flags, 7, nil, nil))
+	tampered := valid
+	tampered.authData = testAuthData(testRPID, flags, 8, nil, nil)
+
+	tests := []struct {
+		name         string
+		rp           *WebAuthnRelyingParty
+		publicKey    []byte
+		assertion    assertion
+		wantErr      bool
+		wantVerified bool
+	}{
+		{"valid ES256", nil, es256.coseKey(), valid, false, true},
+		{"valid EdDSA", nil, eddsa.coseKey(), signed(eddsa, clientData, testAuthData(testRPID, flags, 7, nil, nil)), false, true},
+		{"valid RS256", nil, rs256.coseKey(), signed(rs256, clientData, testAuthData(testRPID, flags, 7, nil, nil)), false, true},
+		{"user present only", nil, es256.coseKey(), signed(es256, clientData, testAuthData(testRPID, authDataUserPresent, 7, nil, nil)), false, false},
+
+		// Signature
+		{"signed by another key", nil, eddsa.coseKey(), valid, true, false},
+		{"authenticator data changed after signing", nil, es256.coseKey(), tampered, true, false},
+		{"signature truncated", nil, es256.coseKey(), assertion{valid.clientData, valid.authData, valid.signature[:len(valid.signature)-1]}, true, false},
+		{"no signature", nil, es256.coseKey(), assertion{valid.clientData, valid.authData, nil}, true, false},
+
+		// Client data, signed so only the check itself can fail
+		{"registration client data", nil, es256.coseKey(), signed(es256, testClientData("webauthn.create", challenge, testOrigin, false), valid.authData), true, false},
+		{"other challenge", nil, es256.coseKey(), signed(es256, testClientData("webauthn.get", []byte("old-challenge"), testOrigin, false), valid.authData), true, false},
+		{"other origin", nil, es256.coseKey(), signed(es256, testClientData("webauthn.get", challenge, "http://app.example.com", false), valid.authData), true, false},
+		{"cross origin", nil, es256.coseKey(), signed(es256, testClientData("webauthn.get", challenge, testOrigin, true), valid.authData), true, false},
+
+		// Authenticator data flags and relying party
+		{"other relying party", nil, es256.coseKey(), signed(es256, clientData, testAuthData("example.com", flags, 7, nil, nil)), true, false},
+		{"user not present", nil, es256.coseKey(), signed(es256, clientData, testAuthData(testRPID, authDataUserVerified, 7, nil, nil)), true, false},
+		{"no flags", nil, es256.coseKey(), signed(es256, clientData, testAuthData(testRPID, 0, 7, nil, nil)), true, false},
+		{"user not verified when required", &WebAuthnRelyingParty{ID: testRPID, Origins: []string{testOrigin}, RequireUserVerification: true}, es256.coseKey(), signed(es256, clientData, testAuthData(testRPID, authDataUserPresent, 7, nil, nil)), true, false},
+		{"user verified when required", &WebAuthnRelyingParty{ID: testRPID, Origins: []string{testOrigin}, RequireUserVerification: true}, es256.coseKey(), valid, false, true},
+		{"authenticator data too short", nil, es256.coseKey(), signed(es256, clientData, valid.authData[:36]), true, false},
+
+		// Stored key
+		{"stored key malformed", nil, es256.coseKey()[:10], valid, true, false},
+		{"stored key unsupported", nil, encodeCBOR(cborPairs{{1, 2}, {3, -35}, {-1, 2}}), valid, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := tt.rp
+			if rp == nil {
+				rp = testRelyingParty()
+			}
+			signCount, userVerified, err := rp.VerifyAssertion(challenge, tt.publicKey, tt.assertion.clientData, tt.assertion.authData, tt.assertion.signature)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want one")
+				}
+				if !errors.Is(err, ErrInvalidWebAuthn) {
+					t.Fatalf("got error %v, want ErrInvalidWebAuthn", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify assertion: %v", err)
+			}
+			if signCount != 7 || userVerified != tt.wantVerified {
+				t.Fatalf("got count %d and user verified %v, want 7 and %v", signCount, userVerified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestParseCOSEKey(t *testing.T) {
+	es256 := newTestAuthenticator(t, COSEAlgES256).signer.Public().(*ecdsa.PublicKey)
+	x, y := es256.X.FillBytes(make([]byte, 32)), es256.Y.FillBytes(make([]byte, 32))
+	ed := newTestAuthenticator(t, COSEAlgEdDSA).signer.Public().(ed25519.PublicKey)
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	offCurve := append([]byte{}, y...)
+	offCurve[31] ^= 1
+
+	tests := []struct {
+		name    string
+		key     []byte
+		wantAlg int64
+	}{
+		{"ES256", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, x}, {-3, y}}), COSEAlgES256},
+		{"EdDSA", encodeCBOR(cborPairs{{1, 1}, {3, COSEAlgEdDSA}, {-1, 6}, {-2, []byte(ed)}}), COSEAlgEdDSA},
+
+		{"empty", nil, 0},
+		{"truncated", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, x}, {-3, y}})[:40], 0},
+		{"array", encodeCBOR([]any{2, COSEAlgES256, 1, x, y}), 0},
+		{"byte string", encodeCBOR(x), 0},
+		{"EC2 point off the curve", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, x}, {-3, offCurve}}), 0},
+		{"EC2 P-384 curve", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 2}, {-2, x}, {-3, y}}), 0},
+		{"EC2 short coordinate", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, x[1:]}, {-3, y}}), 0},
+		{"EC2 coordinate as text", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, string(x)}, {-3, y}}), 0},
+		{"EC2 no y", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, x}}), 0},
+		{"ES384", encodeCBOR(cborPairs{{1, 2}, {3, -35}, {-1, 2}, {-2, x}, {-3, y}}), 0},
+		{"EC2 key with EdDSA", encodeCBOR(cborPairs{{1, 2}, {3, COSEAlgEdDSA}, {-1, 1}, {-2, x}, {-3, y}}), 0},
+		{"OKP X25519 curve", encodeCBOR(cborPairs{{1, 1}, {3, COSEAlgEdDSA}, {-1, 4}, {-2, []byte(ed)}}), 0},
+		{"OKP short key", encodeCBOR(cborPairs{{1, 1}, {3, COSEAlgEdDSA}, {-1, 6}, {-2, []byte(ed)[:31]}}), 0},
+		{"RSA 1024 bits", encodeCBOR(cborPairs{{1, 3}, {3, COSEAlgRS256}, {-1, weakRSA.N.Bytes()}, {-2, big.NewInt(int64(weakRSA.E)).Bytes()}}), 0},
+		{"RSA no exponent", encodeCBOR(cborPairs{{1, 3}, {3, COSEAlgRS256}, {-1, make([]byte, 256)}}), 0},
+		{"RSA oversized exponent", encodeCBOR(cborPairs{{1, 3}, {3, COSEAlgRS256}, {-1, make([]byte, 256)}, {-2, make([]byte, 5)}}), 0},
+		{"RSA PS256", encodeCBOR(cborPairs{{1, 3}, {3, -37}, {-1, make([]byte, 256)}, {-2, []byte{1, 0, 1}}}), 0},
+		{"symmetric key", encodeCBOR(cborPairs{{1, 4}, {3, 5}, {-1, make([]byte, 32)}}), 0},
+		{"no key type", encodeCBOR(cborPairs{{3, COSEAlgES256}, {-1, 1}, {-2, x}, {-3, y}}), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, alg, err := parseCOSEKey(tt.key)
+			if tt.wantAlg == 0 {
+				if err == nil {
+					t.Fatalf("got %T key, want an error", key)
+				}
+				if !errors.Is(err, ErrInvalidWebAuthn) {
+					t.Fatalf("got error %v, want ErrInvalidWebAuthn", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if alg != tt.wantAlg {
+				t.Fatalf("got algorithm %d, want %d", alg, tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestSignCountAdvanced(t *testing.T) {
+	tests := []struct {
+		stored, received uint32
+		want             bool
+	}{
+		{0, 0, true}, // Authenticators that don't count
+		{0, 1, true},
+		{5, 6, true},
+		{5, 100, true},
+		{math.MaxUint32 - 1, math.MaxUint32, true},
+		{5, 5, false}, // Replayed or cloned
+		{5, 4, false},
+		{5, 0, false}, // A counting authenticator can't stop counting
+		{math.MaxUint32, 0, false},
+	}
+	for _, tt := range tests {
+		if got := SignCountAdvanced(tt.stored, tt.received); got != tt.want {
+			t.Errorf("SignCountAdvanced(%d, %d) = %v, want %v", tt.stored, tt.received, got, tt.want)
+		}
+	}
+}
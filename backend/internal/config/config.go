@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -9,14 +13,18 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Log      LogConfig
-	JWT      JWTConfig
-	OAuth    OAuthConfig
-	Cache    CacheConfig
-	Storage  StorageConfig
-	Frontend FrontendConfig
+	Server        ServerConfig
+	Database      DatabaseConfig
+	Log           LogConfig
+	JWT           JWTConfig
+	OAuth         OAuthConfig
+	Cache         CacheConfig
+	Storage       StorageConfig
+	Frontend      FrontendConfig
+	Email         EmailConfig
+	MFA           MFAConfig
+	WebAuthn      WebAuthnConfig
+	LoginThrottle LoginThrottleConfig
 }
 
 type ServerConfig struct {
@@ -25,22 +33,78 @@ type ServerConfig struct {
 	WriteTimeout time.Duration `mapstructure:"writeTimeout"`
 	IdleTimeout  time.Duration `mapstructure:"idleTimeout"`
 	BasePath     string        `mapstructure:"basePath"`
+	// Reverse proxies whose X-Forwarded-For and X-Real-IP headers are believed, as addresses
+	// or CIDR ranges. Empty trusts none, and the peer address is the client.
+	TrustedProxies []string `mapstructure:"trustedProxies"`
 }
 
 type StorageConfig struct {
-	Type  string             `mapstructure:"type"` // "local", "gcs"
-	Local LocalStorageConfig `mapstructure:"local"`
-	GCS   GCSStorageConfig   `mapstructure:"gcs"`
+	Type          string        `mapstructure:"type"`          // "local", "gcs", "s3"
+	MaxUploadSize int64         `mapstructure:"maxUploadSize"` // Bytes per attachment, users.max_upload_size overrides it
+	UploadTimeout time.Duration `mapstructure:"uploadTimeout"` // Replaces the server read/write timeouts on upload requests
+	UserQuota     int64         `mapstructure:"userQuota"`     // Total attachment bytes per user, 0 is unlimited; users.storage_quota overrides it
+	StagingPath   string        `mapstructure:"stagingPath"`   // Uploads are staged here and scanned before they're stored; empty is the system temp dir
+	// Sniffed media types, exact ("application/pdf") or wildcard ("image/*"); the denylist wins
+	AllowedContentTypes []string           `mapstructure:"allowedContentTypes"` // Empty allows anything not denied
+	DeniedContentTypes  []string           `mapstructure:"deniedContentTypes"`
+	Reconcile           ReconcileConfig    `mapstructure:"reconcile"`
+	Resumable           ResumableConfig    `mapstructure:"resumable"`
+	Scanner             ScannerConfig      `mapstructure:"scanner"`
+	Local               LocalStorageConfig `mapstructure:"local"`
+	GCS                 GCSStorageConfig   `mapstructure:"gcs"`
+	S3                  S3StorageConfig    `mapstructure:"s3"`
+}
+
+// ResumableConfig controls tus uploads, whose chunks are staged on local disk until complete.
+// Replicas don't share staged chunks, so every request for one upload must reach the same node.
+type ResumableConfig struct {
+	Path       string        `mapstructure:"path"`       // Must not be inside storage.local.path
+	Expiry     time.Duration `mapstructure:"expiry"`     // Unfinished uploads are discarded this long after their last chunk
+	MaxPending int           `mapstructure:"maxPending"` // Unfinished uploads one user may have at a time
+}
+
+// ReconcileConfig controls the job that removes stored objects no attachment references
+type ReconcileConfig struct {
+	Enabled     bool          `mapstructure:"enabled"` // Run periodically inside the server; `reconcile` runs it once
+	Interval    time.Duration `mapstructure:"interval"`
+	GracePeriod time.Duration `mapstructure:"gracePeriod"` // Younger objects are skipped, they may belong to an upload in flight
+	DryRun      bool          `mapstructure:"dryRun"`      // Only report orphans
+}
+
+// ScannerConfig selects the malware scanner every upload passes through before it is saved
+type ScannerConfig struct {
+	Type     string      `mapstructure:"type"`     // "none" or "clamd"
+	FailOpen bool        `mapstructure:"failOpen"` // Accept uploads, marked scan_failed, when the scanner can't give a verdict
+	Clamd    ClamdConfig `mapstructure:"clamd"`
+}
+
+type ClamdConfig struct {
+	Address string        `mapstructure:"address"` // tcp://host:3310 or unix:///run/clamav/clamd.ctl
+	Timeout time.Duration `mapstructure:"timeout"` // Per scan, covering the whole stream
 }
 
 type LocalStorageConfig struct {
-	Path string `mapstructure:"path"`
+	Path    string `mapstructure:"path"`
+	BaseURL string `mapstructure:"baseUrl"` // URL prefix of the download route, defaults to <basePath>/files
 }
 
 type GCSStorageConfig struct {
-	BucketName      string `mapstructure:"bucketName"`
-	CredentialsFile string `mapstructure:"credentialsFile"`
-	BaseDir         string `mapstructure:"baseDir"`
+	BucketName      string        `mapstructure:"bucketName"`
+	CredentialsFile string        `mapstructure:"credentialsFile"`
+	BaseDir         string        `mapstructure:"baseDir"`
+	SignedURLExpiry time.Duration `mapstructure:"signedUrlExpiry"` // Lifetime of URLs minted per response
+}
+
+type S3StorageConfig struct {
+	Endpoint        string        `mapstructure:"endpoint"` // Host[:port], e.g. s3.amazonaws.com or minio:9000
+	Region          string        `mapstructure:"region"`
+	BucketName      string        `mapstructure:"bucketName"`
+	AccessKeyID     string        `mapstructure:"accessKeyId"`
+	SecretAccessKey string        `mapstructure:"secretAccessKey"`
+	UseSSL          bool          `mapstructure:"useSsl"`
+	UsePathStyle    bool          `mapstructure:"usePathStyle"` // Required by most MinIO/Ceph setups
+	BaseDir         string        `mapstructure:"baseDir"`
+	SignedURLExpiry time.Duration `mapstructure:"signedUrlExpiry"` // Lifetime of URLs minted per response
 }
 
 type DatabaseConfig struct {
@@ -61,18 +125,68 @@ type JWTConfig struct {
 	CookieSecure   bool   `mapstructure:"cookieSecure"`
 	CookieHttpOnly bool   `mapstructure:"cookieHttpOnly"`
 	CookieSameSite string `mapstructure:"cookieSameSite"` // None, Lax, Strict
+	// Refresh tokens are rotated on every use but never outlive this, counted from login
+	RefreshExpiry     time.Duration `mapstructure:"refreshExpiry"`
+	RefreshCookieName string        `mapstructure:"refreshCookieName"`
+	RefreshCookiePath string        `mapstructure:"refreshCookiePath"` // Defaults to <basePath>/auth so the cookie only travels to the auth routes
+	// Every token carries iss = issuer. Access tokens have aud = audience and the JOSE header typ at+jwt;
+	// the backend's other tokens have aud = <audience>:<purpose>, so no other service accepts them.
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+	// Asymmetric signing. Every key in keys verifies tokens and is published at /.well-known/jwks.json;
+	// signingKey picks the one that signs. Without it tokens are signed with HS256 and secret.
+	SigningKey   string         `mapstructure:"signingKey"`
+	Keys         []JWTKeyConfig `mapstructure:"keys"`
+	AcceptSecret bool           `mapstructure:"acceptSecret"` // Also accept HS256 tokens signed with secret while signingKey is set, for the switch over
+}
+
+// JWTKeyConfig is one asymmetric JWT key. Keys with only a public key verify tokens
+// they signed before being retired, but can't sign.
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"id"`         // The kid header of the tokens it signs
+	Algorithm      string `mapstructure:"algorithm"`  // RS256 or EdDSA
+	PrivateKey     string `mapstructure:"privateKey"` // PEM, PKCS#8 or PKCS#1
+	PrivateKeyFile string `mapstructure:"privateKeyFile"`
+	PublicKey      string `mapstructure:"publicKey"` // PEM, PKIX
+	PublicKeyFile  string `mapstructure:"publicKeyFile"`
 }
 
+// GoogleOAuthConfig is the old single-provider setting. LoadConfig turns it into
+// oauth.providers.google unless that is configured too.
 type GoogleOAuthConfig struct {
 	ClientID     string   `mapstructure:"clientId"`
 	ClientSecret string   `mapstructure:"clientSecret"`
 	RedirectURL  string   `mapstructure:"redirectUrl"`
 	Scopes       []string `mapstructure:"scopes"`
-	StateSecret  string   `mapstructure:"stateSecret"` // For signing state cookie
+	StateSecret  string   `mapstructure:"stateSecret"` // Used when oauth.stateSecret is empty
+}
+
+// OAuth provider types
+const (
+	OAuthProviderOIDC   = "oidc"   // Any OpenID Connect provider, configured through discovery
+	OAuthProviderGitHub = "github" // GitHub's OAuth2 apps, which don't speak OpenID Connect
+)
+
+// OAuthProviderConfig is one external login provider. Its key under oauth.providers
+// appears in the routes, /auth/<key>/login and /auth/<key>/callback.
+type OAuthProviderConfig struct {
+	Name         string   `mapstructure:"name"`   // Shown on the login page, defaults to the key
+	Type         string   `mapstructure:"type"`   // oidc (default) or github
+	Issuer       string   `mapstructure:"issuer"` // oidc only; <issuer>/.well-known/openid-configuration must exist
+	ClientID     string   `mapstructure:"clientId"`
+	ClientSecret string   `mapstructure:"clientSecret"`
+	RedirectURL  string   `mapstructure:"redirectUrl"` // <api>/auth/<key>/callback, registered with the provider
+	Scopes       []string `mapstructure:"scopes"`      // Defaults to openid, email and profile; read:user and user:email for github
+	// github only, for GitHub Enterprise. Default to github.com and api.github.com.
+	AuthURL  string `mapstructure:"authUrl"`
+	TokenURL string `mapstructure:"tokenUrl"`
+	APIURL   string `mapstructure:"apiUrl"`
 }
 
 type OAuthConfig struct {
-	Google GoogleOAuthConfig `mapstructure:"google"`
+	StateSecret string                         `mapstructure:"stateSecret"` // Signs the state cookie, defaults to google.stateSecret, then jwt.secret
+	Providers   map[string]OAuthProviderConfig `mapstructure:"providers"`
+	Google      GoogleOAuthConfig              `mapstructure:"google"` // Deprecated: use providers.google
 }
 
 type CacheConfig struct {
@@ -80,6 +194,134 @@ type CacheConfig struct {
 	CleanupInterval   time.Duration `mapstructure:"cleanupInterval"`
 }
 
+// EmailConfig controls outgoing mail and the email verification flow
+type EmailConfig struct {
+	Mailer    string     `mapstructure:"mailer"` // "smtp" or "directory"
+	From      string     `mapstructure:"from"`
+	SMTP      SMTPConfig `mapstructure:"smtp"`
+	Directory string     `mapstructure:"directory"` // The directory mailer writes one .eml file per message here
+
+	TokenSecret        string        `mapstructure:"tokenSecret"` // Signs verification links, defaults to jwt.secret
+	VerificationExpiry time.Duration `mapstructure:"verificationExpiry"`
+	ResendInterval     time.Duration `mapstructure:"resendInterval"`  // Minimum time between verification or password reset emails to one user
+	VerifyURL          string        `mapstructure:"verifyUrl"`       // Frontend page the link points at, defaults to <frontend.url>/verify-email
+	RequireVerified    bool          `mapstructure:"requireVerified"` // Unverified users can only reach the verification, logout and /users/me routes
+
+	PasswordResetExpiry time.Duration `mapstructure:"passwordResetExpiry"`
+	PasswordResetURL    string        `mapstructure:"passwordResetUrl"` // Frontend page the reset link points at, defaults to <frontend.url>/reset-password
+}
+
+// MFAConfig controls second login factors
+type MFAConfig struct {
+	Issuer          string        `mapstructure:"issuer"`          // Account label shown in authenticator apps
+	ChallengeExpiry time.Duration `mapstructure:"challengeExpiry"` // How long after the password the second factor can be entered
+	MaxAttempts     int32         `mapstructure:"maxAttempts"`     // Wrong codes in a row before the challenge or session has to start over
+	// Reaching maxAttempts also locks the second factor for lockoutDuration, twice as long
+	// each time after that, up to maxLockout; only a good code resets the doubling
+	LockoutDuration time.Duration `mapstructure:"lockoutDuration"`
+	MaxLockout      time.Duration `mapstructure:"maxLockout"`
+}
+
+// WebAuthnConfig controls passkey login. The relying party ID must be the frontend's
+// host or a parent domain of it, and can't change without losing every registered passkey.
+type WebAuthnConfig struct {
+	RPID             string        `mapstructure:"rpId"`             // Defaults to the host of frontend.url
+	RPName           string        `mapstructure:"rpName"`           // Shown by the browser when creating a passkey
+	Origins          []string      `mapstructure:"origins"`          // Pages allowed to run the ceremonies, defaults to frontend.url
+	Timeout          time.Duration `mapstructure:"timeout"`          // How long a ceremony can take from begin to finish
+	UserVerification string        `mapstructure:"userVerification"` // required or preferred
+}
+
+// LoginThrottleConfig slows down password guessing. Failed logins are counted per account
+// and per client address; each failure below the threshold doubles the wait before the
+// next attempt, and reaching it locks the key out, twice as long on every further failure.
+type LoginThrottleConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Store            string        `mapstructure:"store"`            // cache (per process) or postgres (shared by replicas)
+	AccountThreshold int           `mapstructure:"accountThreshold"` // Failures in a row that lock an account out, 0 disables the per-account count
+	IPThreshold      int           `mapstructure:"ipThreshold"`      // Failures that lock a client address out, 0 disables the per-address count
+	BaseDelay        time.Duration `mapstructure:"baseDelay"`        // Wait after an account's first failure
+	LockoutDuration  time.Duration `mapstructure:"lockoutDuration"`  // First lockout at the threshold
+	MaxLockout       time.Duration `mapstructure:"maxLockout"`       // Cap for the doubling lockouts
+	ResetAfter       time.Duration `mapstructure:"resetAfter"`       // Counting starts over after this long without failures; at least maxLockout
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"` // Leave empty to send without AUTH
+	Password string `mapstructure:"password"`
+}
+
+// oauthProviderKey keeps provider keys usable as a single path segment
+var oauthProviderKey = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// normalizeOAuth fills in provider defaults, folds the legacy google section into
+// the provider list and rejects providers that can't work
+func normalizeOAuth(cfg *Config) error {
+	if cfg.OAuth.Providers == nil {
+		cfg.OAuth.Providers = make(map[string]OAuthProviderConfig)
+	}
+	if google := cfg.OAuth.Google; google.ClientID != "" {
+		if _, ok := cfg.OAuth.Providers["google"]; !ok {
+			scopes := slices.Clone(google.Scopes)
+			if !slices.Contains(scopes, "openid") {
+				scopes = append([]string{"openid"}, scopes...) // The ID token is what identifies the user now
+			}
+			cfg.OAuth.Providers["google"] = OAuthProviderConfig{
+				Name:         "Google",
+				Type:         OAuthProviderOIDC,
+				Issuer:       "https://accounts.google.com",
+				ClientID:     google.ClientID,
+				ClientSecret: google.ClientSecret,
+				RedirectURL:  google.RedirectURL,
+				Scopes:       scopes,
+			}
+		}
+	}
+	if cfg.OAuth.StateSecret == "" {
+		cfg.OAuth.StateSecret = cfg.OAuth.Google.StateSecret
+	}
+	if cfg.OAuth.StateSecret == "" {
+		cfg.OAuth.StateSecret = cfg.JWT.Secret
+	}
+
+	for key, p := range cfg.OAuth.Providers {
+		if !oauthProviderKey.MatchString(key) {
+			return fmt.Errorf("oauth.providers: %q must be lowercase letters, digits, - and _", key)
+		}
+		if p.Name == "" {
+			p.Name = key
+		}
+		if p.Type == "" {
+			p.Type = OAuthProviderOIDC
+		}
+		switch p.Type {
+		case OAuthProviderOIDC:
+			if p.Issuer == "" {
+				return fmt.Errorf("oauth.providers.%s: issuer is required", key)
+			}
+			if len(p.Scopes) == 0 {
+				p.Scopes = []string{"openid", "email", "profile"}
+			}
+		case OAuthProviderGitHub:
+			if len(p.Scopes) == 0 {
+				p.Scopes = []string{"read:user", "user:email"}
+			}
+		default:
+			return fmt.Errorf("oauth.providers.%s: unknown type %q", key, p.Type)
+		}
+		if p.ClientID == "" || strings.Contains(p.ClientID, "_ENV") {
+			slog.Warn("OAuth provider client ID not set or is using placeholder.", "provider", key)
+		}
+		if p.ClientSecret == "" || strings.Contains(p.ClientSecret, "_ENV") {
+			slog.Warn("OAuth provider client secret not set or is using placeholder.", "provider", key)
+		}
+		cfg.OAuth.Providers[key] = p
+	}
+	return nil
+}
+
 type FrontendConfig struct {
 	Url string `mapstructure:"url"`
 }
@@ -104,11 +346,56 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetDefault("jwt.cookieName", "jwt_token")
 	viper.SetDefault("jwt.cookieHttpOnly", true)
 	viper.SetDefault("jwt.cookieSameSite", "Lax")
+	viper.SetDefault("jwt.refreshExpiry", 30*24*time.Hour)
+	viper.SetDefault("jwt.refreshCookieName", "refresh_token")
+	viper.SetDefault("jwt.issuer", "todolist")
+	viper.SetDefault("jwt.audience", "todolist-api")
 	viper.SetDefault("cache.defaultExpiration", 5*time.Minute)
 	viper.SetDefault("cache.cleanupInterval", 10*time.Minute)
-	viper.SetDefault("storage.type", "local") // Default to local storage
+	viper.SetDefault("storage.type", "local")          // Default to local storage
+	viper.SetDefault("storage.maxUploadSize", 100<<20) // 100 MB
+	viper.SetDefault("storage.uploadTimeout", 5*time.Minute)
+	viper.SetDefault("storage.userQuota", 1<<30) // 1 GB
+	viper.SetDefault("storage.allowedContentTypes", []string{"image/*", "video/*", "audio/*", "text/plain", "application/pdf", "application/zip"})
+	viper.SetDefault("storage.deniedContentTypes", []string{"text/html", "text/xml", "image/svg+xml"}) // Can run script in a browser
+	viper.SetDefault("storage.reconcile.enabled", false)
+	viper.SetDefault("storage.reconcile.interval", 24*time.Hour)
+	viper.SetDefault("storage.reconcile.gracePeriod", 24*time.Hour)
+	viper.SetDefault("storage.resumable.path", "./uploads-partial")
+	viper.SetDefault("storage.resumable.expiry", 24*time.Hour)
+	viper.SetDefault("storage.resumable.maxPending", 10)
+	viper.SetDefault("storage.scanner.type", "none")
+	viper.SetDefault("storage.scanner.clamd.address", "tcp://localhost:3310")
+	viper.SetDefault("storage.scanner.clamd.timeout", 5*time.Minute)
 	viper.SetDefault("storage.local.path", "./uploads")
+	viper.SetDefault("storage.s3.endpoint", "s3.amazonaws.com")
+	viper.SetDefault("storage.s3.useSsl", true)
+	viper.SetDefault("storage.gcs.signedUrlExpiry", 15*time.Minute)
+	viper.SetDefault("storage.s3.signedUrlExpiry", 15*time.Minute)
 	viper.SetDefault("frontend.url", "http://localhost:3000")
+	viper.SetDefault("email.mailer", "directory")
+	viper.SetDefault("email.from", "Todolist <no-reply@localhost>")
+	viper.SetDefault("email.directory", "./mail")
+	viper.SetDefault("email.smtp.port", 587)
+	viper.SetDefault("email.verificationExpiry", 48*time.Hour)
+	viper.SetDefault("email.resendInterval", time.Minute)
+	viper.SetDefault("email.passwordResetExpiry", time.Hour)
+	viper.SetDefault("mfa.issuer", "Todolist")
+	viper.SetDefault("mfa.challengeExpiry", 5*time.Minute)
+	viper.SetDefault("mfa.maxAttempts", 5)
+	viper.SetDefault("mfa.lockoutDuration", 15*time.Minute)
+	viper.SetDefault("mfa.maxLockout", 24*time.Hour)
+	viper.SetDefault("webauthn.rpName", "Todolist")
+	viper.SetDefault("webauthn.timeout", 5*time.Minute)
+	viper.SetDefault("webauthn.userVerification", "required")
+	viper.SetDefault("loginThrottle.enabled", true)
+	viper.SetDefault("loginThrottle.store", "cache")
+	viper.SetDefault("loginThrottle.accountThreshold", 5)
+	viper.SetDefault("loginThrottle.ipThreshold", 50)
+	viper.SetDefault("loginThrottle.baseDelay", time.Second)
+	viper.SetDefault("loginThrottle.lockoutDuration", 15*time.Minute)
+	viper.SetDefault("loginThrottle.maxLockout", 24*time.Hour)
+	viper.SetDefault("loginThrottle.resetAfter", 24*time.Hour)
 
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -124,17 +411,65 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if cfg.Email.TokenSecret == "" {
+		cfg.Email.TokenSecret = cfg.JWT.Secret
+	}
+	if cfg.Email.VerifyURL == "" {
+		cfg.Email.VerifyURL = strings.TrimSuffix(cfg.Frontend.Url, "/") + "/verify-email"
+	}
+	if cfg.Email.PasswordResetURL == "" {
+		cfg.Email.PasswordResetURL = strings.TrimSuffix(cfg.Frontend.Url, "/") + "/reset-password"
+	}
+
+	if cfg.WebAuthn.RPID == "" {
+		if u, err := url.Parse(cfg.Frontend.Url); err == nil {
+			cfg.WebAuthn.RPID = u.Hostname()
+		}
+	}
+	if len(cfg.WebAuthn.Origins) == 0 {
+		cfg.WebAuthn.Origins = []string{strings.TrimSuffix(cfg.Frontend.Url, "/")}
+	}
+
+	if cfg.JWT.RefreshCookiePath == "" {
+		cfg.JWT.RefreshCookiePath = strings.TrimSuffix(cfg.Server.BasePath, "/") + "/auth"
+	}
+
+	if cfg.Storage.Local.BaseURL == "" {
+		cfg.Storage.Local.BaseURL = strings.TrimSuffix(cfg.Server.BasePath, "/") + "/files"
+	}
+
+	if cfg.Storage.Reconcile.Interval <= 0 {
+		cfg.Storage.Reconcile.Interval = 24 * time.Hour
+	}
+	if cfg.Storage.Resumable.Expiry <= 0 {
+		cfg.Storage.Resumable.Expiry = 24 * time.Hour
+	}
+	if cfg.Storage.Resumable.MaxPending <= 0 {
+		cfg.Storage.Resumable.MaxPending = 10
+	}
+
+	if cfg.MFA.MaxLockout < cfg.MFA.LockoutDuration {
+		cfg.MFA.MaxLockout = cfg.MFA.LockoutDuration
+	}
+
+	if cfg.LoginThrottle.Store != "cache" && cfg.LoginThrottle.Store != "postgres" {
+		return nil, fmt.Errorf("loginThrottle.store: unknown store %q", cfg.LoginThrottle.Store)
+	}
+	if cfg.LoginThrottle.MaxLockout < cfg.LoginThrottle.LockoutDuration {
+		cfg.LoginThrottle.MaxLockout = cfg.LoginThrottle.LockoutDuration
+	}
+	if cfg.LoginThrottle.ResetAfter < cfg.LoginThrottle.MaxLockout {
+		cfg.LoginThrottle.ResetAfter = cfg.LoginThrottle.MaxLockout // Otherwise a lockout could outlive the count that caused it
+	}
+
 	if cfg.JWT.Secret == "" || strings.Contains(cfg.JWT.Secret, "unsafe") {
 		slog.Warn("JWT_SECRET environment variable not set or is using unsafe default. THIS IS INSECURE FOR PRODUCTION.")
 	}
-	if cfg.OAuth.Google.ClientID == "" || strings.Contains(cfg.OAuth.Google.ClientID, "_ENV") {
-		slog.Warn("OAUTH_GOOGLE_CLIENTID environment variable not set or is using placeholder.")
-	}
-	if cfg.OAuth.Google.ClientSecret == "" || strings.Contains(cfg.OAuth.Google.ClientSecret, "_ENV") {
-		slog.Warn("OAUTH_GOOGLE_CLIENTSECRET environment variable not set or is using placeholder.")
+	if err := normalizeOAuth(&cfg); err != nil {
+		return nil, err
 	}
-	if cfg.OAuth.Google.StateSecret == "" || strings.Contains(cfg.OAuth.Google.StateSecret, "unsafe") {
-		slog.Warn("OAUTH_GOOGLE_STATESECRET environment variable not set or is using unsafe default. THIS IS INSECURE FOR PRODUCTION.")
+	if cfg.OAuth.StateSecret == "" || strings.Contains(cfg.OAuth.StateSecret, "unsafe") {
+		slog.Warn("OAUTH_STATESECRET environment variable not set or is using unsafe default. THIS IS INSECURE FOR PRODUCTION.")
 	}
 
 	return &cfg, nil
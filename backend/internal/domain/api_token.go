@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes an API token can be limited to
+const (
+	ScopeTodosRead  = "todos:read" // Todos, subtasks and attachments
+	ScopeTodosWrite = "todos:write"
+	ScopeTagsRead   = "tags:read"
+	ScopeTagsWrite  = "tags:write"
+	ScopeUserRead   = "user:read" // GET /users/me
+)
+
+// APIScopes lists every scope, in the order they're documented
+var APIScopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeTagsRead, ScopeTagsWrite, ScopeUserRead}
+
+// APIToken is a personal access token, for scripts and integrations that can't log in
+type APIToken struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"-"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"` // Hex SHA-256 of the token
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"` // Nil never expires
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// Expired reports whether the token can no longer be used at now
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
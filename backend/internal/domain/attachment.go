@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is the metadata row for a file uploaded to a Todo.
+// StoragePath and the thumbnail paths are storage IDs returned by FileStorageService.Upload;
+// thumbnails are only set for image attachments.
+type Attachment struct {
+	ID          uuid.UUID `json:"id"`
+	TodoID      uuid.UUID `json:"todoId"`
+	UserID      uuid.UUID `json:"userId"`
+	FileName    string    `json:"fileName"`
+	StoragePath string    `json:"-"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+
+	ThumbnailSmallPath *string `json:"-"` // 64px
+	ThumbnailLargePath *string `json:"-"` // 256px
+	ContentHash        *string `json:"-"` // Hex SHA-256 of the file; nil for attachments stored before deduplication
+
+	ScanStatus ScanStatus `json:"scanStatus"`
+	ScannedAt  *time.Time `json:"scannedAt"`
+}
+
+// References reports whether storageID is the attachment's file or one of its thumbnails
+func (a *Attachment) References(storageID string) bool {
+	return a.StoragePath == storageID ||
+		(a.ThumbnailSmallPath != nil && *a.ThumbnailSmallPath == storageID) ||
+		(a.ThumbnailLargePath != nil && *a.ThumbnailLargePath == storageID)
+}
+
+// ScanStatus is the malware scan verdict recorded for a stored attachment.
+// Infected uploads are rejected, so there is no status for them.
+type ScanStatus string
+
+const (
+	ScanStatusClean      ScanStatus = "clean"
+	ScanStatusNotScanned ScanStatus = "not_scanned" // No scanner configured, or uploaded before scanning existed
+	ScanStatusFailed     ScanStatus = "scan_failed" // Scanner unavailable and storage.scanner.failOpen set
+)
+
+// ScanResult is what a malware scanner reports for one file
+type ScanResult struct {
+	Infected  bool   `json:"infected"`
+	Signature string `json:"signature,omitempty"` // Name of the matched signature when Infected
+}
+
+// AttachmentBlob is one stored copy of a file, shared by every attachment with the
+// same content, whichever user uploaded it. RefCount is maintained by the database.
+type AttachmentBlob struct {
+	ContentHash        string    `json:"contentHash"`
+	StoragePath        string    `json:"-"`
+	ContentType        string    `json:"contentType"`
+	Size               int64     `json:"size"`
+	ThumbnailSmallPath *string   `json:"-"`
+	ThumbnailLargePath *string   `json:"-"`
+	RefCount           int       `json:"refCount"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+// StoredFile is one storage ID the database points at: an attachment's file, a
+// thumbnail or a blob. Files shared by several attachments appear once.
+type StoredFile struct {
+	StoragePath string
+	FileName    string  // Original name, or the object's base name for thumbnails
+	ContentType string  // Empty for thumbnails, whose type follows their extension
+	ContentHash *string // Hex SHA-256 when the file is a deduplicated blob
+}
+
+// AttachmentInfo is an Attachment together with a URL the client can fetch it from
+type AttachmentInfo struct {
+	FileID      uuid.UUID `json:"fileId"`
+	FileName    string    `json:"fileName"`
+	FileURL     string    `json:"fileUrl"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+
+	ThumbnailSmallURL *string `json:"thumbnailSmallUrl"`
+	ThumbnailLargeURL *string `json:"thumbnailLargeUrl"`
+
+	ScanStatus ScanStatus `json:"scanStatus"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AttachmentUpload is a resumable upload in progress. Once Offset reaches Length
+// the staged bytes are committed as an Attachment and the upload is removed.
+type AttachmentUpload struct {
+	ID        uuid.UUID `json:"id"`
+	TodoID    uuid.UUID `json:"todoId"`
+	UserID    uuid.UUID `json:"userId"`
+	FileName  string    `json:"fileName"`
+	Length    int64     `json:"length"` // Total size announced by the client
+	Offset    int64     `json:"offset"` // Bytes received so far
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Complete reports whether every byte of the upload has been received
+func (u *AttachmentUpload) Complete() bool {
+	return u.Offset >= u.Length
+}
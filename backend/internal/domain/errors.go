@@ -1,13 +1,33 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
-	ErrNotFound       = errors.New("resource not found")
-	ErrForbidden      = errors.New("user does not have permission")
-	ErrBadRequest     = errors.New("invalid input")
-	ErrConflict       = errors.New("resource conflict (e.g., duplicate)")
-	ErrUnauthorized   = errors.New("authentication required or failed")
-	ErrInternalServer = errors.New("internal server error")
-	ErrValidation     = errors.New("validation failed")
+	ErrNotFound        = errors.New("resource not found")
+	ErrForbidden       = errors.New("user does not have permission")
+	ErrBadRequest      = errors.New("invalid input")
+	ErrConflict        = errors.New("resource conflict (e.g., duplicate)")
+	ErrUnauthorized    = errors.New("authentication required or failed")
+	ErrInternalServer  = errors.New("internal server error")
+	ErrValidation      = errors.New("validation failed")
+	ErrTooLarge        = errors.New("payload too large")
+	ErrInfected        = errors.New("file failed malware scan")
+	ErrTooManyRequests = errors.New("too many requests")
 )
+
+// RetryAfterError is an ErrTooManyRequests that knows when the caller may try again
+type RetryAfterError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Message
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return ErrTooManyRequests
+}
@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity is an account at an external OpenID Connect or OAuth2 provider that logs in as a user
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	Provider    string     `json:"provider"` // Key under oauth.providers
+	Subject     string     `json:"-"`        // The provider's stable account ID
+	Email       *string    `json:"email"`    // As reported at the last login
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// LoginAttempts counts the failed logins in a row for one key: an account or a client address
+type LoginAttempts struct {
+	Key              string     `json:"key"`
+	Failures         int        `json:"failures"`
+	LastFailedAt     time.Time  `json:"lastFailedAt"`
+	PreviousFailedAt *time.Time `json:"previousFailedAt,omitempty"` // Nil when the last failure is the first in a row
+}
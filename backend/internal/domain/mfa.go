@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTPFactor is a user's authenticator app. It only counts as a second factor once confirmed.
+type TOTPFactor struct {
+	UserID         uuid.UUID  `json:"-"`
+	Secret         string     `json:"-"` // Base32
+	ConfirmedAt    *time.Time `json:"confirmedAt"`
+	LastUsedStep   int64      `json:"-"` // Codes for this time step or earlier are rejected as replays
+	FailedAttempts int32      `json:"-"` // Wrong codes since the last good one
+	Lockouts       int32      `json:"-"` // Times the wrong codes reached mfa.maxAttempts since the last good one
+	LockedUntil    *time.Time `json:"-"` // No code is checked before this
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// Enabled reports whether logins need a code from this factor
+func (f *TOTPFactor) Enabled() bool {
+	return f.ConfirmedAt != nil
+}
+
+// RecoveryCode is the stored half of a single-use code that stands in for the authenticator
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"-"`
+	UserID    uuid.UUID  `json:"-"`
+	CodeHash  string     `json:"-"` // bcrypt
+	CreatedAt time.Time  `json:"createdAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is the stored half of an opaque refresh token. Each use rotates it:
+// the token is marked rotated and a successor in the same family is issued.
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"userId"`
+	FamilyID  uuid.UUID  `json:"familyId"` // Shared by every token descending from one login
+	TokenHash string     `json:"-"`        // Hex SHA-256 of the token
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RotatedAt *time.Time `json:"rotatedAt"` // Presenting a rotated token again means it leaked
+	RevokedAt *time.Time `json:"revokedAt"`
+}
+
+// Usable reports whether the token may still be exchanged at now
+func (t *RefreshToken) Usable(now time.Time) bool {
+	return t.RotatedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,15 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokedToken is an access token rejected before its expiry, identified by its jti claim
+type RevokedToken struct {
+	JTI       uuid.UUID `json:"jti"`
+	UserID    uuid.UUID `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"` // The token's exp; the record is useless afterwards
+	RevokedAt time.Time `json:"revokedAt"`
+}
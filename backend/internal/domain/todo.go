@@ -16,27 +16,18 @@ const (
 )
 
 type Todo struct {
-	ID            uuid.UUID   `json:"id"`
-	UserID        uuid.UUID   `json:"userId"`
-	Title         string      `json:"title"`
-	Description   *string     `json:"description"` // Nullable
-	Status        TodoStatus  `json:"status"`
-	Deadline      *time.Time  `json:"deadline"`      // Nullable
-	TagIDs        []uuid.UUID `json:"tagIds"`        // Populated after fetching
-	Tags          []Tag       `json:"-"`             // Loaded separately
-	AttachmentUrl *string     `json:"attachmentUrl"` // Renamed and changed type
-	Subtasks      []Subtask   `json:"subtasks"`      // Populated after fetching
-	CreatedAt     time.Time   `json:"createdAt"`
-	UpdatedAt     time.Time   `json:"updatedAt"`
-}
-
-// Keep AttachmentInfo for upload responses
-type AttachmentInfo struct {
-	FileID      string `json:"fileId"`
-	FileName    string `json:"fileName"`
-	FileURL     string `json:"fileUrl"`
-	ContentType string `json:"contentType"`
-	Size        int64  `json:"size"`
+	ID          uuid.UUID        `json:"id"`
+	UserID      uuid.UUID        `json:"userId"`
+	Title       string           `json:"title"`
+	Description *string          `json:"description"` // Nullable
+	Status      TodoStatus       `json:"status"`
+	Deadline    *time.Time       `json:"deadline"`    // Nullable
+	TagIDs      []uuid.UUID      `json:"tagIds"`      // Populated after fetching
+	Tags        []Tag            `json:"-"`           // Loaded separately
+	Attachments []AttachmentInfo `json:"attachments"` // Populated after fetching
+	Subtasks    []Subtask        `json:"subtasks"`    // Populated after fetching
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
 }
 
 // Helper functions remain the same
@@ -12,7 +12,26 @@ type User struct {
 	Email         string    `json:"email"`
 	PasswordHash  string    `json:"-"`
 	EmailVerified bool      `json:"emailVerified"`
-	GoogleID      *string   `json:"-"`
+	MaxUploadSize *int64    `json:"-"` // Overrides storage.maxUploadSize when set
+	StorageQuota  *int64    `json:"-"` // Overrides storage.userQuota when set, 0 is unlimited
+	TokenVersion  int32     `json:"-"` // Access tokens carrying an older version are rejected
 	CreatedAt     time.Time `json:"createdAt"`
 	UpdatedAt     time.Time `json:"updatedAt"`
+
+	VerificationSentAt *time.Time `json:"-"` // Last verification email, for throttling resends
+}
+
+// StorageUsage is how much attachment storage a user has used and may use
+type StorageUsage struct {
+	Used          int64  `json:"used"`          // Sum of the user's attachment sizes
+	Quota         *int64 `json:"quota"`         // nil when unlimited
+	MaxUploadSize int64  `json:"maxUploadSize"` // Largest single attachment allowed
+}
+
+// Remaining is how many more bytes fit in the quota, or -1 when unlimited
+func (u *StorageUsage) Remaining() int64 {
+	if u.Quota == nil {
+		return -1
+	}
+	return max(0, *u.Quota-u.Used)
 }
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type pgxAPITokenRepository struct {
+	q *db.Queries
+}
+
+func NewPgxAPITokenRepository(queries *db.Queries) APITokenRepository {
+	return &pgxAPITokenRepository{q: queries}
+}
+
+// --- Mapping functions ---
+func mapDbAPITokenToDomain(d db.ApiToken) *domain.APIToken {
+	return &domain.APIToken{
+		ID:         d.ID,
+		UserID:     d.UserID,
+		Name:       d.Name,
+		TokenHash:  d.TokenHash,
+		Scopes:     d.Scopes,
+		CreatedAt:  d.CreatedAt,
+		ExpiresAt:  d.ExpiresAt,
+		LastUsedAt: d.LastUsedAt,
+	}
+}
+
+// --- Repository Methods ---
+
+func (r *pgxAPITokenRepository) Create(ctx context.Context, token *domain.APIToken) (*domain.APIToken, error) {
+	d, err := r.q.CreateAPIToken(ctx, db.CreateAPITokenParams{
+		UserID:    token.UserID,
+		Name:      token.Name,
+		TokenHash: token.TokenHash,
+		Scopes:    token.Scopes,
+		ExpiresAt: token.ExpiresAt,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				return nil, fmt.Errorf("api token already exists: %w", domain.ErrConflict)
+			case "23503":
+				return nil, fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+			}
+		}
+		return nil, fmt.Errorf("failed to create api token: %w", err)
+	}
+	return mapDbAPITokenToDomain(d), nil
+}
+
+func (r *pgxAPITokenRepository) GetByHash(ctx context.Context, tokenHash string) (*domain.APIToken, error) {
+	d, err := r.q.GetAPITokenByHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+	return mapDbAPITokenToDomain(d), nil
+}
+
+func (r *pgxAPITokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.APIToken, error) {
+	rows, err := r.q.ListAPITokensByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+	tokens := make([]domain.APIToken, len(rows))
+	for i, row := range rows {
+		tokens[i] = *mapDbAPITokenToDomain(row)
+	}
+	return tokens, nil
+}
+
+func (r *pgxAPITokenRepository) RecordUse(ctx context.Context, id uuid.UUID, interval time.Duration) error {
+	if err := r.q.RecordAPITokenUse(ctx, id, time.Now().Add(-interval)); err != nil {
+		return fmt.Errorf("failed to record api token use: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxAPITokenRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	n, err := r.q.DeleteAPIToken(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api token: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pgxAttachmentRepository struct {
+	q    *db.Queries
+	pool *pgxpool.Pool
+}
+
+func NewPgxAttachmentRepository(queries *db.Queries, pool *pgxpool.Pool) AttachmentRepository {
+	return &pgxAttachmentRepository{q: queries, pool: pool}
+}
+
+// --- Mapping functions ---
+func mapDbAttachmentToDomain(d db.Attachment) *domain.Attachment {
+	return &domain.Attachment{
+		ID:          d.ID,
+		TodoID:      d.TodoID,
+		UserID:      d.UserID,
+		FileName:    d.FileName,
+		StoragePath: d.StoragePath,
+		ContentType: d.ContentType,
+		Size:        d.Size,
+		UploadedAt:  d.UploadedAt,
+
+		ThumbnailSmallPath: domain.NullStringToStringPtr(nullStringFromText(d.ThumbnailSmallPath)),
+		ThumbnailLargePath: domain.NullStringToStringPtr(nullStringFromText(d.ThumbnailLargePath)),
+		ContentHash:        domain.NullStringToStringPtr(nullStringFromText(d.ContentHash)),
+		ScanStatus:         domain.ScanStatus(d.ScanStatus),
+		ScannedAt:          d.ScannedAt,
+	}
+}
+
+func mapDbAttachmentBlobToDomain(d db.AttachmentBlob) *domain.AttachmentBlob {
+	return &domain.AttachmentBlob{
+		ContentHash:        d.ContentHash,
+		StoragePath:        d.StoragePath,
+		ContentType:        d.ContentType,
+		Size:               d.Size,
+		ThumbnailSmallPath: domain.NullStringToStringPtr(nullStringFromText(d.ThumbnailSmallPath)),
+		ThumbnailLargePath: domain.NullStringToStringPtr(nullStringFromText(d.ThumbnailLargePath)),
+		RefCount:           int(d.RefCount),
+		CreatedAt:          d.CreatedAt,
+	}
+}
+
+func mapDbAttachmentsToDomain(ds []db.Attachment) []domain.Attachment {
+	out := make([]domain.Attachment, len(ds))
+	for i, d := range ds {
+		out[i] = *mapDbAttachmentToDomain(d)
+	}
+	return out
+}
+
+// --- Repository Methods ---
+
+// Create inserts the attachment. When it has a ContentHash, the blob for that content
+// is created or reused in the same transaction, and the returned attachment carries
+// the blob's storage and thumbnail paths, which may differ from the ones passed in.
+func (r *pgxAttachmentRepository) Create(
+	ctx context.Context,
+	attachment *domain.Attachment,
+) (*domain.Attachment, error) {
+	if attachment.ContentHash != nil {
+		return r.createWithBlob(ctx, attachment)
+	}
+	return r.create(ctx, r.q, attachment)
+}
+
+func (r *pgxAttachmentRepository) createWithBlob(
+	ctx context.Context,
+	attachment *domain.Attachment,
+) (*domain.Attachment, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	blob, err := qtx.UpsertAttachmentBlob(ctx, db.UpsertAttachmentBlobParams{
+		ContentHash:        *attachment.ContentHash,
+		StoragePath:        attachment.StoragePath,
+		ContentType:        attachment.ContentType,
+		Size:               attachment.Size,
+		ThumbnailSmallPath: pgTextFromPtr(attachment.ThumbnailSmallPath),
+		ThumbnailLargePath: pgTextFromPtr(attachment.ThumbnailLargePath),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert attachment blob: %w", err)
+	}
+
+	created, err := r.create(ctx, qtx, withBlobFiles(attachment, blob))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit attachment tx: %w", err)
+	}
+	return created, nil
+}
+
+// ShareBlob creates an attachment on the files of the blob its content hash names. Unlike
+// Create it never stores a new blob, and fails with domain.ErrNotFound once it's released.
+func (r *pgxAttachmentRepository) ShareBlob(
+	ctx context.Context,
+	attachment *domain.Attachment,
+) (*domain.Attachment, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	blob, err := qtx.LockAttachmentBlob(ctx, *attachment.ContentHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to lock attachment blob: %w", err)
+	}
+	created, err := r.create(ctx, qtx, withBlobFiles(attachment, blob))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit attachment tx: %w", err)
+	}
+	return created, nil
+}
+
+// withBlobFiles returns a copy of attachment pointing at the blob's files
+func withBlobFiles(attachment *domain.Attachment, blob db.AttachmentBlob) *domain.Attachment {
+	shared := *attachment
+	shared.StoragePath = blob.StoragePath
+	shared.ContentType = blob.ContentType
+	shared.ThumbnailSmallPath = domain.NullStringToStringPtr(nullStringFromText(blob.ThumbnailSmallPath))
+	shared.ThumbnailLargePath = domain.NullStringToStringPtr(nullStringFromText(blob.ThumbnailLargePath))
+	return &shared
+}
+
+func (r *pgxAttachmentRepository) create(
+	ctx context.Context,
+	q *db.Queries,
+	attachment *domain.Attachment,
+) (*domain.Attachment, error) {
+	params := db.CreateAttachmentParams{
+		TodoID:      attachment.TodoID,
+		UserID:      attachment.UserID,
+		FileName:    attachment.FileName,
+		StoragePath: attachment.StoragePath,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+
+		ThumbnailSmallPath: pgTextFromPtr(attachment.ThumbnailSmallPath),
+		ThumbnailLargePath: pgTextFromPtr(attachment.ThumbnailLargePath),
+		ContentHash:        pgTextFromPtr(attachment.ContentHash),
+		ScanStatus:         string(attachment.ScanStatus),
+		ScannedAt:          attachment.ScannedAt,
+	}
+	d, err := q.CreateAttachment(ctx, params)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, fmt.Errorf("parent todo %s not found: %w", attachment.TodoID, domain.ErrBadRequest)
+		}
+		return nil, fmt.Errorf("failed to create attachment: %w", err)
+	}
+	return mapDbAttachmentToDomain(d), nil
+}
+
+func (r *pgxAttachmentRepository) GetByID(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) (*domain.Attachment, error) {
+	d, err := r.q.GetAttachmentByID(ctx, db.GetAttachmentByIDParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return mapDbAttachmentToDomain(d), nil
+}
+
+func (r *pgxAttachmentRepository) GetByStoragePath(
+	ctx context.Context,
+	storagePath string,
+	userID uuid.UUID,
+) (*domain.Attachment, error) {
+	d, err := r.q.GetAttachmentByStoragePath(ctx, db.GetAttachmentByStoragePathParams{
+		StoragePath: storagePath,
+		UserID:      userID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return mapDbAttachmentToDomain(d), nil
+}
+
+func (r *pgxAttachmentRepository) ListByTodo(
+	ctx context.Context,
+	todoID, userID uuid.UUID,
+) ([]domain.Attachment, error) {
+	ds, err := r.q.ListAttachmentsForTodo(ctx, db.ListAttachmentsForTodoParams{
+		TodoID: todoID,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return []domain.Attachment{}, nil
+		}
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	return mapDbAttachmentsToDomain(ds), nil
+}
+
+// ListByTodoIDs loads the attachments of several todos in one query, avoiding N+1 lookups on list endpoints
+func (r *pgxAttachmentRepository) ListByTodoIDs(
+	ctx context.Context,
+	todoIDs []uuid.UUID,
+	userID uuid.UUID,
+) ([]domain.Attachment, error) {
+	if len(todoIDs) == 0 {
+		return []domain.Attachment{}, nil
+	}
+	ds, err := r.q.ListAttachmentsForTodos(ctx, db.ListAttachmentsForTodosParams{
+		UserID:  userID,
+		TodoIds: todoIDs,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return []domain.Attachment{}, nil
+		}
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	return mapDbAttachmentsToDomain(ds), nil
+}
+
+func (r *pgxAttachmentRepository) TotalSizeByUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) (int64, error) {
+	used, err := r.q.GetUserStorageUsage(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	return used, nil
+}
+
+func (r *pgxAttachmentRepository) GetBlob(
+	ctx context.Context,
+	contentHash string,
+) (*domain.AttachmentBlob, error) {
+	d, err := r.q.GetAttachmentBlob(ctx, contentHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get attachment blob: %w", err)
+	}
+	return mapDbAttachmentBlobToDomain(d), nil
+}
+
+func (r *pgxAttachmentRepository) ReferencesBlob(
+	ctx context.Context,
+	userID uuid.UUID,
+	contentHash string,
+) (bool, error) {
+	referenced, err := r.q.UserReferencesAttachmentBlob(ctx, db.UserReferencesAttachmentBlobParams{
+		ContentHash: pgTextFromPtr(&contentHash),
+		UserID:      userID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check attachment blob references: %w", err)
+	}
+	return referenced, nil
+}
+
+// ReleaseBlob deletes the blob if no attachment references it any more and returns it,
+// so the caller can remove its files. It returns nil if the blob is still in use.
+func (r *pgxAttachmentRepository) ReleaseBlob(
+	ctx context.Context,
+	contentHash string,
+) (*domain.AttachmentBlob, error) {
+	d, err := r.q.DeleteUnreferencedAttachmentBlob(ctx, contentHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to release attachment blob: %w", err)
+	}
+	return mapDbAttachmentBlobToDomain(d), nil
+}
+
+func (r *pgxAttachmentRepository) DeleteUnreferencedBlobs(ctx context.Context) ([]domain.AttachmentBlob, error) {
+	ds, err := r.q.DeleteUnreferencedAttachmentBlobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete unreferenced attachment blobs: %w", err)
+	}
+	blobs := make([]domain.AttachmentBlob, len(ds))
+	for i, d := range ds {
+		blobs[i] = *mapDbAttachmentBlobToDomain(d)
+	}
+	return blobs, nil
+}
+
+func (r *pgxAttachmentRepository) FilterReferenced(
+	ctx context.Context,
+	storagePaths []string,
+) ([]string, error) {
+	if len(storagePaths) == 0 {
+		return []string{}, nil
+	}
+	paths, err := r.q.ListReferencedStoragePaths(ctx, storagePaths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list referenced storage paths: %w", err)
+	}
+	return paths, nil
+}
+
+func (r *pgxAttachmentRepository) ListStoredFiles(ctx context.Context) ([]domain.StoredFile, error) {
+	ds, err := r.q.ListStoredFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored files: %w", err)
+	}
+	files := make([]domain.StoredFile, len(ds))
+	for i, d := range ds {
+		files[i] = domain.StoredFile{
+			StoragePath: d.Path,
+			FileName:    d.FileName,
+			ContentType: d.ContentType,
+			ContentHash: domain.NullStringToStringPtr(nullStringFromText(d.ContentHash)),
+		}
+	}
+	return files, nil
+}
+
+// RewriteStoragePaths repoints attachments and blobs in a single transaction, so
+// the database never references a mix of old and new paths for one file.
+func (r *pgxAttachmentRepository) RewriteStoragePaths(
+	ctx context.Context,
+	newPaths map[string]string,
+) (int64, error) {
+	if len(newPaths) == 0 {
+		return 0, nil
+	}
+	oldPaths := make([]string, 0, len(newPaths))
+	replacements := make([]string, 0, len(newPaths))
+	for oldPath, newPath := range newPaths {
+		oldPaths = append(oldPaths, oldPath)
+		replacements = append(replacements, newPath)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	attachments, err := qtx.RewriteAttachmentStoragePaths(ctx, db.RewriteAttachmentStoragePathsParams{
+		OldPaths: oldPaths,
+		NewPaths: replacements,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rewrite attachment storage paths: %w", err)
+	}
+	blobs, err := qtx.RewriteAttachmentBlobStoragePaths(ctx, db.RewriteAttachmentBlobStoragePathsParams{
+		OldPaths: oldPaths,
+		NewPaths: replacements,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rewrite attachment blob storage paths: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit storage path tx: %w", err)
+	}
+	return attachments + blobs, nil
+}
+
+func (r *pgxAttachmentRepository) Delete(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) error {
+	if err := r.q.DeleteAttachment(ctx, db.DeleteAttachmentParams{
+		ID:     id,
+		UserID: userID,
+	}); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pgxAttachmentUploadRepository struct {
+	q    *db.Queries
+	pool *pgxpool.Pool
+}
+
+func NewPgxAttachmentUploadRepository(queries *db.Queries, pool *pgxpool.Pool) AttachmentUploadRepository {
+	return &pgxAttachmentUploadRepository{q: queries, pool: pool}
+}
+
+// --- Mapping functions ---
+func mapDbAttachmentUploadToDomain(d db.AttachmentUpload) *domain.AttachmentUpload {
+	return &domain.AttachmentUpload{
+		ID:        d.ID,
+		TodoID:    d.TodoID,
+		UserID:    d.UserID,
+		FileName:  d.FileName,
+		Length:    d.UploadLength,
+		Offset:    d.UploadOffset,
+		CreatedAt: d.CreatedAt,
+		ExpiresAt: d.ExpiresAt,
+	}
+}
+
+// exceeded checks the user's existing uploads plus one of the given length against the limit
+func (l PendingUploadLimit) exceeded(uploads int, totalLength, length int64) error {
+	if uploads >= l.Count {
+		return fmt.Errorf("%d unfinished uploads already in progress: %w", uploads, domain.ErrTooManyRequests)
+	}
+	if l.Bytes >= 0 && totalLength+length > l.Bytes {
+		return fmt.Errorf("unfinished uploads would take %d bytes, %d are available: %w", totalLength+length, l.Bytes, domain.ErrTooLarge)
+	}
+	return nil
+}
+
+// --- Repository Methods ---
+
+// Create checks the user's pending uploads and inserts the new one in a transaction that
+// holds the user's row, so concurrent creates can't all squeeze under the limit.
+func (r *pgxAttachmentUploadRepository) Create(
+	ctx context.Context,
+	upload *domain.AttachmentUpload,
+	limit PendingUploadLimit,
+) (*domain.AttachmentUpload, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	if err := qtx.LockUserAttachmentUploads(ctx, upload.UserID); err != nil {
+		return nil, fmt.Errorf("failed to lock user for upload: %w", err)
+	}
+	pending, err := qtx.GetPendingAttachmentUploads(ctx, upload.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pending uploads: %w", err)
+	}
+	if err := limit.exceeded(int(pending.Uploads), pending.TotalLength, upload.Length); err != nil {
+		return nil, err
+	}
+
+	d, err := qtx.CreateAttachmentUpload(ctx, db.CreateAttachmentUploadParams{
+		TodoID:       upload.TodoID,
+		UserID:       upload.UserID,
+		FileName:     upload.FileName,
+		UploadLength: upload.Length,
+		ExpiresAt:    upload.ExpiresAt,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, fmt.Errorf("parent todo %s not found: %w", upload.TodoID, domain.ErrBadRequest)
+		}
+		return nil, fmt.Errorf("failed to create attachment upload: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit upload tx: %w", err)
+	}
+	return mapDbAttachmentUploadToDomain(d), nil
+}
+
+func (r *pgxAttachmentUploadRepository) GetByID(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) (*domain.AttachmentUpload, error) {
+	d, err := r.q.GetAttachmentUploadByID(ctx, db.GetAttachmentUploadByIDParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get attachment upload: %w", err)
+	}
+	return mapDbAttachmentUploadToDomain(d), nil
+}
+
+// UpdateOffset moves the offset from oldOffset to newOffset. If another request
+// already moved it, domain.ErrConflict is returned and nothing changes.
+func (r *pgxAttachmentUploadRepository) UpdateOffset(
+	ctx context.Context,
+	id, userID uuid.UUID,
+	oldOffset, newOffset int64,
+	expiresAt time.Time,
+) (*domain.AttachmentUpload, error) {
+	d, err := r.q.UpdateAttachmentUploadOffset(ctx, db.UpdateAttachmentUploadOffsetParams{
+		NewOffset: newOffset,
+		ExpiresAt: expiresAt,
+		ID:        id,
+		UserID:    userID,
+		OldOffset: oldOffset,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("upload %s is no longer at offset %d: %w", id, oldOffset, domain.ErrConflict)
+		}
+		return nil, fmt.Errorf("failed to update attachment upload: %w", err)
+	}
+	return mapDbAttachmentUploadToDomain(d), nil
+}
+
+func (r *pgxAttachmentUploadRepository) Delete(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) error {
+	if err := r.q.DeleteAttachmentUpload(ctx, db.DeleteAttachmentUploadParams{
+		ID:     id,
+		UserID: userID,
+	}); err != nil {
+		return fmt.Errorf("failed to delete attachment upload: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxAttachmentUploadRepository) DeleteExpired(ctx context.Context) ([]uuid.UUID, error) {
+	ids, err := r.q.DeleteExpiredAttachmentUploads(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired attachment uploads: %w", err)
+	}
+	return ids, nil
+}
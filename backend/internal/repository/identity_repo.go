@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pgxIdentityRepository struct {
+	q    *db.Queries
+	pool *pgxpool.Pool
+}
+
+func NewPgxIdentityRepository(queries *db.Queries, pool *pgxpool.Pool) IdentityRepository {
+	return &pgxIdentityRepository{q: queries, pool: pool}
+}
+
+// --- Mapping functions ---
+func mapDbUserIdentityToDomain(d db.UserIdentity) *domain.UserIdentity {
+	var email *string
+	if d.Email.Valid {
+		email = &d.Email.String
+	}
+	return &domain.UserIdentity{
+		ID:          d.ID,
+		UserID:      d.UserID,
+		Provider:    d.Provider,
+		Subject:     d.Subject,
+		Email:       email,
+		CreatedAt:   d.CreatedAt,
+		LastLoginAt: d.LastLoginAt,
+	}
+}
+
+func identityEmailToPg(email *string) pgtype.Text {
+	if email == nil {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: *email, Valid: true}
+}
+
+// --- Repository Methods ---
+
+func (r *pgxIdentityRepository) Create(ctx context.Context, identity *domain.UserIdentity) (*domain.UserIdentity, error) {
+	return createIdentity(ctx, r.q, identity)
+}
+
+func createIdentity(ctx context.Context, q *db.Queries, identity *domain.UserIdentity) (*domain.UserIdentity, error) {
+	d, err := q.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		UserID:   identity.UserID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identityEmailToPg(identity.Email),
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				return nil, fmt.Errorf("%s account is already linked: %w", identity.Provider, domain.ErrConflict)
+			case "23503":
+				return nil, fmt.Errorf("user %s not found: %w", identity.UserID, domain.ErrNotFound)
+			}
+		}
+		return nil, fmt.Errorf("failed to create identity: %w", err)
+	}
+	return mapDbUserIdentityToDomain(d), nil
+}
+
+func (r *pgxIdentityRepository) CreateWithUser(ctx context.Context, user *domain.User, identity *domain.UserIdentity) (*domain.User, *domain.UserIdentity, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	dbUser, err := qtx.CreateUser(ctx, db.CreateUserParams{
+		Username:      user.Username,
+		Email:         user.Email,
+		PasswordHash:  user.PasswordHash,
+		EmailVerified: user.EmailVerified,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, nil, domain.ErrConflict
+		}
+		return nil, nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	link := *identity
+	link.UserID = dbUser.ID
+	created, err := createIdentity(ctx, qtx, &link)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("commit user identity tx: %w", err)
+	}
+	return mapDbUserToDomain(dbUser), created, nil
+}
+
+func (r *pgxIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	d, err := r.q.GetUserIdentityBySubject(ctx, provider, subject)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	return mapDbUserIdentityToDomain(d), nil
+}
+
+func (r *pgxIdentityRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.UserIdentity, error) {
+	rows, err := r.q.ListUserIdentitiesByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	identities := make([]domain.UserIdentity, len(rows))
+	for i, row := range rows {
+		identities[i] = *mapDbUserIdentityToDomain(row)
+	}
+	return identities, nil
+}
+
+func (r *pgxIdentityRepository) RecordLogin(ctx context.Context, id uuid.UUID, email *string) error {
+	if err := r.q.RecordUserIdentityLogin(ctx, id, identityEmailToPg(email)); err != nil {
+		return fmt.Errorf("failed to record identity login: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxIdentityRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	n, err := r.q.DeleteUserIdentity(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -22,9 +22,11 @@ type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) (*domain.User, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
-	GetByGoogleID(ctx context.Context, googleID string) (*domain.User, error)
 	Update(ctx context.Context, id uuid.UUID, updateData *domain.User) (*domain.User, error)
 	Delete(ctx context.Context, id uuid.UUID) error
+	IncrementTokenVersion(ctx context.Context, id uuid.UUID) (*domain.User, error) // Invalidates every access token issued so far
+	// MarkVerificationSent fails with domain.ErrConflict if a verification email went out after sentBefore
+	MarkVerificationSent(ctx context.Context, id uuid.UUID, sentBefore time.Time) (*domain.User, error)
 }
 
 type TagRepository interface {
@@ -56,8 +58,6 @@ type TodoRepository interface {
 	RemoveTag(ctx context.Context, todoID, tagID uuid.UUID) error
 	SetTags(ctx context.Context, todoID uuid.UUID, tagIDs []uuid.UUID) error
 	GetTags(ctx context.Context, todoID uuid.UUID) ([]domain.Tag, error)
-	// Attachment URL management
-	UpdateAttachmentURL(ctx context.Context, todoID, userID uuid.UUID, attachmentURL *string) error
 }
 
 type SubtaskRepository interface {
@@ -69,6 +69,134 @@ type SubtaskRepository interface {
 	GetParentTodoID(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
 }
 
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *domain.Attachment) (*domain.Attachment, error)
+	GetByID(ctx context.Context, id, userID uuid.UUID) (*domain.Attachment, error)
+	GetByStoragePath(ctx context.Context, storagePath string, userID uuid.UUID) (*domain.Attachment, error)
+	ListByTodo(ctx context.Context, todoID, userID uuid.UUID) ([]domain.Attachment, error)
+	ListByTodoIDs(ctx context.Context, todoIDs []uuid.UUID, userID uuid.UUID) ([]domain.Attachment, error)
+	TotalSizeByUser(ctx context.Context, userID uuid.UUID) (int64, error) // Bytes charged to the user, counting each shared blob once
+	Delete(ctx context.Context, id, userID uuid.UUID) error
+	// FilterReferenced returns the subset of storagePaths that any user's attachment still points at
+	FilterReferenced(ctx context.Context, storagePaths []string) ([]string, error)
+	// Blobs are deduplicated file contents shared across users; the database keeps their reference counts
+	GetBlob(ctx context.Context, contentHash string) (*domain.AttachmentBlob, error)
+	ShareBlob(ctx context.Context, attachment *domain.Attachment) (*domain.Attachment, error) // Create on an existing blob's files; domain.ErrNotFound once it's released
+	ReferencesBlob(ctx context.Context, userID uuid.UUID, contentHash string) (bool, error)   // Whether the user already has an attachment sharing it
+	ReleaseBlob(ctx context.Context, contentHash string) (*domain.AttachmentBlob, error)      // nil while still referenced
+	DeleteUnreferencedBlobs(ctx context.Context) ([]domain.AttachmentBlob, error)
+	// ListStoredFiles and RewriteStoragePaths let a storage migration find every referenced file and repoint it
+	ListStoredFiles(ctx context.Context) ([]domain.StoredFile, error)
+	RewriteStoragePaths(ctx context.Context, newPaths map[string]string) (int64, error) // Keyed by old path; one transaction, returns rows changed
+}
+
+// AttachmentUploadRepository tracks resumable uploads that haven't been committed yet
+type AttachmentUploadRepository interface {
+	// Create fails with domain.ErrTooManyRequests when the user already has limit.Count unexpired
+	// uploads, and with domain.ErrTooLarge when their declared lengths would pass limit.Bytes
+	Create(ctx context.Context, upload *domain.AttachmentUpload, limit PendingUploadLimit) (*domain.AttachmentUpload, error)
+	GetByID(ctx context.Context, id, userID uuid.UUID) (*domain.AttachmentUpload, error)
+	// UpdateOffset fails with domain.ErrConflict unless the stored offset is still oldOffset
+	UpdateOffset(ctx context.Context, id, userID uuid.UUID, oldOffset, newOffset int64, expiresAt time.Time) (*domain.AttachmentUpload, error)
+	Delete(ctx context.Context, id, userID uuid.UUID) error
+	DeleteExpired(ctx context.Context) ([]uuid.UUID, error) // Returns the IDs of the removed uploads
+}
+
+// PendingUploadLimit bounds the unfinished uploads a user may have at once, counting the new one
+type PendingUploadLimit struct {
+	Count int
+	Bytes int64 // Sum of the declared lengths; negative is unlimited
+}
+
+// RefreshTokenRepository stores hashed refresh tokens and their rotation state
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *domain.RefreshToken) (*domain.RefreshToken, error)
+	GetByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	// Rotate fails with domain.ErrConflict unless the token is still unused and unrevoked
+	Rotate(ctx context.Context, id uuid.UUID, successor *domain.RefreshToken) (*domain.RefreshToken, error)
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+	DeleteExpired(ctx context.Context) (int64, error) // Returns how many were removed
+}
+
+// RevokedTokenRepository records access tokens revoked before they expire, by jti
+type RevokedTokenRepository interface {
+	Revoke(ctx context.Context, token *domain.RevokedToken) error
+	IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error)
+	DeleteExpired(ctx context.Context) (int64, error) // Returns how many were removed
+}
+
+// PasswordResetRepository stores hashed, single-use password reset tokens
+type PasswordResetRepository interface {
+	// Create fails with domain.ErrConflict if the user got a token after createdAfter
+	Create(ctx context.Context, token *domain.PasswordResetToken, createdAfter time.Time) (*domain.PasswordResetToken, error)
+	// Redeem uses up the unexpired, unused token with tokenHash, sets the user's password hash and voids
+	// their other reset tokens, all at once. It fails with domain.ErrNotFound if there is no such token.
+	Redeem(ctx context.Context, tokenHash, passwordHash string) (*domain.PasswordResetToken, error)
+	DeleteExpired(ctx context.Context) (int64, error) // Returns how many were removed
+}
+
+// MFARepository stores second login factors: a TOTP authenticator and its recovery codes
+type MFARepository interface {
+	GetTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPFactor, error)
+	// SetPendingTOTP starts or restarts an enrollment. It fails with domain.ErrConflict once the factor is confirmed.
+	SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) (*domain.TOTPFactor, error)
+	// ConfirmTOTP enables the factor, records the time step of the code that proved it and replaces
+	// the recovery codes, all at once. It fails with domain.ErrConflict if the factor was already confirmed.
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) (*domain.TOTPFactor, error)
+	// UseTOTPStep records a good code and clears the failure count. It fails with domain.ErrConflict
+	// if a code for step or a later one was already used.
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+	RecordFailure(ctx context.Context, userID uuid.UUID) (int32, error) // Returns the wrong codes since the last good one
+	ResetFailures(ctx context.Context, userID uuid.UUID) error          // Also ends any lockout
+	// Lock refuses codes until until. The failure count starts over; the lockout count grows until a good code.
+	Lock(ctx context.Context, userID uuid.UUID, until time.Time) error
+	DeleteTOTP(ctx context.Context, userID uuid.UUID) error                                 // Also deletes the recovery codes
+	ListRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]domain.RecoveryCode, error) // Unused ones only
+	UseRecoveryCode(ctx context.Context, id uuid.UUID) error                                // Fails with domain.ErrConflict if already used
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+}
+
+// WebAuthnRepository stores passkeys
+type WebAuthnRepository interface {
+	Create(ctx context.Context, cred *domain.WebAuthnCredential) (*domain.WebAuthnCredential, error) // Fails with domain.ErrConflict if the credential ID is taken
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*domain.WebAuthnCredential, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error)
+	UpdateUsage(ctx context.Context, id uuid.UUID, signCount uint32) error // Also sets the last used time
+	Delete(ctx context.Context, id, userID uuid.UUID) error
+}
+
+// IdentityRepository stores the external OpenID Connect / OAuth2 accounts users log in with
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *domain.UserIdentity) (*domain.UserIdentity, error) // Fails with domain.ErrConflict if the account or the user's provider slot is taken
+	// CreateWithUser creates a user and their first identity together, so a failed link leaves no half-made account
+	CreateWithUser(ctx context.Context, user *domain.User, identity *domain.UserIdentity) (*domain.User, *domain.UserIdentity, error)
+	GetBySubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.UserIdentity, error)
+	RecordLogin(ctx context.Context, id uuid.UUID, email *string) error // Sets the last login time and refreshes the email
+	Delete(ctx context.Context, id, userID uuid.UUID) error
+}
+
+// APITokenRepository stores personal access tokens
+type APITokenRepository interface {
+	Create(ctx context.Context, token *domain.APIToken) (*domain.APIToken, error)
+	GetByHash(ctx context.Context, tokenHash string) (*domain.APIToken, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.APIToken, error)
+	RecordUse(ctx context.Context, id uuid.UUID, interval time.Duration) error // Sets the last used time unless it's within interval
+	Delete(ctx context.Context, id, userID uuid.UUID) error
+}
+
+// LoginAttemptRepository counts failed logins per key. Get fails with domain.ErrNotFound
+// for a key without failures. RecordFailure is atomic, so concurrent logins each get their
+// own count; Release takes back one that turned out not to be a failure.
+type LoginAttemptRepository interface {
+	Get(ctx context.Context, key string) (*domain.LoginAttempts, error)
+	RecordFailure(ctx context.Context, key string, resetAfter time.Duration) (*domain.LoginAttempts, error) // Counting starts over when the last failure is older than resetAfter
+	Release(ctx context.Context, key string, failures int) error                                            // failures is the count RecordFailure returned
+	Reset(ctx context.Context, key string) error
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
 // Transactioner interface allows services to run operations within a DB transaction
 type Transactioner interface {
 	BeginTx(ctx context.Context) (*db.Queries, error)
@@ -76,10 +204,20 @@ type Transactioner interface {
 
 // RepositoryRegistry bundles all repositories together, often useful for dependency injection
 type RepositoryRegistry struct {
-	UserRepo    UserRepository
-	TagRepo     TagRepository
-	TodoRepo    TodoRepository
-	SubtaskRepo SubtaskRepository
+	UserRepo         UserRepository
+	TagRepo          TagRepository
+	TodoRepo         TodoRepository
+	SubtaskRepo      SubtaskRepository
+	AttachmentRepo   AttachmentRepository
+	UploadRepo       AttachmentUploadRepository
+	RefreshRepo      RefreshTokenRepository
+	RevokedRepo      RevokedTokenRepository
+	ResetRepo        PasswordResetRepository
+	MFARepo          MFARepository
+	WebAuthnRepo     WebAuthnRepository
+	IdentityRepo     IdentityRepository
+	APITokenRepo     APITokenRepository
+	LoginAttemptRepo LoginAttemptRepository // Postgres; main swaps in NewCacheLoginAttemptRepository for loginThrottle.store = cache
 	*db.Queries
 	Pool *pgxpool.Pool
 }
@@ -92,15 +230,37 @@ func NewRepositoryRegistry(pool *pgxpool.Pool, cache cache.Cache, logger *slog.L
 	pgxTagRepo := NewPgxTagRepository(queries)
 	pgxTodoRepo := NewPgxTodoRepository(queries, pool)
 	pgxSubtaskRepo := NewPgxSubtaskRepository(queries)
+	pgxAttachmentRepo := NewPgxAttachmentRepository(queries, pool)
+	pgxUploadRepo := NewPgxAttachmentUploadRepository(queries, pool)
+	pgxRefreshRepo := NewPgxRefreshTokenRepository(queries, pool)
+
+	pgxRevokedRepo := NewPgxRevokedTokenRepository(queries)
+	pgxResetRepo := NewPgxPasswordResetRepository(queries, pool)
+	pgxMFARepo := NewPgxMFARepository(queries, pool)
+	pgxWebAuthnRepo := NewPgxWebAuthnRepository(queries)
+	pgxIdentityRepo := NewPgxIdentityRepository(queries, pool)
+	pgxAPITokenRepo := NewPgxAPITokenRepository(queries)
+	pgxLoginAttemptRepo := NewPgxLoginAttemptRepository(queries)
 
 	cachingTagRepo := NewCachingTagRepository(pgxTagRepo, cache, logger)
+	cachingRevokedRepo := NewCachingRevokedTokenRepository(pgxRevokedRepo, cache, logger)
 
 	return &RepositoryRegistry{
-		UserRepo:    pgxUserRepo,    // Not cached yet in this example
-		TagRepo:     cachingTagRepo, // Use the caching decorator
-		TodoRepo:    pgxTodoRepo,    // Not cached yet in this example
-		SubtaskRepo: pgxSubtaskRepo, // Not cached yet in this example
-		Queries:     queries,
-		Pool:        pool,
+		UserRepo:         pgxUserRepo,       // Not cached yet in this example
+		TagRepo:          cachingTagRepo,    // Use the caching decorator
+		TodoRepo:         pgxTodoRepo,       // Not cached yet in this example
+		SubtaskRepo:      pgxSubtaskRepo,    // Not cached yet in this example
+		AttachmentRepo:   pgxAttachmentRepo, // Not cached yet in this example
+		UploadRepo:       pgxUploadRepo,     // Not cached yet in this example
+		RefreshRepo:      pgxRefreshRepo,
+		RevokedRepo:      cachingRevokedRepo, // Checked on every authenticated request
+		ResetRepo:        pgxResetRepo,
+		MFARepo:          pgxMFARepo,
+		WebAuthnRepo:     pgxWebAuthnRepo,
+		IdentityRepo:     pgxIdentityRepo,
+		APITokenRepo:     pgxAPITokenRepo,
+		LoginAttemptRepo: pgxLoginAttemptRepo,
+		Queries:          queries,
+		Pool:             pool,
 	}
 }
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgxLoginAttemptRepository struct {
+	q *db.Queries
+}
+
+func NewPgxLoginAttemptRepository(queries *db.Queries) LoginAttemptRepository {
+	return &pgxLoginAttemptRepository{q: queries}
+}
+
+// --- Mapping functions ---
+func mapDbLoginAttemptToDomain(d db.LoginAttempt) *domain.LoginAttempts {
+	return &domain.LoginAttempts{
+		Key:              d.Key,
+		Failures:         int(d.Failures),
+		LastFailedAt:     d.LastFailedAt,
+		PreviousFailedAt: d.PreviousFailedAt,
+	}
+}
+
+// --- Repository Methods ---
+
+func (r *pgxLoginAttemptRepository) Get(ctx context.Context, key string) (*domain.LoginAttempts, error) {
+	d, err := r.q.GetLoginAttempts(ctx, key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+	return mapDbLoginAttemptToDomain(d), nil
+}
+
+func (r *pgxLoginAttemptRepository) RecordFailure(ctx context.Context, key string, resetAfter time.Duration) (*domain.LoginAttempts, error) {
+	d, err := r.q.RecordLoginFailure(ctx, key, time.Now().Add(-resetAfter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return mapDbLoginAttemptToDomain(d), nil
+}
+
+func (r *pgxLoginAttemptRepository) Release(ctx context.Context, key string, failures int) error {
+	if err := r.q.ReleaseLoginFailure(ctx, key, int32(failures)); err != nil {
+		return fmt.Errorf("failed to release login failure: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	if err := r.q.ResetLoginAttempts(ctx, key); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxLoginAttemptRepository) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	n, err := r.q.DeleteStaleLoginAttempts(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/cache"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+)
+
+// cacheLoginAttemptRepository keeps failed login counts in the cache, where they expire
+// on their own. The counts are per process, so with several replicas an attacker gets
+// the threshold on each of them; use the Postgres repository there.
+type cacheLoginAttemptRepository struct {
+	mu    sync.Mutex // Makes the read-modify-writes in RecordFailure and Release atomic
+	cache cache.Cache
+}
+
+// cachedLoginAttempts remembers resetAfter, so Release can keep the entry's expiry
+type cachedLoginAttempts struct {
+	attempts   domain.LoginAttempts
+	resetAfter time.Duration
+}
+
+func NewCacheLoginAttemptRepository(cache cache.Cache) LoginAttemptRepository {
+	return &cacheLoginAttemptRepository{cache: cache}
+}
+
+// --- Cache Key Generation ---
+func loginAttemptsCacheKey(key string) string {
+	return "login_attempts:" + key
+}
+
+// get returns the entry for key, the caller holds mu
+func (r *cacheLoginAttemptRepository) get(ctx context.Context, key string) (cachedLoginAttempts, bool) {
+	if cached, found := r.cache.Get(ctx, loginAttemptsCacheKey(key)); found {
+		if entry, ok := cached.(cachedLoginAttempts); ok {
+			return entry, true
+		}
+	}
+	return cachedLoginAttempts{}, false
+}
+
+// --- LoginAttemptRepository Interface Implementation ---
+
+func (r *cacheLoginAttemptRepository) Get(ctx context.Context, key string) (*domain.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.get(ctx, key); ok {
+		return &entry.attempts, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *cacheLoginAttemptRepository) RecordFailure(ctx context.Context, key string, resetAfter time.Duration) (*domain.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	attempts := domain.LoginAttempts{Key: key}
+	if entry, ok := r.get(ctx, key); ok && !entry.attempts.LastFailedAt.Before(now.Add(-resetAfter)) {
+		attempts = entry.attempts
+	}
+	recordLoginFailure(&attempts, now)
+	r.cache.Set(ctx, loginAttemptsCacheKey(key), cachedLoginAttempts{attempts: attempts, resetAfter: resetAfter}, resetAfter)
+	return &attempts, nil
+}
+
+func (r *cacheLoginAttemptRepository) Release(ctx context.Context, key string, failures int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.get(ctx, key)
+	if !ok {
+		return nil
+	}
+	releaseLoginFailure(&entry.attempts, failures)
+	if ttl := time.Until(entry.attempts.LastFailedAt.Add(entry.resetAfter)); ttl > 0 {
+		r.cache.Set(ctx, loginAttemptsCacheKey(key), entry, ttl)
+	} else {
+		r.cache.Delete(ctx, loginAttemptsCacheKey(key))
+	}
+	return nil
+}
+
+func (r *cacheLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cache.Delete(ctx, loginAttemptsCacheKey(key))
+	return nil
+}
+
+// DeleteStale has nothing to do, entries expire resetAfter after their last failure
+func (r *cacheLoginAttemptRepository) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryAPITokenRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryAPITokenRepository) Create(ctx context.Context, token *domain.APIToken) (*domain.APIToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[token.UserID]; !ok {
+		return nil, fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+	}
+	for _, existing := range r.s.apiTokens {
+		if existing.TokenHash == token.TokenHash {
+			return nil, fmt.Errorf("api token already exists: %w", domain.ErrConflict)
+		}
+	}
+	created := *token
+	created.ID = uuid.New()
+	created.Scopes = slices.Clone(token.Scopes)
+	created.CreatedAt = r.s.now()
+	created.LastUsedAt = nil
+	r.s.apiTokens[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryAPITokenRepository) GetByHash(ctx context.Context, tokenHash string) (*domain.APIToken, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, token := range r.s.apiTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *memoryAPITokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.APIToken, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tokens := []domain.APIToken{}
+	for _, token := range r.s.apiTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b domain.APIToken) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return tokens, nil
+}
+
+func (r *memoryAPITokenRepository) RecordUse(ctx context.Context, id uuid.UUID, interval time.Duration) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.apiTokens[id]
+	if !ok {
+		return nil // Like an UPDATE that matches no rows
+	}
+	now := r.s.now()
+	if token.LastUsedAt != nil && !token.LastUsedAt.Before(now.Add(-interval)) {
+		return nil
+	}
+	token.LastUsedAt = &now
+	r.s.apiTokens[id] = token
+	return nil
+}
+
+func (r *memoryAPITokenRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.apiTokens[id]
+	if !ok || token.UserID != userID {
+		return domain.ErrNotFound
+	}
+	delete(r.s.apiTokens, id)
+	return nil
+}
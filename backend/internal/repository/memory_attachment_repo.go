@@ -0,0 +1,474 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryAttachmentRepository struct {
+	s *memoryStore
+}
+
+func sortAttachmentsByUpload(attachments []domain.Attachment) {
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].UploadedAt.Before(attachments[j].UploadedAt) })
+}
+
+// Create inserts the attachment. As in Postgres, an attachment with a ContentHash takes
+// the storage and thumbnail paths of the existing blob for that content, or creates
+// the blob from its own paths.
+func (r *memoryAttachmentRepository) Create(
+	ctx context.Context,
+	attachment *domain.Attachment,
+) (*domain.Attachment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.create(attachment)
+}
+
+func (r *memoryAttachmentRepository) ShareBlob(
+	ctx context.Context,
+	attachment *domain.Attachment,
+) (*domain.Attachment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.blobs[*attachment.ContentHash]; !ok {
+		return nil, domain.ErrNotFound
+	}
+	return r.create(attachment)
+}
+
+// create adds the attachment, and its blob if it's new, with mu held
+func (r *memoryAttachmentRepository) create(attachment *domain.Attachment) (*domain.Attachment, error) {
+	if _, ok := r.s.todos[attachment.TodoID]; !ok {
+		return nil, fmt.Errorf("parent todo %s not found: %w", attachment.TodoID, domain.ErrBadRequest)
+	}
+
+	now := r.s.now()
+	created := *attachment
+	created.ID = uuid.New()
+	created.UploadedAt = now
+
+	if attachment.ContentHash != nil {
+		key := *attachment.ContentHash
+		blob, ok := r.s.blobs[key]
+		if !ok {
+			blob = domain.AttachmentBlob{
+				ContentHash:        *attachment.ContentHash,
+				StoragePath:        attachment.StoragePath,
+				ContentType:        attachment.ContentType,
+				Size:               attachment.Size,
+				ThumbnailSmallPath: attachment.ThumbnailSmallPath,
+				ThumbnailLargePath: attachment.ThumbnailLargePath,
+				CreatedAt:          now,
+			}
+		}
+		blob.RefCount++
+		r.s.blobs[key] = blob
+
+		created.StoragePath = blob.StoragePath
+		created.ContentType = blob.ContentType
+		created.ThumbnailSmallPath = blob.ThumbnailSmallPath
+		created.ThumbnailLargePath = blob.ThumbnailLargePath
+	}
+
+	r.s.attachments[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryAttachmentRepository) GetByID(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) (*domain.Attachment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	attachment, ok := r.s.attachments[id]
+	if !ok || attachment.UserID != userID {
+		return nil, domain.ErrNotFound
+	}
+	return &attachment, nil
+}
+
+// GetByStoragePath matches the original file or one of its thumbnails. Like the query,
+// it prefers a match on the file itself, then the oldest attachment.
+func (r *memoryAttachmentRepository) GetByStoragePath(
+	ctx context.Context,
+	storagePath string,
+	userID uuid.UUID,
+) (*domain.Attachment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var matches []domain.Attachment
+	for _, attachment := range r.s.attachments {
+		if attachment.UserID == userID && attachment.References(storagePath) {
+			matches = append(matches, attachment)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, domain.ErrNotFound
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if fi, fj := matches[i].StoragePath == storagePath, matches[j].StoragePath == storagePath; fi != fj {
+			return fi
+		}
+		if !matches[i].UploadedAt.Equal(matches[j].UploadedAt) {
+			return matches[i].UploadedAt.Before(matches[j].UploadedAt)
+		}
+		return matches[i].ID.String() < matches[j].ID.String()
+	})
+	return &matches[0], nil
+}
+
+func (r *memoryAttachmentRepository) ListByTodo(
+	ctx context.Context,
+	todoID, userID uuid.UUID,
+) ([]domain.Attachment, error) {
+	return r.ListByTodoIDs(ctx, []uuid.UUID{todoID}, userID)
+}
+
+func (r *memoryAttachmentRepository) ListByTodoIDs(
+	ctx context.Context,
+	todoIDs []uuid.UUID,
+	userID uuid.UUID,
+) ([]domain.Attachment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	wanted := make(map[uuid.UUID]bool, len(todoIDs))
+	for _, id := range todoIDs {
+		wanted[id] = true
+	}
+
+	attachments := []domain.Attachment{}
+	for _, attachment := range r.s.attachments {
+		if attachment.UserID == userID && wanted[attachment.TodoID] {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sortAttachmentsByUpload(attachments)
+	return attachments, nil
+}
+
+// TotalSizeByUser charges each blob the user references once, plus attachments without one
+func (r *memoryAttachmentRepository) TotalSizeByUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var used int64
+	counted := make(map[string]bool)
+	for _, attachment := range r.s.attachments {
+		if attachment.UserID != userID {
+			continue
+		}
+		if attachment.ContentHash == nil {
+			used += attachment.Size
+			continue
+		}
+		if blob, ok := r.s.blobs[*attachment.ContentHash]; ok && !counted[blob.ContentHash] {
+			counted[blob.ContentHash] = true
+			used += blob.Size
+		}
+	}
+	return used, nil
+}
+
+func (r *memoryAttachmentRepository) Delete(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if attachment, ok := r.s.attachments[id]; ok && attachment.UserID == userID {
+		r.s.deleteAttachment(id)
+	}
+	return nil
+}
+
+func (r *memoryAttachmentRepository) FilterReferenced(
+	ctx context.Context,
+	storagePaths []string,
+) ([]string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	referenced := []string{}
+	for _, path := range storagePaths {
+		for _, attachment := range r.s.attachments {
+			if attachment.References(path) {
+				referenced = append(referenced, path)
+				break
+			}
+		}
+	}
+	return referenced, nil
+}
+
+func (r *memoryAttachmentRepository) GetBlob(
+	ctx context.Context,
+	contentHash string,
+) (*domain.AttachmentBlob, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	blob, ok := r.s.blobs[contentHash]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &blob, nil
+}
+
+func (r *memoryAttachmentRepository) ReferencesBlob(
+	ctx context.Context,
+	userID uuid.UUID,
+	contentHash string,
+) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, attachment := range r.s.attachments {
+		if attachment.UserID == userID && attachment.ContentHash != nil && *attachment.ContentHash == contentHash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReleaseBlob deletes the blob if no attachment references it any more and returns it,
+// so the caller can remove its files. It returns nil if the blob is still in use.
+func (r *memoryAttachmentRepository) ReleaseBlob(
+	ctx context.Context,
+	contentHash string,
+) (*domain.AttachmentBlob, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	blob, ok := r.s.blobs[contentHash]
+	if !ok || blob.RefCount > 0 {
+		return nil, nil
+	}
+	delete(r.s.blobs, contentHash)
+	return &blob, nil
+}
+
+func (r *memoryAttachmentRepository) DeleteUnreferencedBlobs(ctx context.Context) ([]domain.AttachmentBlob, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	blobs := []domain.AttachmentBlob{}
+	for key, blob := range r.s.blobs {
+		if blob.RefCount == 0 {
+			delete(r.s.blobs, key)
+			blobs = append(blobs, blob)
+		}
+	}
+	return blobs, nil
+}
+
+func (r *memoryAttachmentRepository) ListStoredFiles(ctx context.Context) ([]domain.StoredFile, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	byPath := make(map[string]domain.StoredFile)
+	add := func(file domain.StoredFile) {
+		if existing, ok := byPath[file.StoragePath]; ok && (existing.ContentHash != nil || file.ContentHash == nil) {
+			return
+		}
+		byPath[file.StoragePath] = file
+	}
+	addThumbnail := func(storagePath *string) {
+		if storagePath != nil {
+			add(domain.StoredFile{StoragePath: *storagePath, FileName: path.Base(*storagePath)})
+		}
+	}
+	for _, attachment := range r.s.attachments {
+		add(domain.StoredFile{
+			StoragePath: attachment.StoragePath,
+			FileName:    attachment.FileName,
+			ContentType: attachment.ContentType,
+			ContentHash: attachment.ContentHash,
+		})
+		addThumbnail(attachment.ThumbnailSmallPath)
+		addThumbnail(attachment.ThumbnailLargePath)
+	}
+	for _, blob := range r.s.blobs {
+		contentHash := blob.ContentHash
+		add(domain.StoredFile{
+			StoragePath: blob.StoragePath,
+			FileName:    path.Base(blob.StoragePath),
+			ContentType: blob.ContentType,
+			ContentHash: &contentHash,
+		})
+	}
+
+	files := make([]domain.StoredFile, 0, len(byPath))
+	for _, file := range byPath {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].StoragePath < files[j].StoragePath })
+	return files, nil
+}
+
+func (r *memoryAttachmentRepository) RewriteStoragePaths(
+	ctx context.Context,
+	newPaths map[string]string,
+) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	rewrite := func(storagePath *string) bool {
+		if storagePath == nil {
+			return false
+		}
+		newPath, ok := newPaths[*storagePath]
+		if ok {
+			*storagePath = newPath
+		}
+		return ok
+	}
+	// Thumbnail paths are pointers, possibly shared with a blob, so give each row its own copies
+	rewriteThumbnail := func(storagePath **string) bool {
+		if *storagePath == nil {
+			return false
+		}
+		copied := **storagePath
+		*storagePath = &copied
+		return rewrite(*storagePath)
+	}
+
+	var rows int64
+	for id, attachment := range r.s.attachments {
+		changed := rewrite(&attachment.StoragePath)
+		changed = rewriteThumbnail(&attachment.ThumbnailSmallPath) || changed
+		changed = rewriteThumbnail(&attachment.ThumbnailLargePath) || changed
+		if changed {
+			r.s.attachments[id] = attachment
+			rows++
+		}
+	}
+	for key, blob := range r.s.blobs {
+		changed := rewrite(&blob.StoragePath)
+		changed = rewriteThumbnail(&blob.ThumbnailSmallPath) || changed
+		changed = rewriteThumbnail(&blob.ThumbnailLargePath) || changed
+		if changed {
+			r.s.blobs[key] = blob
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+type memoryAttachmentUploadRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryAttachmentUploadRepository) Create(
+	ctx context.Context,
+	upload *domain.AttachmentUpload,
+	limit PendingUploadLimit,
+) (*domain.AttachmentUpload, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.todos[upload.TodoID]; !ok {
+		return nil, fmt.Errorf("parent todo %s not found: %w", upload.TodoID, domain.ErrBadRequest)
+	}
+	now := r.s.now()
+	uploads, totalLength := 0, int64(0)
+	for _, pending := range r.s.uploads {
+		if pending.UserID == upload.UserID && pending.ExpiresAt.After(now) {
+			uploads++
+			totalLength += pending.Length
+		}
+	}
+	if err := limit.exceeded(uploads, totalLength, upload.Length); err != nil {
+		return nil, err
+	}
+
+	created := domain.AttachmentUpload{
+		ID:        uuid.New(),
+		TodoID:    upload.TodoID,
+		UserID:    upload.UserID,
+		FileName:  upload.FileName,
+		Length:    upload.Length,
+		CreatedAt: now,
+		ExpiresAt: upload.ExpiresAt,
+	}
+	r.s.uploads[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryAttachmentUploadRepository) GetByID(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) (*domain.AttachmentUpload, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	upload, ok := r.s.uploads[id]
+	if !ok || upload.UserID != userID {
+		return nil, domain.ErrNotFound
+	}
+	return &upload, nil
+}
+
+// UpdateOffset moves the offset from oldOffset to newOffset. If another request
+// already moved it, domain.ErrConflict is returned and nothing changes.
+func (r *memoryAttachmentUploadRepository) UpdateOffset(
+	ctx context.Context,
+	id, userID uuid.UUID,
+	oldOffset, newOffset int64,
+	expiresAt time.Time,
+) (*domain.AttachmentUpload, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	upload, ok := r.s.uploads[id]
+	if !ok || upload.UserID != userID || upload.Offset != oldOffset {
+		return nil, fmt.Errorf("upload %s is no longer at offset %d: %w", id, oldOffset, domain.ErrConflict)
+	}
+	upload.Offset = newOffset
+	upload.ExpiresAt = expiresAt
+	r.s.uploads[id] = upload
+	return &upload, nil
+}
+
+func (r *memoryAttachmentUploadRepository) Delete(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if upload, ok := r.s.uploads[id]; ok && upload.UserID == userID {
+		delete(r.s.uploads, id)
+	}
+	return nil
+}
+
+func (r *memoryAttachmentUploadRepository) DeleteExpired(ctx context.Context) ([]uuid.UUID, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	ids := []uuid.UUID{}
+	for id, upload := range r.s.uploads {
+		if upload.ExpiresAt.Before(now) {
+			delete(r.s.uploads, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
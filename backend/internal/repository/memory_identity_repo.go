@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryIdentityRepository struct {
+	s *memoryStore
+}
+
+// createIdentity inserts an identity, enforcing the foreign key and UNIQUE constraints
+// of user_identities. The caller must hold the write lock.
+func (r *memoryIdentityRepository) createIdentity(identity *domain.UserIdentity) (*domain.UserIdentity, error) {
+	if _, ok := r.s.users[identity.UserID]; !ok {
+		return nil, fmt.Errorf("user %s not found: %w", identity.UserID, domain.ErrNotFound)
+	}
+	for _, existing := range r.s.identities {
+		if existing.Provider != identity.Provider {
+			continue
+		}
+		if existing.Subject == identity.Subject || existing.UserID == identity.UserID {
+			return nil, fmt.Errorf("%s account is already linked: %w", identity.Provider, domain.ErrConflict)
+		}
+	}
+	created := *identity
+	created.ID = uuid.New()
+	created.CreatedAt = r.s.now()
+	created.LastLoginAt = nil
+	r.s.identities[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryIdentityRepository) Create(ctx context.Context, identity *domain.UserIdentity) (*domain.UserIdentity, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.createIdentity(identity)
+}
+
+func (r *memoryIdentityRepository) CreateWithUser(ctx context.Context, user *domain.User, identity *domain.UserIdentity) (*domain.User, *domain.UserIdentity, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	createdUser, err := r.s.createUser(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	link := *identity
+	link.UserID = createdUser.ID
+	created, err := r.createIdentity(&link)
+	if err != nil {
+		delete(r.s.users, createdUser.ID) // Roll back
+		return nil, nil, err
+	}
+	return createdUser, created, nil
+}
+
+func (r *memoryIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, identity := range r.s.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *memoryIdentityRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.UserIdentity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	identities := []domain.UserIdentity{}
+	for _, identity := range r.s.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	slices.SortFunc(identities, func(a, b domain.UserIdentity) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return identities, nil
+}
+
+func (r *memoryIdentityRepository) RecordLogin(ctx context.Context, id uuid.UUID, email *string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	identity, ok := r.s.identities[id]
+	if !ok {
+		return nil // Like an UPDATE that matches no rows
+	}
+	now := r.s.now()
+	identity.LastLoginAt = &now
+	identity.Email = email
+	r.s.identities[id] = identity
+	return nil
+}
+
+func (r *memoryIdentityRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	identity, ok := r.s.identities[id]
+	if !ok || identity.UserID != userID {
+		return domain.ErrNotFound
+	}
+	delete(r.s.identities, id)
+	return nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+)
+
+type memoryLoginAttemptRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryLoginAttemptRepository) Get(ctx context.Context, key string) (*domain.LoginAttempts, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	attempts, ok := r.s.logins[key]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &attempts, nil
+}
+
+func (r *memoryLoginAttemptRepository) RecordFailure(ctx context.Context, key string, resetAfter time.Duration) (*domain.LoginAttempts, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.now()
+	attempts, ok := r.s.logins[key]
+	if !ok || attempts.LastFailedAt.Before(now.Add(-resetAfter)) {
+		attempts = domain.LoginAttempts{Key: key}
+	}
+	recordLoginFailure(&attempts, now)
+	r.s.logins[key] = attempts
+	return &attempts, nil
+}
+
+func (r *memoryLoginAttemptRepository) Release(ctx context.Context, key string, failures int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if attempts, ok := r.s.logins[key]; ok {
+		releaseLoginFailure(&attempts, failures)
+		r.s.logins[key] = attempts
+	}
+	return nil
+}
+
+func (r *memoryLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.logins, key)
+	return nil
+}
+
+func (r *memoryLoginAttemptRepository) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var n int64
+	for key, attempts := range r.s.logins {
+		if attempts.LastFailedAt.Before(before) {
+			delete(r.s.logins, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// recordLoginFailure and releaseLoginFailure do what RecordLoginFailure and ReleaseLoginFailure
+// do in SQL, for the repositories that keep counts in memory
+func recordLoginFailure(attempts *domain.LoginAttempts, now time.Time) {
+	attempts.PreviousFailedAt = nil
+	if attempts.Failures > 0 {
+		prev := attempts.LastFailedAt
+		attempts.PreviousFailedAt = &prev
+	}
+	attempts.Failures++
+	attempts.LastFailedAt = now
+}
+
+func releaseLoginFailure(attempts *domain.LoginAttempts, failures int) {
+	if attempts.Failures == failures {
+		if attempts.PreviousFailedAt != nil {
+			attempts.LastFailedAt = *attempts.PreviousFailedAt
+		}
+		attempts.PreviousFailedAt = nil
+	}
+	attempts.Failures = max(attempts.Failures-1, 0)
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryMFARepository struct {
+	s *memoryStore
+}
+
+func (r *memoryMFARepository) GetTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPFactor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	factor, ok := r.s.totp[userID]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &factor, nil
+}
+
+func (r *memoryMFARepository) SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) (*domain.TOTPFactor, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return nil, fmt.Errorf("user %s not found: %w", userID, domain.ErrNotFound)
+	}
+	if existing, ok := r.s.totp[userID]; ok && existing.Enabled() {
+		return nil, fmt.Errorf("an authenticator is already enabled: %w", domain.ErrConflict)
+	}
+	factor := domain.TOTPFactor{UserID: userID, Secret: secret, CreatedAt: r.s.now()}
+	r.s.totp[userID] = factor
+	return &factor, nil
+}
+
+func (r *memoryMFARepository) ConfirmTOTP(
+	ctx context.Context,
+	userID uuid.UUID,
+	step int64,
+	recoveryCodeHashes []string,
+) (*domain.TOTPFactor, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	factor, ok := r.s.totp[userID]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	if factor.Enabled() {
+		return nil, fmt.Errorf("authenticator is already confirmed: %w", domain.ErrConflict)
+	}
+	now := r.s.now()
+	factor.ConfirmedAt = &now
+	factor.LastUsedStep = step
+	factor.FailedAttempts = 0
+	r.s.totp[userID] = factor
+	r.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return &factor, nil
+}
+
+func (r *memoryMFARepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	factor, ok := r.s.totp[userID]
+	if !ok || factor.LastUsedStep >= step {
+		return fmt.Errorf("code was already used: %w", domain.ErrConflict)
+	}
+	factor.LastUsedStep = step
+	factor.FailedAttempts = 0
+	factor.Lockouts = 0
+	factor.LockedUntil = nil
+	r.s.totp[userID] = factor
+	return nil
+}
+
+func (r *memoryMFARepository) RecordFailure(ctx context.Context, userID uuid.UUID) (int32, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	factor, ok := r.s.totp[userID]
+	if !ok {
+		return 0, domain.ErrNotFound
+	}
+	factor.FailedAttempts++
+	r.s.totp[userID] = factor
+	return factor.FailedAttempts, nil
+}
+
+func (r *memoryMFARepository) ResetFailures(ctx context.Context, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if factor, ok := r.s.totp[userID]; ok {
+		factor.FailedAttempts = 0
+		factor.Lockouts = 0
+		factor.LockedUntil = nil
+		r.s.totp[userID] = factor
+	}
+	return nil
+}
+
+func (r *memoryMFARepository) Lock(ctx context.Context, userID uuid.UUID, until time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if factor, ok := r.s.totp[userID]; ok {
+		factor.FailedAttempts = 0
+		factor.Lockouts++
+		factor.LockedUntil = &until
+		r.s.totp[userID] = factor
+	}
+	return nil
+}
+
+func (r *memoryMFARepository) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.totp, userID)
+	r.replaceRecoveryCodes(userID, nil)
+	return nil
+}
+
+func (r *memoryMFARepository) ListRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]domain.RecoveryCode, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var codes []domain.RecoveryCode
+	for _, code := range r.s.recovery {
+		if code.UserID == userID && code.UsedAt == nil {
+			codes = append(codes, code)
+		}
+	}
+	slices.SortFunc(codes, func(a, b domain.RecoveryCode) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return codes, nil
+}
+
+func (r *memoryMFARepository) UseRecoveryCode(ctx context.Context, id uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	code, ok := r.s.recovery[id]
+	if !ok || code.UsedAt != nil {
+		return fmt.Errorf("recovery code was already used: %w", domain.ErrConflict)
+	}
+	now := r.s.now()
+	code.UsedAt = &now
+	r.s.recovery[id] = code
+	return nil
+}
+
+func (r *memoryMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return fmt.Errorf("user %s not found: %w", userID, domain.ErrNotFound)
+	}
+	r.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// replaceRecoveryCodes swaps every code of the user for new ones. The caller must hold the write lock.
+func (r *memoryMFARepository) replaceRecoveryCodes(userID uuid.UUID, codeHashes []string) {
+	for id, code := range r.s.recovery {
+		if code.UserID == userID {
+			delete(r.s.recovery, id)
+		}
+	}
+	now := r.s.now()
+	for _, hash := range codeHashes {
+		code := domain.RecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: hash, CreatedAt: now}
+		r.s.recovery[code.ID] = code
+	}
+}
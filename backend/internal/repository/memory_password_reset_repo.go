@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryPasswordResetRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryPasswordResetRepository) Create(
+	ctx context.Context,
+	token *domain.PasswordResetToken,
+	createdAfter time.Time,
+) (*domain.PasswordResetToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[token.UserID]; !ok {
+		return nil, fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+	}
+	for _, other := range r.s.resets {
+		if other.UserID == token.UserID && other.CreatedAt.After(createdAfter) {
+			return nil, fmt.Errorf("password reset requested too recently: %w", domain.ErrConflict)
+		}
+	}
+
+	created := domain.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    token.UserID,
+		TokenHash: token.TokenHash,
+		CreatedAt: r.s.now(),
+		ExpiresAt: token.ExpiresAt,
+	}
+	r.s.resets[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryPasswordResetRepository) Redeem(
+	ctx context.Context,
+	tokenHash, passwordHash string,
+) (*domain.PasswordResetToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.now()
+	for id, token := range r.s.resets {
+		if token.TokenHash != tokenHash || token.UsedAt != nil || !now.Before(token.ExpiresAt) {
+			continue
+		}
+		user, ok := r.s.users[token.UserID]
+		if !ok {
+			return nil, domain.ErrNotFound
+		}
+		user.PasswordHash = passwordHash
+		user.UpdatedAt = now
+		r.s.users[user.ID] = user
+
+		token.UsedAt = &now
+		r.s.resets[id] = token
+		for otherID, other := range r.s.resets {
+			if other.UserID == token.UserID && other.UsedAt == nil {
+				other.UsedAt = &now
+				r.s.resets[otherID] = other
+			}
+		}
+		return &token, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *memoryPasswordResetRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.now()
+	var n int64
+	for id, token := range r.s.resets {
+		if !now.Before(token.ExpiresAt) {
+			delete(r.s.resets, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryRefreshTokenRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRefreshTokenRepository) Create(
+	ctx context.Context,
+	token *domain.RefreshToken,
+) (*domain.RefreshToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.create(token)
+}
+
+// create stores a new token. The caller must hold the write lock.
+func (r *memoryRefreshTokenRepository) create(token *domain.RefreshToken) (*domain.RefreshToken, error) {
+	if _, ok := r.s.users[token.UserID]; !ok {
+		return nil, fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+	}
+	created := domain.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    token.UserID,
+		FamilyID:  token.FamilyID,
+		TokenHash: token.TokenHash,
+		CreatedAt: r.s.now(),
+		ExpiresAt: token.ExpiresAt,
+	}
+	r.s.refresh[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryRefreshTokenRepository) GetByHash(
+	ctx context.Context,
+	tokenHash string,
+) (*domain.RefreshToken, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, token := range r.s.refresh {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+// Rotate marks the token rotated and stores its successor. If the token was already
+// rotated or revoked, domain.ErrConflict is returned and nothing changes.
+func (r *memoryRefreshTokenRepository) Rotate(
+	ctx context.Context,
+	id uuid.UUID,
+	successor *domain.RefreshToken,
+) (*domain.RefreshToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.refresh[id]
+	if !ok || token.RotatedAt != nil || token.RevokedAt != nil {
+		return nil, fmt.Errorf("refresh token %s was already used: %w", id, domain.ErrConflict)
+	}
+	created, err := r.create(successor)
+	if err != nil {
+		return nil, err
+	}
+	now := r.s.now()
+	token.RotatedAt = &now
+	r.s.refresh[id] = token
+	return created, nil
+}
+
+func (r *memoryRefreshTokenRepository) RevokeFamily(
+	ctx context.Context,
+	familyID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.now()
+	for id, token := range r.s.refresh {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.s.refresh[id] = token
+		}
+	}
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.now()
+	var n int64
+	for id, token := range r.s.refresh {
+		if !now.Before(token.ExpiresAt) {
+			delete(r.s.refresh, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memoryRefreshTokenRepository) RevokeAllForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.now()
+	for id, token := range r.s.refresh {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.s.refresh[id] = token
+		}
+	}
+	return nil
+}
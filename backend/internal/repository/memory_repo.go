@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+// memoryStore holds the tables behind the in-memory repositories. The repositories
+// share one store so foreign keys, cascading deletes and blob reference counts
+// behave like they do in Postgres.
+type memoryStore struct {
+	mu          sync.RWMutex
+	lastTime    time.Time
+	users       map[uuid.UUID]domain.User
+	tags        map[uuid.UUID]domain.Tag
+	todos       map[uuid.UUID]domain.Todo
+	todoTags    map[uuid.UUID]map[uuid.UUID]struct{} // todo ID → tag IDs
+	subtasks    map[uuid.UUID]domain.Subtask
+	attachments map[uuid.UUID]domain.Attachment
+	blobs       map[string]domain.AttachmentBlob // Keyed by content hash
+	uploads     map[uuid.UUID]domain.AttachmentUpload
+	refresh     map[uuid.UUID]domain.RefreshToken
+	revoked     map[uuid.UUID]domain.RevokedToken // Keyed by jti
+	resets      map[uuid.UUID]domain.PasswordResetToken
+	totp        map[uuid.UUID]domain.TOTPFactor   // Keyed by user ID
+	recovery    map[uuid.UUID]domain.RecoveryCode // MFA recovery codes
+	passkeys    map[uuid.UUID]domain.WebAuthnCredential
+	identities  map[uuid.UUID]domain.UserIdentity
+	apiTokens   map[uuid.UUID]domain.APIToken
+	logins      map[string]domain.LoginAttempts // Failed logins, keyed like the login throttle's keys
+}
+
+// NewMemoryRepositoryRegistry creates a registry backed by maps instead of Postgres,
+// for tests and local experiments. Queries and Pool are nil, so it can't be used
+// with code that runs SQL directly.
+func NewMemoryRepositoryRegistry() *RepositoryRegistry {
+	s := &memoryStore{
+		users:       make(map[uuid.UUID]domain.User),
+		tags:        make(map[uuid.UUID]domain.Tag),
+		todos:       make(map[uuid.UUID]domain.Todo),
+		todoTags:    make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		subtasks:    make(map[uuid.UUID]domain.Subtask),
+		attachments: make(map[uuid.UUID]domain.Attachment),
+		blobs:       make(map[string]domain.AttachmentBlob),
+		uploads:     make(map[uuid.UUID]domain.AttachmentUpload),
+		refresh:     make(map[uuid.UUID]domain.RefreshToken),
+		revoked:     make(map[uuid.UUID]domain.RevokedToken),
+		resets:      make(map[uuid.UUID]domain.PasswordResetToken),
+		totp:        make(map[uuid.UUID]domain.TOTPFactor),
+		recovery:    make(map[uuid.UUID]domain.RecoveryCode),
+		passkeys:    make(map[uuid.UUID]domain.WebAuthnCredential),
+		identities:  make(map[uuid.UUID]domain.UserIdentity),
+		apiTokens:   make(map[uuid.UUID]domain.APIToken),
+		logins:      make(map[string]domain.LoginAttempts),
+	}
+
+	return &RepositoryRegistry{
+		UserRepo:         &memoryUserRepository{s: s},
+		TagRepo:          &memoryTagRepository{s: s},
+		TodoRepo:         &memoryTodoRepository{s: s},
+		SubtaskRepo:      &memorySubtaskRepository{s: s},
+		AttachmentRepo:   &memoryAttachmentRepository{s: s},
+		UploadRepo:       &memoryAttachmentUploadRepository{s: s},
+		RefreshRepo:      &memoryRefreshTokenRepository{s: s},
+		RevokedRepo:      &memoryRevokedTokenRepository{s: s},
+		ResetRepo:        &memoryPasswordResetRepository{s: s},
+		MFARepo:          &memoryMFARepository{s: s},
+		WebAuthnRepo:     &memoryWebAuthnRepository{s: s},
+		IdentityRepo:     &memoryIdentityRepository{s: s},
+		APITokenRepo:     &memoryAPITokenRepository{s: s},
+		LoginAttemptRepo: &memoryLoginAttemptRepository{s: s},
+	}
+}
+
+// now returns a strictly increasing timestamp, so rows created back to back
+// still sort in creation order. The caller must hold the write lock.
+func (s *memoryStore) now() time.Time {
+	t := time.Now()
+	if !t.After(s.lastTime) {
+		t = s.lastTime.Add(time.Nanosecond)
+	}
+	s.lastTime = t
+	return t
+}
+
+// createUser inserts a user, failing with domain.ErrConflict like the UNIQUE constraints
+// on users. The caller must hold the write lock.
+func (s *memoryStore) createUser(user *domain.User) (*domain.User, error) {
+	now := s.now()
+	created := domain.User{
+		ID:            uuid.New(),
+		Username:      user.Username,
+		Email:         user.Email,
+		PasswordHash:  user.PasswordHash,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if s.userConflicts(&created) {
+		return nil, domain.ErrConflict
+	}
+	s.users[created.ID] = created
+	return &created, nil
+}
+
+// userConflicts reports whether another user already has the username or email,
+// mirroring the UNIQUE constraints on users. The caller must hold the lock.
+func (s *memoryStore) userConflicts(user *domain.User) bool {
+	for _, other := range s.users {
+		if other.ID != user.ID && (other.Username == user.Username || other.Email == user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// ownsTodo reports whether the todo exists and belongs to userID. The caller must hold the lock.
+func (s *memoryStore) ownsTodo(todoID, userID uuid.UUID) bool {
+	todo, ok := s.todos[todoID]
+	return ok && todo.UserID == userID
+}
+
+// deleteTodo removes a todo and everything that references it, like ON DELETE CASCADE.
+// The caller must hold the write lock.
+func (s *memoryStore) deleteTodo(id uuid.UUID) {
+	delete(s.todos, id)
+	delete(s.todoTags, id)
+	for subtaskID, subtask := range s.subtasks {
+		if subtask.TodoID == id {
+			delete(s.subtasks, subtaskID)
+		}
+	}
+	for attachmentID, attachment := range s.attachments {
+		if attachment.TodoID == id {
+			s.deleteAttachment(attachmentID)
+		}
+	}
+	for uploadID, upload := range s.uploads {
+		if upload.TodoID == id {
+			delete(s.uploads, uploadID)
+		}
+	}
+}
+
+// deleteAttachment removes an attachment and drops its blob reference, like
+// trigger_attachment_blob_refs. The caller must hold the write lock.
+func (s *memoryStore) deleteAttachment(id uuid.UUID) {
+	attachment, ok := s.attachments[id]
+	if !ok {
+		return
+	}
+	delete(s.attachments, id)
+	if attachment.ContentHash == nil {
+		return
+	}
+	if blob, ok := s.blobs[*attachment.ContentHash]; ok {
+		blob.RefCount--
+		s.blobs[*attachment.ContentHash] = blob
+	}
+}
+
+// deleteUser removes a user and everything they own. Blobs are shared, so they stay behind
+// with fewer references. The caller must hold the write lock.
+func (s *memoryStore) deleteUser(id uuid.UUID) {
+	delete(s.users, id)
+	for todoID, todo := range s.todos {
+		if todo.UserID == id {
+			s.deleteTodo(todoID)
+		}
+	}
+	for tagID, tag := range s.tags {
+		if tag.UserID == id {
+			s.deleteTag(tagID)
+		}
+	}
+	for tokenID, token := range s.refresh {
+		if token.UserID == id {
+			delete(s.refresh, tokenID)
+		}
+	}
+	for jti, token := range s.revoked {
+		if token.UserID == id {
+			delete(s.revoked, jti)
+		}
+	}
+	for tokenID, token := range s.resets {
+		if token.UserID == id {
+			delete(s.resets, tokenID)
+		}
+	}
+	delete(s.totp, id)
+	for codeID, code := range s.recovery {
+		if code.UserID == id {
+			delete(s.recovery, codeID)
+		}
+	}
+	for credID, cred := range s.passkeys {
+		if cred.UserID == id {
+			delete(s.passkeys, credID)
+		}
+	}
+	for identityID, identity := range s.identities {
+		if identity.UserID == id {
+			delete(s.identities, identityID)
+		}
+	}
+	for tokenID, token := range s.apiTokens {
+		if token.UserID == id {
+			delete(s.apiTokens, tokenID)
+		}
+	}
+}
+
+// deleteTag removes a tag and its todo associations. The caller must hold the write lock.
+func (s *memoryStore) deleteTag(id uuid.UUID) {
+	delete(s.tags, id)
+	for _, tagIDs := range s.todoTags {
+		delete(tagIDs, id)
+	}
+}
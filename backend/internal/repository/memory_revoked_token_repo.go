@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryRevokedTokenRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRevokedTokenRepository) Revoke(
+	ctx context.Context,
+	token *domain.RevokedToken,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[token.UserID]; !ok {
+		return fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+	}
+	if _, ok := r.s.revoked[token.JTI]; ok {
+		return nil
+	}
+	r.s.revoked[token.JTI] = domain.RevokedToken{
+		JTI:       token.JTI,
+		UserID:    token.UserID,
+		ExpiresAt: token.ExpiresAt,
+		RevokedAt: r.s.now(),
+	}
+	return nil
+}
+
+func (r *memoryRevokedTokenRepository) IsRevoked(
+	ctx context.Context,
+	jti uuid.UUID,
+) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	_, ok := r.s.revoked[jti]
+	return ok, nil
+}
+
+func (r *memoryRevokedTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.now()
+	var n int64
+	for jti, token := range r.s.revoked {
+		if !now.Before(token.ExpiresAt) {
+			delete(r.s.revoked, jti)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memorySubtaskRepository struct {
+	s *memoryStore
+}
+
+// ownedSubtask returns the subtask if its parent todo belongs to userID. The caller must hold the lock.
+func (r *memorySubtaskRepository) ownedSubtask(id, userID uuid.UUID) (domain.Subtask, bool) {
+	subtask, ok := r.s.subtasks[id]
+	if !ok || !r.s.ownsTodo(subtask.TodoID, userID) {
+		return domain.Subtask{}, false
+	}
+	return subtask, true
+}
+
+func (r *memorySubtaskRepository) Create(
+	ctx context.Context,
+	subtask *domain.Subtask,
+) (*domain.Subtask, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.todos[subtask.TodoID]; !ok {
+		return nil, fmt.Errorf("parent todo %s not found: %w", subtask.TodoID, domain.ErrBadRequest)
+	}
+
+	now := r.s.now()
+	created := domain.Subtask{
+		ID:          uuid.New(),
+		TodoID:      subtask.TodoID,
+		Description: subtask.Description,
+		Completed:   subtask.Completed,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	r.s.subtasks[created.ID] = created
+	return &created, nil
+}
+
+func (r *memorySubtaskRepository) GetByID(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) (*domain.Subtask, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	subtask, ok := r.ownedSubtask(id, userID)
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &subtask, nil
+}
+
+func (r *memorySubtaskRepository) ListByTodo(
+	ctx context.Context,
+	todoID, userID uuid.UUID,
+) ([]domain.Subtask, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	subtasks := []domain.Subtask{}
+	if !r.s.ownsTodo(todoID, userID) {
+		return subtasks, nil
+	}
+	for _, subtask := range r.s.subtasks {
+		if subtask.TodoID == todoID {
+			subtasks = append(subtasks, subtask)
+		}
+	}
+	sort.Slice(subtasks, func(i, j int) bool { return subtasks[i].CreatedAt.Before(subtasks[j].CreatedAt) })
+	return subtasks, nil
+}
+
+// Update follows UpdateSubtask: an empty description keeps the stored one, Completed is always written
+func (r *memorySubtaskRepository) Update(
+	ctx context.Context,
+	id, userID uuid.UUID,
+	updateData *domain.Subtask,
+) (*domain.Subtask, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	subtask, ok := r.ownedSubtask(id, userID)
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	if updateData.Description != "" {
+		subtask.Description = updateData.Description
+	}
+	subtask.Completed = updateData.Completed
+	subtask.UpdatedAt = r.s.now()
+	r.s.subtasks[id] = subtask
+	return &subtask, nil
+}
+
+func (r *memorySubtaskRepository) Delete(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.ownedSubtask(id, userID); ok {
+		delete(r.s.subtasks, id)
+	}
+	return nil
+}
+
+func (r *memorySubtaskRepository) GetParentTodoID(
+	ctx context.Context,
+	id uuid.UUID,
+) (uuid.UUID, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	subtask, ok := r.s.subtasks[id]
+	if !ok {
+		return uuid.Nil, domain.ErrNotFound
+	}
+	return subtask.TodoID, nil
+}
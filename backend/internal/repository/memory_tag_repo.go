@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryTagRepository struct {
+	s *memoryStore
+}
+
+// nameTaken mirrors UNIQUE (user_id, name). The caller must hold the lock.
+func (r *memoryTagRepository) nameTaken(tag *domain.Tag) bool {
+	for _, other := range r.s.tags {
+		if other.ID != tag.ID && other.UserID == tag.UserID && other.Name == tag.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryTagRepository) Create(
+	ctx context.Context,
+	tag *domain.Tag,
+) (*domain.Tag, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[tag.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create tag: user %s not found", tag.UserID)
+	}
+
+	now := r.s.now()
+	created := domain.Tag{
+		ID:        uuid.New(),
+		UserID:    tag.UserID,
+		Name:      tag.Name,
+		Color:     tag.Color,
+		Icon:      tag.Icon,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if r.nameTaken(&created) {
+		return nil, fmt.Errorf("tag name '%s' already exists: %w", tag.Name, domain.ErrConflict)
+	}
+	r.s.tags[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryTagRepository) GetByID(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) (*domain.Tag, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tag, ok := r.s.tags[id]
+	if !ok || tag.UserID != userID {
+		return nil, domain.ErrNotFound
+	}
+	return &tag, nil
+}
+
+func (r *memoryTagRepository) GetByIDs(
+	ctx context.Context,
+	ids []uuid.UUID,
+	userID uuid.UUID,
+) ([]domain.Tag, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tags := []domain.Tag{}
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if tag, ok := r.s.tags[id]; ok && tag.UserID == userID && !seen[id] {
+			seen[id] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (r *memoryTagRepository) ListByUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]domain.Tag, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tags := []domain.Tag{}
+	for _, tag := range r.s.tags {
+		if tag.UserID == userID {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].CreatedAt.After(tags[j].CreatedAt) })
+	return tags, nil
+}
+
+// Update follows UpdateTag: the name is always written, and a nil color or icon clears it
+func (r *memoryTagRepository) Update(
+	ctx context.Context,
+	id, userID uuid.UUID,
+	updateData *domain.Tag,
+) (*domain.Tag, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tag, ok := r.s.tags[id]
+	if !ok || tag.UserID != userID {
+		return nil, domain.ErrNotFound
+	}
+	tag.Name = updateData.Name
+	tag.Color = updateData.Color
+	tag.Icon = updateData.Icon
+	if r.nameTaken(&tag) {
+		return nil, fmt.Errorf("tag name '%s' already exists: %w", updateData.Name, domain.ErrConflict)
+	}
+	tag.UpdatedAt = r.s.now()
+	r.s.tags[id] = tag
+	return &tag, nil
+}
+
+func (r *memoryTagRepository) Delete(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if tag, ok := r.s.tags[id]; ok && tag.UserID == userID {
+		r.s.deleteTag(id)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryTodoRepository struct {
+	s *memoryStore
+}
+
+// storedTodo strips the fields the todos table doesn't hold
+func storedTodo(todo domain.Todo) domain.Todo {
+	todo.TagIDs = nil
+	todo.Tags = nil
+	todo.Attachments = nil
+	todo.Subtasks = nil
+	return todo
+}
+
+func (r *memoryTodoRepository) Create(
+	ctx context.Context,
+	todo *domain.Todo,
+) (*domain.Todo, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[todo.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create todo: user %s not found", todo.UserID)
+	}
+
+	now := r.s.now()
+	created := storedTodo(*todo)
+	created.ID = uuid.New()
+	if created.Status == "" {
+		created.Status = domain.StatusPending
+	}
+	created.CreatedAt = now
+	created.UpdatedAt = now
+	r.s.todos[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryTodoRepository) GetByID(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) (*domain.Todo, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if !r.s.ownsTodo(id, userID) {
+		return nil, domain.ErrNotFound
+	}
+	todo := r.s.todos[id]
+	return &todo, nil
+}
+
+// ListByUser applies the same filters, newest-first ordering and paging as ListUserTodos
+func (r *memoryTodoRepository) ListByUser(
+	ctx context.Context,
+	params ListTodosParams,
+) ([]domain.Todo, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	todos := []domain.Todo{}
+	for _, todo := range r.s.todos {
+		if todo.UserID != params.UserID {
+			continue
+		}
+		if params.Status != nil && todo.Status != *params.Status {
+			continue
+		}
+		if params.TagID != nil {
+			if _, tagged := r.s.todoTags[todo.ID][*params.TagID]; !tagged {
+				continue
+			}
+		}
+		if params.DeadlineBefore != nil && (todo.Deadline == nil || !todo.Deadline.Before(*params.DeadlineBefore)) {
+			continue
+		}
+		if params.DeadlineAfter != nil && (todo.Deadline == nil || !todo.Deadline.After(*params.DeadlineAfter)) {
+			continue
+		}
+		todos = append(todos, todo)
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].CreatedAt.After(todos[j].CreatedAt) })
+
+	start := min(max(params.Offset, 0), len(todos))
+	end := min(start+max(params.Limit, 0), len(todos))
+	return todos[start:end], nil
+}
+
+// Update follows UpdateTodo: title and status are always written, and a nil
+// description or deadline clears it
+func (r *memoryTodoRepository) Update(
+	ctx context.Context,
+	id, userID uuid.UUID,
+	updateData *domain.Todo,
+) (*domain.Todo, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if !r.s.ownsTodo(id, userID) {
+		return nil, domain.ErrNotFound
+	}
+	todo := r.s.todos[id]
+	todo.Title = updateData.Title
+	todo.Description = updateData.Description
+	todo.Status = updateData.Status
+	todo.Deadline = updateData.Deadline
+	todo.UpdatedAt = r.s.now()
+	r.s.todos[id] = todo
+	return &todo, nil
+}
+
+func (r *memoryTodoRepository) Delete(
+	ctx context.Context,
+	id, userID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.ownsTodo(id, userID) {
+		r.s.deleteTodo(id)
+	}
+	return nil
+}
+
+// --- Tag Associations ---
+
+// addTag mirrors the todo_tags foreign keys. The caller must hold the write lock.
+func (r *memoryTodoRepository) addTag(todoID, tagID uuid.UUID) error {
+	if _, ok := r.s.todos[todoID]; !ok {
+		return fmt.Errorf("todo %s not found: %w", todoID, domain.ErrBadRequest)
+	}
+	if _, ok := r.s.tags[tagID]; !ok {
+		return fmt.Errorf("tag %s not found: %w", tagID, domain.ErrBadRequest)
+	}
+	if r.s.todoTags[todoID] == nil {
+		r.s.todoTags[todoID] = make(map[uuid.UUID]struct{})
+	}
+	r.s.todoTags[todoID][tagID] = struct{}{}
+	return nil
+}
+
+func (r *memoryTodoRepository) AddTag(
+	ctx context.Context,
+	todoID, tagID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if err := r.addTag(todoID, tagID); err != nil {
+		return fmt.Errorf("failed to add tag: %w", err)
+	}
+	return nil
+}
+
+func (r *memoryTodoRepository) RemoveTag(
+	ctx context.Context,
+	todoID, tagID uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.todoTags[todoID], tagID)
+	return nil
+}
+
+// SetTags replaces the todo's tags, leaving them untouched if any tag is invalid
+func (r *memoryTodoRepository) SetTags(
+	ctx context.Context,
+	todoID uuid.UUID,
+	tagIDs []uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	previous := r.s.todoTags[todoID]
+	delete(r.s.todoTags, todoID)
+	for _, tID := range tagIDs {
+		if err := r.addTag(todoID, tID); err != nil {
+			r.s.todoTags[todoID] = previous
+			return fmt.Errorf("add tag %s: %w", tID, err)
+		}
+	}
+	return nil
+}
+
+func (r *memoryTodoRepository) GetTags(
+	ctx context.Context,
+	todoID uuid.UUID,
+) ([]domain.Tag, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tags := []domain.Tag{}
+	for tagID := range r.s.todoTags[todoID] {
+		tags = append(tags, r.s.tags[tagID])
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].CreatedAt.Before(tags[j].CreatedAt) })
+	return tags, nil
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryUserRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryUserRepository) Create(
+	ctx context.Context,
+	user *domain.User,
+) (*domain.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.createUser(user)
+}
+
+func (r *memoryUserRepository) GetByID(
+	ctx context.Context,
+	id uuid.UUID,
+) (*domain.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(
+	ctx context.Context,
+	email string,
+) (*domain.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, user := range r.s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+// Update follows UpdateUser: empty strings keep the stored value, EmailVerified is always written.
+func (r *memoryUserRepository) Update(
+	ctx context.Context,
+	id uuid.UUID,
+	u *domain.User,
+) (*domain.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	if u.Username != "" {
+		user.Username = u.Username
+	}
+	if u.Email != "" {
+		user.Email = u.Email
+	}
+	user.EmailVerified = u.EmailVerified
+	if r.s.userConflicts(&user) {
+		return nil, domain.ErrConflict
+	}
+	user.UpdatedAt = r.s.now()
+	r.s.users[id] = user
+	return &user, nil
+}
+
+func (r *memoryUserRepository) Delete(
+	ctx context.Context,
+	id uuid.UUID,
+) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.deleteUser(id)
+	return nil
+}
+
+func (r *memoryUserRepository) IncrementTokenVersion(
+	ctx context.Context,
+	id uuid.UUID,
+) (*domain.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	user.TokenVersion++
+	r.s.users[id] = user
+	return &user, nil
+}
+
+func (r *memoryUserRepository) MarkVerificationSent(
+	ctx context.Context,
+	id uuid.UUID,
+	sentBefore time.Time,
+) (*domain.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	if user.VerificationSentAt != nil && !user.VerificationSentAt.Before(sentBefore) {
+		return nil, fmt.Errorf("verification email sent too recently: %w", domain.ErrConflict)
+	}
+	now := r.s.now()
+	user.VerificationSentAt = &now
+	r.s.users[id] = user
+	return &user, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+type memoryWebAuthnRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryWebAuthnRepository) Create(ctx context.Context, cred *domain.WebAuthnCredential) (*domain.WebAuthnCredential, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[cred.UserID]; !ok {
+		return nil, fmt.Errorf("user %s not found: %w", cred.UserID, domain.ErrNotFound)
+	}
+	for _, existing := range r.s.passkeys {
+		if bytes.Equal(existing.CredentialID, cred.CredentialID) {
+			return nil, fmt.Errorf("passkey is already registered: %w", domain.ErrConflict)
+		}
+	}
+	created := *cred
+	created.ID = uuid.New()
+	created.CreatedAt = r.s.now()
+	created.LastUsedAt = nil
+	r.s.passkeys[created.ID] = created
+	return &created, nil
+}
+
+func (r *memoryWebAuthnRepository) GetByCredentialID(ctx context.Context, credentialID []byte) (*domain.WebAuthnCredential, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, cred := range r.s.passkeys {
+		if bytes.Equal(cred.CredentialID, credentialID) {
+			return &cred, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *memoryWebAuthnRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	creds := []domain.WebAuthnCredential{}
+	for _, cred := range r.s.passkeys {
+		if cred.UserID == userID {
+			creds = append(creds, cred)
+		}
+	}
+	slices.SortFunc(creds, func(a, b domain.WebAuthnCredential) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return creds, nil
+}
+
+func (r *memoryWebAuthnRepository) UpdateUsage(ctx context.Context, id uuid.UUID, signCount uint32) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cred, ok := r.s.passkeys[id]
+	if !ok {
+		return nil // Like an UPDATE that matches no rows
+	}
+	now := r.s.now()
+	cred.SignCount = signCount
+	cred.LastUsedAt = &now
+	r.s.passkeys[id] = cred
+	return nil
+}
+
+func (r *memoryWebAuthnRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cred, ok := r.s.passkeys[id]
+	if !ok || cred.UserID != userID {
+		return domain.ErrNotFound
+	}
+	delete(r.s.passkeys, id)
+	return nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pgxMFARepository struct {
+	q    *db.Queries
+	pool *pgxpool.Pool
+}
+
+func NewPgxMFARepository(queries *db.Queries, pool *pgxpool.Pool) MFARepository {
+	return &pgxMFARepository{q: queries, pool: pool}
+}
+
+// --- Mapping functions ---
+func mapDbUserTotpToDomain(d db.UserTotp) *domain.TOTPFactor {
+	return &domain.TOTPFactor{
+		UserID:         d.UserID,
+		Secret:         d.Secret,
+		ConfirmedAt:    d.ConfirmedAt,
+		LastUsedStep:   d.LastUsedStep,
+		FailedAttempts: d.FailedAttempts,
+		Lockouts:       d.Lockouts,
+		LockedUntil:    d.LockedUntil,
+		CreatedAt:      d.CreatedAt,
+	}
+}
+
+func mapDbRecoveryCodeToDomain(d db.MfaRecoveryCode) domain.RecoveryCode {
+	return domain.RecoveryCode{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		CodeHash:  d.CodeHash,
+		CreatedAt: d.CreatedAt,
+		UsedAt:    d.UsedAt,
+	}
+}
+
+// --- Repository Methods ---
+
+func (r *pgxMFARepository) GetTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPFactor, error) {
+	d, err := r.q.GetUserTotp(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get totp factor: %w", err)
+	}
+	return mapDbUserTotpToDomain(d), nil
+}
+
+func (r *pgxMFARepository) SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) (*domain.TOTPFactor, error) {
+	d, err := r.q.UpsertPendingUserTotp(ctx, userID, secret)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("an authenticator is already enabled: %w", domain.ErrConflict)
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, fmt.Errorf("user %s not found: %w", userID, domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to store totp factor: %w", err)
+	}
+	return mapDbUserTotpToDomain(d), nil
+}
+
+func (r *pgxMFARepository) ConfirmTOTP(
+	ctx context.Context,
+	userID uuid.UUID,
+	step int64,
+	recoveryCodeHashes []string,
+) (*domain.TOTPFactor, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	d, err := qtx.ConfirmUserTotp(ctx, userID, step)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if _, getErr := qtx.GetUserTotp(ctx, userID); getErr == nil {
+				return nil, fmt.Errorf("authenticator is already confirmed: %w", domain.ErrConflict)
+			}
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to confirm totp factor: %w", err)
+	}
+	if err := replaceRecoveryCodes(ctx, qtx, userID, recoveryCodeHashes); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit totp confirmation tx: %w", err)
+	}
+	return mapDbUserTotpToDomain(d), nil
+}
+
+func (r *pgxMFARepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	if _, err := r.q.UseUserTotpStep(ctx, userID, step); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("code was already used: %w", domain.ErrConflict)
+		}
+		return fmt.Errorf("failed to record totp step: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxMFARepository) RecordFailure(ctx context.Context, userID uuid.UUID) (int32, error) {
+	n, err := r.q.IncrementUserTotpFailures(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, domain.ErrNotFound
+		}
+		return 0, fmt.Errorf("failed to record totp failure: %w", err)
+	}
+	return n, nil
+}
+
+func (r *pgxMFARepository) ResetFailures(ctx context.Context, userID uuid.UUID) error {
+	if err := r.q.ResetUserTotpFailures(ctx, userID); err != nil {
+		return fmt.Errorf("failed to reset totp failures: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxMFARepository) Lock(ctx context.Context, userID uuid.UUID, until time.Time) error {
+	if err := r.q.LockUserTotp(ctx, userID, &until); err != nil {
+		return fmt.Errorf("failed to lock totp factor: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxMFARepository) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	if err := qtx.DeleteUserMfaRecoveryCodes(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if err := qtx.DeleteUserTotp(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete totp factor: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit totp removal tx: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxMFARepository) ListRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]domain.RecoveryCode, error) {
+	rows, err := r.q.ListUnusedMfaRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recovery codes: %w", err)
+	}
+	codes := make([]domain.RecoveryCode, len(rows))
+	for i, row := range rows {
+		codes[i] = mapDbRecoveryCodeToDomain(row)
+	}
+	return codes, nil
+}
+
+func (r *pgxMFARepository) UseRecoveryCode(ctx context.Context, id uuid.UUID) error {
+	n, err := r.q.UseMfaRecoveryCode(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("recovery code was already used: %w", domain.ErrConflict)
+	}
+	return nil
+}
+
+func (r *pgxMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, r.q.WithTx(tx), userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit recovery codes tx: %w", err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes swaps every code of the user, used or not, for new ones
+func replaceRecoveryCodes(ctx context.Context, q *db.Queries, userID uuid.UUID, codeHashes []string) error {
+	if err := q.DeleteUserMfaRecoveryCodes(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if err := q.CreateMfaRecoveryCode(ctx, userID, hash); err != nil {
+			return fmt.Errorf("failed to create recovery code: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pgxPasswordResetRepository struct {
+	q    *db.Queries
+	pool *pgxpool.Pool
+}
+
+func NewPgxPasswordResetRepository(queries *db.Queries, pool *pgxpool.Pool) PasswordResetRepository {
+	return &pgxPasswordResetRepository{q: queries, pool: pool}
+}
+
+// --- Mapping functions ---
+func mapDbPasswordResetTokenToDomain(d db.PasswordResetToken) *domain.PasswordResetToken {
+	return &domain.PasswordResetToken{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		TokenHash: d.TokenHash,
+		CreatedAt: d.CreatedAt,
+		ExpiresAt: d.ExpiresAt,
+		UsedAt:    d.UsedAt,
+	}
+}
+
+// --- Repository Methods ---
+
+// Create stores a token unless the user got one after createdAfter, in which case
+// domain.ErrConflict is returned
+func (r *pgxPasswordResetRepository) Create(
+	ctx context.Context,
+	token *domain.PasswordResetToken,
+	createdAfter time.Time,
+) (*domain.PasswordResetToken, error) {
+	d, err := r.q.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		UserID:       token.UserID,
+		TokenHash:    token.TokenHash,
+		ExpiresAt:    token.ExpiresAt,
+		CreatedAfter: createdAfter,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("password reset requested too recently: %w", domain.ErrConflict)
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return mapDbPasswordResetTokenToDomain(d), nil
+}
+
+// Redeem uses up the token, sets the new password hash and voids the user's other
+// reset tokens in one transaction
+func (r *pgxPasswordResetRepository) Redeem(
+	ctx context.Context,
+	tokenHash, passwordHash string,
+) (*domain.PasswordResetToken, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	d, err := qtx.RedeemPasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to redeem password reset token: %w", err)
+	}
+	if _, err := qtx.UpdateUserPassword(ctx, d.UserID, passwordHash); err != nil {
+		return nil, fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := qtx.InvalidateUserPasswordResetTokens(ctx, d.UserID); err != nil {
+		return nil, fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit password reset tx: %w", err)
+	}
+	return mapDbPasswordResetTokenToDomain(d), nil
+}
+
+func (r *pgxPasswordResetRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	n, err := r.q.DeleteExpiredPasswordResetTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired password reset tokens: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pgxRefreshTokenRepository struct {
+	q    *db.Queries
+	pool *pgxpool.Pool
+}
+
+func NewPgxRefreshTokenRepository(queries *db.Queries, pool *pgxpool.Pool) RefreshTokenRepository {
+	return &pgxRefreshTokenRepository{q: queries, pool: pool}
+}
+
+// --- Mapping functions ---
+func mapDbRefreshTokenToDomain(d db.RefreshToken) *domain.RefreshToken {
+	return &domain.RefreshToken{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		FamilyID:  d.FamilyID,
+		TokenHash: d.TokenHash,
+		CreatedAt: d.CreatedAt,
+		ExpiresAt: d.ExpiresAt,
+		RotatedAt: d.RotatedAt,
+		RevokedAt: d.RevokedAt,
+	}
+}
+
+// --- Repository Methods ---
+
+func (r *pgxRefreshTokenRepository) Create(
+	ctx context.Context,
+	token *domain.RefreshToken,
+) (*domain.RefreshToken, error) {
+	return r.create(ctx, r.q, token)
+}
+
+func (r *pgxRefreshTokenRepository) create(
+	ctx context.Context,
+	q *db.Queries,
+	token *domain.RefreshToken,
+) (*domain.RefreshToken, error) {
+	d, err := q.CreateRefreshToken(ctx, db.CreateRefreshTokenParams{
+		UserID:    token.UserID,
+		FamilyID:  token.FamilyID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return mapDbRefreshTokenToDomain(d), nil
+}
+
+func (r *pgxRefreshTokenRepository) GetByHash(
+	ctx context.Context,
+	tokenHash string,
+) (*domain.RefreshToken, error) {
+	d, err := r.q.GetRefreshTokenByHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return mapDbRefreshTokenToDomain(d), nil
+}
+
+// Rotate marks the token rotated and stores its successor in one transaction. If the
+// token was already rotated or revoked, domain.ErrConflict is returned and nothing changes.
+func (r *pgxRefreshTokenRepository) Rotate(
+	ctx context.Context,
+	id uuid.UUID,
+	successor *domain.RefreshToken,
+) (*domain.RefreshToken, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.q.WithTx(tx)
+	if _, err := qtx.MarkRefreshTokenRotated(ctx, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("refresh token %s was already used: %w", id, domain.ErrConflict)
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	created, err := r.create(ctx, qtx, successor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit refresh token tx: %w", err)
+	}
+	return created, nil
+}
+
+func (r *pgxRefreshTokenRepository) RevokeFamily(
+	ctx context.Context,
+	familyID uuid.UUID,
+) error {
+	if err := r.q.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxRefreshTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	n, err := r.q.DeleteExpiredRefreshTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	return n, nil
+}
+
+func (r *pgxRefreshTokenRepository) RevokeAllForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) error {
+	if err := r.q.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens for user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type pgxRevokedTokenRepository struct {
+	q *db.Queries
+}
+
+func NewPgxRevokedTokenRepository(queries *db.Queries) RevokedTokenRepository {
+	return &pgxRevokedTokenRepository{q: queries}
+}
+
+func (r *pgxRevokedTokenRepository) Revoke(
+	ctx context.Context,
+	token *domain.RevokedToken,
+) error {
+	err := r.q.RevokeToken(ctx, db.RevokeTokenParams{
+		Jti:       token.JTI,
+		UserID:    token.UserID,
+		ExpiresAt: token.ExpiresAt,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return fmt.Errorf("user %s not found: %w", token.UserID, domain.ErrNotFound)
+		}
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxRevokedTokenRepository) IsRevoked(
+	ctx context.Context,
+	jti uuid.UUID,
+) (bool, error) {
+	revoked, err := r.q.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+func (r *pgxRevokedTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	n, err := r.q.DeleteExpiredRevokedTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired revoked tokens: %w", err)
+	}
+	return n, nil
+}
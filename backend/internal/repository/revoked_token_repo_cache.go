@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/cache"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+// notRevokedCacheTTL bounds how long a replica can keep accepting a token another
+// replica revoked. Revocations made through this replica are visible at once.
+const notRevokedCacheTTL = 30 * time.Second
+
+// cachingRevokedTokenRepository answers the per-request revocation check from the
+// cache. A revocation is cached until the token expires, since it can't be undone.
+type cachingRevokedTokenRepository struct {
+	next   RevokedTokenRepository
+	cache  cache.Cache
+	logger *slog.Logger
+}
+
+func NewCachingRevokedTokenRepository(next RevokedTokenRepository, cache cache.Cache, logger *slog.Logger) RevokedTokenRepository {
+	return &cachingRevokedTokenRepository{
+		next:   next,
+		cache:  cache,
+		logger: logger.With("repository", "revoked_token_cache_decorator"),
+	}
+}
+
+// --- Cache Key Generation ---
+func revokedTokenCacheKey(jti uuid.UUID) string {
+	return fmt.Sprintf("revoked_token:%s", jti)
+}
+
+// --- RevokedTokenRepository Interface Implementation ---
+
+func (r *cachingRevokedTokenRepository) Revoke(ctx context.Context, token *domain.RevokedToken) error {
+	if err := r.next.Revoke(ctx, token); err != nil {
+		return err
+	}
+	if ttl := time.Until(token.ExpiresAt); ttl > 0 {
+		r.cache.Set(ctx, revokedTokenCacheKey(token.JTI), true, ttl)
+	}
+	return nil
+}
+
+func (r *cachingRevokedTokenRepository) IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	cacheKey := revokedTokenCacheKey(jti)
+	if cached, found := r.cache.Get(ctx, cacheKey); found {
+		if revoked, ok := cached.(bool); ok {
+			return revoked, nil
+		}
+		r.logger.WarnContext(ctx, "Invalid type found in revoked token cache", "key", cacheKey, "type", fmt.Sprintf("%T", cached))
+		r.cache.Delete(ctx, cacheKey)
+	}
+
+	revoked, err := r.next.IsRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	ttl := notRevokedCacheTTL
+	if revoked {
+		ttl = 0 // Revoked by another replica; the token's expiry isn't known here, so the default expiration applies
+	}
+	r.cache.Set(ctx, cacheKey, revoked, ttl)
+	return revoked, nil
+}
+
+func (r *cachingRevokedTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	return r.next.DeleteExpired(ctx)
+}
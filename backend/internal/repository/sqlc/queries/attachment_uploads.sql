@@ -0,0 +1,35 @@
+-- name: CreateAttachmentUpload :one
+INSERT INTO attachment_uploads (todo_id, user_id, file_name, upload_length, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: LockUserAttachmentUploads :exec
+-- Serializes upload creation per user so the pending limits can't be raced past
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE;
+
+-- name: GetPendingAttachmentUploads :one
+SELECT COUNT(*)::int AS uploads, COALESCE(SUM(upload_length), 0)::bigint AS total_length
+FROM attachment_uploads
+WHERE user_id = $1 AND expires_at > NOW();
+
+-- name: GetAttachmentUploadByID :one
+SELECT * FROM attachment_uploads
+WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: UpdateAttachmentUploadOffset :one
+-- Only moves forward from the offset the caller read, so concurrent writers can't both win
+UPDATE attachment_uploads
+SET upload_offset = sqlc.arg(new_offset), expires_at = sqlc.arg(expires_at)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id) AND upload_offset = sqlc.arg(old_offset)
+RETURNING *;
+
+-- name: DeleteAttachmentUpload :exec
+DELETE FROM attachment_uploads
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteExpiredAttachmentUploads :many
+DELETE FROM attachment_uploads
+WHERE expires_at < NOW()
+RETURNING id;
@@ -0,0 +1,133 @@
+-- name: CreateAttachment :one
+INSERT INTO attachments (todo_id, user_id, file_name, storage_path, content_type, size, thumbnail_small_path, thumbnail_large_path, content_hash, scan_status, scanned_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING *;
+
+-- name: GetAttachmentByID :one
+SELECT * FROM attachments
+WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: ListAttachmentsForTodo :many
+SELECT * FROM attachments
+WHERE todo_id = $1 AND user_id = $2
+ORDER BY uploaded_at ASC;
+
+-- name: ListAttachmentsForTodos :many
+-- Batch load for todo lists to avoid one query per todo
+SELECT * FROM attachments
+WHERE todo_id = ANY(sqlc.arg(todo_ids)::uuid[]) AND user_id = $1
+ORDER BY uploaded_at ASC;
+
+-- name: DeleteAttachment :exec
+DELETE FROM attachments
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetAttachmentByStoragePath :one
+-- Matches the original file or one of its thumbnails. Attachments sharing a blob share
+-- the path, so prefer a match on the file itself, then the oldest attachment.
+SELECT * FROM attachments
+WHERE (storage_path = $1 OR thumbnail_small_path = $1 OR thumbnail_large_path = $1) AND user_id = $2
+ORDER BY (storage_path = $1) DESC, uploaded_at ASC, id ASC
+LIMIT 1;
+
+-- name: ListReferencedStoragePaths :many
+-- Returns which of the given storage IDs are still referenced by any attachment
+SELECT storage_path::text AS path FROM attachments
+WHERE storage_path = ANY(sqlc.arg(paths)::text[])
+UNION
+SELECT thumbnail_small_path::text FROM attachments
+WHERE thumbnail_small_path = ANY(sqlc.arg(paths)::text[])
+UNION
+SELECT thumbnail_large_path::text FROM attachments
+WHERE thumbnail_large_path = ANY(sqlc.arg(paths)::text[]);
+
+-- name: GetUserStorageUsage :one
+-- Bytes charged to the user: each distinct blob they reference once, however many
+-- attachments share it, plus attachments stored before deduplication
+SELECT (
+    COALESCE((
+        SELECT SUM(b.size) FROM attachment_blobs b
+        WHERE b.content_hash IN (
+            SELECT a.content_hash FROM attachments a
+            WHERE a.user_id = $1 AND a.content_hash IS NOT NULL
+        )
+    ), 0)
+    + COALESCE((
+        SELECT SUM(a.size) FROM attachments a
+        WHERE a.user_id = $1 AND a.content_hash IS NULL
+    ), 0)
+)::bigint AS used;
+
+-- name: GetAttachmentBlob :one
+SELECT * FROM attachment_blobs
+WHERE content_hash = $1 LIMIT 1;
+
+-- name: LockAttachmentBlob :one
+-- Keeps the blob from being released before an attachment referencing it commits
+SELECT * FROM attachment_blobs
+WHERE content_hash = $1
+FOR SHARE;
+
+-- name: UserReferencesAttachmentBlob :one
+-- Whether the user already has an attachment sharing this blob, served by idx_attachments_content_hash
+SELECT EXISTS (
+    SELECT 1 FROM attachments
+    WHERE content_hash = $1 AND user_id = $2
+) AS referenced;
+
+-- name: UpsertAttachmentBlob :one
+-- Returns the stored blob for this content, inserting it first if it is new.
+-- The no-op update locks an existing row so it can't be released before the attachment referencing it commits.
+INSERT INTO attachment_blobs (content_hash, storage_path, content_type, size, thumbnail_small_path, thumbnail_large_path)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (content_hash) DO UPDATE SET content_hash = EXCLUDED.content_hash
+RETURNING *;
+
+-- name: DeleteUnreferencedAttachmentBlob :one
+DELETE FROM attachment_blobs
+WHERE content_hash = $1 AND ref_count = 0
+RETURNING *;
+
+-- name: DeleteUnreferencedAttachmentBlobs :many
+-- Blobs left at zero references by cascading deletes
+DELETE FROM attachment_blobs
+WHERE ref_count = 0
+RETURNING *;
+
+-- name: ListStoredFiles :many
+-- Every storage ID the database points at, once each, preferring the row that knows its content hash
+SELECT DISTINCT ON (path) path, file_name, content_type, content_hash FROM (
+    SELECT storage_path::text AS path, file_name::text, content_type::text, content_hash::text FROM attachments
+    UNION ALL
+    SELECT storage_path::text, regexp_replace(storage_path, '^.*/', ''), content_type::text, content_hash::text FROM attachment_blobs
+    UNION ALL
+    SELECT thumbnail_small_path::text, regexp_replace(thumbnail_small_path, '^.*/', ''), '', NULL FROM attachments WHERE thumbnail_small_path IS NOT NULL
+    UNION ALL
+    SELECT thumbnail_large_path::text, regexp_replace(thumbnail_large_path, '^.*/', ''), '', NULL FROM attachments WHERE thumbnail_large_path IS NOT NULL
+) files
+ORDER BY path, content_hash IS NULL, file_name;
+
+-- name: RewriteAttachmentStoragePaths :execrows
+-- Points every file and thumbnail reference found in old_paths at the matching new_paths entry
+WITH moved AS (
+    SELECT * FROM unnest(sqlc.arg(old_paths)::text[], sqlc.arg(new_paths)::text[]) AS m(old_path, new_path)
+)
+UPDATE attachments a SET
+    storage_path = COALESCE((SELECT new_path FROM moved WHERE old_path = a.storage_path), a.storage_path),
+    thumbnail_small_path = COALESCE((SELECT new_path FROM moved WHERE old_path = a.thumbnail_small_path), a.thumbnail_small_path),
+    thumbnail_large_path = COALESCE((SELECT new_path FROM moved WHERE old_path = a.thumbnail_large_path), a.thumbnail_large_path)
+WHERE a.storage_path = ANY(sqlc.arg(old_paths)::text[])
+   OR a.thumbnail_small_path = ANY(sqlc.arg(old_paths)::text[])
+   OR a.thumbnail_large_path = ANY(sqlc.arg(old_paths)::text[]);
+
+-- name: RewriteAttachmentBlobStoragePaths :execrows
+WITH moved AS (
+    SELECT * FROM unnest(sqlc.arg(old_paths)::text[], sqlc.arg(new_paths)::text[]) AS m(old_path, new_path)
+)
+UPDATE attachment_blobs b SET
+    storage_path = COALESCE((SELECT new_path FROM moved WHERE old_path = b.storage_path), b.storage_path),
+    thumbnail_small_path = COALESCE((SELECT new_path FROM moved WHERE old_path = b.thumbnail_small_path), b.thumbnail_small_path),
+    thumbnail_large_path = COALESCE((SELECT new_path FROM moved WHERE old_path = b.thumbnail_large_path), b.thumbnail_large_path)
+WHERE b.storage_path = ANY(sqlc.arg(old_paths)::text[])
+   OR b.thumbnail_small_path = ANY(sqlc.arg(old_paths)::text[])
+   OR b.thumbnail_large_path = ANY(sqlc.arg(old_paths)::text[]);
@@ -0,0 +1,29 @@
+-- name: GetLoginAttempts :one
+SELECT * FROM login_attempts
+WHERE key = $1 LIMIT 1;
+
+-- name: RecordLoginFailure :one
+-- Counting starts over when the last failure is older than $2
+INSERT INTO login_attempts (key, failures, last_failed_at)
+VALUES ($1, 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE WHEN login_attempts.last_failed_at < $2 THEN 1 ELSE login_attempts.failures + 1 END,
+    previous_failed_at = CASE WHEN login_attempts.last_failed_at < $2 THEN NULL ELSE login_attempts.last_failed_at END,
+    last_failed_at = NOW()
+RETURNING *;
+
+-- name: ReleaseLoginFailure :exec
+-- Takes back one failure. The time of the last one is only restored when no other came in since ($2 is still the count).
+UPDATE login_attempts
+SET failures = GREATEST(failures - 1, 0),
+    last_failed_at = CASE WHEN failures = $2 THEN COALESCE(previous_failed_at, last_failed_at) ELSE last_failed_at END,
+    previous_failed_at = CASE WHEN failures = $2 THEN NULL ELSE previous_failed_at END
+WHERE key = $1;
+
+-- name: ResetLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: DeleteStaleLoginAttempts :execrows
+DELETE FROM login_attempts
+WHERE last_failed_at < $1;
@@ -0,0 +1,64 @@
+-- name: GetUserTotp :one
+SELECT * FROM user_totp
+WHERE user_id = $1 LIMIT 1;
+
+-- name: UpsertPendingUserTotp :one
+-- Starts over an unconfirmed enrollment; a confirmed one is left alone and no row comes back
+INSERT INTO user_totp (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = 0, failed_attempts = 0, lockouts = 0, locked_until = NULL, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: ConfirmUserTotp :one
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2, failed_attempts = 0
+WHERE user_id = $1 AND confirmed_at IS NULL
+RETURNING *;
+
+-- name: UseUserTotpStep :one
+-- Accepts each time step once, so an observed code can't be replayed
+UPDATE user_totp
+SET last_used_step = $2, failed_attempts = 0, lockouts = 0, locked_until = NULL
+WHERE user_id = $1 AND last_used_step < $2
+RETURNING *;
+
+-- name: IncrementUserTotpFailures :one
+UPDATE user_totp
+SET failed_attempts = failed_attempts + 1
+WHERE user_id = $1
+RETURNING failed_attempts;
+
+-- name: ResetUserTotpFailures :exec
+UPDATE user_totp
+SET failed_attempts = 0, lockouts = 0, locked_until = NULL
+WHERE user_id = $1;
+
+-- name: LockUserTotp :exec
+-- Starts a lockout; the failure count starts over but the lockout count keeps growing
+UPDATE user_totp
+SET failed_attempts = 0, lockouts = lockouts + 1, locked_until = $2
+WHERE user_id = $1;
+
+-- name: DeleteUserTotp :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateMfaRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+VALUES ($1, $2);
+
+-- name: ListUnusedMfaRecoveryCodes :many
+SELECT * FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL
+ORDER BY created_at;
+
+-- name: UseMfaRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: DeleteUserMfaRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
@@ -0,0 +1,23 @@
+-- name: CreatePasswordResetToken :one
+-- Inserts nothing when the user got a token after $4, which throttles reset emails
+INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+SELECT $1, $2, $3
+WHERE NOT EXISTS (
+  SELECT 1 FROM password_reset_tokens WHERE user_id = $1 AND created_at > $4
+)
+RETURNING *;
+
+-- name: RedeemPasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: InvalidateUserPasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteExpiredPasswordResetTokens :execrows
+DELETE FROM password_reset_tokens
+WHERE expires_at < NOW();
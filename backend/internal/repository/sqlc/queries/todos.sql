@@ -1,6 +1,6 @@
 -- name: CreateTodo :one
-INSERT INTO todos (user_id, title, description, status, deadline, attachment_url)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO todos (user_id, title, description, status, deadline)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING *;
 
 -- name: GetTodoByID :one
@@ -27,17 +27,10 @@ SET
   title = COALESCE(sqlc.narg(title), title),
   description = sqlc.narg(description),
   status = COALESCE(sqlc.narg(status), status),
-  deadline = sqlc.narg(deadline),
-  attachment_url = COALESCE(sqlc.narg(attachment_url), attachment_url) -- Update attachment_url
+  deadline = sqlc.narg(deadline)
 WHERE id = $1 AND user_id = $2
 RETURNING *;
 
 -- name: DeleteTodo :exec
 DELETE FROM todos
-WHERE id = $1 AND user_id = $2;
-
--- name: UpdateTodoAttachmentURL :exec
--- Sets or clears the attachment URL for a specific todo
-UPDATE todos
-SET attachment_url = $1 -- $1 will be the URL (TEXT) or NULL
-WHERE id = $2 AND user_id = $3;
\ No newline at end of file
+WHERE id = $1 AND user_id = $2;
\ No newline at end of file
@@ -1,6 +1,6 @@
 -- name: CreateUser :one
-INSERT INTO users (username, email, password_hash, email_verified, google_id)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO users (username, email, password_hash, email_verified)
+VALUES ($1, $2, $3, $4)
 RETURNING *;
 
 -- name: GetUserByID :one
@@ -11,21 +11,35 @@ WHERE id = $1 LIMIT 1;
 SELECT * FROM users
 WHERE email = $1 LIMIT 1;
 
--- name: GetUserByGoogleID :one
-SELECT * FROM users
-WHERE google_id = $1 LIMIT 1;
-
 -- name: UpdateUser :one
 UPDATE users
 SET
   username = COALESCE(sqlc.narg(username), username),
   email = COALESCE(sqlc.narg(email), email),
-  email_verified = COALESCE(sqlc.narg(email_verified), email_verified),
-  google_id = COALESCE(sqlc.narg(google_id), google_id)
+  email_verified = COALESCE(sqlc.narg(email_verified), email_verified)
   -- password_hash update should be handled separately if needed
 WHERE id = $1
 RETURNING *;
 
 -- name: DeleteUser :exec
 DELETE FROM users
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING *;
+
+-- name: MarkUserVerificationSent :one
+-- Claims the right to send a verification email; no row back means one went out after $2
+UPDATE users
+SET verification_sent_at = NOW()
+WHERE id = $1 AND (verification_sent_at IS NULL OR verification_sent_at < $2)
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET password_hash = $2
+WHERE id = $1
+RETURNING *;
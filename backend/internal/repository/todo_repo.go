@@ -29,15 +29,14 @@ func NewPgxTodoRepository(queries *db.Queries, pool *pgxpool.Pool) TodoRepositor
 
 func mapDbTodoToDomain(dbTodo db.Todo) *domain.Todo {
 	return &domain.Todo{
-		ID:            dbTodo.ID,
-		UserID:        dbTodo.UserID,
-		Title:         dbTodo.Title,
-		Description:   domain.NullStringToStringPtr(dbTodo.Description),
-		Status:        domain.TodoStatus(dbTodo.Status),
-		AttachmentUrl: domain.NullStringToStringPtr(dbTodo.AttachmentUrl),
-		Deadline:      dbTodo.Deadline,
-		CreatedAt:     dbTodo.CreatedAt,
-		UpdatedAt:     dbTodo.UpdatedAt,
+		ID:          dbTodo.ID,
+		UserID:      dbTodo.UserID,
+		Title:       dbTodo.Title,
+		Description: domain.NullStringToStringPtr(dbTodo.Description),
+		Status:      domain.TodoStatus(dbTodo.Status),
+		Deadline:    dbTodo.Deadline,
+		CreatedAt:   dbTodo.CreatedAt,
+		UpdatedAt:   dbTodo.UpdatedAt,
 	}
 }
 
@@ -250,23 +249,6 @@ func (r *pgxTodoRepository) GetTags(
 	return tags, nil
 }
 
-func (r *pgxTodoRepository) UpdateAttachmentURL(
-	ctx context.Context,
-	todoID, userID uuid.UUID,
-	attachmentURL *string,
-) error {
-	query := `
-		UPDATE todos
-		SET attachment_url = $1
-		WHERE id = $2 AND user_id = $3
-	`
-	_, err := r.pool.Exec(ctx, query, attachmentURL, todoID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to update attachment URL: %w", err)
-	}
-	return nil
-}
-
 // ― Helpers ―
 
 func derefString(s *string) string {
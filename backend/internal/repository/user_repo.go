@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Sosokker/todolist-backend/internal/domain"
 	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
@@ -22,9 +24,13 @@ func NewPgxUserRepository(queries *db.Queries) UserRepository {
 
 // mapDbUserToDomain converts a generated User → domain.User
 func mapDbUserToDomain(u db.User) *domain.User {
-	var googleID *string
-	if u.GoogleID.Valid {
-		googleID = &u.GoogleID.String
+	var maxUploadSize *int64
+	if u.MaxUploadSize.Valid {
+		maxUploadSize = &u.MaxUploadSize.Int64
+	}
+	var storageQuota *int64
+	if u.StorageQuota.Valid {
+		storageQuota = &u.StorageQuota.Int64
 	}
 	return &domain.User{
 		ID:            u.ID,
@@ -32,9 +38,13 @@ func mapDbUserToDomain(u db.User) *domain.User {
 		Email:         u.Email,
 		PasswordHash:  u.PasswordHash,
 		EmailVerified: u.EmailVerified,
-		GoogleID:      googleID,
+		MaxUploadSize: maxUploadSize,
+		StorageQuota:  storageQuota,
+		TokenVersion:  u.TokenVersion,
 		CreatedAt:     u.CreatedAt,
 		UpdatedAt:     u.UpdatedAt,
+
+		VerificationSentAt: u.VerificationSentAt,
 	}
 }
 
@@ -42,17 +52,11 @@ func (r *pgxUserRepository) Create(
 	ctx context.Context,
 	user *domain.User,
 ) (*domain.User, error) {
-	var pgGoogleID pgtype.Text
-	if user.GoogleID != nil {
-		pgGoogleID = pgtype.Text{String: *user.GoogleID, Valid: true}
-	}
-
 	dbUser, err := r.q.CreateUser(ctx, db.CreateUserParams{
 		Username:      user.Username,
 		Email:         user.Email,
 		PasswordHash:  user.PasswordHash,
 		EmailVerified: user.EmailVerified,
-		GoogleID:      pgGoogleID,
 	})
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -92,21 +96,6 @@ func (r *pgxUserRepository) GetByEmail(
 	return mapDbUserToDomain(dbUser), nil
 }
 
-func (r *pgxUserRepository) GetByGoogleID(
-	ctx context.Context,
-	googleID string,
-) (*domain.User, error) {
-	pgGoogleID := pgtype.Text{String: googleID, Valid: true}
-	dbUser, err := r.q.GetUserByGoogleID(ctx, pgGoogleID)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, domain.ErrNotFound
-		}
-		return nil, err
-	}
-	return mapDbUserToDomain(dbUser), nil
-}
-
 func (r *pgxUserRepository) Update(
 	ctx context.Context,
 	id uuid.UUID,
@@ -126,17 +115,11 @@ func (r *pgxUserRepository) Update(
 	}
 	emailVerified := pgtype.Bool{Bool: u.EmailVerified, Valid: true}
 
-	var pgGoogleID pgtype.Text
-	if u.GoogleID != nil {
-		pgGoogleID = pgtype.Text{String: *u.GoogleID, Valid: true}
-	}
-
 	dbUser, err := r.q.UpdateUser(ctx, db.UpdateUserParams{
 		ID:            id,
 		Username:      username,
 		Email:         email,
 		EmailVerified: emailVerified,
-		GoogleID:      pgGoogleID,
 	})
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -154,3 +137,38 @@ func (r *pgxUserRepository) Delete(
 ) error {
 	return r.q.DeleteUser(ctx, id)
 }
+
+// IncrementTokenVersion invalidates every access token issued to the user so far
+func (r *pgxUserRepository) IncrementTokenVersion(
+	ctx context.Context,
+	id uuid.UUID,
+) (*domain.User, error) {
+	dbUser, err := r.q.IncrementUserTokenVersion(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return mapDbUserToDomain(dbUser), nil
+}
+
+// MarkVerificationSent records that a verification email is going out now, unless one
+// already went out after sentBefore, in which case domain.ErrConflict is returned
+func (r *pgxUserRepository) MarkVerificationSent(
+	ctx context.Context,
+	id uuid.UUID,
+	sentBefore time.Time,
+) (*domain.User, error) {
+	dbUser, err := r.q.MarkUserVerificationSent(ctx, id, sentBefore)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if _, getErr := r.GetByID(ctx, id); getErr != nil {
+				return nil, getErr
+			}
+			return nil, fmt.Errorf("verification email sent too recently: %w", domain.ErrConflict)
+		}
+		return nil, err
+	}
+	return mapDbUserToDomain(dbUser), nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	db "github.com/Sosokker/todolist-backend/internal/repository/sqlc/generated"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type pgxWebAuthnRepository struct {
+	q *db.Queries
+}
+
+func NewPgxWebAuthnRepository(queries *db.Queries) WebAuthnRepository {
+	return &pgxWebAuthnRepository{q: queries}
+}
+
+// --- Mapping functions ---
+func mapDbWebauthnCredentialToDomain(d db.WebauthnCredential) *domain.WebAuthnCredential {
+	return &domain.WebAuthnCredential{
+		ID:           d.ID,
+		UserID:       d.UserID,
+		CredentialID: d.CredentialID,
+		PublicKey:    d.PublicKey,
+		SignCount:    uint32(d.SignCount),
+		Name:         d.Name,
+		CreatedAt:    d.CreatedAt,
+		LastUsedAt:   d.LastUsedAt,
+	}
+}
+
+// --- Repository Methods ---
+
+func (r *pgxWebAuthnRepository) Create(ctx context.Context, cred *domain.WebAuthnCredential) (*domain.WebAuthnCredential, error) {
+	d, err := r.q.CreateWebauthnCredential(ctx, db.CreateWebauthnCredentialParams{
+		UserID:       cred.UserID,
+		CredentialID: cred.CredentialID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    int64(cred.SignCount),
+		Name:         cred.Name,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				return nil, fmt.Errorf("passkey is already registered: %w", domain.ErrConflict)
+			case "23503":
+				return nil, fmt.Errorf("user %s not found: %w", cred.UserID, domain.ErrNotFound)
+			}
+		}
+		return nil, fmt.Errorf("failed to create passkey: %w", err)
+	}
+	return mapDbWebauthnCredentialToDomain(d), nil
+}
+
+func (r *pgxWebAuthnRepository) GetByCredentialID(ctx context.Context, credentialID []byte) (*domain.WebAuthnCredential, error) {
+	d, err := r.q.GetWebauthnCredentialByCredentialID(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get passkey: %w", err)
+	}
+	return mapDbWebauthnCredentialToDomain(d), nil
+}
+
+func (r *pgxWebAuthnRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error) {
+	rows, err := r.q.ListWebauthnCredentialsByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	creds := make([]domain.WebAuthnCredential, len(rows))
+	for i, row := range rows {
+		creds[i] = *mapDbWebauthnCredentialToDomain(row)
+	}
+	return creds, nil
+}
+
+func (r *pgxWebAuthnRepository) UpdateUsage(ctx context.Context, id uuid.UUID, signCount uint32) error {
+	if err := r.q.UpdateWebauthnCredentialUsage(ctx, id, int64(signCount)); err != nil {
+		return fmt.Errorf("failed to update passkey usage: %w", err)
+	}
+	return nil
+}
+
+func (r *pgxWebAuthnRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	n, err := r.q.DeleteWebauthnCredential(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
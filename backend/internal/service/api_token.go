@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/auth"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+// apiTokenUseInterval is how stale a token's last used time may get. Recording every
+// request would turn each read by a busy script into a write.
+const apiTokenUseInterval = time.Minute
+
+func (s *authService) CreateAPIToken(ctx context.Context, userID uuid.UUID, input CreateAPITokenInput) (string, *domain.APIToken, error) {
+	name, scopes, err := ValidateCreateAPITokenInput(input, time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to generate api token", "error", err)
+		return "", nil, domain.ErrInternalServer
+	}
+	token := auth.APITokenPrefix + secret
+
+	created, err := s.apiTokenRepo.Create(ctx, &domain.APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashOpaqueToken(token),
+		Scopes:    scopes,
+		ExpiresAt: input.ExpiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to store api token", "error", err, "userId", userID)
+		return "", nil, domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "API token created", "userId", userID, "tokenId", created.ID, "scopes", scopes)
+	return token, created, nil
+}
+
+func (s *authService) ListAPITokens(ctx context.Context, userID uuid.UUID) ([]domain.APIToken, error) {
+	tokens, err := s.apiTokenRepo.ListByUser(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list api tokens", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	return tokens, nil
+}
+
+func (s *authService) DeleteAPIToken(ctx context.Context, userID, id uuid.UUID) error {
+	if err := s.apiTokenRepo.Delete(ctx, id, userID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		s.logger.ErrorContext(ctx, "Failed to delete api token", "error", err, "userId", userID, "tokenId", id)
+		return domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "API token revoked", "userId", userID, "tokenId", id)
+	return nil
+}
+
+func (s *authService) ValidateAPIToken(ctx context.Context, token string) (*domain.User, *domain.APIToken, error) {
+	apiToken, err := s.apiTokenRepo.GetByHash(ctx, hashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil, fmt.Errorf("unknown api token: %w", domain.ErrUnauthorized)
+		}
+		s.logger.ErrorContext(ctx, "Failed to look up api token", "error", err)
+		return nil, nil, domain.ErrInternalServer
+	}
+	if apiToken.Expired(time.Now()) {
+		return nil, nil, fmt.Errorf("api token has expired: %w", domain.ErrUnauthorized)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, apiToken.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil, fmt.Errorf("user associated with token not found: %w", domain.ErrUnauthorized)
+		}
+		s.logger.ErrorContext(ctx, "Failed to fetch user for api token", "error", err, "tokenId", apiToken.ID)
+		return nil, nil, domain.ErrInternalServer
+	}
+
+	if err := s.apiTokenRepo.RecordUse(ctx, apiToken.ID, apiTokenUseInterval); err != nil {
+		s.logger.WarnContext(ctx, "Failed to record api token use", "error", err, "tokenId", apiToken.ID)
+	}
+	return user, apiToken, nil
+}
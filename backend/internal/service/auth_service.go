@@ -2,6 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -12,25 +16,71 @@ import (
 	"github.com/Sosokker/todolist-backend/internal/domain"
 	"github.com/Sosokker/todolist-backend/internal/repository"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/oauth2"
 )
 
+// tokenPurgeInterval is how often expired refresh tokens, revocation records and stale login counts are deleted
+const tokenPurgeInterval = time.Hour
+
+// opaqueTokenBytes is the entropy of refresh, password reset and API tokens
+const opaqueTokenBytes = 32
+
 type authService struct {
-	userRepo        repository.UserRepository
-	cfg             *config.Config
-	googleOAuthProv auth.OAuthProvider
-	logger          *slog.Logger
+	userRepo       repository.UserRepository
+	refreshRepo    repository.RefreshTokenRepository
+	revokedRepo    repository.RevokedTokenRepository
+	webauthnRepo   repository.WebAuthnRepository
+	identityRepo   repository.IdentityRepository
+	apiTokenRepo   repository.APITokenRepository
+	throttle       *loginThrottle
+	mfa            MFAService
+	jwtKeys        *auth.JWTKeys
+	cfg            *config.Config
+	oauthProviders map[string]auth.OAuthProvider // By key under oauth.providers
+	relyingParty   *auth.WebAuthnRelyingParty
+	logger         *slog.Logger
 }
 
-func NewAuthService(repo repository.UserRepository, cfg *config.Config) AuthService {
+func NewAuthService(
+	repo repository.UserRepository,
+	refreshRepo repository.RefreshTokenRepository,
+	revokedRepo repository.RevokedTokenRepository,
+	webauthnRepo repository.WebAuthnRepository,
+	identityRepo repository.IdentityRepository,
+	apiTokenRepo repository.APITokenRepository,
+	loginAttemptRepo repository.LoginAttemptRepository,
+	mfa MFAService,
+	jwtKeys *auth.JWTKeys,
+	cfg *config.Config,
+) AuthService {
 	logger := slog.Default().With("service", "auth")
-	googleProvider := auth.NewGoogleOAuthProvider(cfg)
+	providers := make(map[string]auth.OAuthProvider, len(cfg.OAuth.Providers))
+	for id, providerCfg := range cfg.OAuth.Providers {
+		providers[id] = auth.NewOAuthProvider(id, providerCfg, nil)
+	}
 	return &authService{
-		userRepo:        repo,
-		cfg:             cfg,
-		googleOAuthProv: googleProvider,
-		logger:          logger,
+		userRepo:     repo,
+		refreshRepo:  refreshRepo,
+		revokedRepo:  revokedRepo,
+		webauthnRepo: webauthnRepo,
+		identityRepo: identityRepo,
+		apiTokenRepo: apiTokenRepo,
+		throttle: &loginThrottle{
+			repo:   loginAttemptRepo,
+			cfg:    cfg.LoginThrottle,
+			logger: logger,
+		},
+		mfa:            mfa,
+		jwtKeys:        jwtKeys,
+		cfg:            cfg,
+		oauthProviders: providers,
+		relyingParty: &auth.WebAuthnRelyingParty{
+			ID:                      cfg.WebAuthn.RPID,
+			Origins:                 cfg.WebAuthn.Origins,
+			RequireUserVerification: cfg.WebAuthn.UserVerification == "required",
+		},
+		logger: logger,
 	}
 }
 
@@ -68,73 +118,218 @@ func (s *authService) Signup(ctx context.Context, creds SignupCredentials) (*dom
 	return createdUser, nil
 }
 
-func (s *authService) Login(ctx context.Context, creds LoginCredentials) (string, *domain.User, error) {
+func (s *authService) Login(ctx context.Context, creds LoginCredentials) (*AuthTokens, *MFAChallenge, error) {
 	if err := ValidateLoginInput(creds); err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
+	attempt, err := s.throttle.begin(ctx, creds.Email, creds.ClientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer attempt.release(ctx)
 
 	user, err := s.userRepo.GetByEmail(ctx, creds.Email)
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
-			return "", nil, fmt.Errorf("invalid email or password: %w", domain.ErrUnauthorized)
+			attempt.fail(ctx, "")
+			return nil, nil, fmt.Errorf("invalid email or password: %w", domain.ErrUnauthorized)
 		}
 		slog.ErrorContext(ctx, "Failed to get user by email", "error", err)
-		return "", nil, domain.ErrInternalServer
+		return nil, nil, domain.ErrInternalServer
 	}
 
-	if user.PasswordHash == "" && user.GoogleID != nil {
-		return "", nil, fmt.Errorf("please log in using Google: %w", domain.ErrUnauthorized)
-	}
 	if user.PasswordHash == "" {
+		identities, err := s.identityRepo.ListByUser(ctx, user.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to list identities", "error", err, "userId", user.ID)
+			return nil, nil, domain.ErrInternalServer
+		}
+		if len(identities) > 0 {
+			return nil, nil, fmt.Errorf("please log in using %s: %w", s.oauthProviderName(identities[0].Provider), domain.ErrUnauthorized)
+		}
 		slog.ErrorContext(ctx, "User found with empty password hash", "userId", user.ID)
-		return "", nil, fmt.Errorf("account error, please contact support: %w", domain.ErrInternalServer)
+		return nil, nil, fmt.Errorf("account error, please contact support: %w", domain.ErrInternalServer)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(creds.Password))
 	if err != nil {
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return "", nil, fmt.Errorf("invalid email or password: %w", domain.ErrUnauthorized)
+			attempt.fail(ctx, user.ID.String())
+			return nil, nil, fmt.Errorf("invalid email or password: %w", domain.ErrUnauthorized)
 		}
 		slog.ErrorContext(ctx, "Error comparing password hash", "error", err, "userId", user.ID)
-		return "", nil, domain.ErrInternalServer
+		return nil, nil, domain.ErrInternalServer
 	}
 
-	token, err := s.GenerateJWT(user)
+	mfaEnabled, err := s.mfa.Enabled(ctx, user.ID)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := s.newMFAChallenge(user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil // The account's failure count is only cleared once the second factor passes
+	}
+	s.throttle.recordSuccess(ctx, creds.Email)
+
+	tokens, err := s.issueTokens(ctx, user)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return token, user, nil
+	return tokens, nil, nil
+}
+
+// newMFAChallenge returns a token proving the user got the password right. It carries
+// the token version, so LogoutEverywhere and password resets invalidate it too.
+func (s *authService) newMFAChallenge(user *domain.User) (*MFAChallenge, error) {
+	expiresAt := time.Now().Add(s.cfg.MFA.ChallengeExpiry)
+	token, err := s.signJWT(&auth.Claims{
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
+		Purpose:      auth.PurposeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   user.ID.String(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallenge{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+func (s *authService) VerifyMFA(ctx context.Context, challengeToken, code string) (*AuthTokens, error) {
+	claims, err := s.parseJWT(challengeToken, auth.PurposeMFA)
+	if err != nil {
+		return nil, fmt.Errorf("login has expired, log in again: %w", domain.ErrUnauthorized)
+	}
+	user, err := s.userForClaims(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfa.VerifyCode(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrMFAAttemptsExhausted) {
+			if revokeErr := s.revokeClaims(ctx, claims); revokeErr != nil {
+				return nil, revokeErr
+			}
+		}
+		if errors.Is(err, domain.ErrBadRequest) {
+			return nil, fmt.Errorf("invalid code: %w", domain.ErrUnauthorized) // 2FA was turned off since the password step
+		}
+		return nil, err
+	}
+
+	// A challenge is good for one login
+	if err := s.revokeClaims(ctx, claims); err != nil {
+		return nil, err
+	}
+	s.throttle.recordSuccess(ctx, user.Email)
+	return s.issueTokens(ctx, user)
 }
 
 func (s *authService) GenerateJWT(user *domain.User) (string, error) {
-	expirationTime := time.Now().Add(time.Duration(s.cfg.JWT.ExpiryMinutes) * time.Minute)
-	claims := &auth.Claims{
-		UserID: user.ID,
+	return s.generateJWT(user, time.Now().Add(time.Duration(s.cfg.JWT.ExpiryMinutes)*time.Minute))
+}
+
+func (s *authService) generateJWT(user *domain.User, expirationTime time.Time) (string, error) {
+	return s.signJWT(&auth.Claims{
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   user.ID.String(),
 		},
-	}
+	})
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.cfg.JWT.Secret))
+// signJWT stamps the issuer and the purpose's audience on claims and signs them
+func (s *authService) signJWT(claims *auth.Claims) (string, error) {
+	claims.Issuer = s.cfg.JWT.Issuer
+	claims.Audience = jwt.ClaimStrings{auth.Audience(s.cfg.JWT.Audience, claims.Purpose)}
+	typ := ""
+	if claims.Purpose == auth.PurposeAccess {
+		typ = auth.AccessTokenType
+	}
+	tokenString, err := s.jwtKeys.Sign(claims, typ)
 	if err != nil {
-		slog.Error("Failed to sign JWT token", "error", err, "userId", user.ID)
+		slog.Error("Failed to sign JWT token", "error", err, "userId", claims.UserID)
 		return "", domain.ErrInternalServer
 	}
 	return tokenString, nil
 }
 
-func (s *authService) ValidateJWT(tokenString string) (*domain.User, error) {
-	claims := &auth.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+func (s *authService) JWKS() auth.JSONWebKeySet {
+	return s.jwtKeys.JWKS()
+}
+
+func (s *authService) ValidateJWT(ctx context.Context, tokenString string) (*domain.User, error) {
+	claims, err := s.parseJWT(tokenString, auth.PurposeAccess)
+	if err != nil {
+		return nil, err
+	}
+	return s.userForClaims(ctx, claims)
+}
+
+// userForClaims checks that a parsed token wasn't revoked, on its own or by a token version bump,
+// and returns its user
+func (s *authService) userForClaims(ctx context.Context, claims *auth.Claims) (*domain.User, error) {
+	if err := s.checkNotRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, fmt.Errorf("user associated with token not found: %w", domain.ErrUnauthorized)
 		}
-		return []byte(s.cfg.JWT.Secret), nil
-	})
+		slog.Error("Failed to fetch user for valid JWT", "error", err, "userId", claims.UserID)
+		return nil, domain.ErrInternalServer
+	}
+
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, fmt.Errorf("token has been revoked: %w", domain.ErrUnauthorized)
+	}
+
+	return user, nil
+}
+
+// checkNotRevoked fails with domain.ErrUnauthorized if the token was revoked on its own
+func (s *authService) checkNotRevoked(ctx context.Context, claims *auth.Claims) error {
+	// Tokens issued before jti existed can't be revoked one by one, only by LogoutEverywhere
+	if claims.ID == "" {
+		return nil
+	}
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return fmt.Errorf("invalid token id: %w", domain.ErrUnauthorized)
+	}
+	revoked, err := s.revokedRepo.IsRevoked(ctx, jti)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to check token revocation", "error", err, "jti", jti)
+		return domain.ErrInternalServer
+	}
+	if revoked {
+		return fmt.Errorf("token has been revoked: %w", domain.ErrUnauthorized)
+	}
+	return nil
+}
+
+// parseJWT verifies the signature, expiry, issuer, audience and purpose and returns the claims
+func (s *authService) parseJWT(tokenString, purpose string) (*auth.Claims, error) {
+	claims := &auth.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.jwtKeys.Keyfunc,
+		jwt.WithValidMethods(s.jwtKeys.ValidMethods()),
+		jwt.WithIssuer(s.cfg.JWT.Issuer),
+		jwt.WithAudience(auth.Audience(s.cfg.JWT.Audience, purpose)),
+	)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -147,112 +342,226 @@ func (s *authService) ValidateJWT(tokenString string) (*domain.User, error) {
 		return nil, fmt.Errorf("invalid token: %w", domain.ErrUnauthorized)
 	}
 
-	if !token.Valid {
+	isAccessType := token.Header["typ"] == auth.AccessTokenType
+	if !token.Valid || claims.Purpose != purpose || isAccessType != (purpose == auth.PurposeAccess) {
 		return nil, fmt.Errorf("invalid token: %w", domain.ErrUnauthorized)
 	}
+	return claims, nil
+}
 
-	user, err := s.userRepo.GetByID(context.Background(), claims.UserID)
+func (s *authService) RevokeAccessToken(ctx context.Context, tokenString string) error {
+	claims, err := s.parseJWT(tokenString, auth.PurposeAccess)
+	if err != nil {
+		return err
+	}
+	return s.revokeClaims(ctx, claims)
+}
+
+// revokeClaims rejects the token the claims came from until it expires
+func (s *authService) revokeClaims(ctx context.Context, claims *auth.Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil // Nothing to key a revocation on; it lapses at its expiry
+	}
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return fmt.Errorf("invalid token id: %w", domain.ErrUnauthorized)
+	}
+
+	err = s.revokedRepo.Revoke(ctx, &domain.RevokedToken{
+		JTI:       jti,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
-			return nil, fmt.Errorf("user associated with token not found: %w", domain.ErrUnauthorized)
+			return fmt.Errorf("user associated with token not found: %w", domain.ErrUnauthorized)
 		}
-		slog.Error("Failed to fetch user for valid JWT", "error", err, "userId", claims.UserID)
-		return nil, domain.ErrInternalServer
+		s.logger.ErrorContext(ctx, "Failed to revoke access token", "error", err, "jti", jti)
+		return domain.ErrInternalServer
 	}
-
-	return user, nil
+	return nil
 }
 
-func (s *authService) GetGoogleAuthConfig() *oauth2.Config {
-	return s.googleOAuthProv.GetOAuth2Config()
+func (s *authService) LogoutEverywhere(ctx context.Context, userID uuid.UUID) error {
+	if _, err := s.userRepo.IncrementTokenVersion(ctx, userID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		s.logger.ErrorContext(ctx, "Failed to bump token version", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	if err := s.refreshRepo.RevokeAllForUser(ctx, userID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to revoke refresh tokens", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Logged out all sessions", "userId", userID)
+	return nil
 }
 
-type GoogleUserInfo struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
+// issueTokens starts a new refresh token family for user, as every login does
+func (s *authService) issueTokens(ctx context.Context, user *domain.User) (*AuthTokens, error) {
+	return s.issueTokensInFamily(ctx, user, uuid.New(), time.Now().Add(s.cfg.JWT.RefreshExpiry), nil)
 }
 
-func (s *authService) HandleGoogleCallback(ctx context.Context, code string) (string, *domain.User, error) {
-	token, err := s.googleOAuthProv.ExchangeCode(ctx, code)
+// issueTokensInFamily mints an access token and a refresh token in familyID. When
+// rotating is set, the new refresh token replaces it and rotating must still be unused.
+func (s *authService) issueTokensInFamily(
+	ctx context.Context,
+	user *domain.User,
+	familyID uuid.UUID,
+	refreshExpiresAt time.Time,
+	rotating *domain.RefreshToken,
+) (*AuthTokens, error) {
+	refreshToken, err := newOpaqueToken()
 	if err != nil {
-		s.logger.ErrorContext(ctx, "Failed to exchange google auth code via provider", "error", err)
-		return "", nil, fmt.Errorf("google auth exchange failed: %w", domain.ErrUnauthorized)
+		s.logger.ErrorContext(ctx, "Failed to generate refresh token", "error", err)
+		return nil, domain.ErrInternalServer
 	}
 
-	userInfo, err := s.googleOAuthProv.FetchUserInfo(ctx, token)
+	next := &domain.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashOpaqueToken(refreshToken),
+		ExpiresAt: refreshExpiresAt,
+	}
+	if rotating != nil {
+		_, err = s.refreshRepo.Rotate(ctx, rotating.ID, next)
+	} else {
+		_, err = s.refreshRepo.Create(ctx, next)
+	}
 	if err != nil {
-		s.logger.ErrorContext(ctx, "Failed to fetch google user info via provider", "error", err)
-		return "", nil, fmt.Errorf("failed to get user info from google: %w", domain.ErrUnauthorized)
+		if errors.Is(err, domain.ErrConflict) {
+			return nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to store refresh token", "error", err, "userId", user.ID)
+		return nil, domain.ErrInternalServer
 	}
 
-	if !userInfo.VerifiedEmail {
-		return "", nil, fmt.Errorf("google email not verified: %w", domain.ErrUnauthorized)
+	accessExpiresAt := time.Now().Add(time.Duration(s.cfg.JWT.ExpiryMinutes) * time.Minute)
+	accessToken, err := s.generateJWT(user, accessExpiresAt)
+	if err != nil {
+		return nil, err
 	}
 
-	user, err := s.userRepo.GetByGoogleID(ctx, userInfo.ID)
-	if err != nil && !errors.Is(err, domain.ErrNotFound) {
-		slog.ErrorContext(ctx, "Failed to check user by google ID", "error", err, "googleId", userInfo.ID)
-		return "", nil, domain.ErrInternalServer
-	}
+	return &AuthTokens{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
 
-	if user != nil {
-		jwtToken, jwtErr := s.GenerateJWT(user)
-		if jwtErr != nil {
-			return "", nil, jwtErr
-		}
-		return jwtToken, user, nil
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*AuthTokens, error) {
+	stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
 	}
 
-	user, err = s.userRepo.GetByEmail(ctx, userInfo.Email)
-	if err != nil && !errors.Is(err, domain.ErrNotFound) {
-		slog.ErrorContext(ctx, "Failed to check user by email during google callback", "error", err, "email", userInfo.Email)
-		return "", nil, domain.ErrInternalServer
+	if stored.RotatedAt != nil {
+		s.revokeReusedFamily(ctx, stored)
+		return nil, fmt.Errorf("refresh token was already used: %w", domain.ErrUnauthorized)
+	}
+	if !stored.Usable(time.Now()) {
+		return nil, fmt.Errorf("refresh token has expired or was revoked: %w", domain.ErrUnauthorized)
 	}
 
-	if user != nil {
-		if user.GoogleID != nil && *user.GoogleID != userInfo.ID {
-			slog.WarnContext(ctx, "User email associated with different Google ID", "userId", user.ID, "existingGoogleId", *user.GoogleID, "newGoogleId", userInfo.ID)
-			return "", nil, fmt.Errorf("email already linked to a different Google account: %w", domain.ErrConflict)
-		}
-		if user.GoogleID == nil {
-			updateData := &domain.User{GoogleID: &userInfo.ID, EmailVerified: true}
-			updatedUser, updateErr := s.userRepo.Update(ctx, user.ID, updateData)
-			if updateErr != nil {
-				slog.ErrorContext(ctx, "Failed to link Google ID to existing user", "error", updateErr, "userId", user.ID)
-				return "", nil, domain.ErrInternalServer
-			}
-			user = updatedUser
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, fmt.Errorf("user associated with refresh token not found: %w", domain.ErrUnauthorized)
 		}
+		s.logger.ErrorContext(ctx, "Failed to fetch user for refresh token", "error", err, "userId", stored.UserID)
+		return nil, domain.ErrInternalServer
+	}
 
-		jwtToken, jwtErr := s.GenerateJWT(user)
-		if jwtErr != nil {
-			return "", nil, jwtErr
+	// The family's expiry carries over, so rotating never extends a login past jwt.refreshExpiry
+	tokens, err := s.issueTokensInFamily(ctx, user, stored.FamilyID, stored.ExpiresAt, stored)
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			// Another request rotated it between the lookup and now
+			s.revokeReusedFamily(ctx, stored)
+			return nil, fmt.Errorf("refresh token was already used: %w", domain.ErrUnauthorized)
 		}
-		return jwtToken, user, nil
+		return nil, err
 	}
+	return tokens, nil
+}
 
-	newUser := &domain.User{
-		Username:      userInfo.Name,
-		Email:         userInfo.Email,
-		PasswordHash:  "",
-		EmailVerified: true,
-		GoogleID:      &userInfo.ID,
+func (s *authService) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to revoke refresh token family", "error", err, "familyId", stored.FamilyID)
+		return domain.ErrInternalServer
 	}
+	return nil
+}
 
-	createdUser, err := s.userRepo.Create(ctx, newUser)
+// lookupRefreshToken finds the stored token, failing with domain.ErrUnauthorized if it's unknown
+func (s *authService) lookupRefreshToken(ctx context.Context, refreshToken string) (*domain.RefreshToken, error) {
+	if refreshToken == "" {
+		return nil, fmt.Errorf("refresh token is required: %w", domain.ErrUnauthorized)
+	}
+	stored, err := s.refreshRepo.GetByHash(ctx, hashOpaqueToken(refreshToken))
 	if err != nil {
-		if errors.Is(err, domain.ErrConflict) {
-			return "", nil, fmt.Errorf("failed to create user, potential conflict: %w", domain.ErrConflict)
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, fmt.Errorf("invalid refresh token: %w", domain.ErrUnauthorized)
+		}
+		s.logger.ErrorContext(ctx, "Failed to look up refresh token", "error", err)
+		return nil, domain.ErrInternalServer
+	}
+	return stored, nil
+}
+
+// revokeReusedFamily ends every session descending from the login a reused token
+// belongs to. Either the client or an attacker holds a stale copy and there's no
+// telling which, so both have to log in again.
+func (s *authService) revokeReusedFamily(ctx context.Context, stored *domain.RefreshToken) {
+	s.logger.WarnContext(ctx, "Refresh token reused, revoking its family", "userId", stored.UserID, "familyId", stored.FamilyID)
+	if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to revoke reused refresh token family", "error", err, "familyId", stored.FamilyID)
+	}
+}
+
+// Run deletes expired refresh tokens and revocation records every tokenPurgeInterval until ctx is cancelled
+func (s *authService) Run(ctx context.Context) {
+	ticker := time.NewTicker(tokenPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.refreshRepo.DeleteExpired(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to purge expired refresh tokens", "error", err)
+		} else if n > 0 {
+			s.logger.InfoContext(ctx, "Purged expired refresh tokens", "count", n)
+		}
+		if n, err := s.revokedRepo.DeleteExpired(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to purge expired revoked tokens", "error", err)
+		} else if n > 0 {
+			s.logger.InfoContext(ctx, "Purged expired revoked tokens", "count", n)
+		}
+		s.throttle.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-		slog.ErrorContext(ctx, "Failed to create new user from google info", "error", err)
-		return "", nil, domain.ErrInternalServer
 	}
+}
 
-	jwtToken, jwtErr := s.GenerateJWT(createdUser)
-	if jwtErr != nil {
-		return "", nil, jwtErr
+// newOpaqueToken returns a random, URL-safe opaque token
+func newOpaqueToken() (string, error) {
+	b := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return jwtToken, createdUser, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashOpaqueToken is what gets stored; the tokens are random enough that a plain SHA-256 suffices
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+)
+
+// clamdChunkSize is the size of the INSTREAM chunks sent to clamd
+const clamdChunkSize = 64 << 10
+
+// clamdScanner streams files to a clamd daemon with the INSTREAM command:
+// length-prefixed chunks terminated by a zero-length chunk, answered with
+// "stream: OK", "stream: <signature> FOUND" or "<message> ERROR".
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+	logger  *slog.Logger
+}
+
+// NewClamdScanner creates a scanner for a clamd listening on TCP ("tcp://host:port" or
+// "host:port") or on a Unix socket ("unix:///path/to/clamd.ctl").
+func NewClamdScanner(cfg config.ClamdConfig, logger *slog.Logger) (AttachmentScanner, error) {
+	network, address := "tcp", cfg.Address
+	if rest, ok := strings.CutPrefix(address, "unix://"); ok {
+		network, address = "unix", rest
+	} else if rest, ok := strings.CutPrefix(address, "tcp://"); ok {
+		address = rest
+	}
+	if address == "" {
+		return nil, fmt.Errorf("clamd address is required")
+	}
+
+	logger.Info("clamd scanner initialized", "network", network, "address", address)
+
+	return &clamdScanner{
+		network: network,
+		address: address,
+		timeout: cfg.Timeout,
+		logger:  logger.With("service", "clamd"),
+	}, nil
+}
+
+func (s *clamdScanner) Scan(ctx context.Context, content io.Reader) (*domain.ScanResult, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() }) // Unblock reads and writes on cancellation
+	defer stop()
+
+	if err := s.sendStream(conn, content); err != nil {
+		// clamd answers before hanging up when it rejects a stream, e.g. past StreamMaxLength
+		if reply, replyErr := readClamdReply(conn); replyErr == nil {
+			return nil, fmt.Errorf("clamd rejected stream: %s", reply)
+		}
+		return nil, err
+	}
+
+	reply, err := readClamdReply(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// sendStream writes the INSTREAM command, the content as chunks, and the terminating empty chunk
+func (s *clamdScanner) sendStream(conn net.Conn, content io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("failed to send clamd command: %w", err)
+	}
+
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := content.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("failed to stream to clamd: %w", err)
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read content for clamd: %w", readErr)
+		}
+	}
+
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to finish clamd stream: %w", err)
+	}
+	return nil
+}
+
+// readClamdReply reads one NUL-terminated reply, as requested by the "z" command prefix
+func readClamdReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return "", err
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+func parseClamdReply(reply string) (*domain.ScanResult, error) {
+	// Replies are prefixed with the stream name: "stream: OK"
+	result := strings.TrimSpace(reply)
+	if _, after, ok := strings.Cut(result, ": "); ok {
+		result = after
+	}
+
+	switch {
+	case result == "OK":
+		return &domain.ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &domain.ScanResult{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd error: %s", reply)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+)
+
+// sniffLen is the number of leading bytes inspected, matching http.DetectContentType
+const sniffLen = 512
+
+// sniffContentType detects the media type of a file from its first bytes,
+// ignoring the file name entirely. Parameters such as charset are dropped.
+func sniffContentType(head []byte) string {
+	// http.DetectContentType only knows MP4 brands, so recognise QuickTime (macOS screen recordings) here
+	if len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) && bytes.Equal(head[8:12], []byte("qt  ")) {
+		return "video/quicktime"
+	}
+	detected := http.DetectContentType(head)
+	mediaType, _, err := mime.ParseMediaType(detected)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// contentTypePolicy decides which sniffed media types may be uploaded.
+// Patterns are exact types ("application/pdf") or a major type wildcard ("image/*").
+type contentTypePolicy struct {
+	allowed []string
+	denied  []string
+}
+
+func newContentTypePolicy(allowed, denied []string) *contentTypePolicy {
+	return &contentTypePolicy{allowed: normalizePatterns(allowed), denied: normalizePatterns(denied)}
+}
+
+// Check returns a validation error if the media type is denied, or if an allowlist
+// is configured and the type isn't on it. The denylist always wins.
+func (p *contentTypePolicy) Check(contentType string) error {
+	contentType = strings.ToLower(contentType)
+	if matchesAny(p.denied, contentType) {
+		return fmt.Errorf("file type %s is not allowed: %w", contentType, domain.ErrValidation)
+	}
+	if len(p.allowed) > 0 && !matchesAny(p.allowed, contentType) {
+		return fmt.Errorf("file type %s is not allowed: %w", contentType, domain.ErrValidation)
+	}
+	return nil
+}
+
+func normalizePatterns(patterns []string) []string {
+	out := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func matchesAny(patterns []string, contentType string) bool {
+	for _, p := range patterns {
+		if p == "*/*" || p == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineContentTypes can be rendered by a browser without running script in our origin
+var inlineContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/quicktime": true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"audio/ogg":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// ContentDisposition builds the Content-Disposition header for serving a file:
+// inline for media a browser can display safely, attachment for everything else.
+func ContentDisposition(contentType, fileName string) string {
+	disposition := "attachment"
+	if inlineContentTypes[contentType] {
+		disposition = "inline"
+	}
+	if header := mime.FormatMediaType(disposition, map[string]string{"filename": fileName}); header != "" {
+		return header
+	}
+	return disposition // File name couldn't be encoded
+}
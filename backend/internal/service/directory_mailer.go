@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/google/uuid"
+)
+
+// directoryMailer writes every message to its own .eml file instead of sending it,
+// so local setups can open verification links without a mail server
+type directoryMailer struct {
+	dir    string
+	from   string
+	logger *slog.Logger
+}
+
+func NewDirectoryMailer(cfg config.EmailConfig, logger *slog.Logger) (Mailer, error) {
+	if cfg.Directory == "" {
+		return nil, fmt.Errorf("email.directory is required for the directory mailer")
+	}
+	if err := os.MkdirAll(cfg.Directory, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory %s: %w", cfg.Directory, err)
+	}
+	logger.Info("Directory mailer initialized, email is written to disk instead of sent", "path", cfg.Directory)
+	return &directoryMailer{
+		dir:    cfg.Directory,
+		from:   cfg.From,
+		logger: logger.With("service", "directoryMailer"),
+	}, nil
+}
+
+func (m *directoryMailer) Send(ctx context.Context, msg *MailMessage) error {
+	now := time.Now()
+	data, err := formatMessage(m.from, msg, now)
+	if err != nil {
+		return fmt.Errorf("failed to format message: %w", err)
+	}
+
+	// Timestamp first so the files list in the order they were sent
+	path := filepath.Join(m.dir, fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), uuid.NewString()))
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	m.logger.InfoContext(ctx, "Wrote email", "to", msg.To, "subject", msg.Subject, "path", path)
+	return nil
+}
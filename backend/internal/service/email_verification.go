@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/auth"
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+const verificationEmailBody = `Hi %s,
+
+Confirm your email address by opening this link:
+
+%s
+
+The link expires in %s. If you didn't sign up, you can ignore this email.
+`
+
+type emailVerificationService struct {
+	userRepo repository.UserRepository
+	mailer   Mailer
+	cfg      config.EmailConfig
+	logger   *slog.Logger
+}
+
+func NewEmailVerificationService(userRepo repository.UserRepository, mailer Mailer, cfg config.EmailConfig) EmailVerificationService {
+	return &emailVerificationService{
+		userRepo: userRepo,
+		mailer:   mailer,
+		cfg:      cfg,
+		logger:   slog.Default().With("service", "email_verification"),
+	}
+}
+
+func (s *emailVerificationService) SendVerification(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for verification email", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	if user.EmailVerified {
+		return fmt.Errorf("email address is already verified: %w", domain.ErrConflict)
+	}
+
+	// Claim the send first, so concurrent requests can't both get through the throttle
+	now := time.Now()
+	if _, err := s.userRepo.MarkVerificationSent(ctx, userID, now.Add(-s.cfg.ResendInterval)); err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			retryAfter := s.cfg.ResendInterval
+			if user.VerificationSentAt != nil {
+				retryAfter = user.VerificationSentAt.Add(s.cfg.ResendInterval).Sub(now)
+			}
+			return &domain.RetryAfterError{
+				Message:    "a verification email was sent recently, try again later",
+				RetryAfter: max(retryAfter, time.Second),
+			}
+		}
+		s.logger.ErrorContext(ctx, "Failed to record verification email", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+
+	token := auth.SignEmailToken(user.ID, user.Email, now.Add(s.cfg.VerificationExpiry), []byte(s.cfg.TokenSecret))
+	link, err := url.Parse(s.cfg.VerifyURL)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Invalid email.verifyUrl", "error", err, "url", s.cfg.VerifyURL)
+		return domain.ErrInternalServer
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = s.mailer.Send(ctx, &MailMessage{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf(verificationEmailBody, user.Username, link.String(), s.cfg.VerificationExpiry),
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to send verification email", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	return nil
+}
+
+func (s *emailVerificationService) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	userID, email, err := auth.VerifyEmailToken(token, []byte(s.cfg.TokenSecret))
+	if err != nil {
+		if errors.Is(err, auth.ErrEmailTokenExpired) {
+			return nil, fmt.Errorf("verification link has expired, request a new one: %w", domain.ErrBadRequest)
+		}
+		return nil, fmt.Errorf("invalid verification link: %w", domain.ErrBadRequest)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, fmt.Errorf("invalid verification link: %w", domain.ErrBadRequest)
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for email verification", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	if user.Email != email {
+		return nil, fmt.Errorf("verification link is for a previous email address: %w", domain.ErrBadRequest)
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+
+	verified, err := s.userRepo.Update(ctx, user.ID, &domain.User{EmailVerified: true})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to mark email verified", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Email verified", "userId", userID)
+	return verified, nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// EXIF orientation values, as written by cameras and phones that store pixels
+// in sensor order and leave rotation to the viewer
+const (
+	orientationNormal      = 1
+	orientationFlipH       = 2
+	orientationRotate180   = 3
+	orientationFlipV       = 4
+	orientationTranspose   = 5 // Flip along the top-left to bottom-right diagonal
+	orientationRotate90CW  = 6
+	orientationTransverse  = 7 // Flip along the top-right to bottom-left diagonal
+	orientationRotate90CCW = 8
+)
+
+const (
+	exifOrientationTag = 0x0112
+	exifTypeShort      = 3
+
+	jpegMarkerStartOfScan    = 0xDA
+	jpegMarkerEndOfImage     = 0xD9
+	jpegMarkerApp1           = 0xE1
+	jpegStandaloneMarkerLow  = 0xD0 // RST0..RST7 and SOI carry no length
+	jpegStandaloneMarkerHigh = 0xD8
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// jpegOrientation returns the EXIF orientation of a JPEG, or orientationNormal when
+// the file isn't a JPEG or has no usable orientation tag.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return orientationNormal
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return orientationNormal
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // Fill byte before a marker
+			i++
+			continue
+		case marker >= jpegStandaloneMarkerLow && marker <= jpegStandaloneMarkerHigh, marker == 0x01:
+			i += 2
+			continue
+		case marker == jpegMarkerStartOfScan, marker == jpegMarkerEndOfImage:
+			return orientationNormal // EXIF always comes before the image data
+		}
+
+		segLen := int(binary.BigEndian.Uint16(data[i+2:]))
+		if segLen < 2 || i+2+segLen > len(data) {
+			return orientationNormal
+		}
+		segment := data[i+4 : i+2+segLen]
+		if marker == jpegMarkerApp1 && bytes.HasPrefix(segment, exifHeader) {
+			return tiffOrientation(segment[len(exifHeader):])
+		}
+		i += 2 + segLen
+	}
+	return orientationNormal
+}
+
+// tiffOrientation reads the orientation tag from IFD0 of a TIFF structure
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return orientationNormal
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return orientationNormal
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return orientationNormal
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return orientationNormal
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		if order.Uint16(tiff[entry+2:]) != exifTypeShort {
+			return orientationNormal
+		}
+		if o := int(order.Uint16(tiff[entry+8:])); o >= orientationNormal && o <= orientationRotate90CCW {
+			return o
+		}
+		return orientationNormal
+	}
+	return orientationNormal
+}
+
+// applyOrientation returns img transformed so it displays upright for the given
+// EXIF orientation. It copies pixel by pixel, so it's meant for thumbnails.
+func applyOrientation(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= orientationNormal || orientation > orientationRotate90CCW {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= orientationTranspose {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case orientationFlipH:
+				dx, dy = w-1-x, y
+			case orientationRotate180:
+				dx, dy = w-1-x, h-1-y
+			case orientationFlipV:
+				dx, dy = x, h-1-y
+			case orientationTranspose:
+				dx, dy = y, x
+			case orientationRotate90CW:
+				dx, dy = h-1-y, x
+			case orientationTransverse:
+				dx, dy = h-1-y, w-1-x
+			case orientationRotate90CCW:
+				dx, dy = y, w-1-x
+			}
+			src := img.PixOffset(x+img.Rect.Min.X, y+img.Rect.Min.Y)
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], img.Pix[src:src+4])
+		}
+	}
+	return dst
+}
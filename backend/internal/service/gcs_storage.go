@@ -6,14 +6,16 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"mime"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
 	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -29,6 +31,9 @@ func NewGCStorageService(cfg config.GCSStorageConfig, logger *slog.Logger) (File
 	if cfg.BucketName == "" {
 		return nil, fmt.Errorf("GCS bucket name is required")
 	}
+	if cfg.SignedURLExpiry <= 0 {
+		return nil, fmt.Errorf("GCS signed URL expiry must be positive")
+	}
 
 	opts := []option.ClientOption{}
 	// Prefer environment variable GOOGLE_APPLICATION_CREDENTIALS
@@ -55,14 +60,14 @@ func NewGCStorageService(cfg config.GCSStorageConfig, logger *slog.Logger) (File
 		return nil, fmt.Errorf("failed to access GCS bucket '%s': %w", cfg.BucketName, err)
 	}
 
-	logger.Info("GCS storage service initialized", "bucket", cfg.BucketName, "baseDir", cfg.BaseDir)
+	logger.Info("GCS storage service initialized", "bucket", cfg.BucketName, "baseDir", cfg.BaseDir, "signedUrlExpiry", cfg.SignedURLExpiry)
 
 	return &gcsStorageService{
 		bucket:          cfg.BucketName,
 		client:          client,
 		logger:          logger.With("service", "gcsstorage"),
 		baseDir:         strings.Trim(cfg.BaseDir, "/"), // Ensure no leading/trailing slashes
-		signedURLExpiry: 168 * time.Hour,                // Default signed URL validity
+		signedURLExpiry: cfg.SignedURLExpiry,            // Short-lived, a fresh URL is minted on every read
 	}, nil
 }
 
@@ -71,24 +76,41 @@ func NewGCStorageService(cfg config.GCSStorageConfig, logger *slog.Logger) (File
 func (s *gcsStorageService) GenerateUniqueObjectName(userID, todoID uuid.UUID, originalFilename string) string {
 	ext := filepath.Ext(originalFilename)
 	fileName := uuid.NewString() + ext
-	objectPath := filepath.Join(s.baseDir, userID.String(), todoID.String(), fileName)
-	return filepath.ToSlash(objectPath)
+	return s.ObjectName(path.Join(userID.String(), todoID.String(), fileName))
 }
-func (s *gcsStorageService) Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename string, reader io.Reader, size int64) (string, string, error) {
-	objectName := s.GenerateUniqueObjectName(userID, todoID, originalFilename)
 
-	ctxUpload, cancel := context.WithTimeout(ctx, 5*time.Minute) // Timeout for upload
-	defer cancel()
+// ObjectName places the key inside the bucket's base directory.
+func (s *gcsStorageService) ObjectName(key string) string {
+	return path.Join(s.baseDir, key)
+}
 
-	wc := s.client.Bucket(s.bucket).Object(objectName).NewWriter(ctxUpload)
+// validObjectName reports whether the storage ID points inside the base directory.
+func (s *gcsStorageService) validObjectName(objectName string) bool {
+	if objectName == "" || strings.Contains(objectName, "..") {
+		return false
+	}
+	return s.baseDir == "" || strings.HasPrefix(objectName, s.baseDir+"/")
+}
+
+func (s *gcsStorageService) Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename, contentType string, reader io.Reader, size int64) (string, error) {
+	objectName := s.GenerateUniqueObjectName(userID, todoID, originalFilename)
+	if err := s.Put(ctx, objectName, originalFilename, contentType, reader, size); err != nil {
+		return "", err
+	}
+	// Return the object name (path) as the storage ID
+	return objectName, nil
+}
 
-	// Attempt to determine Content-Type
-	contentType := mime.TypeByExtension(filepath.Ext(originalFilename))
-	if contentType == "" {
-		contentType = "application/octet-stream" // Default fallback
-		// Could potentially read first 512 bytes from reader here if it's TeeReader, but might be complex
+func (s *gcsStorageService) Put(ctx context.Context, objectName, originalFilename, contentType string, reader io.Reader, size int64) error {
+	if !s.validObjectName(objectName) {
+		s.logger.WarnContext(ctx, "Attempted invalid put operation", "storageId", objectName, "baseDir", s.baseDir)
+		return fmt.Errorf("invalid storage ID for upload")
 	}
+
+	wc := s.client.Bucket(s.bucket).Object(objectName).NewWriter(ctx)
+
 	wc.ContentType = contentType
+	wc.ContentDisposition = ContentDisposition(contentType, originalFilename)
 	wc.ChunkSize = 0 // Recommended for better performance unless files are huge
 
 	s.logger.DebugContext(ctx, "Uploading file to GCS", "bucket", s.bucket, "object", objectName, "contentType", contentType, "size", size)
@@ -98,25 +120,24 @@ func (s *gcsStorageService) Upload(ctx context.Context, userID, todoID uuid.UUID
 		// Close writer explicitly on error to clean up potential partial uploads
 		_ = wc.CloseWithError(fmt.Errorf("copy failed: %w", err))
 		s.logger.ErrorContext(ctx, "Failed to copy data to GCS", "error", err, "object", objectName)
-		return "", "", fmt.Errorf("failed to upload to GCS: %w", err)
+		return fmt.Errorf("failed to upload to GCS: %w", err)
 	}
 
 	// Close the writer to finalize the upload
 	if err := wc.Close(); err != nil {
 		s.logger.ErrorContext(ctx, "Failed to finalize GCS upload", "error", err, "object", objectName)
-		return "", "", fmt.Errorf("failed to finalize upload: %w", err)
+		return fmt.Errorf("failed to finalize upload: %w", err)
 	}
 
-	if written != size {
+	if size >= 0 && written != size {
 		s.logger.WarnContext(ctx, "File size mismatch during GCS upload", "expected", size, "written", written, "object", objectName)
 		// Optionally delete the potentially corrupted file
 		_ = s.Delete(context.Background(), objectName) // Use background context for cleanup
-		return "", "", fmt.Errorf("file size mismatch during upload")
+		return fmt.Errorf("file size mismatch during upload")
 	}
 
 	s.logger.InfoContext(ctx, "File uploaded successfully to GCS", "object", objectName, "size", written, "contentType", contentType)
-	// Return the object name (path) as the storage ID
-	return objectName, contentType, nil
+	return nil
 }
 
 func (s *gcsStorageService) Delete(ctx context.Context, storageID string) error {
@@ -145,6 +166,54 @@ func (s *gcsStorageService) Delete(ctx context.Context, storageID string) error
 	return nil
 }
 
+func (s *gcsStorageService) List(ctx context.Context, fn func(StoredObject) error) error {
+	prefix := ""
+	if s.baseDir != "" {
+		prefix = s.baseDir + "/"
+	}
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list GCS objects: %w", err)
+		}
+		if err := fn(StoredObject{StorageID: attrs.Name, Size: attrs.Size, LastModified: attrs.Updated}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *gcsStorageService) Stat(ctx context.Context, storageID string) (*StoredObject, error) {
+	if !s.validObjectName(storageID) {
+		return nil, fmt.Errorf("invalid storage ID: %w", domain.ErrBadRequest)
+	}
+	attrs, err := s.client.Bucket(s.bucket).Object(storageID).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("could not stat GCS object: %w", err)
+	}
+	return &StoredObject{StorageID: storageID, Size: attrs.Size, LastModified: attrs.Updated}, nil
+}
+
+func (s *gcsStorageService) Download(ctx context.Context, storageID string) (io.ReadCloser, error) {
+	if !s.validObjectName(storageID) {
+		return nil, fmt.Errorf("invalid storage ID: %w", domain.ErrBadRequest)
+	}
+	reader, err := s.client.Bucket(s.bucket).Object(storageID).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("could not read GCS object: %w", err)
+	}
+	return reader, nil
+}
+
 // GetURL generates a signed URL for accessing the private GCS object.
 func (s *gcsStorageService) GetURL(ctx context.Context, storageID string) (string, error) {
 	objectName := storageID
@@ -5,9 +5,9 @@ import (
 	"io"
 	"time"
 
+	"github.com/Sosokker/todolist-backend/internal/auth"
 	"github.com/Sosokker/todolist-backend/internal/domain"
 	"github.com/google/uuid"
-	"golang.org/x/oauth2"
 )
 
 // --- Auth Service ---
@@ -20,15 +20,208 @@ type SignupCredentials struct {
 type LoginCredentials struct {
 	Email    string
 	Password string
+	ClientIP string // Failed logins are also counted per address; empty skips that
+}
+
+// AuthTokens is what a login or a refresh hands back: a short-lived access JWT and
+// the opaque refresh token that can be exchanged once for the next pair
+type AuthTokens struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// MFAChallenge is handed out instead of tokens when the password was right but a second factor is needed
+type MFAChallenge struct {
+	Token     string // Exchanged at VerifyMFA along with a code
+	ExpiresAt time.Time
+}
+
+// OAuthProviderInfo is an external login provider the frontend can offer
+type OAuthProviderInfo struct {
+	ID   string // Used in /auth/{provider}/login
+	Name string
+}
+
+// CreateAPITokenInput describes a personal access token to issue
+type CreateAPITokenInput struct {
+	Name      string
+	Scopes    []string   // From domain.APIScopes
+	ExpiresAt *time.Time // Nil never expires
+}
+
+// OAuthLinkPending is an external account waiting for the user to confirm linking it
+type OAuthLinkPending struct {
+	Token    string // Goes to ConfirmOAuthLink
+	Provider string
+	Email    string // As the provider reported it, may be empty
+}
+
+// WebAuthnCreationOptions are what navigator.credentials.create() needs to make a passkey
+type WebAuthnCreationOptions struct {
+	Challenge          []byte
+	RPID               string
+	RPName             string
+	UserHandle         []byte // The user's ID; the authenticator hands it back at every login
+	UserName           string
+	UserDisplayName    string
+	Algorithms         []int64  // COSE algorithm identifiers, most preferred first
+	ExcludeCredentials [][]byte // The user's existing passkeys, so an authenticator isn't registered twice
+	UserVerification   string
+	Timeout            time.Duration
+}
+
+// WebAuthnRequestOptions are what navigator.credentials.get() needs to log in with a passkey.
+// No credentials are listed: the authenticator offers whichever passkeys it has for the site.
+type WebAuthnRequestOptions struct {
+	Challenge        []byte
+	RPID             string
+	UserVerification string
+	Timeout          time.Duration
+}
+
+// WebAuthnAttestation is the authenticator's response to a registration
+type WebAuthnAttestation struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+	Name              string // Label for the passkey list; defaults to "Passkey"
+}
+
+// WebAuthnAssertion is the authenticator's response to a login
+type WebAuthnAssertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
 }
 
 type AuthService interface {
 	Signup(ctx context.Context, creds SignupCredentials) (*domain.User, error)
-	Login(ctx context.Context, creds LoginCredentials) (token string, user *domain.User, err error)
+	// Login checks the password. Users with two-factor authentication get a challenge instead of tokens.
+	Login(ctx context.Context, creds LoginCredentials) (tokens *AuthTokens, challenge *MFAChallenge, err error)
+	// VerifyMFA completes a login that returned a challenge. The challenge works once, and stops
+	// working after mfa.maxAttempts wrong codes.
+	VerifyMFA(ctx context.Context, challengeToken, code string) (*AuthTokens, error)
+	// BeginWebAuthnRegistration starts adding a passkey. The session token goes back to
+	// FinishWebAuthnRegistration with the authenticator's response, within webauthn.timeout.
+	BeginWebAuthnRegistration(ctx context.Context, userID uuid.UUID) (options *WebAuthnCreationOptions, sessionToken string, err error)
+	FinishWebAuthnRegistration(ctx context.Context, userID uuid.UUID, sessionToken string, attestation WebAuthnAttestation) (*domain.WebAuthnCredential, error)
+	// BeginWebAuthnLogin starts a passwordless login. Like BeginWebAuthnRegistration, the session
+	// token goes back to FinishWebAuthnLogin, and works once.
+	BeginWebAuthnLogin(ctx context.Context) (options *WebAuthnRequestOptions, sessionToken string, err error)
+	// FinishWebAuthnLogin logs in with a passkey. Users with two-factor authentication get a challenge
+	// instead of tokens when the authenticator didn't verify them with a PIN or biometric.
+	FinishWebAuthnLogin(ctx context.Context, sessionToken string, assertion WebAuthnAssertion) (tokens *AuthTokens, challenge *MFAChallenge, err error)
+	ListWebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error)
+	DeleteWebAuthnCredential(ctx context.Context, userID, id uuid.UUID) error
+	// CreateAPIToken issues a personal access token. The token is only returned here; just its hash is stored.
+	CreateAPIToken(ctx context.Context, userID uuid.UUID, input CreateAPITokenInput) (token string, info *domain.APIToken, err error)
+	ListAPITokens(ctx context.Context, userID uuid.UUID) ([]domain.APIToken, error)
+	DeleteAPIToken(ctx context.Context, userID, id uuid.UUID) error
+	// ValidateAPIToken returns the owner of an unexpired personal access token, and records the use.
+	// Scope checks are up to the caller.
+	ValidateAPIToken(ctx context.Context, token string) (*domain.User, *domain.APIToken, error)
 	GenerateJWT(user *domain.User) (string, error)
-	ValidateJWT(tokenString string) (*domain.User, error)
-	GetGoogleAuthConfig() *oauth2.Config
-	HandleGoogleCallback(ctx context.Context, code string) (token string, user *domain.User, err error)
+	// ValidateJWT checks the signature and expiry, then that the token wasn't revoked on its own
+	// or by a LogoutEverywhere since it was issued
+	ValidateJWT(ctx context.Context, tokenString string) (*domain.User, error)
+	JWKS() auth.JSONWebKeySet                                        // Public keys of jwt.keys, for services verifying access tokens without the secret
+	RevokeAccessToken(ctx context.Context, tokenString string) error // Rejects the token from now on, for logout
+	LogoutEverywhere(ctx context.Context, userID uuid.UUID) error    // Invalidates every access and refresh token of the user
+	OAuthProviders() []OAuthProviderInfo                             // The configured external login providers, sorted by ID
+	// OAuthLoginURL is where to send the browser to log in with provider. state must be
+	// passed to HandleOAuthCallback again; unknown providers fail with domain.ErrNotFound.
+	OAuthLoginURL(ctx context.Context, provider, state string) (string, error)
+	// HandleOAuthCallback finishes an external login with the code from the provider's redirect.
+	// The account logs in as the user it's linked to, else signs up a new user. It fails with
+	// domain.ErrConflict if its email belongs to an existing user, who has to link it explicitly.
+	HandleOAuthCallback(ctx context.Context, provider, code, state string) (tokens *AuthTokens, user *domain.User, err error)
+	// BeginOAuthLink starts linking an external account to the user. Like OAuthLoginURL it returns where
+	// to send the browser; the intent must come back to HandleOAuthLinkCallback from the same flow.
+	BeginOAuthLink(ctx context.Context, userID uuid.UUID, provider, state string) (authURL, intent string, err error)
+	// HandleOAuthLinkCallback checks the account at the provider but doesn't link it yet. The user
+	// confirms the pending link with ConfirmOAuthLink.
+	HandleOAuthLinkCallback(ctx context.Context, provider, code, state, intent string) (*OAuthLinkPending, error)
+	// ConfirmOAuthLink links the pending account. The token works once, for the user who started the link.
+	ConfirmOAuthLink(ctx context.Context, userID uuid.UUID, pendingToken string) (*domain.UserIdentity, error)
+	ListIdentities(ctx context.Context, userID uuid.UUID) ([]domain.UserIdentity, error)
+	// UnlinkIdentity fails with domain.ErrConflict if the user would be left without a way to log in
+	UnlinkIdentity(ctx context.Context, userID, id uuid.UUID) error
+	// Refresh rotates refreshToken into a new pair. Presenting a token that was already
+	// rotated revokes every token of its login and fails with domain.ErrUnauthorized.
+	Refresh(ctx context.Context, refreshToken string) (*AuthTokens, error)
+	RevokeRefreshToken(ctx context.Context, refreshToken string) error // Revokes the token's whole family, for logout
+	Run(ctx context.Context)                                           // Purges expired refresh tokens periodically until ctx is cancelled
+}
+
+// --- Email Verification Service ---
+
+// EmailVerificationService proves users control their email address with signed, expiring links
+type EmailVerificationService interface {
+	// SendVerification mails the user a verification link. It fails with domain.ErrConflict if the
+	// address is already verified and with a domain.RetryAfterError within email.resendInterval of the last one.
+	SendVerification(ctx context.Context, userID uuid.UUID) error
+	VerifyEmail(ctx context.Context, token string) (*domain.User, error)
+}
+
+// --- Password Reset Service ---
+
+// PasswordResetService lets users who forgot their password set a new one through a single-use emailed link
+type PasswordResetService interface {
+	// RequestReset mails a reset link if an account has the address. It returns nil either way,
+	// and sends nothing within email.resendInterval of the user's last reset email.
+	RequestReset(ctx context.Context, email string) error
+	// ResetPassword redeems the token, sets the new password and logs the user out everywhere
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	Run(ctx context.Context) // Purges expired reset tokens periodically until ctx is cancelled
+}
+
+// --- MFA Service ---
+
+// MFAStatus is what second factors a user has set up
+type MFAStatus struct {
+	TOTPEnabled       bool
+	RecoveryCodesLeft int
+}
+
+// TOTPEnrollment is what an authenticator app needs to start generating codes
+type TOTPEnrollment struct {
+	Secret string // Base32, for typing in by hand
+	URI    string // otpauth:// provisioning URI, usually shown as a QR code
+}
+
+// MFAService manages second login factors: a TOTP authenticator app and single-use recovery codes
+type MFAService interface {
+	Status(ctx context.Context, userID uuid.UUID) (*MFAStatus, error)
+	Enabled(ctx context.Context, userID uuid.UUID) (bool, error) // Whether logins need a second factor
+	// EnrollTOTP starts over any unconfirmed enrollment with a new secret. It fails with
+	// domain.ErrConflict while an authenticator is enabled.
+	EnrollTOTP(ctx context.Context, userID uuid.UUID) (*TOTPEnrollment, error)
+	// ConfirmTOTP enables the authenticator once it produces a valid code, and returns the recovery codes
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) (recoveryCodes []string, err error)
+	DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error // code is a TOTP or recovery code
+	// RegenerateRecoveryCodes replaces every recovery code. code is a TOTP or recovery code.
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	// VerifyCode accepts a TOTP code, once, or an unused recovery code, which is then used up. Wrong codes
+	// fail with domain.ErrUnauthorized, and with ErrMFAAttemptsExhausted after mfa.maxAttempts in a row,
+	// which locks the factor: until the lockout ends every code fails with a domain.RetryAfterError.
+	VerifyCode(ctx context.Context, userID uuid.UUID, code string) error
+}
+
+// --- Mailer ---
+
+// MailMessage is a plain-text email
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email; email.mailer selects the implementation
+type Mailer interface {
+	Send(ctx context.Context, msg *MailMessage) error
 }
 
 // --- User Service ---
@@ -92,7 +285,7 @@ type ListTodosInput struct {
 
 type TodoService interface {
 	CreateTodo(ctx context.Context, userID uuid.UUID, input CreateTodoInput) (*domain.Todo, error)
-	GetTodoByID(ctx context.Context, todoID, userID uuid.UUID) (*domain.Todo, error) // Fetches attachment URL
+	GetTodoByID(ctx context.Context, todoID, userID uuid.UUID) (*domain.Todo, error) // Fetches attachment URLs
 	ListUserTodos(ctx context.Context, userID uuid.UUID, input ListTodosInput) ([]domain.Todo, error)
 	UpdateTodo(ctx context.Context, todoID, userID uuid.UUID, input UpdateTodoInput) (*domain.Todo, error)
 	DeleteTodo(ctx context.Context, todoID, userID uuid.UUID) error
@@ -102,9 +295,31 @@ type TodoService interface {
 	UpdateSubtask(ctx context.Context, todoID, subtaskID, userID uuid.UUID, input UpdateSubtaskInput) (*domain.Subtask, error)
 	DeleteSubtask(ctx context.Context, todoID, subtaskID, userID uuid.UUID) error
 	// Attachment methods
-	AddAttachment(ctx context.Context, todoID, userID uuid.UUID, fileName string, fileSize int64, fileContent io.Reader) (*domain.Todo, error)
-	// Uploads, gets URL, updates Todo, returns updated Todo
-	DeleteAttachment(ctx context.Context, todoID, userID uuid.UUID) error // Deletes from storage and clears Todo URL
+	ListAttachments(ctx context.Context, todoID, userID uuid.UUID) ([]domain.AttachmentInfo, error)
+	GetAttachmentByStorageID(ctx context.Context, userID uuid.UUID, storageID string, attachmentID *uuid.UUID) (*domain.Attachment, error) // attachmentID may be nil
+	GetAttachmentDownloadURL(ctx context.Context, attachmentID, userID uuid.UUID) (string, error)                                          // Mints a fresh short-lived URL
+	StorageUsage(ctx context.Context, userID uuid.UUID) (*domain.StorageUsage, error)
+	UploadLimit(ctx context.Context, userID uuid.UUID) (int64, error) // Max bytes the next attachment may be; the quota is checked once its content is known
+	// AddAttachment streams fileContent into storage, failing with domain.ErrTooLarge past UploadLimit or the quota.
+	// Content the user already stores is free; anything else is charged against the quota once.
+	AddAttachment(ctx context.Context, todoID, userID uuid.UUID, fileName string, fileContent io.Reader) (*domain.AttachmentInfo, error)
+	DeleteAttachment(ctx context.Context, todoID, attachmentID, userID uuid.UUID) error // Deletes the row, then the stored file
+}
+
+// --- Resumable Upload Service ---
+
+// ResumableUploadService implements the tus 1.0 upload model for todo attachments.
+// Chunks are staged on local disk and the finished file is committed through TodoService.AddAttachment.
+type ResumableUploadService interface {
+	// Create charges length against the quota until the upload finishes. It fails with domain.ErrTooManyRequests
+	// once the user has storage.resumable.maxPending unfinished uploads.
+	Create(ctx context.Context, todoID, userID uuid.UUID, fileName string, length int64) (*domain.AttachmentUpload, error)
+	Get(ctx context.Context, todoID, uploadID, userID uuid.UUID) (*domain.AttachmentUpload, error)
+	// WriteChunk appends chunk at offset, which must equal the upload's current offset (domain.ErrConflict otherwise).
+	// The returned upload reflects any bytes kept even when err is set. The attachment is non-nil once the last byte is committed.
+	WriteChunk(ctx context.Context, todoID, uploadID, userID uuid.UUID, offset int64, chunk io.Reader) (*domain.AttachmentUpload, *domain.AttachmentInfo, error)
+	Terminate(ctx context.Context, todoID, uploadID, userID uuid.UUID) error
+	Run(ctx context.Context) // Purges expired uploads periodically until ctx is cancelled
 }
 
 // --- Subtask Service ---
@@ -128,22 +343,106 @@ type SubtaskService interface {
 
 // FileStorageService defines the interface for handling file uploads and deletions.
 type FileStorageService interface {
-	// Upload saves the content from the reader and returns a unique storage identifier (e.g., path/key) and the content type.
-	Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename string, reader io.Reader, size int64) (storageID string, contentType string, err error)
+	// Upload saves the content from the reader and returns a unique storage identifier (e.g., path/key).
+	// contentType is the sniffed media type; backends that keep object metadata store it along with
+	// a Content-Disposition so the file is served safely.
+	// size may be -1 when the length isn't known up front, e.g. for a streamed multipart upload.
+	// The upload is bounded by ctx, so callers decide how long it may take.
+	Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename, contentType string, reader io.Reader, size int64) (storageID string, err error)
 	// Delete removes the file associated with the given storage identifier.
 	Delete(ctx context.Context, storageID string) error
 	// GetURL retrieves a publicly accessible URL for the storage ID (e.g., signed URL for GCS).
 	GetURL(ctx context.Context, storageID string) (string, error)
 	// GenerateUniqueObjectName creates a unique storage path/name for a file.
 	GenerateUniqueObjectName(userID, todoID uuid.UUID, originalFilename string) string
+	// ObjectName maps a <user_uuid>/<todo_uuid>/<file_uuid>.<ext> key onto this backend's storage ID.
+	ObjectName(key string) string
+	// Put is Upload to a storage ID chosen by the caller, replacing any object already there.
+	Put(ctx context.Context, storageID, originalFilename, contentType string, reader io.Reader, size int64) error
+	// Stat describes a stored object, failing with domain.ErrNotFound if it doesn't exist.
+	Stat(ctx context.Context, storageID string) (*StoredObject, error)
+	// Download opens a stored object for reading, failing with domain.ErrNotFound if it doesn't exist. The caller must close it.
+	Download(ctx context.Context, storageID string) (io.ReadCloser, error)
+	// List walks every object below the prefix GenerateUniqueObjectName writes to, calling fn for each.
+	// Returning an error from fn stops the walk and is returned from List.
+	List(ctx context.Context, fn func(StoredObject) error) error
+}
+
+// --- Attachment Reconciler ---
+type ReconcileOptions struct {
+	DryRun      bool          // Report orphans without deleting them
+	GracePeriod time.Duration // Objects modified more recently than this are left alone
+}
+
+type ReconcileReport struct {
+	DryRun        bool
+	ReleasedBlobs int   // Deduplicated blobs no attachment referenced any more
+	Scanned       int   // Objects listed under the storage prefix
+	Ignored       int   // Objects not laid out like attachments or upload temp files, e.g. other data sharing the bucket
+	Skipped       int   // Objects still inside the grace period
+	Orphans       int   // Objects no attachment references
+	OrphanBytes   int64 // Total size of the orphans
+	Deleted       int
+	Failed        int
+}
+
+// AttachmentReconciler finds stored objects that no attachment row references
+type AttachmentReconciler interface {
+	Reconcile(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error)
+	Run(ctx context.Context) // Reconciles periodically until ctx is cancelled
+}
+
+// --- Storage Migrator ---
+type StorageMigrationOptions struct {
+	DryRun  bool // Report what would be copied; nothing is written and no references change
+	Verify  bool // Read every destination object back and compare its SHA-256 with the source
+	Workers int  // Files copied in parallel
+}
+
+type StorageMigrationReport struct {
+	DryRun      bool
+	Files       int   // Distinct storage IDs the database references
+	Copied      int   // Written to the destination, or that would be on a dry run
+	CopiedBytes int64 // Total size of the copied files
+	Present     int   // Already at the destination, e.g. copied by an interrupted run
+	Verified    int   // Read back from the destination with the expected SHA-256
+	Missing     int   // In neither backend; their references are left as they are
+	Mismatched  int   // Destination content differed from the source; the copy is removed so the next run retries it
+	Failed      int
+	Rewritten   int64 // Database rows repointed at the destination
+}
+
+// StorageMigrator moves every attachment file from one storage backend to another
+type StorageMigrator interface {
+	// Migrate copies each file the database references to the destination, then repoints the
+	// references in one transaction once every copy succeeded. Files already at the destination
+	// are skipped, so an interrupted or failed run is resumed by running it again.
+	Migrate(ctx context.Context, opts StorageMigrationOptions) (*StorageMigrationReport, error)
+}
+
+// AttachmentScanner checks uploaded content for malware before it is saved
+type AttachmentScanner interface {
+	// Scan reads content to EOF and returns the verdict. An error means no verdict was reached.
+	Scan(ctx context.Context, content io.Reader) (*domain.ScanResult, error)
+}
+
+// StoredObject describes an object found by FileStorageService.List
+type StoredObject struct {
+	StorageID    string
+	Size         int64
+	LastModified time.Time
 }
 
 // ServiceRegistry bundles services
 type ServiceRegistry struct {
-	Auth    AuthService
-	User    UserService
-	Tag     TagService
-	Todo    TodoService
-	Subtask SubtaskService
-	Storage FileStorageService
+	Auth          AuthService
+	Email         EmailVerificationService
+	PasswordReset PasswordResetService
+	MFA           MFAService
+	User          UserService
+	Tag           TagService
+	Todo          TodoService
+	Subtask       SubtaskService
+	Storage       FileStorageService
+	Upload        ResumableUploadService
 }
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+// LocalFileServer is implemented by storage backends that keep files on the
+// server itself. The API layer uses it to stream files through an
+// authenticated download route instead of redirecting to an external URL.
+type LocalFileServer interface {
+	Open(ctx context.Context, storageID string) (*os.File, fs.FileInfo, error)
+}
+
+type localStorageService struct {
+	rootDir string
+	baseURL string
+	logger  *slog.Logger
+}
+
+func NewLocalStorageService(cfg config.LocalStorageConfig, logger *slog.Logger) (FileStorageService, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("local storage path is required")
+	}
+
+	rootDir, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local storage path '%s': %w", cfg.Path, err)
+	}
+	if err := os.MkdirAll(rootDir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory '%s': %w", rootDir, err)
+	}
+
+	logger.Info("Local storage service initialized", "path", rootDir, "baseUrl", cfg.BaseURL)
+
+	return &localStorageService{
+		rootDir: rootDir,
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		logger:  logger.With("service", "localstorage"),
+	}, nil
+}
+
+// GenerateUniqueObjectName creates a unique relative path below the storage root.
+// Example: <user_uuid>/<todo_uuid>/<file_uuid>.<ext>
+func (s *localStorageService) GenerateUniqueObjectName(userID, todoID uuid.UUID, originalFilename string) string {
+	ext := filepath.Ext(originalFilename)
+	fileName := uuid.NewString() + ext
+	return s.ObjectName(path.Join(userID.String(), todoID.String(), fileName))
+}
+
+// ObjectName returns the key unchanged, storage IDs are relative to the storage root.
+func (s *localStorageService) ObjectName(key string) string {
+	return key
+}
+
+// resolvePath maps a storage ID onto a file path inside the storage root,
+// rejecting anything that would escape it.
+func (s *localStorageService) resolvePath(storageID string) (string, error) {
+	cleaned := path.Clean("/" + storageID)[1:]
+	if cleaned == "" || cleaned != storageID || strings.Contains(storageID, "..") {
+		return "", fmt.Errorf("invalid storage ID: %w", domain.ErrBadRequest)
+	}
+	return filepath.Join(s.rootDir, filepath.FromSlash(cleaned)), nil
+}
+
+// Upload writes the file below the storage root. The content type isn't persisted here;
+// the download route takes it from the attachment row.
+func (s *localStorageService) Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename, contentType string, reader io.Reader, size int64) (string, error) {
+	objectName := s.GenerateUniqueObjectName(userID, todoID, originalFilename)
+	if err := s.Put(ctx, objectName, originalFilename, contentType, reader, size); err != nil {
+		return "", err
+	}
+	return objectName, nil
+}
+
+func (s *localStorageService) Put(ctx context.Context, objectName, originalFilename, contentType string, reader io.Reader, size int64) error {
+	filePath, err := s.resolvePath(objectName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o750); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to create attachment directory", "error", err, "object", objectName)
+		return fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+
+	s.logger.DebugContext(ctx, "Writing file to local storage", "object", objectName, "contentType", contentType, "size", size)
+
+	// Write to a temporary file first so a failed upload never leaves a partial file under the final name
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to create temporary file", "error", err, "object", objectName)
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath) // No-op once renamed
+
+	written, err := io.Copy(tmpFile, reader)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to write file to local storage", "error", err, "object", objectName)
+		return fmt.Errorf("failed to write file to local storage: %w", err)
+	}
+
+	if size >= 0 && written != size {
+		s.logger.WarnContext(ctx, "File size mismatch during local upload", "expected", size, "written", written, "object", objectName)
+		return fmt.Errorf("file size mismatch during upload")
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to finalize local upload", "error", err, "object", objectName)
+		return fmt.Errorf("failed to finalize upload: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "File uploaded successfully to local storage", "object", objectName, "size", written, "contentType", contentType)
+	return nil
+}
+
+func (s *localStorageService) Delete(ctx context.Context, storageID string) error {
+	filePath, err := s.resolvePath(storageID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Attempted invalid delete operation", "storageId", storageID)
+		return fmt.Errorf("invalid storage ID for deletion")
+	}
+
+	if err := os.Remove(filePath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			s.logger.WarnContext(ctx, "Attempted to delete non-existent local file", "storageId", storageID)
+			return nil // Treat as success if already deleted
+		}
+		s.logger.ErrorContext(ctx, "Failed to delete local file", "error", err, "storageId", storageID)
+		return fmt.Errorf("could not delete local file: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Local file deleted successfully", "storageId", storageID)
+	return nil
+}
+
+// GetURL returns the URL of the authenticated download route serving the file.
+func (s *localStorageService) GetURL(ctx context.Context, storageID string) (string, error) {
+	if _, err := s.resolvePath(storageID); err != nil {
+		s.logger.WarnContext(ctx, "Attempted invalid GetURL operation", "storageId", storageID)
+		return "", fmt.Errorf("invalid storage ID for URL generation")
+	}
+	return s.baseURL + "/" + storageID, nil
+}
+
+func (s *localStorageService) List(ctx context.Context, fn func(StoredObject) error) error {
+	return filepath.WalkDir(s.rootDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // Removed while walking
+			}
+			return err
+		}
+		rel, err := filepath.Rel(s.rootDir, filePath)
+		if err != nil {
+			return err
+		}
+		// Abandoned .upload-* temp files are listed too; the reconciler ages them out like any orphan
+		return fn(StoredObject{StorageID: filepath.ToSlash(rel), Size: info.Size(), LastModified: info.ModTime()})
+	})
+}
+
+func (s *localStorageService) Stat(ctx context.Context, storageID string) (*StoredObject, error) {
+	filePath, err := s.resolvePath(storageID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("could not stat local file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, domain.ErrNotFound
+	}
+	return &StoredObject{StorageID: storageID, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+func (s *localStorageService) Download(ctx context.Context, storageID string) (io.ReadCloser, error) {
+	f, _, err := s.Open(ctx, storageID)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Open returns the file for the given storage ID. The caller must close it.
+func (s *localStorageService) Open(ctx context.Context, storageID string) (*os.File, fs.FileInfo, error) {
+	filePath, err := s.resolvePath(storageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, domain.ErrNotFound
+		}
+		s.logger.ErrorContext(ctx, "Failed to open local file", "error", err, "storageId", storageID)
+		return nil, nil, fmt.Errorf("could not open local file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("could not stat local file: %w", err)
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, domain.ErrNotFound
+	}
+	return f, info, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+)
+
+// loginThrottle enforces loginThrottle config on password logins. A store outage
+// doesn't block logins; it's logged and the attempt goes through unthrottled.
+type loginThrottle struct {
+	repo   repository.LoginAttemptRepository
+	cfg    config.LoginThrottleConfig
+	logger *slog.Logger
+}
+
+// loginThrottleKey is one counter an attempt is charged to
+type loginThrottleKey struct {
+	scope     string // account or ip
+	key       string
+	threshold int
+	backoff   bool // Whether failures below the threshold already delay the next attempt
+}
+
+func (t *loginThrottle) keys(email, clientIP string) []loginThrottleKey {
+	var keys []loginThrottleKey
+	if t.cfg.AccountThreshold > 0 {
+		keys = append(keys, loginThrottleKey{
+			scope:     "account",
+			key:       "account:" + strings.ToLower(strings.TrimSpace(email)),
+			threshold: t.cfg.AccountThreshold,
+			backoff:   true,
+		})
+	}
+	// A shared address (an office, a carrier NAT) makes many honest failures, so it only
+	// gets a lockout for the volume of an attack, not a delay per typo
+	if t.cfg.IPThreshold > 0 && clientIP != "" {
+		keys = append(keys, loginThrottleKey{
+			scope:     "ip",
+			key:       "ip:" + clientIP,
+			threshold: t.cfg.IPThreshold,
+		})
+	}
+	return keys
+}
+
+// delay is how long after the last of failures the next attempt has to wait
+func (t *loginThrottle) delay(k loginThrottleKey, failures int) time.Duration {
+	if failures >= k.threshold {
+		return doubled(t.cfg.LockoutDuration, failures-k.threshold, t.cfg.MaxLockout)
+	}
+	if !k.backoff || failures == 0 {
+		return 0
+	}
+	return doubled(t.cfg.BaseDelay, failures-1, t.cfg.LockoutDuration)
+}
+
+// doubled returns d doubled n times, but no more than limit
+func doubled(d time.Duration, n int, limit time.Duration) time.Duration {
+	for ; n > 0 && d < limit; n-- {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+// loginAttempt is a password login already charged as a failure to every key, before the
+// password is checked, so concurrent guesses can't all get past the same count.
+type loginAttempt struct {
+	t        *loginThrottle
+	email    string
+	clientIP string
+	charged  []chargedLoginKey
+	failed   bool
+}
+
+type chargedLoginKey struct {
+	loginThrottleKey
+	failures int // The count RecordFailure returned
+}
+
+// begin charges an attempt to the account and the client address. It fails with a
+// domain.RetryAfterError, giving the charge back, while either of them has to wait.
+func (t *loginThrottle) begin(ctx context.Context, email, clientIP string) (*loginAttempt, error) {
+	a := &loginAttempt{t: t, email: email, clientIP: clientIP}
+	if !t.cfg.Enabled {
+		return a, nil
+	}
+	var wait time.Duration
+	for _, k := range t.keys(email, clientIP) {
+		attempts, err := t.repo.RecordFailure(ctx, k.key, t.cfg.ResetAfter)
+		if err != nil {
+			t.logger.ErrorContext(ctx, "Failed to record login attempt", "error", err, "scope", k.scope)
+			continue
+		}
+		a.charged = append(a.charged, chargedLoginKey{loginThrottleKey: k, failures: attempts.Failures})
+		if attempts.PreviousFailedAt == nil {
+			continue
+		}
+		// Compared with the time this attempt was charged, so both come from the store's clock
+		until := attempts.PreviousFailedAt.Add(t.delay(k, attempts.Failures-1))
+		if until.After(attempts.LastFailedAt) {
+			wait = max(wait, until.Sub(attempts.LastFailedAt))
+		}
+	}
+	if wait > 0 {
+		a.release(ctx)
+		return nil, &domain.RetryAfterError{Message: "too many failed login attempts, try again later", RetryAfter: wait}
+	}
+	return a, nil
+}
+
+// fail keeps the charge for a wrong password and logs a security event for each lockout
+// it starts. userID is empty when no account has the email.
+func (a *loginAttempt) fail(ctx context.Context, userID string) {
+	a.failed = true
+	for _, k := range a.charged {
+		// Attempts are refused while locked out, so every failure from the threshold on starts a new lockout
+		if k.failures >= k.threshold {
+			a.t.logger.WarnContext(ctx, "Login locked out after repeated failures",
+				"event", "login_lockout",
+				"scope", k.scope,
+				"failures", k.failures,
+				"lockout", a.t.delay(k.loginThrottleKey, k.failures),
+				"email", a.email,
+				"userId", userID,
+				"clientIp", a.clientIP)
+		}
+	}
+}
+
+// release gives the charge back, unless fail was called. Login defers it, so an attempt
+// that ends any other way, the right password included, doesn't count.
+func (a *loginAttempt) release(ctx context.Context) {
+	if a.failed {
+		return
+	}
+	ctx = context.WithoutCancel(ctx) // A client hanging up mid-login still gets it back
+	for _, k := range a.charged {
+		if err := a.t.repo.Release(ctx, k.key, k.failures); err != nil {
+			a.t.logger.ErrorContext(ctx, "Failed to release login attempt", "error", err, "scope", k.scope)
+		}
+	}
+	a.charged = nil
+}
+
+// recordSuccess clears the account's count. The address keeps its count, one good
+// password doesn't vouch for everything else sent from there.
+func (t *loginThrottle) recordSuccess(ctx context.Context, email string) {
+	if !t.cfg.Enabled || t.cfg.AccountThreshold <= 0 {
+		return
+	}
+	if err := t.repo.Reset(ctx, "account:"+strings.ToLower(strings.TrimSpace(email))); err != nil {
+		t.logger.ErrorContext(ctx, "Failed to reset login attempts", "error", err)
+	}
+}
+
+// purge deletes counts whose last failure is older than resetAfter
+func (t *loginThrottle) purge(ctx context.Context) {
+	if !t.cfg.Enabled {
+		return
+	}
+	if n, err := t.repo.DeleteStale(ctx, time.Now().Add(-t.cfg.ResetAfter)); err != nil {
+		t.logger.ErrorContext(ctx, "Failed to purge stale login attempts", "error", err)
+	} else if n > 0 {
+		t.logger.InfoContext(ctx, "Purged stale login attempts", "count", n)
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/google/uuid"
+)
+
+// NewMailer creates the Mailer selected by email.mailer
+func NewMailer(cfg config.EmailConfig, logger *slog.Logger) (Mailer, error) {
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("invalid email.from '%s': %w", cfg.From, err)
+	}
+	switch cfg.Mailer {
+	case "smtp":
+		return NewSMTPMailer(cfg, logger)
+	case "", "directory":
+		return NewDirectoryMailer(cfg, logger)
+	default:
+		return nil, fmt.Errorf("unsupported mailer type '%s'", cfg.Mailer)
+	}
+}
+
+// formatMessage renders msg as an RFC 5322 message with a quoted-printable UTF-8 body
+func formatMessage(from string, msg *MailMessage, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@todolist>\r\n", uuid.NewString())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
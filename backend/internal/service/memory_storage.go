@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+// memoryStorageService keeps uploaded files in a map. It's meant for tests, where
+// it stands in for GCS or S3 without any external service.
+type memoryStorageService struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	logger  *slog.Logger
+}
+
+type memoryObject struct {
+	data         []byte
+	lastModified time.Time
+}
+
+func NewMemoryStorageService(logger *slog.Logger) FileStorageService {
+	return &memoryStorageService{
+		objects: make(map[string]memoryObject),
+		logger:  logger.With("service", "memorystorage"),
+	}
+}
+
+// GenerateUniqueObjectName uses the same layout as the local backend.
+// Example: <user_uuid>/<todo_uuid>/<file_uuid>.<ext>
+func (s *memoryStorageService) GenerateUniqueObjectName(userID, todoID uuid.UUID, originalFilename string) string {
+	ext := filepath.Ext(originalFilename)
+	return s.ObjectName(path.Join(userID.String(), todoID.String(), uuid.NewString()+ext))
+}
+
+func (s *memoryStorageService) ObjectName(key string) string {
+	return key
+}
+
+func (s *memoryStorageService) Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename, contentType string, reader io.Reader, size int64) (string, error) {
+	objectName := s.GenerateUniqueObjectName(userID, todoID, originalFilename)
+	if err := s.Put(ctx, objectName, originalFilename, contentType, reader, size); err != nil {
+		return "", err
+	}
+	return objectName, nil
+}
+
+func (s *memoryStorageService) Put(ctx context.Context, objectName, originalFilename, contentType string, reader io.Reader, size int64) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("file size mismatch during upload")
+	}
+
+	s.mu.Lock()
+	s.objects[objectName] = memoryObject{data: data, lastModified: time.Now()}
+	s.mu.Unlock()
+
+	s.logger.DebugContext(ctx, "File stored in memory", "object", objectName, "size", len(data), "contentType", contentType)
+	return nil
+}
+
+func (s *memoryStorageService) Stat(ctx context.Context, storageID string) (*StoredObject, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[storageID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &StoredObject{StorageID: storageID, Size: int64(len(obj.data)), LastModified: obj.lastModified}, nil
+}
+
+func (s *memoryStorageService) Download(ctx context.Context, storageID string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[storageID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (s *memoryStorageService) Delete(ctx context.Context, storageID string) error {
+	s.mu.Lock()
+	delete(s.objects, storageID)
+	s.mu.Unlock()
+	return nil
+}
+
+// GetURL returns a mem:// URL; it only identifies the object, nothing serves it
+func (s *memoryStorageService) GetURL(ctx context.Context, storageID string) (string, error) {
+	s.mu.RLock()
+	_, ok := s.objects[storageID]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("object %s: %w", storageID, domain.ErrNotFound)
+	}
+	return "mem://" + storageID, nil
+}
+
+func (s *memoryStorageService) List(ctx context.Context, fn func(StoredObject) error) error {
+	s.mu.RLock()
+	objects := make([]StoredObject, 0, len(s.objects))
+	for id, obj := range s.objects {
+		objects = append(objects, StoredObject{StorageID: id, Size: int64(len(obj.data)), LastModified: obj.lastModified})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].StorageID < objects[j].StorageID })
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/auth"
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	recoveryCodeCount = 10
+	recoveryCodeChars = 10 // Base32 of 6 random bytes; shown as two groups of five
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrMFAAttemptsExhausted means maxAttempts wrong codes were entered in a row. The factor is
+// locked for a while, and whatever the codes were entered with should stop working.
+var ErrMFAAttemptsExhausted = fmt.Errorf("too many wrong codes, start over: %w", domain.ErrUnauthorized)
+
+type mfaService struct {
+	userRepo repository.UserRepository
+	mfaRepo  repository.MFARepository
+	cfg      config.MFAConfig
+	logger   *slog.Logger
+}
+
+func NewMFAService(userRepo repository.UserRepository, mfaRepo repository.MFARepository, cfg config.MFAConfig) MFAService {
+	return &mfaService{
+		userRepo: userRepo,
+		mfaRepo:  mfaRepo,
+		cfg:      cfg,
+		logger:   slog.Default().With("service", "mfa"),
+	}
+}
+
+func (s *mfaService) Status(ctx context.Context, userID uuid.UUID) (*MFAStatus, error) {
+	factor, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{}
+	if factor == nil || !factor.Enabled() {
+		return status, nil
+	}
+	status.TOTPEnabled = true
+	codes, err := s.mfaRepo.ListRecoveryCodes(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list recovery codes", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	status.RecoveryCodesLeft = len(codes)
+	return status, nil
+}
+
+func (s *mfaService) Enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	factor, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return factor != nil && factor.Enabled(), nil
+}
+
+func (s *mfaService) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*TOTPEnrollment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for totp enrollment", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to generate totp secret", "error", err)
+		return nil, domain.ErrInternalServer
+	}
+	if _, err := s.mfaRepo.SetPendingTOTP(ctx, userID, secret); err != nil {
+		if errors.Is(err, domain.ErrConflict) || errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to store totp secret", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPProvisioningURI(s.cfg.Issuer, user.Email, secret),
+	}, nil
+}
+
+func (s *mfaService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	factor, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil {
+		return nil, fmt.Errorf("start enrolling an authenticator first: %w", domain.ErrBadRequest)
+	}
+	if factor.Enabled() {
+		return nil, fmt.Errorf("authenticator is already confirmed: %w", domain.ErrConflict)
+	}
+
+	step, ok := auth.ValidateTOTP(factor.Secret, normalizeMFACode(code), time.Now())
+	if !ok {
+		return nil, fmt.Errorf("invalid code: %w", domain.ErrBadRequest)
+	}
+	codes, hashes, err := s.newRecoveryCodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.mfaRepo.ConfirmTOTP(ctx, userID, step, hashes); err != nil {
+		if errors.Is(err, domain.ErrConflict) || errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to confirm totp", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Two-factor authentication enabled", "userId", userID)
+	return codes, nil
+}
+
+func (s *mfaService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	if err := s.VerifyCode(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.mfaRepo.DeleteTOTP(ctx, userID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to delete totp", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Two-factor authentication disabled", "userId", userID)
+	return nil
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if err := s.VerifyCode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := s.newRecoveryCodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to replace recovery codes", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Recovery codes regenerated", "userId", userID)
+	return codes, nil
+}
+
+func (s *mfaService) VerifyCode(ctx context.Context, userID uuid.UUID, code string) error {
+	factor, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if factor == nil || !factor.Enabled() {
+		return fmt.Errorf("two-factor authentication is not enabled: %w", domain.ErrBadRequest)
+	}
+	// Checked before the code, so guesses during a lockout learn nothing and don't count
+	if factor.LockedUntil != nil {
+		if wait := time.Until(*factor.LockedUntil); wait > 0 {
+			return &domain.RetryAfterError{Message: "too many wrong codes, try again later", RetryAfter: wait}
+		}
+	}
+
+	code = normalizeMFACode(code)
+	var ok bool
+	if len(code) == auth.TOTPDigits {
+		ok, err = s.useTOTPCode(ctx, factor, code)
+	} else {
+		ok, err = s.useRecoveryCode(ctx, userID, code)
+	}
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	return s.recordFailure(ctx, factor)
+}
+
+func (s *mfaService) useTOTPCode(ctx context.Context, factor *domain.TOTPFactor, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(factor.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	if err := s.mfaRepo.UseTOTPStep(ctx, factor.UserID, step); err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			return false, nil // Replayed
+		}
+		s.logger.ErrorContext(ctx, "Failed to record totp step", "error", err, "userId", factor.UserID)
+		return false, domain.ErrInternalServer
+	}
+	return true, nil
+}
+
+func (s *mfaService) useRecoveryCode(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	if len(code) != recoveryCodeChars {
+		return false, nil
+	}
+	codes, err := s.mfaRepo.ListRecoveryCodes(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list recovery codes", "error", err, "userId", userID)
+		return false, domain.ErrInternalServer
+	}
+	for _, stored := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(stored.CodeHash), []byte(code)) != nil {
+			continue
+		}
+		if err := s.mfaRepo.UseRecoveryCode(ctx, stored.ID); err != nil {
+			if errors.Is(err, domain.ErrConflict) {
+				return false, nil // Used concurrently
+			}
+			s.logger.ErrorContext(ctx, "Failed to use recovery code", "error", err, "userId", userID)
+			return false, domain.ErrInternalServer
+		}
+		if err := s.mfaRepo.ResetFailures(ctx, userID); err != nil {
+			s.logger.WarnContext(ctx, "Failed to reset totp failures", "error", err, "userId", userID)
+		}
+		s.logger.InfoContext(ctx, "Recovery code used", "userId", userID, "left", len(codes)-1)
+		return true, nil
+	}
+	return false, nil
+}
+
+// recordFailure counts a wrong code and returns the error for it. Reaching maxAttempts locks
+// the factor, for twice as long as the lockout before unless a good code came in between, so
+// logging in again with the password doesn't buy more guesses.
+func (s *mfaService) recordFailure(ctx context.Context, factor *domain.TOTPFactor) error {
+	userID := factor.UserID
+	failures, err := s.mfaRepo.RecordFailure(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record totp failure", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	if failures < s.cfg.MaxAttempts {
+		return fmt.Errorf("invalid code: %w", domain.ErrUnauthorized)
+	}
+	lockout := doubled(s.cfg.LockoutDuration, int(factor.Lockouts), s.cfg.MaxLockout)
+	if err := s.mfaRepo.Lock(ctx, userID, time.Now().Add(lockout)); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to lock totp factor", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	s.logger.WarnContext(ctx, "Too many wrong two-factor codes",
+		"event", "mfa_lockout",
+		"userId", userID,
+		"attempts", failures,
+		"lockout", lockout)
+	return ErrMFAAttemptsExhausted
+}
+
+// getTOTP returns the user's factor, or nil if they never started enrolling one
+func (s *mfaService) getTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPFactor, error) {
+	factor, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil
+		}
+		s.logger.ErrorContext(ctx, "Failed to get totp factor", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	return factor, nil
+}
+
+// newRecoveryCodes returns fresh codes as shown to the user, and their hashes
+func (s *mfaService) newRecoveryCodes(ctx context.Context) ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeChars*5/8)
+		if _, err := rand.Read(b); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to generate recovery code", "error", err)
+			return nil, nil, domain.ErrInternalServer
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to hash recovery code", "error", err)
+			return nil, nil, domain.ErrInternalServer
+		}
+		codes[i] = code[:recoveryCodeChars/2] + "-" + code[recoveryCodeChars/2:]
+		hashes[i] = string(hash)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeMFACode drops the separators people type or paste along with a code
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Sosokker/todolist-backend/internal/auth"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// usernameAttempts is how many suffixed usernames are tried when the provider's name is taken
+const usernameAttempts = 5
+
+// oauthLinkExpiry bounds both halves of linking: the trip to the provider and the confirmation
+const oauthLinkExpiry = 10 * time.Minute
+
+// External logins keep no server-side state between the redirect and the callback. The nonce
+// and PKCE verifier are derived from the signed state, which the handler checks against its cookie.
+
+func (s *authService) OAuthProviders() []OAuthProviderInfo {
+	providers := make([]OAuthProviderInfo, 0, len(s.oauthProviders))
+	for _, p := range s.oauthProviders {
+		providers = append(providers, OAuthProviderInfo{ID: p.ID(), Name: p.Name()})
+	}
+	slices.SortFunc(providers, func(a, b OAuthProviderInfo) int { return strings.Compare(a.ID, b.ID) })
+	return providers
+}
+
+func (s *authService) oauthProvider(id string) (auth.OAuthProvider, error) {
+	p, ok := s.oauthProviders[id]
+	if !ok {
+		return nil, fmt.Errorf("login provider %q is not configured: %w", id, domain.ErrNotFound)
+	}
+	return p, nil
+}
+
+// oauthProviderName is the display name of a provider, or its key once it's no longer configured
+func (s *authService) oauthProviderName(id string) string {
+	if p, ok := s.oauthProviders[id]; ok {
+		return p.Name()
+	}
+	return id
+}
+
+// oauthSecrets derives the nonce and PKCE verifier of the login started with state.
+// The provider is part of the label, so a state minted for one provider fails at another.
+func (s *authService) oauthSecrets(provider, state string) (nonce, verifier string) {
+	key := []byte(s.cfg.OAuth.StateSecret)
+	return auth.DeriveFromState(state, "nonce"+provider, key), auth.DeriveFromState(state, "pkce"+provider, key)
+}
+
+func (s *authService) OAuthLoginURL(ctx context.Context, providerID, state string) (string, error) {
+	p, err := s.oauthProvider(providerID)
+	if err != nil {
+		return "", err
+	}
+	nonce, verifier := s.oauthSecrets(providerID, state)
+	url, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to build login URL", "error", err, "provider", providerID)
+		return "", domain.ErrInternalServer
+	}
+	return url, nil
+}
+
+func (s *authService) HandleOAuthCallback(ctx context.Context, providerID, code, state string) (*AuthTokens, *domain.User, error) {
+	p, err := s.oauthProvider(providerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, verifier := s.oauthSecrets(providerID, state)
+	external, err := p.Exchange(ctx, code, nonce, verifier)
+	if err != nil {
+		if errors.Is(err, auth.ErrOAuthRejected) {
+			s.logger.WarnContext(ctx, "External login rejected", "error", err, "provider", providerID)
+			return nil, nil, fmt.Errorf("%s login failed: %w", p.Name(), domain.ErrUnauthorized)
+		}
+		s.logger.ErrorContext(ctx, "External login failed", "error", err, "provider", providerID)
+		return nil, nil, domain.ErrInternalServer
+	}
+
+	user, err := s.userForExternalIdentity(ctx, p, external)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.issueTokens(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// userForExternalIdentity finds the user an external account logs in as: the one it's linked to,
+// else a new user. An account whose email belongs to an existing user isn't merged into it; the user
+// links it from their settings instead, so nobody gets into an account by controlling its address at a provider.
+func (s *authService) userForExternalIdentity(ctx context.Context, p auth.OAuthProvider, external *auth.ExternalIdentity) (*domain.User, error) {
+	var email *string
+	if external.Email != "" {
+		email = &external.Email
+	}
+
+	identity, err := s.identityRepo.GetBySubject(ctx, p.ID(), external.Subject)
+	switch {
+	case err == nil:
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to get user of identity", "error", err, "identityId", identity.ID)
+			return nil, domain.ErrInternalServer
+		}
+		if err := s.identityRepo.RecordLogin(ctx, identity.ID, email); err != nil {
+			s.logger.WarnContext(ctx, "Failed to record identity login", "error", err, "identityId", identity.ID)
+		}
+		return user, nil
+	case !errors.Is(err, domain.ErrNotFound):
+		s.logger.ErrorContext(ctx, "Failed to look up identity", "error", err, "provider", p.ID())
+		return nil, domain.ErrInternalServer
+	}
+
+	if external.Email == "" {
+		return nil, fmt.Errorf("%s didn't share an email address: %w", p.Name(), domain.ErrUnauthorized)
+	}
+	_, err = s.userRepo.GetByEmail(ctx, external.Email)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("an account with this email already exists, log in and link %s from your settings: %w", p.Name(), domain.ErrConflict)
+	case !errors.Is(err, domain.ErrNotFound):
+		s.logger.ErrorContext(ctx, "Failed to get user by email", "error", err)
+		return nil, domain.ErrInternalServer
+	}
+
+	return s.createExternalUser(ctx, p, external, &domain.UserIdentity{Provider: p.ID(), Subject: external.Subject, Email: email})
+}
+
+// createExternalUser signs up a password-less user for an external account. The provider's
+// display name becomes the username, with a random suffix if it's taken.
+func (s *authService) createExternalUser(ctx context.Context, p auth.OAuthProvider, external *auth.ExternalIdentity, identity *domain.UserIdentity) (*domain.User, error) {
+	base := externalUsername(external)
+	username := base
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		user, _, err := s.identityRepo.CreateWithUser(ctx, &domain.User{
+			Username:      username,
+			Email:         external.Email,
+			EmailVerified: external.EmailVerified,
+		}, identity)
+		if err == nil {
+			s.logger.InfoContext(ctx, "Created user from external account", "userId", user.ID, "provider", p.ID())
+			return user, nil
+		}
+		if !errors.Is(err, domain.ErrConflict) {
+			s.logger.ErrorContext(ctx, "Failed to create user from external account", "error", err, "provider", p.ID())
+			return nil, domain.ErrInternalServer
+		}
+		if _, emailErr := s.userRepo.GetByEmail(ctx, external.Email); emailErr == nil {
+			return nil, fmt.Errorf("an account with this email already exists: %w", domain.ErrConflict) // Signed up in the meantime
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, domain.ErrInternalServer
+		}
+		username = truncateRunes(base, MaxUsernameLength-len(suffix)*2-1) + "-" + hex.EncodeToString(suffix)
+	}
+	return nil, fmt.Errorf("could not find a free username: %w", domain.ErrConflict)
+}
+
+// externalUsername picks a valid username from the account's name or email
+func externalUsername(external *auth.ExternalIdentity) string {
+	name := strings.TrimSpace(external.Name)
+	if len(name) < MinUsernameLength {
+		name, _, _ = strings.Cut(external.Email, "@")
+	}
+	if len(name) < MinUsernameLength {
+		name = "user"
+	}
+	return truncateRunes(name, MaxUsernameLength)
+}
+
+// truncateRunes shortens s to at most n bytes without splitting a character
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// --- Account linking ---
+
+func (s *authService) BeginOAuthLink(ctx context.Context, userID uuid.UUID, providerID, state string) (string, string, error) {
+	p, err := s.oauthProvider(providerID)
+	if err != nil {
+		return "", "", err
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", "", err
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for linking", "error", err, "userId", userID)
+		return "", "", domain.ErrInternalServer
+	}
+	linked, err := s.linkedIdentity(ctx, userID, providerID)
+	if err != nil {
+		return "", "", err
+	}
+	if linked != nil {
+		return "", "", fmt.Errorf("a %s account is already linked, unlink it first: %w", p.Name(), domain.ErrConflict)
+	}
+
+	url, err := s.OAuthLoginURL(ctx, providerID, state)
+	if err != nil {
+		return "", "", err
+	}
+	intent, err := s.signJWT(s.oauthLinkClaims(user, auth.PurposeOAuthLink, providerID, func(c *auth.Claims) { c.State = state }))
+	if err != nil {
+		return "", "", err
+	}
+	return url, intent, nil
+}
+
+func (s *authService) HandleOAuthLinkCallback(ctx context.Context, providerID, code, state, intent string) (*OAuthLinkPending, error) {
+	p, err := s.oauthProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.parseJWT(intent, auth.PurposeOAuthLink)
+	if err != nil {
+		return nil, err
+	}
+	// The intent is only good for the flow it was issued with, so a stale cookie can't turn a later login into a link
+	if claims.Provider != providerID || claims.State != state {
+		return nil, fmt.Errorf("link intent doesn't match this login: %w", domain.ErrUnauthorized)
+	}
+	user, err := s.userForClaims(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, verifier := s.oauthSecrets(providerID, state)
+	external, err := p.Exchange(ctx, code, nonce, verifier)
+	if err != nil {
+		if errors.Is(err, auth.ErrOAuthRejected) {
+			s.logger.WarnContext(ctx, "External link rejected", "error", err, "provider", providerID)
+			return nil, fmt.Errorf("%s login failed: %w", p.Name(), domain.ErrUnauthorized)
+		}
+		s.logger.ErrorContext(ctx, "External link failed", "error", err, "provider", providerID)
+		return nil, domain.ErrInternalServer
+	}
+	if err := s.checkLinkable(ctx, p, external.Subject); err != nil {
+		return nil, err
+	}
+
+	token, err := s.signJWT(s.oauthLinkClaims(user, auth.PurposeOAuthLinkPending, providerID, func(c *auth.Claims) {
+		c.ExternalSubject = external.Subject
+		c.ExternalEmail = external.Email
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthLinkPending{Token: token, Provider: providerID, Email: external.Email}, nil
+}
+
+func (s *authService) ConfirmOAuthLink(ctx context.Context, userID uuid.UUID, pendingToken string) (*domain.UserIdentity, error) {
+	claims, err := s.parseJWT(pendingToken, auth.PurposeOAuthLinkPending)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID != userID {
+		return nil, fmt.Errorf("the link was started by another user: %w", domain.ErrForbidden)
+	}
+	if _, err := s.userForClaims(ctx, claims); err != nil {
+		return nil, err
+	}
+	p, err := s.oauthProvider(claims.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLinkable(ctx, p, claims.ExternalSubject); err != nil {
+		return nil, err
+	}
+	// A pending link works once
+	if err := s.revokeClaims(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	var email *string
+	if claims.ExternalEmail != "" {
+		email = &claims.ExternalEmail
+	}
+	identity, err := s.identityRepo.Create(ctx, &domain.UserIdentity{
+		UserID:   userID,
+		Provider: claims.Provider,
+		Subject:  claims.ExternalSubject,
+		Email:    email,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) || errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to link identity", "error", err, "userId", userID, "provider", claims.Provider)
+		return nil, domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Linked external account", "userId", userID, "provider", claims.Provider)
+	return identity, nil
+}
+
+func (s *authService) ListIdentities(ctx context.Context, userID uuid.UUID) ([]domain.UserIdentity, error) {
+	identities, err := s.identityRepo.ListByUser(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list identities", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	return identities, nil
+}
+
+func (s *authService) UnlinkIdentity(ctx context.Context, userID, id uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for unlinking", "error", err, "userId", userID)
+		return domain.ErrInternalServer
+	}
+	identities, err := s.ListIdentities(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(identities, func(i domain.UserIdentity) bool { return i.ID == id }) {
+		return domain.ErrNotFound
+	}
+	if user.PasswordHash == "" && len(identities) == 1 {
+		passkeys, err := s.webauthnRepo.ListByUser(ctx, userID)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to list passkeys", "error", err, "userId", userID)
+			return domain.ErrInternalServer
+		}
+		if len(passkeys) == 0 {
+			return fmt.Errorf("this is your only way to log in, set a password or add a passkey first: %w", domain.ErrConflict)
+		}
+	}
+
+	if err := s.identityRepo.Delete(ctx, id, userID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		s.logger.ErrorContext(ctx, "Failed to unlink identity", "error", err, "userId", userID, "identityId", id)
+		return domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Unlinked external account", "userId", userID, "identityId", id)
+	return nil
+}
+
+// linkedIdentity returns the user's account at provider, or nil
+func (s *authService) linkedIdentity(ctx context.Context, userID uuid.UUID, providerID string) (*domain.UserIdentity, error) {
+	identities, err := s.ListIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range identities {
+		if identity.Provider == providerID {
+			return &identity, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkLinkable fails with domain.ErrConflict if the external account already logs in as someone
+func (s *authService) checkLinkable(ctx context.Context, p auth.OAuthProvider, subject string) error {
+	_, err := s.identityRepo.GetBySubject(ctx, p.ID(), subject)
+	switch {
+	case err == nil:
+		return fmt.Errorf("this %s account is already linked to an account: %w", p.Name(), domain.ErrConflict)
+	case !errors.Is(err, domain.ErrNotFound):
+		s.logger.ErrorContext(ctx, "Failed to look up identity", "error", err, "provider", p.ID())
+		return domain.ErrInternalServer
+	}
+	return nil
+}
+
+// oauthLinkClaims are the claims of a linking token for user; set adds the purpose-specific ones
+func (s *authService) oauthLinkClaims(user *domain.User, purpose, providerID string, set func(*auth.Claims)) *auth.Claims {
+	now := time.Now()
+	claims := &auth.Claims{
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
+		Purpose:      purpose,
+		Provider:     providerID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   user.ID.String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oauthLinkExpiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	set(claims)
+	return claims
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetEmailBody = `Hi %s,
+
+Someone asked to reset the password of your account. Choose a new one by opening this link:
+
+%s
+
+The link works once and expires in %s. If you didn't ask for this, you can ignore this email.
+`
+
+type passwordResetService struct {
+	userRepo  repository.UserRepository
+	resetRepo repository.PasswordResetRepository
+	auth      AuthService
+	mailer    Mailer
+	cfg       config.EmailConfig
+	logger    *slog.Logger
+}
+
+func NewPasswordResetService(
+	userRepo repository.UserRepository,
+	resetRepo repository.PasswordResetRepository,
+	authService AuthService,
+	mailer Mailer,
+	cfg config.EmailConfig,
+) PasswordResetService {
+	return &passwordResetService{
+		userRepo:  userRepo,
+		resetRepo: resetRepo,
+		auth:      authService,
+		mailer:    mailer,
+		cfg:       cfg,
+		logger:    slog.Default().With("service", "password_reset"),
+	}
+}
+
+func (s *passwordResetService) RequestReset(ctx context.Context, email string) error {
+	if err := ValidateEmail(email); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			s.logger.InfoContext(ctx, "Password reset requested for unknown email")
+			return nil
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for password reset", "error", err)
+		return domain.ErrInternalServer
+	}
+
+	// Store and mail the token off the request, so the response time doesn't reveal whether the account exists
+	go s.sendReset(context.WithoutCancel(ctx), user)
+	return nil
+}
+
+func (s *passwordResetService) sendReset(ctx context.Context, user *domain.User) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to generate password reset token", "error", err)
+		return
+	}
+	now := time.Now()
+	_, err = s.resetRepo.Create(ctx, &domain.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashOpaqueToken(token),
+		ExpiresAt: now.Add(s.cfg.PasswordResetExpiry),
+	}, now.Add(-s.cfg.ResendInterval))
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			s.logger.InfoContext(ctx, "Password reset throttled", "userId", user.ID)
+			return
+		}
+		s.logger.ErrorContext(ctx, "Failed to store password reset token", "error", err, "userId", user.ID)
+		return
+	}
+
+	link, err := url.Parse(s.cfg.PasswordResetURL)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Invalid email.passwordResetUrl", "error", err, "url", s.cfg.PasswordResetURL)
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = s.mailer.Send(ctx, &MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf(passwordResetEmailBody, user.Username, link.String(), s.cfg.PasswordResetExpiry),
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to send password reset email", "error", err, "userId", user.ID)
+		return
+	}
+	s.logger.InfoContext(ctx, "Password reset email sent", "userId", user.ID)
+}
+
+func (s *passwordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+	if token == "" {
+		return fmt.Errorf("reset token is required: %w", domain.ErrValidation)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to hash password", "error", err)
+		return domain.ErrInternalServer
+	}
+
+	redeemed, err := s.resetRepo.Redeem(ctx, hashOpaqueToken(token), string(hashedPassword))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return fmt.Errorf("invalid or expired reset link: %w", domain.ErrBadRequest)
+		}
+		s.logger.ErrorContext(ctx, "Failed to redeem password reset token", "error", err)
+		return domain.ErrInternalServer
+	}
+
+	// Whoever knew the old password may still be signed in
+	if err := s.auth.LogoutEverywhere(ctx, redeemed.UserID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to revoke sessions after password reset", "error", err, "userId", redeemed.UserID)
+		return domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Password reset", "userId", redeemed.UserID)
+	return nil
+}
+
+// Run deletes expired reset tokens every tokenPurgeInterval until ctx is cancelled
+func (s *passwordResetService) Run(ctx context.Context) {
+	ticker := time.NewTicker(tokenPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.resetRepo.DeleteExpired(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to purge expired password reset tokens", "error", err)
+		} else if n > 0 {
+			s.logger.InfoContext(ctx, "Purged expired password reset tokens", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+)
+
+// reconcileBatchSize is how many listed objects are checked against the database per query
+const reconcileBatchSize = 500
+
+// attachmentObjectPattern matches the <user_uuid>/<todo_uuid>/<file_uuid>.<ext> tail that
+// GenerateUniqueObjectName produces. Anything else in the bucket isn't ours to delete,
+// which matters when no base directory is configured and the whole bucket is listed.
+var attachmentObjectPattern = regexp.MustCompile(
+	`(^|/)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}/[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}/[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}(\.[^/]*)?$`,
+)
+
+// uploadTempPattern matches the temp files local storage writes an upload to before renaming
+// it into place. One left behind by a crash is never referenced, so it's reconciled like an orphan.
+var uploadTempPattern = regexp.MustCompile(`(^|/)\.upload-[^/]+$`)
+
+// isAttachmentObject reports whether storageID has the layout of an attachment object
+func isAttachmentObject(storageID string) bool {
+	return path.Clean(storageID) == storageID && attachmentObjectPattern.MatchString(storageID)
+}
+
+// isUploadTemp reports whether storageID is an upload's temp file
+func isUploadTemp(storageID string) bool {
+	return path.Clean(storageID) == storageID && uploadTempPattern.MatchString(storageID)
+}
+
+// attachmentObjectKey returns the <user_uuid>/<todo_uuid>/<file_uuid>.<ext> tail of an
+// attachment object's storage ID, without any base directory in front of it
+func attachmentObjectKey(storageID string) (string, bool) {
+	if path.Clean(storageID) != storageID {
+		return "", false
+	}
+	key := attachmentObjectPattern.FindString(storageID)
+	if key == "" {
+		return "", false
+	}
+	return strings.TrimPrefix(key, "/"), true
+}
+
+type attachmentReconciler struct {
+	storageService FileStorageService
+	attachmentRepo repository.AttachmentRepository
+	cfg            config.ReconcileConfig
+	logger         *slog.Logger
+}
+
+// NewAttachmentReconciler creates a reconciler that removes stored objects left
+// behind by best-effort deletes and by uploads whose database insert failed.
+func NewAttachmentReconciler(
+	storageService FileStorageService,
+	attachmentRepo repository.AttachmentRepository,
+	cfg config.ReconcileConfig,
+) AttachmentReconciler {
+	return &attachmentReconciler{
+		storageService: storageService,
+		attachmentRepo: attachmentRepo,
+		cfg:            cfg,
+		logger:         slog.Default().With("service", "reconciler"),
+	}
+}
+
+func (r *attachmentReconciler) Reconcile(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	report := &ReconcileReport{DryRun: opts.DryRun}
+	cutoff := time.Now().Add(-opts.GracePeriod)
+
+	r.logger.InfoContext(ctx, "Starting attachment reconciliation", "dryRun", opts.DryRun, "gracePeriod", opts.GracePeriod)
+
+	// Blobs left at zero references by cascading deletes no longer protect their files,
+	// so the scan below picks those up as orphans
+	if !opts.DryRun {
+		blobs, err := r.attachmentRepo.DeleteUnreferencedBlobs(ctx)
+		if err != nil {
+			r.logger.ErrorContext(ctx, "Attachment reconciliation failed", "error", err)
+			return report, fmt.Errorf("reconciliation failed: %w", err)
+		}
+		report.ReleasedBlobs = len(blobs)
+	}
+
+	batch := make([]StoredObject, 0, reconcileBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := r.reconcileBatch(ctx, batch, opts.DryRun, report)
+		batch = batch[:0]
+		return err
+	}
+
+	err := r.storageService.List(ctx, func(obj StoredObject) error {
+		report.Scanned++
+		if !isAttachmentObject(obj.StorageID) && !isUploadTemp(obj.StorageID) {
+			report.Ignored++
+			return nil
+		}
+		if obj.LastModified.After(cutoff) {
+			report.Skipped++
+			return nil
+		}
+		batch = append(batch, obj)
+		if len(batch) == reconcileBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Attachment reconciliation failed", "error", err, "scanned", report.Scanned)
+		return report, fmt.Errorf("reconciliation failed: %w", err)
+	}
+
+	r.logger.InfoContext(ctx, "Attachment reconciliation finished",
+		"dryRun", report.DryRun, "releasedBlobs", report.ReleasedBlobs, "scanned", report.Scanned, "ignored", report.Ignored, "skipped", report.Skipped,
+		"orphans", report.Orphans, "orphanBytes", report.OrphanBytes, "deleted", report.Deleted, "failed", report.Failed)
+	return report, nil
+}
+
+func (r *attachmentReconciler) reconcileBatch(ctx context.Context, batch []StoredObject, dryRun bool, report *ReconcileReport) error {
+	storageIDs := make([]string, len(batch))
+	for i, obj := range batch {
+		storageIDs[i] = obj.StorageID
+	}
+
+	referencedIDs, err := r.attachmentRepo.FilterReferenced(ctx, storageIDs)
+	if err != nil {
+		return err
+	}
+	referenced := make(map[string]bool, len(referencedIDs))
+	for _, id := range referencedIDs {
+		referenced[id] = true
+	}
+
+	for _, obj := range batch {
+		if referenced[obj.StorageID] {
+			continue
+		}
+		report.Orphans++
+		report.OrphanBytes += obj.Size
+		if dryRun {
+			r.logger.InfoContext(ctx, "Found orphaned object", "storageId", obj.StorageID, "size", obj.Size, "lastModified", obj.LastModified)
+			continue
+		}
+		if err := r.storageService.Delete(ctx, obj.StorageID); err != nil {
+			report.Failed++
+			r.logger.WarnContext(ctx, "Failed to delete orphaned object", "error", err, "storageId", obj.StorageID)
+			continue
+		}
+		report.Deleted++
+		r.logger.InfoContext(ctx, "Deleted orphaned object", "storageId", obj.StorageID, "size", obj.Size, "lastModified", obj.LastModified)
+	}
+	return nil
+}
+
+// Run reconciles once at startup and then every cfg.Interval until ctx is cancelled
+func (r *attachmentReconciler) Run(ctx context.Context) {
+	opts := ReconcileOptions{DryRun: r.cfg.DryRun, GracePeriod: r.cfg.GracePeriod}
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Errors are logged by Reconcile; the next tick simply tries again
+		_, _ = r.Reconcile(ctx, opts)
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Attachment reconciler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
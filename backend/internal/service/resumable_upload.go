@@ -0,0 +1,398 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// uploadPurgeInterval is how often expired uploads and their staged bytes are removed
+const uploadPurgeInterval = time.Hour
+
+// stagedFileExt marks the files ResumableUploadService writes to its staging directory
+const stagedFileExt = ".part"
+
+type resumableUploadService struct {
+	uploadRepo  repository.AttachmentUploadRepository
+	todoRepo    repository.TodoRepository
+	todoService TodoService
+	stagingDir  string
+	expiry      time.Duration
+	maxPending  int
+	logger      *slog.Logger
+
+	mu     sync.Mutex
+	active map[uuid.UUID]bool // Uploads currently receiving a chunk
+}
+
+// NewResumableUploadService creates the service behind the tus endpoints. Completed
+// uploads go through TodoService.AddAttachment, so they get the same ownership,
+// size and content type checks as a single-shot upload.
+func NewResumableUploadService(
+	uploadRepo repository.AttachmentUploadRepository,
+	todoRepo repository.TodoRepository,
+	todoService TodoService,
+	cfg config.StorageConfig,
+) (ResumableUploadService, error) {
+	if cfg.Resumable.Path == "" {
+		return nil, fmt.Errorf("resumable upload staging path is required")
+	}
+	stagingDir, err := filepath.Abs(cfg.Resumable.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resumable upload path '%s': %w", cfg.Resumable.Path, err)
+	}
+	if err := os.MkdirAll(stagingDir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create resumable upload directory '%s': %w", stagingDir, err)
+	}
+	// The reconciler walks storage.local.path and would delete staged chunks as orphans
+	if cfg.Type == "local" && cfg.Local.Path != "" {
+		inside, err := isWithinDir(stagingDir, cfg.Local.Path)
+		if err != nil {
+			return nil, err
+		}
+		if inside {
+			return nil, fmt.Errorf("resumable upload path '%s' must not be inside local storage path '%s'", cfg.Resumable.Path, cfg.Local.Path)
+		}
+	}
+
+	return &resumableUploadService{
+		uploadRepo:  uploadRepo,
+		todoRepo:    todoRepo,
+		todoService: todoService,
+		stagingDir:  stagingDir,
+		expiry:      cfg.Resumable.Expiry,
+		maxPending:  cfg.Resumable.MaxPending,
+		logger:      slog.Default().With("service", "resumableupload"),
+		active:      make(map[uuid.UUID]bool),
+	}, nil
+}
+
+// isWithinDir reports whether path is dir or lies below it, after resolving symlinks
+func isWithinDir(path, dir string) (bool, error) {
+	resolve := func(p string) (string, error) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve path '%s': %w", p, err)
+		}
+		if real, err := filepath.EvalSymlinks(abs); err == nil {
+			return real, nil
+		}
+		return abs, nil // dir may not exist yet
+	}
+	path, err := resolve(path)
+	if err != nil {
+		return false, err
+	}
+	dir, err = resolve(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false, nil // Different volumes
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))), nil
+}
+
+func (s *resumableUploadService) stagedPath(uploadID uuid.UUID) string {
+	return filepath.Join(s.stagingDir, uploadID.String()+stagedFileExt)
+}
+
+// acquire marks an upload as busy. A second PATCH for the same upload while the
+// first is still streaming gets domain.ErrConflict instead of interleaving bytes.
+// Both this lock and the staged chunks are local to the process, so with several
+// replicas every request for an upload must be routed to the same node.
+func (s *resumableUploadService) acquire(uploadID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[uploadID] {
+		return fmt.Errorf("upload %s is already receiving data: %w", uploadID, domain.ErrConflict)
+	}
+	s.active[uploadID] = true
+	return nil
+}
+
+func (s *resumableUploadService) release(uploadID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.active, uploadID)
+}
+
+func (s *resumableUploadService) Create(ctx context.Context, todoID, userID uuid.UUID, fileName string, length int64) (*domain.AttachmentUpload, error) {
+	fileName = strings.TrimSpace(fileName)
+	if fileName == "" {
+		return nil, fmt.Errorf("file name is required: %w", domain.ErrValidation)
+	}
+	if length <= 0 {
+		return nil, fmt.Errorf("upload length must be positive: %w", domain.ErrValidation)
+	}
+
+	if _, err := s.todoRepo.GetByID(ctx, todoID, userID); err != nil {
+		return nil, err
+	}
+
+	usage, err := s.todoService.StorageUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if length > usage.MaxUploadSize {
+		return nil, limitExceeded(usage.MaxUploadSize)
+	}
+	// Staged bytes aren't attachments yet, so unfinished uploads are charged their declared
+	// length up front. That holds even for content the user already stores.
+	remaining := usage.Remaining()
+	if remaining >= 0 && length > remaining {
+		return nil, quotaExceeded(usage)
+	}
+
+	upload, err := s.uploadRepo.Create(ctx, &domain.AttachmentUpload{
+		TodoID:    todoID,
+		UserID:    userID,
+		FileName:  fileName,
+		Length:    length,
+		ExpiresAt: time.Now().Add(s.expiry),
+	}, repository.PendingUploadLimit{Count: s.maxPending, Bytes: remaining})
+	if err != nil {
+		if errors.Is(err, domain.ErrTooManyRequests) || errors.Is(err, domain.ErrTooLarge) {
+			s.logger.WarnContext(ctx, "Upload rejected by pending upload limits", "error", err, "todoId", todoID)
+			return nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to create upload in repo", "error", err, "todoId", todoID)
+		return nil, err
+	}
+
+	f, err := os.OpenFile(s.stagedPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to create staging file", "error", err, "uploadId", upload.ID)
+		if delErr := s.uploadRepo.Delete(ctx, upload.ID, userID); delErr != nil {
+			s.logger.WarnContext(ctx, "Failed to remove upload after staging error", "error", delErr, "uploadId", upload.ID)
+		}
+		return nil, domain.ErrInternalServer
+	}
+	f.Close()
+
+	s.logger.InfoContext(ctx, "Resumable upload created", "todoId", todoID, "uploadId", upload.ID, "length", length)
+	return upload, nil
+}
+
+func (s *resumableUploadService) Get(ctx context.Context, todoID, uploadID, userID uuid.UUID) (*domain.AttachmentUpload, error) {
+	upload, err := s.uploadRepo.GetByID(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Expired rows linger until the next purge; treat them as gone already
+	if upload.TodoID != todoID || time.Now().After(upload.ExpiresAt) {
+		return nil, domain.ErrNotFound
+	}
+	return upload, nil
+}
+
+func (s *resumableUploadService) WriteChunk(ctx context.Context, todoID, uploadID, userID uuid.UUID, offset int64, chunk io.Reader) (*domain.AttachmentUpload, *domain.AttachmentInfo, error) {
+	if err := s.acquire(uploadID); err != nil {
+		return nil, nil, err
+	}
+	defer s.release(uploadID)
+
+	upload, err := s.Get(ctx, todoID, uploadID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset != upload.Offset {
+		return upload, nil, fmt.Errorf("offset %d doesn't match the upload's offset %d: %w", offset, upload.Offset, domain.ErrConflict)
+	}
+
+	// A complete upload whose commit failed can be retried with an empty chunk
+	if !upload.Complete() {
+		upload, err = s.appendChunk(ctx, upload, chunk)
+		if err != nil || !upload.Complete() {
+			return upload, nil, err
+		}
+	}
+
+	info, err := s.commit(ctx, upload)
+	if err != nil {
+		return upload, nil, err
+	}
+	return upload, info, nil
+}
+
+// appendChunk writes the chunk at the upload's offset and records how far it got.
+// Bytes received before the client went away are kept so it can resume from there.
+func (s *resumableUploadService) appendChunk(ctx context.Context, upload *domain.AttachmentUpload, chunk io.Reader) (*domain.AttachmentUpload, error) {
+	f, err := os.OpenFile(s.stagedPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to open staging file", "error", err, "uploadId", upload.ID)
+		return upload, domain.ErrInternalServer
+	}
+	defer f.Close()
+
+	// Drop anything past the recorded offset, left over from a write whose offset was never saved
+	if err := f.Truncate(upload.Offset); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to truncate staging file", "error", err, "uploadId", upload.ID)
+		return upload, domain.ErrInternalServer
+	}
+	if _, err := f.Seek(upload.Offset, io.SeekStart); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to seek staging file", "error", err, "uploadId", upload.ID)
+		return upload, domain.ErrInternalServer
+	}
+
+	remaining := upload.Length - upload.Offset
+	written, copyErr := io.Copy(f, io.LimitReader(chunk, remaining))
+	if copyErr == nil && written == remaining {
+		// Anything after the announced length means the client and server disagree on the file
+		if n, _ := chunk.Read(make([]byte, 1)); n > 0 {
+			if err := f.Truncate(upload.Offset); err != nil {
+				s.logger.WarnContext(ctx, "Failed to truncate staging file", "error", err, "uploadId", upload.ID)
+			}
+			return upload, fmt.Errorf("chunk extends past the upload length of %d bytes: %w", upload.Length, domain.ErrBadRequest)
+		}
+	}
+	if written > 0 {
+		if err := f.Sync(); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to flush staging file", "error", err, "uploadId", upload.ID)
+			return upload, domain.ErrInternalServer
+		}
+		updated, err := s.uploadRepo.UpdateOffset(ctx, upload.ID, upload.UserID, upload.Offset, upload.Offset+written, time.Now().Add(s.expiry))
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to save upload offset", "error", err, "uploadId", upload.ID)
+			return upload, err
+		}
+		upload = updated
+	}
+	if copyErr != nil {
+		s.logger.WarnContext(ctx, "Upload chunk interrupted", "error", copyErr, "uploadId", upload.ID, "offset", upload.Offset)
+		return upload, fmt.Errorf("chunk interrupted at offset %d: %w", upload.Offset, domain.ErrBadRequest)
+	}
+	return upload, nil
+}
+
+// commit hands the assembled file to TodoService.AddAttachment. Uploads that can never
+// succeed (rejected type, todo gone) are discarded; on other failures the staged file is
+// kept so the client can retry the commit.
+func (s *resumableUploadService) commit(ctx context.Context, upload *domain.AttachmentUpload) (*domain.AttachmentInfo, error) {
+	f, err := os.Open(s.stagedPath(upload.ID))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to open staging file", "error", err, "uploadId", upload.ID)
+		return nil, domain.ErrInternalServer
+	}
+	info, err := s.todoService.AddAttachment(ctx, upload.TodoID, upload.UserID, upload.FileName, f)
+	f.Close()
+
+	if err != nil && !isPermanentUploadError(err) {
+		s.logger.ErrorContext(ctx, "Failed to commit resumable upload", "error", err, "uploadId", upload.ID)
+		return nil, err
+	}
+	s.discard(ctx, upload.ID, upload.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Resumable upload committed", "uploadId", upload.ID, "attachmentId", info.FileID)
+	return info, nil
+}
+
+func isPermanentUploadError(err error) bool {
+	return errors.Is(err, domain.ErrValidation) ||
+		errors.Is(err, domain.ErrTooLarge) ||
+		errors.Is(err, domain.ErrNotFound) ||
+		errors.Is(err, domain.ErrBadRequest) ||
+		errors.Is(err, domain.ErrInfected)
+}
+
+func (s *resumableUploadService) Terminate(ctx context.Context, todoID, uploadID, userID uuid.UUID) error {
+	if err := s.acquire(uploadID); err != nil {
+		return err
+	}
+	defer s.release(uploadID)
+
+	if _, err := s.Get(ctx, todoID, uploadID, userID); err != nil {
+		return err
+	}
+	if err := s.uploadRepo.Delete(ctx, uploadID, userID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to delete upload from repo", "error", err, "uploadId", uploadID)
+		return domain.ErrInternalServer
+	}
+	s.removeStagedFile(ctx, uploadID)
+
+	s.logger.InfoContext(ctx, "Resumable upload terminated", "todoId", todoID, "uploadId", uploadID)
+	return nil
+}
+
+// discard removes an upload and its staged bytes on a best-effort basis
+func (s *resumableUploadService) discard(ctx context.Context, uploadID, userID uuid.UUID) {
+	if err := s.uploadRepo.Delete(ctx, uploadID, userID); err != nil {
+		s.logger.WarnContext(ctx, "Failed to delete upload from repo", "error", err, "uploadId", uploadID)
+	}
+	s.removeStagedFile(ctx, uploadID)
+}
+
+func (s *resumableUploadService) removeStagedFile(ctx context.Context, uploadID uuid.UUID) {
+	if err := os.Remove(s.stagedPath(uploadID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.logger.WarnContext(ctx, "Failed to remove staging file", "error", err, "uploadId", uploadID)
+	}
+}
+
+// purgeExpired drops expired upload rows, then any staged file that hasn't been written
+// to within the expiry. The second pass also catches uploads whose todo was deleted.
+func (s *resumableUploadService) purgeExpired(ctx context.Context) {
+	ids, err := s.uploadRepo.DeleteExpired(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to delete expired uploads", "error", err)
+		return
+	}
+
+	entries, err := os.ReadDir(s.stagingDir)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to read staging directory", "error", err, "path", s.stagingDir)
+		return
+	}
+	cutoff := time.Now().Add(-s.expiry)
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != stagedFileExt {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.stagingDir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logger.WarnContext(ctx, "Failed to remove stale staging file", "error", err, "file", entry.Name())
+			continue
+		}
+		removed++
+	}
+
+	if len(ids) > 0 || removed > 0 {
+		s.logger.InfoContext(ctx, "Purged expired resumable uploads", "uploads", len(ids), "files", removed)
+	}
+}
+
+// Run purges expired uploads once at startup and then hourly until ctx is cancelled
+func (s *resumableUploadService) Run(ctx context.Context) {
+	ticker := time.NewTicker(uploadPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeExpired(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3StreamingPartSize is the multipart part size used when the upload length isn't known.
+// minio-go buffers one part in memory per upload, and S3 requires parts of at least 5 MiB.
+const s3StreamingPartSize = 16 << 20
+
+type s3StorageService struct {
+	bucket          string
+	client          *minio.Client
+	logger          *slog.Logger
+	baseDir         string
+	signedURLExpiry time.Duration
+}
+
+// NewS3StorageService creates a FileStorageService for any S3-compatible API (AWS S3, MinIO, Ceph RGW).
+func NewS3StorageService(cfg config.S3StorageConfig, logger *slog.Logger) (FileStorageService, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("S3 endpoint is required")
+	}
+	if cfg.BucketName == "" {
+		return nil, fmt.Errorf("S3 bucket name is required")
+	}
+	// SigV4 presigned URLs are valid for at most 7 days
+	if cfg.SignedURLExpiry <= 0 || cfg.SignedURLExpiry > 7*24*time.Hour {
+		return nil, fmt.Errorf("S3 signed URL expiry must be between 1s and 168h")
+	}
+
+	var creds *credentials.Credentials
+	// Only use static keys from config if they're explicitly set
+	if cfg.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+		logger.Info("Using S3 access key specified in config", "accessKeyId", cfg.AccessKeyID)
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+		logger.Info("Using default S3 credentials (e.g., AWS_ACCESS_KEY_ID, ~/.aws/credentials or instance role)")
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if cfg.UsePathStyle {
+		bucketLookup = minio.BucketLookupPath // Required by most MinIO and Ceph deployments
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// Check bucket existence and permissions
+	exists, err := client.BucketExists(ctx, cfg.BucketName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access S3 bucket '%s': %w", cfg.BucketName, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("S3 bucket '%s' does not exist", cfg.BucketName)
+	}
+
+	logger.Info("S3 storage service initialized", "endpoint", cfg.Endpoint, "bucket", cfg.BucketName, "baseDir", cfg.BaseDir, "signedUrlExpiry", cfg.SignedURLExpiry)
+
+	return &s3StorageService{
+		bucket:          cfg.BucketName,
+		client:          client,
+		logger:          logger.With("service", "s3storage"),
+		baseDir:         strings.Trim(cfg.BaseDir, "/"), // Ensure no leading/trailing slashes
+		signedURLExpiry: cfg.SignedURLExpiry,            // Short-lived, a fresh URL is minted on every read
+	}, nil
+}
+
+// GenerateUniqueObjectName creates a unique object key within the bucket's base directory.
+// Example: attachments/<user_uuid>/<todo_uuid>/<file_uuid>.<ext>
+func (s *s3StorageService) GenerateUniqueObjectName(userID, todoID uuid.UUID, originalFilename string) string {
+	ext := filepath.Ext(originalFilename)
+	fileName := uuid.NewString() + ext
+	return s.ObjectName(path.Join(userID.String(), todoID.String(), fileName))
+}
+
+// ObjectName places the key inside the bucket's base directory.
+func (s *s3StorageService) ObjectName(key string) string {
+	return path.Join(s.baseDir, key)
+}
+
+// validObjectName reports whether the storage ID points inside the base directory.
+func (s *s3StorageService) validObjectName(objectName string) bool {
+	if objectName == "" || strings.Contains(objectName, "..") {
+		return false
+	}
+	return s.baseDir == "" || strings.HasPrefix(objectName, s.baseDir+"/")
+}
+
+func (s *s3StorageService) Upload(ctx context.Context, userID, todoID uuid.UUID, originalFilename, contentType string, reader io.Reader, size int64) (string, error) {
+	objectName := s.GenerateUniqueObjectName(userID, todoID, originalFilename)
+	if err := s.Put(ctx, objectName, originalFilename, contentType, reader, size); err != nil {
+		return "", err
+	}
+	return objectName, nil
+}
+
+func (s *s3StorageService) Put(ctx context.Context, objectName, originalFilename, contentType string, reader io.Reader, size int64) error {
+	if !s.validObjectName(objectName) {
+		s.logger.WarnContext(ctx, "Attempted invalid put operation", "storageId", objectName, "baseDir", s.baseDir)
+		return fmt.Errorf("invalid storage ID for upload")
+	}
+
+	s.logger.DebugContext(ctx, "Uploading file to S3", "bucket", s.bucket, "object", objectName, "contentType", contentType, "size", size)
+
+	opts := minio.PutObjectOptions{
+		ContentType:        contentType,
+		ContentDisposition: ContentDisposition(contentType, originalFilename),
+	}
+	if size < 0 {
+		// A size of -1 makes minio-go switch to a streaming multipart upload. Without a part size
+		// it plans parts for a 5 TiB object and buffers ~544 MiB per upload, so pin it.
+		opts.PartSize = s3StreamingPartSize
+	}
+	info, err := s.client.PutObject(ctx, s.bucket, objectName, reader, size, opts)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to upload object to S3", "error", err, "object", objectName)
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	if size >= 0 && info.Size != size {
+		s.logger.WarnContext(ctx, "File size mismatch during S3 upload", "expected", size, "written", info.Size, "object", objectName)
+		_ = s.Delete(context.Background(), objectName) // Use background context for cleanup
+		return fmt.Errorf("file size mismatch during upload")
+	}
+
+	s.logger.InfoContext(ctx, "File uploaded successfully to S3", "object", objectName, "size", info.Size, "contentType", contentType)
+	return nil
+}
+
+func (s *s3StorageService) Delete(ctx context.Context, storageID string) error {
+	objectName := storageID
+	if !s.validObjectName(objectName) {
+		s.logger.WarnContext(ctx, "Attempted invalid delete operation", "storageId", storageID, "baseDir", s.baseDir)
+		return fmt.Errorf("invalid storage ID for deletion")
+	}
+
+	ctxDelete, cancel := context.WithTimeout(ctx, 30*time.Second) // Timeout for delete
+	defer cancel()
+
+	// S3 treats deleting a missing key as success, so no not-found special case is needed
+	if err := s.client.RemoveObject(ctxDelete, s.bucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to delete S3 object", "error", err, "storageId", storageID)
+		return fmt.Errorf("could not delete S3 object: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "S3 object deleted successfully", "storageId", storageID)
+	return nil
+}
+
+func (s *s3StorageService) List(ctx context.Context, fn func(StoredObject) error) error {
+	prefix := ""
+	if s.baseDir != "" {
+		prefix = s.baseDir + "/"
+	}
+	ctxList, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops the listing goroutine if fn returns early
+
+	for obj := range s.client.ListObjects(ctxList, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("failed to list S3 objects: %w", obj.Err)
+		}
+		if err := fn(StoredObject{StorageID: obj.Key, Size: obj.Size, LastModified: obj.LastModified}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *s3StorageService) Stat(ctx context.Context, storageID string) (*StoredObject, error) {
+	if !s.validObjectName(storageID) {
+		return nil, fmt.Errorf("invalid storage ID: %w", domain.ErrBadRequest)
+	}
+	info, err := s.client.StatObject(ctx, s.bucket, storageID, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("could not stat S3 object: %w", err)
+	}
+	return &StoredObject{StorageID: storageID, Size: info.Size, LastModified: info.LastModified}, nil
+}
+
+func (s *s3StorageService) Download(ctx context.Context, storageID string) (io.ReadCloser, error) {
+	if !s.validObjectName(storageID) {
+		return nil, fmt.Errorf("invalid storage ID: %w", domain.ErrBadRequest)
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, storageID, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not read S3 object: %w", err)
+	}
+	// GetObject is lazy; stat it so a missing key fails here rather than on the first Read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("could not read S3 object: %w", err)
+	}
+	return obj, nil
+}
+
+// GetURL generates a presigned GET URL for accessing the private S3 object.
+func (s *s3StorageService) GetURL(ctx context.Context, storageID string) (string, error) {
+	objectName := storageID
+	if !s.validObjectName(objectName) {
+		s.logger.WarnContext(ctx, "Attempted invalid GetURL operation", "storageId", storageID, "baseDir", s.baseDir)
+		return "", fmt.Errorf("invalid storage ID for URL generation")
+	}
+
+	presignedURL, err := s.client.PresignedGetObject(ctx, s.bucket, objectName, s.signedURLExpiry, nil)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to generate presigned URL", "error", err, "object", objectName)
+		return "", fmt.Errorf("could not get presigned URL for object: %w", err)
+	}
+
+	s.logger.DebugContext(ctx, "Generated presigned URL", "object", objectName, "expiry", s.signedURLExpiry)
+	return presignedURL.String(), nil
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+)
+
+// NewAttachmentScanner creates the AttachmentScanner selected by storage.scanner.type.
+// It returns nil for "none", in which case uploads are stored as not_scanned.
+func NewAttachmentScanner(cfg config.ScannerConfig, logger *slog.Logger) (AttachmentScanner, error) {
+	switch cfg.Type {
+	case "", "none":
+		logger.Warn("Malware scanning is disabled; attachments are stored unscanned")
+		return nil, nil
+	case "clamd":
+		return NewClamdScanner(cfg.Clamd, logger)
+	default:
+		return nil, fmt.Errorf("unsupported scanner type '%s'", cfg.Type)
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+)
+
+// smtpSendTimeout bounds one delivery, from dialing to QUIT
+const smtpSendTimeout = 30 * time.Second
+
+// smtpMailer delivers through an SMTP relay, upgrading to TLS with STARTTLS when the server offers it
+type smtpMailer struct {
+	host     string
+	addr     string
+	from     string
+	envelope string // Bare address of from, for MAIL FROM
+	auth     smtp.Auth
+	logger   *slog.Logger
+}
+
+func NewSMTPMailer(cfg config.EmailConfig, logger *slog.Logger) (Mailer, error) {
+	if cfg.SMTP.Host == "" {
+		return nil, fmt.Errorf("email.smtp.host is required for the smtp mailer")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email.from '%s': %w", cfg.From, err)
+	}
+
+	var auth smtp.Auth
+	if cfg.SMTP.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection to anything but localhost
+		auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+
+	addr := net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port))
+	logger.Info("SMTP mailer initialized", "address", addr, "auth", auth != nil)
+	return &smtpMailer{
+		host:     cfg.SMTP.Host,
+		addr:     addr,
+		from:     cfg.From,
+		envelope: from.Address,
+		auth:     auth,
+		logger:   logger.With("service", "smtpMailer"),
+	}, nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *MailMessage) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient '%s': %w", msg.To, err)
+	}
+	data, err := formatMessage(m.from, msg, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to format message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpSendTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if m.auth != nil {
+		if err := c.Auth(m.auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := c.Mail(m.envelope); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send message body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected the message: %w", err)
+	}
+	if err := c.Quit(); err != nil {
+		m.logger.WarnContext(ctx, "SMTP QUIT failed after the message was accepted", "error", err)
+	}
+
+	m.logger.InfoContext(ctx, "Sent email", "to", to.Address, "subject", msg.Subject)
+	return nil
+}
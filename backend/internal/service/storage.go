@@ -0,0 +1,22 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/Sosokker/todolist-backend/internal/config"
+)
+
+// NewFileStorageService creates the FileStorageService selected by storage.type.
+func NewFileStorageService(cfg config.StorageConfig, logger *slog.Logger) (FileStorageService, error) {
+	switch cfg.Type {
+	case "local":
+		return NewLocalStorageService(cfg.Local, logger)
+	case "gcs":
+		return NewGCStorageService(cfg.GCS, logger)
+	case "s3":
+		return NewS3StorageService(cfg.S3, logger)
+	default:
+		return nil, fmt.Errorf("unsupported storage type '%s'", cfg.Type)
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"path"
+	"sync"
+
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/Sosokker/todolist-backend/internal/repository"
+)
+
+var (
+	errSourceMissing   = errors.New("object is missing from both backends")
+	errContentMismatch = errors.New("destination content differs from the source")
+)
+
+type storageMigrator struct {
+	source         FileStorageService
+	destination    FileStorageService
+	attachmentRepo repository.AttachmentRepository
+	logger         *slog.Logger
+}
+
+// NewStorageMigrator creates a migrator that copies attachment files from source to
+// destination. Source objects are never deleted; the reconciler can't see them once the
+// server runs on the destination, so remove the old bucket or directory by hand.
+func NewStorageMigrator(
+	source, destination FileStorageService,
+	attachmentRepo repository.AttachmentRepository,
+) StorageMigrator {
+	return &storageMigrator{
+		source:         source,
+		destination:    destination,
+		attachmentRepo: attachmentRepo,
+		logger:         slog.Default().With("service", "storagemigrator"),
+	}
+}
+
+// fileMigration is the outcome of moving one file
+type fileMigration struct {
+	destination string
+	copied      bool // false when the destination already had it
+	size        int64
+	verified    bool
+}
+
+func (m *storageMigrator) Migrate(ctx context.Context, opts StorageMigrationOptions) (*StorageMigrationReport, error) {
+	report := &StorageMigrationReport{DryRun: opts.DryRun}
+	workers := max(opts.Workers, 1)
+
+	files, err := m.attachmentRepo.ListStoredFiles(ctx)
+	if err != nil {
+		m.logger.ErrorContext(ctx, "Storage migration failed", "error", err)
+		return report, fmt.Errorf("storage migration failed: %w", err)
+	}
+	report.Files = len(files)
+	m.logger.InfoContext(ctx, "Starting storage migration", "files", len(files), "dryRun", opts.DryRun, "verify", opts.Verify, "workers", workers)
+
+	var (
+		mu       sync.Mutex
+		newPaths = make(map[string]string)
+		wg       sync.WaitGroup
+		jobs     = make(chan domain.StoredFile)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				result, err := m.migrateFile(ctx, file, opts)
+
+				mu.Lock()
+				switch {
+				case errors.Is(err, errSourceMissing):
+					report.Missing++
+					m.logger.WarnContext(ctx, "Referenced file is missing from both backends", "storageId", file.StoragePath)
+				case errors.Is(err, errContentMismatch):
+					report.Mismatched++
+					m.logger.ErrorContext(ctx, "Copied file failed verification", "storageId", file.StoragePath)
+				case err != nil:
+					report.Failed++
+					m.logger.ErrorContext(ctx, "Failed to migrate file", "error", err, "storageId", file.StoragePath)
+				default:
+					if result.copied {
+						report.Copied++
+						report.CopiedBytes += result.size
+					} else {
+						report.Present++
+					}
+					if result.verified {
+						report.Verified++
+					}
+					if result.destination != file.StoragePath {
+						newPaths[file.StoragePath] = result.destination
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, file := range files {
+		select {
+		case jobs <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return report, fmt.Errorf("storage migration interrupted: %w", err)
+	}
+	if !opts.DryRun {
+		if report.Failed > 0 || report.Mismatched > 0 {
+			m.logger.ErrorContext(ctx, "Storage migration incomplete, references left unchanged",
+				"failed", report.Failed, "mismatched", report.Mismatched)
+			return report, fmt.Errorf("storage migration incomplete: %d failed, %d mismatched", report.Failed, report.Mismatched)
+		}
+		report.Rewritten, err = m.attachmentRepo.RewriteStoragePaths(ctx, newPaths)
+		if err != nil {
+			m.logger.ErrorContext(ctx, "Failed to rewrite storage references", "error", err)
+			return report, fmt.Errorf("storage migration failed: %w", err)
+		}
+	}
+
+	m.logger.InfoContext(ctx, "Storage migration finished",
+		"dryRun", report.DryRun, "files", report.Files, "copied", report.Copied, "copiedBytes", report.CopiedBytes,
+		"present", report.Present, "verified", report.Verified, "missing", report.Missing, "rewritten", report.Rewritten)
+	return report, nil
+}
+
+// migrateFile makes sure the destination holds the file and reports where
+func (m *storageMigrator) migrateFile(ctx context.Context, file domain.StoredFile, opts StorageMigrationOptions) (*fileMigration, error) {
+	key, ok := attachmentObjectKey(file.StoragePath)
+	if !ok {
+		return nil, fmt.Errorf("storage ID %q is not laid out like an attachment", file.StoragePath)
+	}
+	result := &fileMigration{destination: m.destination.ObjectName(key)}
+
+	src, err := m.source.Stat(ctx, file.StoragePath)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, fmt.Errorf("stat source: %w", err)
+	}
+	existing, err := m.destination.Stat(ctx, result.destination)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, fmt.Errorf("stat destination: %w", err)
+	}
+
+	// expected is the SHA-256 the destination must have; empty when it can't be known
+	var expected string
+	if file.ContentHash != nil {
+		expected = *file.ContentHash
+	}
+
+	switch {
+	case existing != nil && (src == nil || existing.Size == src.Size):
+		// Copied by an earlier run. Without a source the references already point here.
+		result.size = existing.Size
+		if opts.Verify && expected == "" && src != nil {
+			if expected, err = m.hash(ctx, m.source, file.StoragePath); err != nil {
+				return nil, fmt.Errorf("hash source: %w", err)
+			}
+		}
+	case src == nil:
+		return nil, errSourceMissing
+	case opts.DryRun:
+		result.copied, result.size = true, src.Size
+		return result, nil
+	default:
+		sum, err := m.copy(ctx, file, result.destination, src.Size)
+		if err != nil {
+			return nil, err
+		}
+		result.copied, result.size = true, src.Size
+		expected = sum // What was actually read, even if the recorded hash disagrees
+	}
+
+	if opts.Verify && expected != "" {
+		got, err := m.hash(ctx, m.destination, result.destination)
+		if err != nil {
+			return nil, fmt.Errorf("hash destination: %w", err)
+		}
+		if got != expected {
+			if !opts.DryRun {
+				if err := m.destination.Delete(ctx, result.destination); err != nil {
+					m.logger.WarnContext(ctx, "Failed to remove mismatched copy", "error", err, "storageId", result.destination)
+				}
+			}
+			return nil, errContentMismatch
+		}
+		result.verified = true
+	}
+	return result, nil
+}
+
+// copy streams the file from source to destination and returns the SHA-256 of what it read
+func (m *storageMigrator) copy(ctx context.Context, file domain.StoredFile, destination string, size int64) (string, error) {
+	reader, err := m.source.Download(ctx, file.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("read source: %w", err)
+	}
+	defer reader.Close()
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(file.StoragePath))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	hasher := sha256.New()
+	if err := m.destination.Put(ctx, destination, file.FileName, contentType, io.TeeReader(reader, hasher), size); err != nil {
+		return "", fmt.Errorf("write destination: %w", err)
+	}
+	m.logger.DebugContext(ctx, "Copied file", "from", file.StoragePath, "to", destination, "size", size)
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func (m *storageMigrator) hash(ctx context.Context, storage FileStorageService, storageID string) (string, error) {
+	reader, err := storage.Download(ctx, storageID)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
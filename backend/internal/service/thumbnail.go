@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	// Decoders for the formats thumbnails are generated from
+	_ "image/gif"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbnailSmallSize = 64  // Longest side in pixels, for list rows
+	thumbnailLargeSize = 256 // Longest side in pixels, for previews
+
+	// Images above these limits are stored without thumbnails rather than
+	// held in memory and decoded
+	maxThumbnailSourceBytes  = 32 << 20
+	maxThumbnailSourcePixels = 50_000_000
+)
+
+// thumbnailSourceTypes are the sniffed media types thumbnails can be generated for
+var thumbnailSourceTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// thumbnail is an encoded, resized copy of an image attachment
+type thumbnail struct {
+	data        []byte
+	contentType string
+	ext         string
+}
+
+// decodeThumbnailSource decodes an image after checking its dimensions,
+// so a small file that claims huge dimensions is never fully decoded.
+func decodeThumbnailSource(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		return nil, fmt.Errorf("image dimensions %dx%d not supported for thumbnails", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// makeThumbnail scales src so its longest side is at most maxDim, keeping the aspect
+// ratio, then turns it upright for its EXIF orientation. Opaque images become JPEG;
+// anything with transparency stays PNG.
+func makeThumbnail(src image.Image, orientation, maxDim int) (*thumbnail, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxDim || height > maxDim {
+		if width >= height {
+			height = max(1, height*maxDim/width)
+			width = maxDim
+		} else {
+			width = max(1, width*maxDim/height)
+			height = maxDim
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	dst = applyOrientation(dst, orientation) // Cheaper on the scaled copy than on the source
+
+	var buf bytes.Buffer
+	if dst.Opaque() {
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+			return nil, fmt.Errorf("failed to encode JPEG thumbnail: %w", err)
+		}
+		return &thumbnail{data: buf.Bytes(), contentType: "image/jpeg", ext: ".jpg"}, nil
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG thumbnail: %w", err)
+	}
+	return &thumbnail{data: buf.Bytes(), contentType: "image/png", ext: ".png"}, nil
+}
+
+// cappedBuffer keeps a copy of everything written to it up to max bytes.
+// Past that it drops the data and marks itself overflowed instead of failing
+// the write, so it can sit behind an io.TeeReader on the upload stream.
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	max        int
+	overflowed bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflowed {
+		return len(p), nil
+	}
+	if b.buf.Len()+len(p) > b.max {
+		b.overflowed = true
+		b.buf = bytes.Buffer{} // Release what was collected
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -1,13 +1,22 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/Sosokker/todolist-backend/internal/config"
 	"github.com/Sosokker/todolist-backend/internal/domain"
 	"github.com/Sosokker/todolist-backend/internal/repository"
 	"github.com/google/uuid"
@@ -15,24 +24,44 @@ import (
 
 type todoService struct {
 	todoRepo       repository.TodoRepository
+	attachmentRepo repository.AttachmentRepository
+	userRepo       repository.UserRepository
 	tagService     TagService
 	subtaskService SubtaskService
 	storageService FileStorageService
+	scanner        AttachmentScanner // nil when scanning is disabled
+	scanFailOpen   bool
+	stagingDir     string // Uploads are written here and scanned before they're stored; "" is the system temp dir
+	maxUploadSize  int64
+	userQuota      int64
+	contentTypes   *contentTypePolicy
 	logger         *slog.Logger
 }
 
 // NewTodoService creates a new TodoService
 func NewTodoService(
 	todoRepo repository.TodoRepository,
+	attachmentRepo repository.AttachmentRepository,
+	userRepo repository.UserRepository,
 	tagService TagService,
 	subtaskService SubtaskService,
 	storageService FileStorageService,
+	scanner AttachmentScanner,
+	storageCfg config.StorageConfig,
 ) TodoService {
 	return &todoService{
 		todoRepo:       todoRepo,
+		attachmentRepo: attachmentRepo,
+		userRepo:       userRepo,
 		tagService:     tagService,
 		subtaskService: subtaskService,
 		storageService: storageService,
+		scanner:        scanner,
+		scanFailOpen:   storageCfg.Scanner.FailOpen,
+		stagingDir:     storageCfg.StagingPath,
+		maxUploadSize:  storageCfg.MaxUploadSize,
+		userQuota:      storageCfg.UserQuota,
+		contentTypes:   newContentTypePolicy(storageCfg.AllowedContentTypes, storageCfg.DeniedContentTypes),
 		logger:         slog.Default().With("service", "todo"),
 	}
 }
@@ -57,13 +86,12 @@ func (s *todoService) CreateTodo(ctx context.Context, userID uuid.UUID, input Cr
 	}
 
 	newTodo := &domain.Todo{
-		UserID:        userID,
-		Title:         input.Title,
-		Description:   input.Description,
-		Status:        status,
-		Deadline:      input.Deadline,
-		TagIDs:        input.TagIDs,
-		AttachmentUrl: nil, // No attachment on creation
+		UserID:      userID,
+		Title:       input.Title,
+		Description: input.Description,
+		Status:      status,
+		Deadline:    input.Deadline,
+		TagIDs:      input.TagIDs,
 	}
 
 	createdTodo, err := s.todoRepo.Create(ctx, newTodo)
@@ -115,8 +143,12 @@ func (s *todoService) GetTodoByID(ctx context.Context, todoID, userID uuid.UUID)
 		todo.Subtasks = subtasks
 	}
 
-	// Note: todo.Attachments currently holds storage IDs (paths).
-	// The handler will call GetAttachmentURLs to convert these to full URLs for the API response.
+	attachments, err := s.attachmentRepo.ListByTodo(ctx, todoID, userID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to get attachments for todo", "error", err, "todoId", todoID)
+	} else {
+		todo.Attachments = s.toAttachmentInfos(ctx, attachments)
+	}
 
 	return todo, nil
 }
@@ -154,6 +186,26 @@ func (s *todoService) ListUserTodos(ctx context.Context, userID uuid.UUID, input
 	// See todo_repo.go for implementation notes.
 	// This avoids N+1 queries.
 
+	// Attachments are loaded in a single batch query for the whole page
+	if len(todos) > 0 {
+		todoIDs := make([]uuid.UUID, len(todos))
+		for i := range todos {
+			todoIDs[i] = todos[i].ID
+		}
+		attachments, err := s.attachmentRepo.ListByTodoIDs(ctx, todoIDs, userID)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Failed to get attachments for todo list", "error", err, "userId", userID)
+		} else {
+			byTodo := make(map[uuid.UUID][]domain.Attachment, len(todos))
+			for _, a := range attachments {
+				byTodo[a.TodoID] = append(byTodo[a.TodoID], a)
+			}
+			for i := range todos {
+				todos[i].Attachments = s.toAttachmentInfos(ctx, byTodo[todos[i].ID])
+			}
+		}
+	}
+
 	return todos, nil
 }
 
@@ -164,14 +216,13 @@ func (s *todoService) UpdateTodo(ctx context.Context, todoID, userID uuid.UUID,
 	}
 
 	updateData := &domain.Todo{
-		ID:            existingTodo.ID,
-		UserID:        existingTodo.UserID,
-		Title:         existingTodo.Title,
-		Description:   existingTodo.Description,
-		Status:        existingTodo.Status,
-		Deadline:      existingTodo.Deadline,
-		TagIDs:        existingTodo.TagIDs,
-		AttachmentUrl: existingTodo.AttachmentUrl, // Single attachment URL
+		ID:          existingTodo.ID,
+		UserID:      existingTodo.UserID,
+		Title:       existingTodo.Title,
+		Description: existingTodo.Description,
+		Status:      existingTodo.Status,
+		Deadline:    existingTodo.Deadline,
+		TagIDs:      existingTodo.TagIDs,
 	}
 
 	updated := false
@@ -239,16 +290,25 @@ func (s *todoService) UpdateTodo(ctx context.Context, todoID, userID uuid.UUID,
 		return reloadedTodo, nil
 	}
 
+	if attachments, err := s.attachmentRepo.ListByTodo(ctx, todoID, userID); err != nil {
+		s.logger.WarnContext(ctx, "Failed to get attachments for updated todo", "error", err, "todoId", todoID)
+	} else {
+		updatedRepoTodo.Attachments = s.toAttachmentInfos(ctx, attachments)
+	}
+
 	return updatedRepoTodo, nil // Return the result from repo Update or existing if only tags changed
 }
 
 func (s *todoService) DeleteTodo(ctx context.Context, todoID, userID uuid.UUID) error {
-	existingTodo, err := s.todoRepo.GetByID(ctx, todoID, userID)
+	_, err := s.todoRepo.GetByID(ctx, todoID, userID)
 	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			return nil // Already deleted or doesn't exist/belong to user
-		}
-		return err // Internal error
+		return err // domain.ErrNotFound for another user's todo too, so its existence isn't revealed
+	}
+
+	// Collect storage IDs before the rows are removed by ON DELETE CASCADE
+	attachments, err := s.attachmentRepo.ListByTodo(ctx, todoID, userID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to list attachments before todo deletion", "error", err, "todoId", todoID)
 	}
 
 	// Delete the Todo record from the database first
@@ -258,16 +318,9 @@ func (s *todoService) DeleteTodo(ctx context.Context, todoID, userID uuid.UUID)
 		return domain.ErrInternalServer
 	}
 
-	// If there is an attachment, attempt to delete it from storage (best effort)
-	if existingTodo.AttachmentUrl != nil {
-		storageID := *existingTodo.AttachmentUrl
-		deleteCtx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-		defer cancel()
-		if err := s.storageService.Delete(deleteCtx, storageID); err != nil {
-			s.logger.WarnContext(ctx, "Failed to delete attachment file during todo deletion", "error", err, "storageId", storageID, "todoId", todoID)
-		} else {
-			s.logger.InfoContext(ctx, "Deleted attachment file during todo deletion", "storageId", storageID, "todoId", todoID)
-		}
+	// Attempt to delete the attachment files from storage (best effort)
+	for i := range attachments {
+		s.releaseAttachmentFiles(ctx, &attachments[i])
 	}
 
 	s.logger.InfoContext(ctx, "Successfully deleted todo and attempted attachment cleanup", "todoId", todoID, "userId", userID)
@@ -312,48 +365,509 @@ func (s *todoService) DeleteSubtask(ctx context.Context, todoID, subtaskID, user
 	return s.subtaskService.Delete(ctx, subtaskID, userID)
 }
 
-// --- Attachment Methods (Simplified) ---
+// --- Attachment Methods ---
 
-func (s *todoService) AddAttachment(ctx context.Context, todoID, userID uuid.UUID, fileName string, fileSize int64, fileContent io.Reader) (*domain.Todo, error) {
+func (s *todoService) ListAttachments(ctx context.Context, todoID, userID uuid.UUID) ([]domain.AttachmentInfo, error) {
 	_, err := s.todoRepo.GetByID(ctx, todoID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	storageID, _, err := s.storageService.Upload(ctx, userID, todoID, fileName, fileContent, fileSize)
+	attachments, err := s.attachmentRepo.ListByTodo(ctx, todoID, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list attachments from repo", "error", err, "todoId", todoID)
+		return nil, domain.ErrInternalServer
+	}
+	return s.toAttachmentInfos(ctx, attachments), nil
+}
+
+func (s *todoService) GetAttachmentDownloadURL(ctx context.Context, attachmentID, userID uuid.UUID) (string, error) {
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", domain.ErrNotFound
+		}
+		s.logger.ErrorContext(ctx, "Failed to get attachment", "error", err, "attachmentId", attachmentID)
+		return "", domain.ErrInternalServer
+	}
+
+	fileURL, err := s.attachmentFileURL(ctx, attachment.StoragePath, attachment.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to generate URL for attachment", "error", err, "attachmentId", attachmentID, "storageId", attachment.StoragePath)
+		return "", domain.ErrInternalServer
+	}
+	return fileURL, nil
+}
+
+// attachmentFileURL resolves the URL of one of an attachment's files. Attachments sharing
+// a blob share its paths, so URLs served by DownloadLocalFile also name the attachment.
+func (s *todoService) attachmentFileURL(ctx context.Context, storageID string, attachmentID uuid.UUID) (string, error) {
+	fileURL, err := s.storageService.GetURL(ctx, storageID)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := s.storageService.(LocalFileServer); ok {
+		fileURL += "?" + url.Values{"attachment": {attachmentID.String()}}.Encode()
+	}
+	return fileURL, nil
+}
+
+// GetAttachmentByStorageID finds the attachment stored under storageID, scoped to the user.
+// attachmentID picks one of several attachments sharing the file; without it the oldest wins.
+// For a thumbnail's storage ID the result describes the thumbnail file itself.
+func (s *todoService) GetAttachmentByStorageID(ctx context.Context, userID uuid.UUID, storageID string, attachmentID *uuid.UUID) (*domain.Attachment, error) {
+	var attachment *domain.Attachment
+	var err error
+	if attachmentID != nil {
+		attachment, err = s.attachmentRepo.GetByID(ctx, *attachmentID, userID)
+		if err == nil && !attachment.References(storageID) {
+			err = domain.ErrNotFound
+		}
+	} else {
+		attachment, err = s.attachmentRepo.GetByStoragePath(ctx, storageID, userID)
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrNotFound
+		}
+		s.logger.ErrorContext(ctx, "Failed to get attachment by storage ID", "error", err, "storageId", storageID)
+		return nil, domain.ErrInternalServer
+	}
+	if attachment.StoragePath != storageID {
+		// Thumbnails are generated by us as JPEG or PNG, so the extension can be trusted
+		thumb := *attachment
+		thumb.StoragePath = storageID
+		thumb.ContentType = "image/jpeg"
+		if filepath.Ext(storageID) == ".png" {
+			thumb.ContentType = "image/png"
+		}
+		thumb.FileName = strings.TrimSuffix(attachment.FileName, filepath.Ext(attachment.FileName)) + "_thumbnail" + filepath.Ext(storageID)
+		thumb.ThumbnailSmallPath, thumb.ThumbnailLargePath = nil, nil
+		return &thumb, nil
+	}
+	return attachment, nil
+}
+
+func (s *todoService) StorageUsage(ctx context.Context, userID uuid.UUID) (*domain.StorageUsage, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrUnauthorized
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for storage usage", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	used, err := s.attachmentRepo.TotalSizeByUser(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to get storage usage", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+
+	usage := &domain.StorageUsage{Used: used, MaxUploadSize: s.maxUploadSize}
+	if user.MaxUploadSize != nil {
+		usage.MaxUploadSize = *user.MaxUploadSize
+	}
+	quota := s.userQuota
+	if user.StorageQuota != nil {
+		quota = *user.StorageQuota
+	}
+	if quota > 0 {
+		usage.Quota = &quota
+	}
+	return usage, nil
+}
+
+// uploadAllowance returns the user's usage and the most the next upload may be.
+// That's the per-attachment limit only: content the user already stores doesn't count
+// against the quota again, so the quota is checked once the upload has been hashed.
+func (s *todoService) uploadAllowance(ctx context.Context, userID uuid.UUID) (*domain.StorageUsage, int64, error) {
+	usage, err := s.StorageUsage(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	limit := usage.MaxUploadSize
+	if limit <= 0 {
+		return usage, 0, limitExceeded(limit)
+	}
+	return usage, limit, nil
+}
+
+// limitExceeded explains that an upload ran into the per-attachment limit
+func limitExceeded(limit int64) error {
+	return fmt.Errorf("attachment exceeds the %d byte upload limit: %w", limit, domain.ErrTooLarge)
+}
+
+// quotaExceeded explains that an upload would take the user past their storage quota
+func quotaExceeded(usage *domain.StorageUsage) error {
+	return fmt.Errorf("attachment would exceed the %d byte storage quota (%d bytes used): %w", *usage.Quota, usage.Used, domain.ErrTooLarge)
+}
+
+func (s *todoService) UploadLimit(ctx context.Context, userID uuid.UUID) (int64, error) {
+	_, limit, err := s.uploadAllowance(ctx, userID)
+	return limit, err
+}
+
+func (s *todoService) AddAttachment(ctx context.Context, todoID, userID uuid.UUID, fileName string, fileContent io.Reader) (*domain.AttachmentInfo, error) {
+	_, err := s.todoRepo.GetByID(ctx, todoID, userID)
 	if err != nil {
-		s.logger.ErrorContext(ctx, "Failed to upload attachment", "error", err, "todoId", todoID)
 		return nil, err
 	}
 
-	// Construct the public URL for the uploaded file in GCS
-	publicURL, err := s.storageService.GetURL(ctx, storageID)
+	// Checked before anything is staged; the stream is cut off past the per-attachment limit
+	usage, limit, err := s.uploadAllowance(ctx, userID)
 	if err != nil {
-		s.logger.ErrorContext(ctx, "Failed to generate public URL for attachment", "error", err, "todoId", todoID, "storageId", storageID)
+		s.logger.WarnContext(ctx, "Attachment rejected by upload limit", "error", err, "todoId", todoID)
 		return nil, err
 	}
 
-	if err := s.todoRepo.UpdateAttachmentURL(ctx, todoID, userID, &publicURL); err != nil {
-		s.logger.ErrorContext(ctx, "Failed to update attachment URL in repo", "error", err, "todoId", todoID)
+	// The size isn't known until the stream ends, so count while uploading and cut off past the limit
+	reader := &sizeLimitedReader{r: fileContent, limit: limit}
+
+	// Decide the type from the content itself; the file name is client-controlled
+	head := make([]byte, sniffLen)
+	headLen, err := io.ReadFull(reader, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		if reader.exceeded {
+			return nil, limitExceeded(limit)
+		}
+		s.logger.ErrorContext(ctx, "Failed to read attachment", "error", err, "todoId", todoID)
+		return nil, fmt.Errorf("failed to read attachment: %w", domain.ErrBadRequest)
+	}
+	head = head[:headLen]
+	contentType := sniffContentType(head)
+	if err := s.contentTypes.Check(contentType); err != nil {
+		s.logger.WarnContext(ctx, "Rejected attachment content type", "todoId", todoID, "fileName", fileName, "contentType", contentType)
 		return nil, err
 	}
 
-	s.logger.InfoContext(ctx, "Attachment added successfully", "todoId", todoID, "storageId", storageID)
+	// Stage the file before anything reaches storage, so it can be scanned first
+	staged, err := os.CreateTemp(s.stagingDir, "attachment-*"+stagedFileExt)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to create staging file for attachment", "error", err, "todoId", todoID)
+		return nil, domain.ErrInternalServer
+	}
+	defer func() {
+		staged.Close()
+		if err := os.Remove(staged.Name()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logger.WarnContext(ctx, "Failed to remove staged attachment", "error", err, "path", staged.Name())
+		}
+	}()
 
-	return s.GetTodoByID(ctx, todoID, userID)
+	// Hash while staging so identical files can share one stored blob
+	hasher := sha256.New()
+	var body io.Reader = io.TeeReader(io.MultiReader(bytes.NewReader(head), reader), hasher)
+	// Keep a copy of small enough images while they stream past, for thumbnails
+	var thumbSource *cappedBuffer
+	if thumbnailSourceTypes[contentType] {
+		thumbSource = &cappedBuffer{max: maxThumbnailSourceBytes}
+		body = io.TeeReader(body, thumbSource)
+	}
+
+	_, err = io.Copy(staged, body)
+	if reader.exceeded {
+		s.logger.WarnContext(ctx, "Attachment exceeds upload limit", "todoId", todoID, "limit", limit)
+		return nil, limitExceeded(limit)
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to stage attachment", "error", err, "todoId", todoID)
+		return nil, fmt.Errorf("failed to read attachment: %w", domain.ErrBadRequest)
+	}
+	fileSize := reader.n
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+
+	// Content the user already has an attachment for is charged once, so it never takes them over quota
+	charged := true
+	if usage.Quota != nil {
+		referenced, err := s.attachmentRepo.ReferencesBlob(ctx, userID, contentHash)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to check attachment blob references", "error", err, "todoId", todoID)
+			return nil, domain.ErrInternalServer
+		}
+		charged = !referenced
+		if charged && usage.Used+fileSize > *usage.Quota {
+			s.logger.WarnContext(ctx, "Attachment exceeds storage quota", "todoId", todoID, "quota", *usage.Quota, "used", usage.Used, "size", fileSize)
+			return nil, quotaExceeded(usage)
+		}
+	}
+
+	// The verdict decides whether the file is stored at all
+	scanStatus, scannedAt := domain.ScanStatusNotScanned, (*time.Time)(nil)
+	if s.scanner != nil {
+		scanResult, scanErr := s.scanStaged(ctx, staged)
+		switch {
+		case scanErr != nil && !s.scanFailOpen:
+			s.logger.ErrorContext(ctx, "Malware scan failed, rejecting attachment", "error", scanErr, "todoId", todoID)
+			return nil, domain.ErrInternalServer
+		case scanErr != nil:
+			s.logger.WarnContext(ctx, "Malware scan failed, storing attachment unscanned", "error", scanErr, "todoId", todoID)
+			scanStatus = domain.ScanStatusFailed
+		case scanResult.Infected:
+			s.logger.WarnContext(ctx, "Rejected infected attachment", "todoId", todoID, "userId", userID, "fileName", fileName, "signature", scanResult.Signature)
+			return nil, fmt.Errorf("%s contains malware (%s): %w", fileName, scanResult.Signature, domain.ErrInfected)
+		default:
+			now := time.Now()
+			scanStatus, scannedAt = domain.ScanStatusClean, &now
+		}
+	}
+
+	newAttachment := &domain.Attachment{
+		TodoID:      todoID,
+		UserID:      userID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        fileSize,
+		ScanStatus:  scanStatus,
+		ScannedAt:   scannedAt,
+	}
+	newAttachment.ContentHash = &contentHash
+
+	// Content that's already stored, whoever uploaded it, is shared instead of stored again
+	attachment, err := s.shareStoredBlob(ctx, newAttachment, usage, charged)
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil {
+		if attachment, err = s.storeAttachment(ctx, newAttachment, staged, thumbSource, usage, charged); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Attachment added successfully", "todoId", todoID, "attachmentId", attachment.ID, "storageId", attachment.StoragePath)
+
+	info := s.toAttachmentInfo(ctx, attachment)
+	return &info, nil
 }
 
-func (s *todoService) DeleteAttachment(ctx context.Context, todoID, userID uuid.UUID) error {
-	_, err := s.todoRepo.GetByID(ctx, todoID, userID)
+// shareStoredBlob creates the attachment on the files of an already stored blob with the same
+// content. It returns nil when there's no such blob, or it was released before it could be shared.
+func (s *todoService) shareStoredBlob(ctx context.Context, newAttachment *domain.Attachment, usage *domain.StorageUsage, charged bool) (*domain.Attachment, error) {
+	if _, err := s.attachmentRepo.GetBlob(ctx, *newAttachment.ContentHash); err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			s.logger.WarnContext(ctx, "Failed to look up attachment blob", "error", err, "todoId", newAttachment.TodoID)
+		}
+		return nil, nil
+	}
+	if err := s.recheckQuota(ctx, newAttachment, usage, charged); err != nil {
+		return nil, err
+	}
+
+	attachment, err := s.attachmentRepo.ShareBlob(ctx, newAttachment)
 	if err != nil {
-		return err
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil
+		}
+		s.logger.ErrorContext(ctx, "Failed to create attachment in repo", "error", err, "todoId", newAttachment.TodoID)
+		return nil, domain.ErrInternalServer
 	}
+	s.logger.InfoContext(ctx, "Attachment shares stored blob", "todoId", newAttachment.TodoID, "attachmentId", attachment.ID, "storageId", attachment.StoragePath, "contentHash", *newAttachment.ContentHash)
+	return attachment, nil
+}
+
+// storeAttachment uploads the staged file and its thumbnails and creates the attachment on them
+func (s *todoService) storeAttachment(ctx context.Context, newAttachment *domain.Attachment, staged *os.File, thumbSource *cappedBuffer, usage *domain.StorageUsage, charged bool) (*domain.Attachment, error) {
+	userID, todoID := newAttachment.UserID, newAttachment.TodoID
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to rewind staged attachment", "error", err, "todoId", todoID)
+		return nil, domain.ErrInternalServer
+	}
+	storageID, err := s.storageService.Upload(ctx, userID, todoID, newAttachment.FileName, newAttachment.ContentType, staged, newAttachment.Size)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to upload attachment", "error", err, "todoId", todoID)
+		return nil, err
+	}
+	newAttachment.StoragePath = storageID
+
+	if err := s.recheckQuota(ctx, newAttachment, usage, charged); err != nil {
+		s.deleteStoredFile(ctx, storageID, todoID)
+		return nil, err
+	}
+
+	if thumbSource != nil && !thumbSource.overflowed {
+		newAttachment.ThumbnailSmallPath, newAttachment.ThumbnailLargePath = s.storeThumbnails(ctx, userID, todoID, newAttachment.FileName, thumbSource.buf.Bytes())
+	}
+
+	attachment, err := s.attachmentRepo.Create(ctx, newAttachment)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to create attachment in repo", "error", err, "todoId", todoID, "storageId", storageID)
+		s.deleteAttachmentFiles(ctx, newAttachment) // Don't leave unreferenced files behind
+		return nil, domain.ErrInternalServer
+	}
+
+	// The same content was stored concurrently and won; drop the copy just uploaded
+	if attachment.StoragePath != storageID {
+		s.deleteAttachmentFiles(ctx, newAttachment)
+		s.logger.InfoContext(ctx, "Attachment deduplicated against stored blob", "todoId", todoID, "attachmentId", attachment.ID, "storageId", attachment.StoragePath, "contentHash", *newAttachment.ContentHash)
+	}
+	return attachment, nil
+}
+
+// recheckQuota recounts the user's usage right before the attachment is created. Concurrent
+// uploads were each checked against the same usage, this keeps them from overshooting together.
+func (s *todoService) recheckQuota(ctx context.Context, newAttachment *domain.Attachment, usage *domain.StorageUsage, charged bool) error {
+	if usage.Quota == nil || !charged {
+		return nil
+	}
+	used, err := s.attachmentRepo.TotalSizeByUser(ctx, newAttachment.UserID)
+	if err == nil && used+newAttachment.Size > *usage.Quota {
+		s.logger.WarnContext(ctx, "Attachment exceeds storage quota after concurrent uploads", "todoId", newAttachment.TodoID, "quota", *usage.Quota, "used", used)
+		return quotaExceeded(&domain.StorageUsage{Used: used, Quota: usage.Quota, MaxUploadSize: usage.MaxUploadSize})
+	}
+	return nil
+}
+
+// scanStaged runs the malware scanner over the staged file from the start
+func (s *todoService) scanStaged(ctx context.Context, staged *os.File) (*domain.ScanResult, error) {
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind staged attachment: %w", err)
+	}
+	return s.scanner.Scan(ctx, staged)
+}
 
-	if err := s.todoRepo.UpdateAttachmentURL(ctx, todoID, userID, nil); err != nil {
-		s.logger.ErrorContext(ctx, "Failed to update attachment URL in repo", "error", err, "todoId", todoID)
+func (s *todoService) DeleteAttachment(ctx context.Context, todoID, attachmentID, userID uuid.UUID) error {
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID, userID)
+	if err != nil {
 		return err
 	}
+	if attachment.TodoID != todoID {
+		return domain.ErrNotFound
+	}
 
-	s.logger.InfoContext(ctx, "Attachment deleted successfully", "todoId", todoID)
+	if err := s.attachmentRepo.Delete(ctx, attachmentID, userID); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to delete attachment from repo", "error", err, "attachmentId", attachmentID)
+		return domain.ErrInternalServer
+	}
+
+	s.releaseAttachmentFiles(ctx, attachment)
+
+	s.logger.InfoContext(ctx, "Attachment deleted successfully", "todoId", todoID, "attachmentId", attachmentID)
 	return nil
 }
+
+// toAttachmentInfo resolves the download URL for an attachment. A URL failure is logged
+// and leaves FileURL empty so one bad object doesn't fail the whole response.
+func (s *todoService) toAttachmentInfo(ctx context.Context, attachment *domain.Attachment) domain.AttachmentInfo {
+	fileURL, err := s.attachmentFileURL(ctx, attachment.StoragePath, attachment.ID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to generate URL for attachment", "error", err, "attachmentId", attachment.ID, "storageId", attachment.StoragePath)
+	}
+	return domain.AttachmentInfo{
+		FileID:      attachment.ID,
+		FileName:    attachment.FileName,
+		FileURL:     fileURL,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		UploadedAt:  attachment.UploadedAt,
+
+		ThumbnailSmallURL: s.thumbnailURL(ctx, attachment.ThumbnailSmallPath, attachment.ID),
+		ThumbnailLargeURL: s.thumbnailURL(ctx, attachment.ThumbnailLargePath, attachment.ID),
+
+		ScanStatus: attachment.ScanStatus,
+	}
+}
+
+func (s *todoService) thumbnailURL(ctx context.Context, storageID *string, attachmentID uuid.UUID) *string {
+	if storageID == nil {
+		return nil
+	}
+	thumbURL, err := s.attachmentFileURL(ctx, *storageID, attachmentID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to generate URL for thumbnail", "error", err, "storageId", *storageID)
+		return nil
+	}
+	return &thumbURL
+}
+
+// storeThumbnails generates and uploads the small and large previews of an image.
+// Thumbnails are optional, so failures are logged and the affected path is left nil.
+func (s *todoService) storeThumbnails(ctx context.Context, userID, todoID uuid.UUID, fileName string, data []byte) (small, large *string) {
+	img, err := decodeThumbnailSource(data)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Skipping thumbnails for attachment", "error", err, "todoId", todoID, "fileName", fileName)
+		return nil, nil
+	}
+	orientation := jpegOrientation(data) // Phone photos are usually stored sideways
+
+	store := func(maxDim int) *string {
+		thumb, err := makeThumbnail(img, orientation, maxDim)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Failed to generate thumbnail", "error", err, "todoId", todoID, "size", maxDim)
+			return nil
+		}
+		thumbName := fmt.Sprintf("%s_%d%s", strings.TrimSuffix(fileName, filepath.Ext(fileName)), maxDim, thumb.ext)
+		storageID, err := s.storageService.Upload(ctx, userID, todoID, thumbName, thumb.contentType, bytes.NewReader(thumb.data), int64(len(thumb.data)))
+		if err != nil {
+			s.logger.WarnContext(ctx, "Failed to upload thumbnail", "error", err, "todoId", todoID, "size", maxDim)
+			return nil
+		}
+		return &storageID
+	}
+	return store(thumbnailSmallSize), store(thumbnailLargeSize)
+}
+
+// deleteAttachmentFiles removes an attachment's file and thumbnails from storage
+func (s *todoService) deleteAttachmentFiles(ctx context.Context, attachment *domain.Attachment) {
+	s.deleteStoredFile(ctx, attachment.StoragePath, attachment.TodoID)
+	for _, thumb := range []*string{attachment.ThumbnailSmallPath, attachment.ThumbnailLargePath} {
+		if thumb != nil {
+			s.deleteStoredFile(ctx, *thumb, attachment.TodoID)
+		}
+	}
+}
+
+// releaseAttachmentFiles removes the files of an attachment whose row is already gone.
+// Deduplicated files are kept until the last attachment sharing them is deleted.
+func (s *todoService) releaseAttachmentFiles(ctx context.Context, attachment *domain.Attachment) {
+	if attachment.ContentHash == nil {
+		s.deleteAttachmentFiles(ctx, attachment)
+		return
+	}
+	blob, err := s.attachmentRepo.ReleaseBlob(ctx, *attachment.ContentHash)
+	if err != nil {
+		// Left at zero references, the reconciler removes it later
+		s.logger.WarnContext(ctx, "Failed to release attachment blob", "error", err, "attachmentId", attachment.ID, "contentHash", *attachment.ContentHash)
+		return
+	}
+	if blob == nil {
+		s.logger.DebugContext(ctx, "Attachment blob still referenced", "attachmentId", attachment.ID, "contentHash", *attachment.ContentHash)
+		return
+	}
+	s.deleteAttachmentFiles(ctx, attachment) // Same paths as the blob
+}
+
+func (s *todoService) toAttachmentInfos(ctx context.Context, attachments []domain.Attachment) []domain.AttachmentInfo {
+	infos := make([]domain.AttachmentInfo, len(attachments))
+	for i := range attachments {
+		infos[i] = s.toAttachmentInfo(ctx, &attachments[i])
+	}
+	return infos
+}
+
+// sizeLimitedReader counts the bytes read and fails once more than limit have been read
+type sizeLimitedReader struct {
+	r        io.Reader
+	limit    int64
+	n        int64
+	exceeded bool
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		l.exceeded = true
+		return n, domain.ErrTooLarge
+	}
+	return n, err
+}
+
+// deleteStoredFile removes a file from storage, logging instead of failing since the
+// database row is the source of truth.
+func (s *todoService) deleteStoredFile(ctx context.Context, storageID string, todoID uuid.UUID) {
+	deleteCtx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	if err := s.storageService.Delete(deleteCtx, storageID); err != nil {
+		s.logger.WarnContext(ctx, "Failed to delete attachment file", "error", err, "storageId", storageID, "todoId", todoID)
+	} else {
+		s.logger.InfoContext(ctx, "Deleted attachment file", "storageId", storageID, "todoId", todoID)
+	}
+}
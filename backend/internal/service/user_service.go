@@ -45,7 +45,8 @@ func (s *userService) UpdateUser(ctx context.Context, userID uuid.UUID, input Up
 
 	// Prepare update data DTO for the repository
 	updateData := &domain.User{
-		// Copy non-updatable fields or handle defaults
+		// The repository always writes EmailVerified, so carry it over
+		EmailVerified: existingUser.EmailVerified,
 	}
 	needsUpdate := false
 
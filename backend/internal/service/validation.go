@@ -4,20 +4,24 @@ import (
 	"fmt"
 	"net/mail"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Sosokker/todolist-backend/internal/domain"
 )
 
 const (
-	MinUsernameLength    = 3
-	MaxUsernameLength    = 50
-	MinPasswordLength    = 6
-	MinTagNameLength     = 1
-	MaxTagNameLength     = 50
-	MaxTagIconLength     = 30
-	MinTodoTitleLength   = 1
-	MinSubtaskDescLength = 1
+	MinUsernameLength     = 3
+	MaxUsernameLength     = 50
+	MinPasswordLength     = 6
+	MinTagNameLength      = 1
+	MaxTagNameLength      = 50
+	MaxTagIconLength      = 30
+	MinTodoTitleLength    = 1
+	MinSubtaskDescLength  = 1
+	MaxAPITokenNameLength = 100
 )
 
 // Regex for simple hex color validation (#RRGGBB)
@@ -125,6 +129,34 @@ func ValidateUpdateTagInput(input UpdateTagInput) error {
 	return nil
 }
 
+// ValidateCreateAPITokenInput validates input for creating an API token. It returns the trimmed
+// name and the scopes without duplicates, in the order of domain.APIScopes.
+func ValidateCreateAPITokenInput(input CreateAPITokenInput, now time.Time) (string, []string, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > MaxAPITokenNameLength {
+		return "", nil, fmt.Errorf("token name must be between 1 and %d characters: %w", MaxAPITokenNameLength, domain.ErrValidation)
+	}
+	if len(input.Scopes) == 0 {
+		return "", nil, fmt.Errorf("token needs at least one scope: %w", domain.ErrValidation)
+	}
+	for _, scope := range input.Scopes {
+		if !slices.Contains(domain.APIScopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope %q, valid scopes are %s: %w", scope, strings.Join(domain.APIScopes, ", "), domain.ErrValidation)
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(now) {
+		return "", nil, fmt.Errorf("token expiry must be in the future: %w", domain.ErrValidation)
+	}
+
+	var scopes []string
+	for _, scope := range domain.APIScopes {
+		if slices.Contains(input.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return name, scopes, nil
+}
+
 // ValidateTodoTitle checks title constraints.
 func ValidateTodoTitle(title string) error {
 	if len(strings.TrimSpace(title)) < MinTodoTitleLength {
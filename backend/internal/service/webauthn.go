@@ -0,0 +1,264 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sosokker/todolist-backend/internal/auth"
+	"github.com/Sosokker/todolist-backend/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPasskeyName   = "Passkey"
+	maxPasskeyNameLength = 100
+)
+
+// Passkey ceremonies keep no server-side state between begin and finish. The challenge travels
+// in a short-lived signed token instead, which is revoked by jti once it has been used.
+
+func (s *authService) BeginWebAuthnRegistration(ctx context.Context, userID uuid.UUID) (*WebAuthnCreationOptions, string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, "", err
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for passkey registration", "error", err, "userId", userID)
+		return nil, "", domain.ErrInternalServer
+	}
+	existing, err := s.webauthnRepo.ListByUser(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list passkeys", "error", err, "userId", userID)
+		return nil, "", domain.ErrInternalServer
+	}
+
+	challenge, token, err := s.newWebAuthnSession(user, auth.PurposeWebAuthnRegister)
+	if err != nil {
+		return nil, "", err
+	}
+	exclude := make([][]byte, len(existing))
+	for i, cred := range existing {
+		exclude[i] = cred.CredentialID
+	}
+	return &WebAuthnCreationOptions{
+		Challenge:          challenge,
+		RPID:               s.cfg.WebAuthn.RPID,
+		RPName:             s.cfg.WebAuthn.RPName,
+		UserHandle:         user.ID[:],
+		UserName:           user.Email,
+		UserDisplayName:    user.Username,
+		Algorithms:         auth.WebAuthnAlgorithms,
+		ExcludeCredentials: exclude,
+		UserVerification:   s.cfg.WebAuthn.UserVerification,
+		Timeout:            s.cfg.WebAuthn.Timeout,
+	}, token, nil
+}
+
+func (s *authService) FinishWebAuthnRegistration(
+	ctx context.Context,
+	userID uuid.UUID,
+	sessionToken string,
+	attestation WebAuthnAttestation,
+) (*domain.WebAuthnCredential, error) {
+	name := strings.TrimSpace(attestation.Name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	if len(name) > maxPasskeyNameLength {
+		return nil, fmt.Errorf("passkey name must be at most %d characters: %w", maxPasskeyNameLength, domain.ErrValidation)
+	}
+
+	claims, err := s.parseJWT(sessionToken, auth.PurposeWebAuthnRegister)
+	if err != nil || claims.UserID != userID {
+		return nil, fmt.Errorf("passkey registration has expired, start over: %w", domain.ErrUnauthorized)
+	}
+	user, err := s.userForClaims(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(claims.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registration session: %w", domain.ErrUnauthorized)
+	}
+
+	verified, err := s.relyingParty.VerifyRegistration(challenge, attestation.ClientDataJSON, attestation.AttestationObject)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Passkey registration rejected", "error", err, "userId", user.ID)
+		return nil, fmt.Errorf("%v: %w", err, domain.ErrBadRequest)
+	}
+	if err := s.revokeClaims(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	cred, err := s.webauthnRepo.Create(ctx, &domain.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: verified.ID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    verified.SignCount,
+		Name:         name,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) || errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		s.logger.ErrorContext(ctx, "Failed to store passkey", "error", err, "userId", user.ID)
+		return nil, domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Passkey registered", "userId", user.ID, "passkeyId", cred.ID)
+	return cred, nil
+}
+
+func (s *authService) BeginWebAuthnLogin(ctx context.Context) (*WebAuthnRequestOptions, string, error) {
+	challenge, token, err := s.newWebAuthnSession(nil, auth.PurposeWebAuthnLogin)
+	if err != nil {
+		return nil, "", err
+	}
+	return &WebAuthnRequestOptions{
+		Challenge:        challenge,
+		RPID:             s.cfg.WebAuthn.RPID,
+		UserVerification: s.cfg.WebAuthn.UserVerification,
+		Timeout:          s.cfg.WebAuthn.Timeout,
+	}, token, nil
+}
+
+func (s *authService) FinishWebAuthnLogin(
+	ctx context.Context,
+	sessionToken string,
+	assertion WebAuthnAssertion,
+) (*AuthTokens, *MFAChallenge, error) {
+	claims, err := s.parseJWT(sessionToken, auth.PurposeWebAuthnLogin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("passkey login has expired, start over: %w", domain.ErrUnauthorized)
+	}
+	if err := s.checkNotRevoked(ctx, claims); err != nil {
+		return nil, nil, err
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(claims.Challenge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid login session: %w", domain.ErrUnauthorized)
+	}
+
+	cred, err := s.webauthnRepo.GetByCredentialID(ctx, assertion.CredentialID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil, fmt.Errorf("passkey is not registered: %w", domain.ErrUnauthorized)
+		}
+		s.logger.ErrorContext(ctx, "Failed to get passkey", "error", err)
+		return nil, nil, domain.ErrInternalServer
+	}
+	if len(assertion.UserHandle) > 0 && !bytes.Equal(assertion.UserHandle, cred.UserID[:]) {
+		return nil, nil, fmt.Errorf("passkey belongs to another user: %w", domain.ErrUnauthorized)
+	}
+
+	signCount, userVerified, err := s.relyingParty.VerifyAssertion(
+		challenge, cred.PublicKey, assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature,
+	)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Passkey login rejected", "error", err, "userId", cred.UserID, "passkeyId", cred.ID)
+		return nil, nil, fmt.Errorf("passkey verification failed: %w", domain.ErrUnauthorized)
+	}
+	if !auth.SignCountAdvanced(cred.SignCount, signCount) {
+		s.logger.WarnContext(ctx, "Passkey signature counter went backwards, possible cloned authenticator",
+			"userId", cred.UserID, "passkeyId", cred.ID, "stored", cred.SignCount, "received", signCount)
+		return nil, nil, fmt.Errorf("passkey verification failed: %w", domain.ErrUnauthorized)
+	}
+
+	// The session has no user until now; revocations are recorded against the passkey's owner
+	claims.UserID = cred.UserID
+	if err := s.revokeClaims(ctx, claims); err != nil {
+		return nil, nil, err
+	}
+	if err := s.webauthnRepo.UpdateUsage(ctx, cred.ID, signCount); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record passkey use", "error", err, "passkeyId", cred.ID)
+		return nil, nil, domain.ErrInternalServer
+	}
+
+	user, err := s.userRepo.GetByID(ctx, cred.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil, fmt.Errorf("passkey is not registered: %w", domain.ErrUnauthorized)
+		}
+		s.logger.ErrorContext(ctx, "Failed to get user for passkey login", "error", err, "userId", cred.UserID)
+		return nil, nil, domain.ErrInternalServer
+	}
+
+	// A verified passkey is two factors in itself: something held and a PIN or biometric
+	if !userVerified {
+		mfaEnabled, err := s.mfa.Enabled(ctx, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if mfaEnabled {
+			challenge, err := s.newMFAChallenge(user)
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, challenge, nil
+		}
+	}
+
+	tokens, err := s.issueTokens(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, nil, nil
+}
+
+func (s *authService) ListWebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error) {
+	creds, err := s.webauthnRepo.ListByUser(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list passkeys", "error", err, "userId", userID)
+		return nil, domain.ErrInternalServer
+	}
+	return creds, nil
+}
+
+func (s *authService) DeleteWebAuthnCredential(ctx context.Context, userID, id uuid.UUID) error {
+	if err := s.webauthnRepo.Delete(ctx, id, userID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		s.logger.ErrorContext(ctx, "Failed to delete passkey", "error", err, "userId", userID, "passkeyId", id)
+		return domain.ErrInternalServer
+	}
+	s.logger.InfoContext(ctx, "Passkey removed", "userId", userID, "passkeyId", id)
+	return nil
+}
+
+// newWebAuthnSession returns a fresh challenge and the token carrying it to the finish step.
+// A registration session belongs to user and carries the token version, so logging out
+// everywhere cancels it; a login session has no user yet.
+func (s *authService) newWebAuthnSession(user *domain.User, purpose string) ([]byte, string, error) {
+	challenge, err := auth.NewWebAuthnChallenge()
+	if err != nil {
+		s.logger.Error("Failed to generate WebAuthn challenge", "error", err)
+		return nil, "", domain.ErrInternalServer
+	}
+
+	now := time.Now()
+	claims := &auth.Claims{
+		Purpose:   purpose,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.WebAuthn.Timeout)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if user != nil {
+		claims.UserID = user.ID
+		claims.TokenVersion = user.TokenVersion
+		claims.Subject = user.ID.String()
+	}
+	token, err := s.signJWT(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return challenge, token, nil
+}
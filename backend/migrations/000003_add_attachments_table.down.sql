@@ -0,0 +1,6 @@
+-- backend/migrations/000003_add_attachments_table.down.sql
+-- Restore the single URL column (previous attachment rows are lost)
+ALTER TABLE todos
+ADD COLUMN attachment_url TEXT NULL;
+
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,45 @@
+-- backend/migrations/000003_add_attachments_table.up.sql
+-- Bring back the attachments metadata table so a todo can hold several attachments
+CREATE TABLE attachments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    todo_id UUID NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- Lets ownership checks skip the join on todos
+    file_name VARCHAR(255) NOT NULL,
+    storage_path VARCHAR(512) NOT NULL, -- Storage ID returned by FileStorageService.Upload
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    uploaded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_attachments_todo_id ON attachments(todo_id);
+CREATE INDEX idx_attachments_user_id ON attachments(user_id);
+
+-- attachment_url holds V4 signed URLs whose path still names the object, either
+-- https://storage.googleapis.com/<bucket>/<object> or https://<bucket>.<host>/<object>,
+-- where <object> is <baseDir>/<user_uuid>/<todo_uuid>/<file_uuid>.<ext>. Recover the
+-- object name so existing attachments keep their rows (and aren't reconciled away as
+-- orphans). The original file name, type and size were never stored.
+WITH legacy AS (
+    SELECT
+        id AS todo_id,
+        user_id,
+        regexp_replace(
+            split_part(split_part(attachment_url, '?', 1), '#', 1),
+            '^https?://storage\.googleapis\.com/[^/]+/|^https?://[^/]+/',
+            ''
+        ) AS storage_path
+    FROM todos
+    WHERE attachment_url IS NOT NULL
+)
+INSERT INTO attachments (todo_id, user_id, file_name, storage_path, content_type, size)
+SELECT
+    todo_id,
+    user_id,
+    regexp_replace(storage_path, '^.*/', ''),
+    storage_path,
+    'application/octet-stream',
+    0
+FROM legacy
+-- Only paths laid out by GenerateUniqueObjectName for this very todo
+WHERE storage_path ~ ('(^|/)' || user_id::text || '/' || todo_id::text || '/[0-9a-f-]{36}(\.[^/]*)?$');
+
+ALTER TABLE todos DROP COLUMN IF EXISTS attachment_url;
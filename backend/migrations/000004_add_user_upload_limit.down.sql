@@ -0,0 +1,3 @@
+-- backend/migrations/000004_add_user_upload_limit.down.sql
+ALTER TABLE users
+DROP COLUMN IF EXISTS max_upload_size;
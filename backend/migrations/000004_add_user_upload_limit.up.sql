@@ -0,0 +1,6 @@
+-- backend/migrations/000004_add_user_upload_limit.up.sql
+-- Per-user override of storage.maxUploadSize, NULL means use the deployment default
+ALTER TABLE users
+ADD COLUMN max_upload_size BIGINT NULL;
+
+COMMENT ON COLUMN users.max_upload_size IS 'Maximum size in bytes of a single attachment upload; NULL falls back to storage.maxUploadSize';
@@ -0,0 +1,4 @@
+-- backend/migrations/000005_add_attachment_thumbnails.down.sql
+ALTER TABLE attachments
+DROP COLUMN IF EXISTS thumbnail_small_path,
+DROP COLUMN IF EXISTS thumbnail_large_path;
@@ -0,0 +1,5 @@
+-- backend/migrations/000005_add_attachment_thumbnails.up.sql
+-- Storage IDs of the resized previews generated for image attachments
+ALTER TABLE attachments
+ADD COLUMN thumbnail_small_path VARCHAR(512) NULL, -- 64px on the longest side
+ADD COLUMN thumbnail_large_path VARCHAR(512) NULL; -- 256px on the longest side
@@ -0,0 +1,2 @@
+-- backend/migrations/000006_add_attachment_uploads.down.sql
+DROP TABLE IF EXISTS attachment_uploads;
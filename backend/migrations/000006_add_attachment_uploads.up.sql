@@ -0,0 +1,15 @@
+-- backend/migrations/000006_add_attachment_uploads.up.sql
+-- Resumable (tus) uploads in progress. The received bytes are staged on the server's disk;
+-- the row is removed once the upload is committed as an attachment.
+CREATE TABLE attachment_uploads (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    todo_id UUID NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+    upload_length BIGINT NOT NULL, -- Total size announced by the client
+    upload_offset BIGINT NOT NULL DEFAULT 0, -- Bytes received so far
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL -- Pushed back on every chunk
+);
+
+CREATE INDEX idx_attachment_uploads_expires_at ON attachment_uploads(expires_at);
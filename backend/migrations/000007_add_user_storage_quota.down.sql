@@ -0,0 +1,3 @@
+-- backend/migrations/000007_add_user_storage_quota.down.sql
+ALTER TABLE users
+DROP COLUMN IF EXISTS storage_quota;
@@ -0,0 +1,6 @@
+-- backend/migrations/000007_add_user_storage_quota.up.sql
+-- Per-user override of storage.userQuota, NULL means use the deployment default
+ALTER TABLE users
+ADD COLUMN storage_quota BIGINT NULL;
+
+COMMENT ON COLUMN users.storage_quota IS 'Total attachment bytes the user may store; 0 is unlimited, NULL falls back to storage.userQuota';
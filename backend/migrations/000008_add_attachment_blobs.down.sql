@@ -0,0 +1,10 @@
+-- backend/migrations/000008_add_attachment_blobs.down.sql
+-- Attachments that shared a blob keep pointing at the same files afterwards
+DROP TRIGGER IF EXISTS attachment_blob_refs ON attachments;
+DROP FUNCTION IF EXISTS trigger_attachment_blob_refs();
+
+ALTER TABLE attachments
+DROP CONSTRAINT IF EXISTS fk_attachments_blob,
+DROP COLUMN IF EXISTS content_hash;
+
+DROP TABLE IF EXISTS attachment_blobs;
@@ -0,0 +1,44 @@
+-- backend/migrations/000008_add_attachment_blobs.up.sql
+-- Each distinct file is stored once. Attachments with the same content share a blob,
+-- across users, so a team attaching the same file stores it once; each user is still
+-- charged for every distinct blob they reference. The blob's files are removed when
+-- the last attachment to it is deleted.
+CREATE TABLE attachment_blobs (
+    content_hash VARCHAR(64) PRIMARY KEY, -- Hex SHA-256 of the file
+    storage_path VARCHAR(512) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    thumbnail_small_path VARCHAR(512) NULL,
+    thumbnail_large_path VARCHAR(512) NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0 CHECK (ref_count >= 0), -- Maintained by trigger_attachment_blob_refs
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_attachment_blobs_unreferenced ON attachment_blobs(ref_count) WHERE ref_count = 0;
+
+-- NULL for attachments uploaded before deduplication; those own their files outright
+ALTER TABLE attachments
+ADD COLUMN content_hash VARCHAR(64) NULL,
+ADD CONSTRAINT fk_attachments_blob FOREIGN KEY (content_hash) REFERENCES attachment_blobs(content_hash);
+CREATE INDEX idx_attachments_content_hash ON attachments(content_hash);
+
+-- Keeps ref_count in step with the attachments pointing at a blob, including rows
+-- removed by ON DELETE CASCADE when a todo or user is deleted. Blobs outlive the user
+-- who uploaded them first; the reconciler releases them once ref_count reaches zero.
+CREATE OR REPLACE FUNCTION trigger_attachment_blob_refs()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' AND NEW.content_hash IS NOT NULL THEN
+    UPDATE attachment_blobs SET ref_count = ref_count + 1
+    WHERE content_hash = NEW.content_hash;
+  ELSIF TG_OP = 'DELETE' AND OLD.content_hash IS NOT NULL THEN
+    UPDATE attachment_blobs SET ref_count = ref_count - 1
+    WHERE content_hash = OLD.content_hash;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER attachment_blob_refs
+AFTER INSERT OR DELETE ON attachments
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_attachment_blob_refs();
@@ -0,0 +1,4 @@
+-- backend/migrations/000009_add_attachment_scan_status.down.sql
+ALTER TABLE attachments
+DROP COLUMN IF EXISTS scan_status,
+DROP COLUMN IF EXISTS scanned_at;
@@ -0,0 +1,7 @@
+-- backend/migrations/000009_add_attachment_scan_status.up.sql
+-- Malware scan verdict recorded when the attachment was uploaded. Infected files are
+-- rejected, so only 'clean', 'not_scanned' (no scanner configured) and 'scan_failed'
+-- (scanner unreachable with storage.scanner.failOpen) are ever stored.
+ALTER TABLE attachments
+ADD COLUMN scan_status VARCHAR(20) NOT NULL DEFAULT 'not_scanned',
+ADD COLUMN scanned_at TIMESTAMPTZ NULL;
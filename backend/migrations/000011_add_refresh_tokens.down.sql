@@ -0,0 +1,2 @@
+-- backend/migrations/000011_add_refresh_tokens.down.sql
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,17 @@
+-- backend/migrations/000011_add_refresh_tokens.up.sql
+-- Opaque refresh tokens, exchanged at /auth/refresh for a new access token and a
+-- new refresh token. Every token rotated out of one login shares a family_id, so
+-- presenting an already rotated token revokes the whole family.
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id UUID NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- Hex SHA-256; the token itself is never stored
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL, -- Inherited from the family's first token, rotation doesn't extend it
+    rotated_at TIMESTAMPTZ NULL, -- Set once exchanged for a successor
+    revoked_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
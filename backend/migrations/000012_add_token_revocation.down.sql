@@ -0,0 +1,5 @@
+-- backend/migrations/000012_add_token_revocation.down.sql
+DROP TABLE IF EXISTS revoked_tokens;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS token_version;
@@ -0,0 +1,16 @@
+-- backend/migrations/000012_add_token_revocation.up.sql
+-- Access tokens carry the user's token_version; bumping it invalidates every token
+-- issued before, which is how "log out everywhere" works.
+ALTER TABLE users
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+-- Access tokens revoked one at a time (logout), by their jti claim. Rows are only
+-- needed until the token would have expired anyway.
+CREATE TABLE revoked_tokens (
+    jti UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL, -- The token's exp claim
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
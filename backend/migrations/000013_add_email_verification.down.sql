@@ -0,0 +1,3 @@
+-- backend/migrations/000013_add_email_verification.down.sql
+ALTER TABLE users
+DROP COLUMN IF EXISTS verification_sent_at;
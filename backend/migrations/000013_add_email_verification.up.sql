@@ -0,0 +1,4 @@
+-- backend/migrations/000013_add_email_verification.up.sql
+-- When the last verification email went out, so resends can be throttled across replicas
+ALTER TABLE users
+ADD COLUMN verification_sent_at TIMESTAMPTZ NULL;
@@ -0,0 +1,2 @@
+-- backend/migrations/000014_add_password_reset_tokens.down.sql
+DROP TABLE IF EXISTS password_reset_tokens;
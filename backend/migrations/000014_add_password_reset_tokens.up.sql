@@ -0,0 +1,14 @@
+-- backend/migrations/000014_add_password_reset_tokens.up.sql
+-- Single-use password reset tokens. Only the SHA-256 of the token is stored, so a
+-- leaked table can't be used to take over accounts.
+CREATE TABLE password_reset_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- Hex SHA-256
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL -- Set when redeemed, or when another token of the user is
+);
+
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+CREATE INDEX idx_password_reset_tokens_expires_at ON password_reset_tokens(expires_at);
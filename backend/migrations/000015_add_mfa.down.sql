@@ -0,0 +1,3 @@
+-- backend/migrations/000015_add_mfa.down.sql
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
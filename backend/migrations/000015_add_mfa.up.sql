@@ -0,0 +1,24 @@
+-- backend/migrations/000015_add_mfa.up.sql
+-- TOTP authenticator apps (RFC 6238) as a second login factor. A row without
+-- confirmed_at is an enrollment the user hasn't proven with a code yet.
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL, -- Base32, as shown to the user
+    confirmed_at TIMESTAMPTZ NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0, -- A code is accepted once; older steps are replays
+    failed_attempts INT NOT NULL DEFAULT 0, -- Wrong codes since the last good one
+    lockouts INT NOT NULL DEFAULT 0, -- Times failed_attempts reached mfa.maxAttempts since the last good code; each doubles the lockout
+    locked_until TIMESTAMPTZ NULL, -- No code is checked before this
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Single-use codes for when the authenticator is lost
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(255) NOT NULL, -- bcrypt; the codes are short enough to brute force a plain hash
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
@@ -0,0 +1,2 @@
+-- backend/migrations/000016_add_webauthn_credentials.down.sql
+DROP TABLE IF EXISTS webauthn_credentials;
@@ -0,0 +1,8 @@
+-- backend/migrations/000017_add_user_identities.down.sql
+ALTER TABLE users ADD COLUMN google_id VARCHAR(255) UNIQUE NULL;
+
+UPDATE users SET google_id = i.subject
+FROM user_identities i
+WHERE i.user_id = users.id AND i.provider = 'google';
+
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,19 @@
+-- backend/migrations/000017_add_user_identities.up.sql
+-- Accounts at external OpenID Connect / OAuth2 providers that log in as a user.
+-- Replaces users.google_id, which could only hold one provider.
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL, -- Key under oauth.providers, e.g. google
+    subject VARCHAR(255) NOT NULL, -- The provider's stable ID for the account (the sub claim)
+    email VARCHAR(255) NULL, -- As the provider reported it at the last login
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ NULL,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider) -- One account per provider and user
+);
+
+INSERT INTO user_identities (user_id, provider, subject, email)
+SELECT id, 'google', google_id, email FROM users WHERE google_id IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN google_id;
@@ -0,0 +1,2 @@
+-- backend/migrations/000018_add_api_tokens.down.sql
+DROP TABLE IF EXISTS api_tokens;
@@ -0,0 +1,15 @@
+-- backend/migrations/000018_add_api_tokens.up.sql
+-- Personal access tokens for scripts and integrations. They're sent as bearer tokens
+-- like JWTs, but are long-lived, named, limited to their scopes and revocable one by one.
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- Hex SHA-256; the token itself is only shown once
+    scopes TEXT[] NOT NULL, -- e.g. todos:read, tags:write
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NULL, -- NULL never expires
+    last_used_at TIMESTAMPTZ NULL -- Updated at most once a minute
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
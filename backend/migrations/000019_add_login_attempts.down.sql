@@ -0,0 +1,2 @@
+-- backend/migrations/000019_add_login_attempts.down.sql
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,11 @@
+-- backend/migrations/000019_add_login_attempts.up.sql
+-- Failed password logins per account and per client address, for backoff and lockout.
+-- Only used with loginThrottle.store = postgres, so every replica sees the same counts.
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY, -- account:<email> or ip:<address>
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMPTZ NOT NULL,
+    previous_failed_at TIMESTAMPTZ NULL -- The failure before last_failed_at in the same run, to check it's allowed
+);
+
+CREATE INDEX idx_login_attempts_last_failed_at ON login_attempts(last_failed_at);